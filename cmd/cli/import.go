@@ -0,0 +1,203 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"educational-game-db/internal/export"
+	"educational-game-db/internal/models"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	importFormat      string
+	importMode        string
+	importDryRun      bool
+	importMatch       string
+	importStrategy    string
+	importDeactivate  bool
+	importMapping     string
+	importPreview     bool
+	importPreviewRows int
+)
+
+// newImportCmd returns the command importing accounts from CSV or JSON files
+func newImportCmd() *cobra.Command {
+	var importCmd = &cobra.Command{
+		Use:   "import [file]",
+		Short: "Import accounts from a CSV or JSON export",
+		Long: "Import accounts from a file in the layout export writes. Every row is checked\n" +
+			"first and each problem is reported with its line number. In all_or_nothing\n" +
+			"mode any bad row stops the whole import; in best_effort mode the good rows\n" +
+			"are imported anyway. --dry-run reports what would happen without saving.\n\n" +
+			"With --match, rows that match an existing account update it as --strategy\n" +
+			"says, so a roster can be re-imported: skip leaves it alone, overwrite copies\n" +
+			"every field and merge only the fields the row fills in. --deactivate-missing\n" +
+			"also deactivates the students of the imported schools no row matches.",
+		Args: cobra.ExactArgs(1),
+		Run:  importAccounts,
+	}
+	importCmd.Flags().StringVar(&importFormat, "format", "", "Import format: csv or json (default from the file extension)")
+	importCmd.Flags().StringVar(&importMode, "mode", models.ImportAllOrNothing, "Import mode: all_or_nothing or best_effort")
+	importCmd.Flags().BoolVar(&importDryRun, "dry-run", false, "Check and report the import without saving anything")
+	importCmd.Flags().StringVar(&importMatch, "match", "", "Match rows to existing accounts by username, email or external_id")
+	importCmd.Flags().StringVar(&importStrategy, "strategy", models.ConflictSkip, "What a matching row does: skip, overwrite or merge")
+	importCmd.Flags().BoolVar(&importDeactivate, "deactivate-missing", false, "Deactivate the students of the imported schools that no row matches (needs --match)")
+	importCmd.Flags().StringVar(&importMapping, "mapping", "", "Saved mapping of the CSV file's columns to fields (see mapping save)")
+	importCmd.Flags().BoolVar(&importPreview, "preview", false, "Show how the first rows of a CSV file would be read, without importing")
+	importCmd.Flags().IntVar(&importPreviewRows, "preview-rows", 5, "How many rows --preview shows")
+
+	return importCmd
+}
+
+func importAccounts(cmd *cobra.Command, args []string) {
+	format := importFormat
+	if format == "" {
+		format = strings.TrimPrefix(strings.ToLower(filepath.Ext(args[0])), ".")
+	}
+
+	service := export.NewExportService(db)
+	var importFile func(io.Reader, models.ImportOptions) (*models.ImportReport, error)
+	switch format {
+	case "csv":
+		importFile = service.ImportCSV
+	case "json":
+		importFile = service.ImportJSON
+	default:
+		fmt.Println("Error: --format must be csv or json")
+		return
+	}
+	if !models.IsValidImportMode(importMode) {
+		fmt.Printf("Error: --mode must be %s or %s\n", models.ImportAllOrNothing, models.ImportBestEffort)
+		return
+	}
+	if importMatch != "" && !models.IsValidMatchKey(importMatch) {
+		fmt.Printf("Error: --match must be %s, %s or %s\n", models.MatchUsername, models.MatchEmail, models.MatchExternalID)
+		return
+	}
+	if !models.IsValidConflictStrategy(importStrategy) {
+		fmt.Printf("Error: --strategy must be %s, %s or %s\n", models.ConflictSkip, models.ConflictOverwrite, models.ConflictMerge)
+		return
+	}
+	if importDeactivate && importMatch == "" {
+		fmt.Println("Error: --deactivate-missing needs --match")
+		return
+	}
+	if (importMapping != "" || importPreview) && format != "csv" {
+		fmt.Println("Error: --mapping and --preview only apply to CSV files")
+		return
+	}
+
+	var mapping *models.ImportMapping
+	if importMapping != "" {
+		var err error
+		if mapping, err = db.GetImportMapping(importMapping); err != nil {
+			fmt.Printf("Error getting import mapping %s: %v\n", importMapping, err)
+			return
+		}
+	}
+
+	file, err := os.Open(args[0])
+	if err != nil {
+		fmt.Printf("Error opening import file: %v\n", err)
+		return
+	}
+	defer file.Close()
+
+	if importPreview {
+		previewImport(file, mapping)
+		return
+	}
+
+	opts := models.ImportOptions{
+		Mode:              importMode,
+		DryRun:            importDryRun,
+		MatchKey:          importMatch,
+		Strategy:          importStrategy,
+		DeactivateMissing: importDeactivate,
+		Mapping:           mapping,
+	}
+	report, err := importFile(bufio.NewReader(file), opts)
+	if err != nil {
+		fmt.Printf("Error importing accounts: %v\n", err)
+		return
+	}
+
+	counts := fmt.Sprintf("%d created, %d updated, %d unchanged, %d deactivated, %d skipped",
+		report.Created, report.Updated, report.Unchanged, report.Deactivated, report.Skipped)
+	switch {
+	case report.DryRun:
+		fmt.Printf("Dry run of %d rows: %s; nothing was saved.\n", report.Rows, counts)
+	case report.Committed:
+		fmt.Printf("Imported %d rows: %s.\n", report.Rows, counts)
+	default:
+		fmt.Printf("Nothing was imported from %d rows.\n", report.Rows)
+	}
+	for _, change := range report.Changes {
+		switch {
+		case change.Action == models.ImportCreated:
+			continue
+		case change.Line > 0:
+			fmt.Printf("  Line %d: %s %s\n", change.Line, change.Action, change.Username)
+		default:
+			fmt.Printf("  %s %s\n", change.Action, change.Username)
+		}
+		for _, field := range change.Fields {
+			fmt.Printf("    %s: %#v -> %#v\n", field.Field, field.Old, field.New)
+		}
+	}
+	for _, rowErr := range report.Errors {
+		if rowErr.Field != "" {
+			fmt.Printf("  Line %d: %s: %s\n", rowErr.Line, rowErr.Field, rowErr.Message)
+		} else {
+			fmt.Printf("  Line %d: %s\n", rowErr.Line, rowErr.Message)
+		}
+	}
+}
+
+// previewImport prints the columns a CSV import reads each field from and
+// the first rows as they would be imported
+func previewImport(r io.Reader, mapping *models.ImportMapping) {
+	preview, err := export.PreviewCSV(r, mapping, importPreviewRows)
+	if err != nil {
+		fmt.Printf("Error reading CSV file: %v\n", err)
+		return
+	}
+
+	fmt.Println("Columns:")
+	for _, field := range models.ImportFields {
+		if header, ok := preview.Columns[field]; ok {
+			fmt.Printf("  %-12s <- %s\n", field, header)
+		}
+	}
+	if len(preview.Ignored) > 0 {
+		fmt.Printf("Ignored columns: %s\n", strings.Join(preview.Ignored, ", "))
+	}
+
+	for _, row := range preview.Rows {
+		fmt.Printf("\nLine %d:\n", row.Line)
+		// A row that could not be read at all has no values to show
+		readable := true
+		for _, rowErr := range row.Errors {
+			if rowErr.Field != "" {
+				fmt.Printf("  Error: %s: %s\n", rowErr.Field, rowErr.Message)
+			} else {
+				fmt.Printf("  Error: %s\n", rowErr.Message)
+				readable = false
+			}
+		}
+		for _, field := range models.ImportFields {
+			if _, ok := preview.Columns[field]; ok && readable {
+				fmt.Printf("  %-12s %q\n", field, row.Value(field))
+			}
+		}
+	}
+	if len(preview.Rows) == 0 {
+		fmt.Println("\nThe file has no rows.")
+	}
+}
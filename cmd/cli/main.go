@@ -2,23 +2,112 @@ package main
 
 import (
 	"bufio"
+	"errors"
 	"fmt"
+	"io"
 	"log"
 	"os"
 	"strconv"
 	"strings"
+	"time"
 
+	"educational-game-db/internal/achievements"
+	"educational-game-db/internal/auth"
 	"educational-game-db/internal/database"
+	"educational-game-db/internal/export"
 	"educational-game-db/internal/models"
+	"educational-game-db/internal/notify"
+	"educational-game-db/internal/progression"
 	"educational-game-db/internal/server"
 
 	"github.com/spf13/cobra"
 )
 
 var (
-	dbPath string
-	port   string
-	db     *database.Database
+	dbPath           string
+	port             string
+	jwtSecret        string
+	apiKeyName       string
+	apiKeyOwner      string
+	apiKeyScopes     string
+	apiKeyExpiresIn  time.Duration
+	accessTokenTTL   time.Duration
+	refreshTokenTTL  time.Duration
+	resetTokenTTL    time.Duration
+	resetURL         string
+	smtpAddr         string
+	smtpFrom         string
+	smtpUsername     string
+	smtpPassword     string
+	lockThreshold    int
+	lockDuration     time.Duration
+	twoFactorRoles   string
+	oidcIssuer       string
+	oidcClientID     string
+	oidcSecret       string
+	oidcRedirectURL  string
+	ssoGrade         int
+	ssoSchool        string
+	deletedRetention time.Duration
+	db               database.Store
+
+	passwordCost      int
+	passwordMinLength int
+	passwordBlocklist string
+	passwords         *auth.PasswordPolicy
+
+	listSchool        string
+	listRole          string
+	listGrade         int
+	listActive        string
+	listMinLevel      int
+	listMaxLevel      int
+	listCreatedAfter  string
+	listCreatedBefore string
+	listSort          string
+	listOrder         string
+	listLimit         int
+	listCursor        string
+	listSchoolID      int
+	listClassroomID   int
+	listDeleted       bool
+	searchLimit       int
+	purgeRetention    time.Duration
+	exportFormat      string
+	exportOutput      string
+	exportSchool      string
+	exportSchoolID    int
+	exportClassroomID int
+
+	statsSchoolID    int
+	statsClassroomID int
+	classroomGrade   int
+	enrollRole       string
+	consentMethod    string
+	consentPolicy    string
+
+	levelBaseXP  int
+	levelGrowth  float64
+	levelMax     int
+	xpSource     string
+	xpReason     string
+	xpHistoryMax int
+
+	badgesPath string
+	badgeNote  string
+
+	boardMetric string
+	boardScope  string
+	boardWindow string
+	boardSchool string
+	boardGrade  int
+	boardLimit  int
+
+	lockoutAll     bool
+	authLogUser    string
+	authLogIP      string
+	authLogOutcome string
+	authLogLimit   int
 )
 
 func main() {
@@ -28,10 +117,22 @@ func main() {
 		Long:  "A command-line interface for managing student accounts in the educational game database.",
 		PersistentPreRun: func(cmd *cobra.Command, args []string) {
 			var err error
-			db, err = database.NewDatabase(dbPath)
+			db, err = database.Open(dbPath)
 			if err != nil {
 				log.Fatalf("Failed to connect to database: %v", err)
 			}
+
+			curve := progression.Curve{BaseXP: levelBaseXP, Growth: levelGrowth, MaxLevel: levelMax}
+			if err := db.SetLevelCurve(curve); err != nil {
+				log.Fatalf("Invalid level curve: %v", err)
+			}
+
+			if err := db.SetPasswordCost(passwordCost); err != nil {
+				log.Fatalf("Invalid --bcrypt-cost: %v", err)
+			}
+			if passwords, err = loadPasswordPolicy(); err != nil {
+				log.Fatalf("Invalid password policy: %v", err)
+			}
 		},
 		PersistentPostRun: func(cmd *cobra.Command, args []string) {
 			if db != nil {
@@ -40,7 +141,14 @@ func main() {
 		},
 	}
 
-	rootCmd.PersistentFlags().StringVar(&dbPath, "db", "accounts.db", "Database file path")
+	rootCmd.PersistentFlags().StringVar(&dbPath, "db", "accounts.db", "SQLite file path or postgres:// connection URL")
+	rootCmd.PersistentFlags().IntVar(&levelBaseXP, "level-base-xp", progression.DefaultCurve.BaseXP, "Experience needed to go from level 1 to 2")
+	rootCmd.PersistentFlags().Float64Var(&levelGrowth, "level-growth", progression.DefaultCurve.Growth, "Factor by which each further level costs more experience")
+	rootCmd.PersistentFlags().StringVar(&badgesPath, "badges", "", "YAML or JSON badge catalog (defaults to the built-in badges)")
+	rootCmd.PersistentFlags().IntVar(&levelMax, "level-max", progression.DefaultCurve.MaxLevel, "Highest reachable game level (0 for no limit)")
+	rootCmd.PersistentFlags().IntVar(&passwordCost, "bcrypt-cost", 12, "bcrypt cost for new password hashes; older hashes are upgraded at login")
+	rootCmd.PersistentFlags().IntVar(&passwordMinLength, "password-min-length", auth.DefaultPasswordMinLength, "Shortest password accepted, except from students in young grades")
+	rootCmd.PersistentFlags().StringVar(&passwordBlocklist, "password-blocklist", "", "File of extra passwords to refuse, one per line")
 
 	// Create account command
 	var createCmd = &cobra.Command{
@@ -52,9 +160,33 @@ func main() {
 	// List accounts command
 	var listCmd = &cobra.Command{
 		Use:   "list",
-		Short: "List all student accounts",
+		Short: "List student accounts, filtered, sorted and paginated",
 		Run:   listAccounts,
 	}
+	listCmd.Flags().StringVar(&listSchool, "school", "", "Only list accounts of this school")
+	listCmd.Flags().StringVar(&listRole, "role", "", "Only list accounts with this role")
+	listCmd.Flags().IntVar(&listGrade, "grade", -1, "Only list accounts in this grade")
+	listCmd.Flags().StringVar(&listActive, "active", "", "Only list active (true) or inactive (false) accounts")
+	listCmd.Flags().IntVar(&listMinLevel, "min-level", -1, "Only list accounts at or above this game level")
+	listCmd.Flags().IntVar(&listMaxLevel, "max-level", -1, "Only list accounts at or below this game level")
+	listCmd.Flags().StringVar(&listCreatedAfter, "created-after", "", "Only list accounts created on or after this date (YYYY-MM-DD)")
+	listCmd.Flags().StringVar(&listCreatedBefore, "created-before", "", "Only list accounts created before this date (YYYY-MM-DD)")
+	listCmd.Flags().StringVar(&listSort, "sort", "created_at", "Sort by "+strings.Join(models.AccountSortKeys, ", "))
+	listCmd.Flags().StringVar(&listOrder, "order", "", "Sort order, asc or desc (newest first by default)")
+	listCmd.Flags().IntVar(&listLimit, "limit", models.DefaultPageSize, "Accounts per page")
+	listCmd.Flags().StringVar(&listCursor, "cursor", "", "Cursor printed by the previous page")
+	listCmd.Flags().IntVar(&listSchoolID, "school-id", 0, "Only list accounts of the school with this ID")
+	listCmd.Flags().IntVar(&listClassroomID, "classroom-id", 0, "Only list accounts enrolled in the classroom with this ID")
+	listCmd.Flags().BoolVar(&listDeleted, "deleted", false, "List deleted accounts that can still be restored")
+
+	// Search accounts command
+	var searchCmd = &cobra.Command{
+		Use:   "search [query...]",
+		Short: "Search accounts by username, email, name or school",
+		Args:  cobra.MinimumNArgs(1),
+		Run:   searchAccounts,
+	}
+	searchCmd.Flags().IntVar(&searchLimit, "limit", 20, "Maximum number of results")
 
 	// Get account command
 	var getCmd = &cobra.Command{
@@ -75,17 +207,426 @@ func main() {
 	// Delete account command
 	var deleteCmd = &cobra.Command{
 		Use:   "delete [id]",
-		Short: "Delete account by ID",
+		Short: "Delete account by ID (it can be restored until purged)",
 		Args:  cobra.ExactArgs(1),
 		Run:   deleteAccount,
 	}
 
+	// Restore account command
+	var restoreCmd = &cobra.Command{
+		Use:   "restore [id]",
+		Short: "Restore a deleted account by ID",
+		Args:  cobra.ExactArgs(1),
+		Run:   restoreAccount,
+	}
+
+	// Purge command
+	var purgeCmd = &cobra.Command{
+		Use:   "purge",
+		Short: "Permanently remove accounts deleted longer ago than the retention period",
+		Run:   purgeAccounts,
+	}
+	purgeCmd.Flags().DurationVar(&purgeRetention, "retention", server.DefaultDeletedRetention, "How long deleted accounts are kept (0 purges every deleted account)")
+
+	// Export command
+	var exportCmd = &cobra.Command{
+		Use:   "export",
+		Short: "Export accounts as CSV or JSON to a file or stdout",
+		Long: "Export accounts as CSV or JSON. Accounts are written as they are read, so\n" +
+			"exports of any size can be piped, e.g. export --format json | gzip > accounts.json.gz",
+		Run: exportAccounts,
+	}
+	exportCmd.Flags().StringVar(&exportFormat, "format", "csv", "Export format: csv or json")
+	exportCmd.Flags().StringVarP(&exportOutput, "output", "o", "-", "File to write, or - for stdout")
+	exportCmd.Flags().StringVar(&exportSchool, "school", "", "Only export accounts of this school")
+	exportCmd.Flags().IntVar(&exportSchoolID, "school-id", 0, "Only export accounts of the school with this ID")
+	exportCmd.Flags().IntVar(&exportClassroomID, "classroom-id", 0, "Only export accounts enrolled in the classroom with this ID")
+
 	// Stats command
 	var statsCmd = &cobra.Command{
 		Use:   "stats",
 		Short: "Show account statistics",
 		Run:   showStats,
 	}
+	statsCmd.Flags().IntVar(&statsSchoolID, "school-id", 0, "Only count accounts of the school with this ID")
+	statsCmd.Flags().IntVar(&statsClassroomID, "classroom-id", 0, "Only count accounts enrolled in the classroom with this ID")
+
+	// School and classroom commands
+	var schoolCmd = &cobra.Command{
+		Use:   "school",
+		Short: "Manage schools",
+	}
+
+	var schoolListCmd = &cobra.Command{
+		Use:   "list",
+		Short: "List schools",
+		Run:   listSchools,
+	}
+
+	var schoolCreateCmd = &cobra.Command{
+		Use:   "create [name]",
+		Short: "Add a school",
+		Args:  cobra.ExactArgs(1),
+		Run:   createSchool,
+	}
+
+	var schoolRenameCmd = &cobra.Command{
+		Use:   "rename [id] [name]",
+		Short: "Rename a school and the school shown on its accounts",
+		Args:  cobra.ExactArgs(2),
+		Run:   renameSchool,
+	}
+
+	var schoolDeleteCmd = &cobra.Command{
+		Use:   "delete [id]",
+		Short: "Delete a school and its classrooms, keeping its accounts",
+		Args:  cobra.ExactArgs(1),
+		Run:   deleteSchool,
+	}
+
+	var schoolMergeCmd = &cobra.Command{
+		Use:   "merge [from-id] [into-id]",
+		Short: "Move the accounts and classrooms of a duplicate school into another",
+		Args:  cobra.ExactArgs(2),
+		Run:   mergeSchools,
+	}
+
+	schoolCmd.AddCommand(schoolListCmd, schoolCreateCmd, schoolRenameCmd, schoolDeleteCmd, schoolMergeCmd)
+
+	var classroomCmd = &cobra.Command{
+		Use:   "classroom",
+		Short: "Manage classrooms and enrollments",
+	}
+
+	var classroomListCmd = &cobra.Command{
+		Use:   "list [school-id]",
+		Short: "List the classrooms of a school",
+		Args:  cobra.ExactArgs(1),
+		Run:   listClassrooms,
+	}
+
+	var classroomCreateCmd = &cobra.Command{
+		Use:   "create [school-id] [name]",
+		Short: "Add a classroom to a school",
+		Args:  cobra.ExactArgs(2),
+		Run:   createClassroom,
+	}
+	classroomCreateCmd.Flags().IntVar(&classroomGrade, "grade", 0, "Grade taught in the classroom")
+
+	var classroomUpdateCmd = &cobra.Command{
+		Use:   "update [id] [name]",
+		Short: "Rename a classroom or change its grade",
+		Args:  cobra.ExactArgs(2),
+		Run:   updateClassroom,
+	}
+	classroomUpdateCmd.Flags().IntVar(&classroomGrade, "grade", 0, "Grade taught in the classroom")
+
+	var classroomDeleteCmd = &cobra.Command{
+		Use:   "delete [id]",
+		Short: "Delete a classroom and its enrollments",
+		Args:  cobra.ExactArgs(1),
+		Run:   deleteClassroom,
+	}
+
+	var classroomMembersCmd = &cobra.Command{
+		Use:   "members [id]",
+		Short: "List the teachers and students of a classroom",
+		Args:  cobra.ExactArgs(1),
+		Run:   classroomMembers,
+	}
+
+	var classroomEnrollCmd = &cobra.Command{
+		Use:   "enroll [id] [account-id]",
+		Short: "Enroll an account in a classroom",
+		Args:  cobra.ExactArgs(2),
+		Run:   enrollAccount,
+	}
+	classroomEnrollCmd.Flags().StringVar(&enrollRole, "role", models.EnrollmentStudent, "Enroll as student or teacher")
+
+	var classroomUnenrollCmd = &cobra.Command{
+		Use:   "unenroll [id] [account-id]",
+		Short: "Remove an account from a classroom",
+		Args:  cobra.ExactArgs(2),
+		Run:   unenrollAccount,
+	}
+
+	var classroomAddStudentsCmd = &cobra.Command{
+		Use:   "add-students [id] [username...]",
+		Short: "Enroll students of the classroom's school by username",
+		Args:  cobra.MinimumNArgs(2),
+		Run:   addStudents,
+	}
+
+	classroomCmd.AddCommand(classroomListCmd, classroomCreateCmd, classroomUpdateCmd, classroomDeleteCmd,
+		classroomMembersCmd, classroomEnrollCmd, classroomUnenrollCmd, classroomAddStudentsCmd)
+
+	// Guardian commands
+	var guardianCmd = &cobra.Command{
+		Use:   "guardian",
+		Short: "Link guardians to students and record their consent",
+	}
+
+	var guardianListCmd = &cobra.Command{
+		Use:   "list [student-id]",
+		Short: "List a student's guardians and the consent they gave",
+		Args:  cobra.ExactArgs(1),
+		Run:   listGuardians,
+	}
+
+	var guardianLinkCmd = &cobra.Command{
+		Use:   "link [student-id] [guardian-id]",
+		Short: "Record a guardian's consent collected outside the app",
+		Args:  cobra.ExactArgs(2),
+		Run:   linkGuardian,
+	}
+	guardianLinkCmd.Flags().StringVar(&consentMethod, "method", models.ConsentMethodSignedForm, "How consent was given: online, signed_form, email or phone")
+	guardianLinkCmd.Flags().StringVar(&consentPolicy, "policy-version", "", "Version of the privacy policy the guardian accepted")
+	guardianLinkCmd.MarkFlagRequired("policy-version")
+
+	guardianCmd.AddCommand(guardianListCmd, guardianLinkCmd)
+
+	// Role management commands
+	var roleCmd = &cobra.Command{
+		Use:   "role",
+		Short: "Grant or revoke account roles",
+	}
+
+	var roleGrantCmd = &cobra.Command{
+		Use:   "grant [id] [role]",
+		Short: "Grant a role (" + strings.Join(models.Roles, ", ") + ") to an account",
+		Args:  cobra.ExactArgs(2),
+		Run:   grantRole,
+	}
+
+	var roleRevokeCmd = &cobra.Command{
+		Use:   "revoke [id]",
+		Short: "Revoke an account's role, making it a student again",
+		Args:  cobra.ExactArgs(1),
+		Run:   revokeRole,
+	}
+
+	roleCmd.AddCommand(roleGrantCmd, roleRevokeCmd)
+
+	var resetPasswordCmd = &cobra.Command{
+		Use:   "reset-password [id]",
+		Short: "Give an account a temporary password it must change at next login",
+		Args:  cobra.ExactArgs(1),
+		Run:   resetPassword,
+	}
+
+	// Experience ledger commands
+	var xpCmd = &cobra.Command{
+		Use:   "xp",
+		Short: "Record and inspect experience",
+	}
+
+	var xpAddCmd = &cobra.Command{
+		Use:   "add [id] [amount]",
+		Short: "Add (or with a negative amount, remove) experience",
+		Args:  cobra.ExactArgs(2),
+		Run:   addXP,
+	}
+	xpAddCmd.Flags().StringVar(&xpSource, "source", models.XPSourceAdjustment, "Where the experience came from")
+	xpAddCmd.Flags().StringVar(&xpReason, "reason", "", "Why the experience was added")
+
+	var xpHistoryCmd = &cobra.Command{
+		Use:   "history [id]",
+		Short: "Show an account's experience ledger",
+		Args:  cobra.ExactArgs(1),
+		Run:   xpHistory,
+	}
+	xpHistoryCmd.Flags().IntVar(&xpHistoryMax, "limit", 20, "Number of entries to show")
+
+	var xpReplayCmd = &cobra.Command{
+		Use:   "replay",
+		Short: "Recompute every account's experience and level from the ledger",
+		Run:   replayXP,
+	}
+
+	xpCmd.AddCommand(xpAddCmd, xpHistoryCmd, xpReplayCmd)
+
+	// Achievement commands
+	var badgesCmd = &cobra.Command{
+		Use:   "badges",
+		Short: "List, award and check achievement badges",
+	}
+
+	var badgesListCmd = &cobra.Command{
+		Use:   "list",
+		Short: "List the badges that can be earned",
+		Run:   listBadges,
+	}
+
+	var badgesShowCmd = &cobra.Command{
+		Use:   "show [id]",
+		Short: "Show the badges an account has earned",
+		Args:  cobra.ExactArgs(1),
+		Run:   showBadges,
+	}
+
+	var badgesAwardCmd = &cobra.Command{
+		Use:   "award [id] [badge]",
+		Short: "Award a badge to an account by hand",
+		Args:  cobra.ExactArgs(2),
+		Run:   awardBadge,
+	}
+	badgesAwardCmd.Flags().StringVar(&badgeNote, "note", "", "Why the badge was awarded")
+
+	var badgesRevokeCmd = &cobra.Command{
+		Use:   "revoke [id] [badge]",
+		Short: "Take a badge away from an account",
+		Args:  cobra.ExactArgs(2),
+		Run:   revokeBadge,
+	}
+
+	var badgesCheckCmd = &cobra.Command{
+		Use:   "check",
+		Short: "Evaluate badge rules for every account, e.g. after adding badges",
+		Run:   checkBadges,
+	}
+
+	badgesCmd.AddCommand(badgesListCmd, badgesShowCmd, badgesAwardCmd, badgesRevokeCmd, badgesCheckCmd)
+
+	// Leaderboard commands
+	var leaderboardCmd = &cobra.Command{
+		Use:   "leaderboard",
+		Short: "Show a student leaderboard",
+		Run:   showLeaderboard,
+	}
+	leaderboardCmd.Flags().StringVar(&boardMetric, "metric", models.LeaderboardMetricExperience, "Rank by experience or level")
+	leaderboardCmd.Flags().StringVar(&boardScope, "scope", models.LeaderboardScopeGlobal, "global, school or grade")
+	leaderboardCmd.Flags().StringVar(&boardWindow, "window", models.LeaderboardWindowAllTime, "all_time, weekly or daily")
+	leaderboardCmd.Flags().StringVar(&boardSchool, "school", "", "School to rank for the school scope")
+	leaderboardCmd.Flags().IntVar(&boardGrade, "grade", 0, "Grade to rank for the grade scope")
+	leaderboardCmd.Flags().IntVar(&boardLimit, "limit", 10, "Number of places to show")
+
+	var leaderboardOptOutCmd = &cobra.Command{
+		Use:   "opt-out [id]",
+		Short: "Hide an account from leaderboards",
+		Args:  cobra.ExactArgs(1),
+		Run:   func(cmd *cobra.Command, args []string) { setLeaderboardOptOut(args[0], true) },
+	}
+
+	var leaderboardOptInCmd = &cobra.Command{
+		Use:   "opt-in [id]",
+		Short: "Show an account on leaderboards again",
+		Args:  cobra.ExactArgs(1),
+		Run:   func(cmd *cobra.Command, args []string) { setLeaderboardOptOut(args[0], false) },
+	}
+
+	leaderboardCmd.AddCommand(leaderboardOptOutCmd, leaderboardOptInCmd)
+
+	// API key management commands
+	var apiKeyCmd = &cobra.Command{
+		Use:   "apikey",
+		Short: "Manage API keys for game servers and integrations",
+	}
+
+	var apiKeyCreateCmd = &cobra.Command{
+		Use:   "create",
+		Short: "Create a new API key",
+		Run:   createAPIKey,
+	}
+	apiKeyCreateCmd.Flags().StringVar(&apiKeyName, "name", "", "Name describing what the key is used for")
+	apiKeyCreateCmd.Flags().StringVar(&apiKeyOwner, "owner", "", "Person or team responsible for the key")
+	apiKeyCreateCmd.Flags().StringVar(&apiKeyScopes, "scopes", "", "Comma separated scopes, e.g. accounts:read,accounts:write")
+	apiKeyCreateCmd.Flags().DurationVar(&apiKeyExpiresIn, "expires-in", 0, "Key lifetime, e.g. 2160h (0 means no expiry)")
+	apiKeyCreateCmd.MarkFlagRequired("name")
+	apiKeyCreateCmd.MarkFlagRequired("owner")
+	apiKeyCreateCmd.MarkFlagRequired("scopes")
+
+	var apiKeyListCmd = &cobra.Command{
+		Use:   "list",
+		Short: "List API keys",
+		Run:   listAPIKeys,
+	}
+
+	var apiKeyRevokeCmd = &cobra.Command{
+		Use:   "revoke [id]",
+		Short: "Revoke an API key",
+		Args:  cobra.ExactArgs(1),
+		Run:   revokeAPIKey,
+	}
+
+	apiKeyCmd.AddCommand(apiKeyCreateCmd, apiKeyListCmd, apiKeyRevokeCmd)
+
+	// Login lockout and auth log commands
+	var lockoutCmd = &cobra.Command{
+		Use:   "lockout",
+		Short: "View and clear login lockouts",
+	}
+
+	var lockoutListCmd = &cobra.Command{
+		Use:   "list",
+		Short: "List usernames and IPs locked out after failed logins",
+		Args:  cobra.NoArgs,
+		Run:   listLockouts,
+	}
+	lockoutListCmd.Flags().BoolVar(&lockoutAll, "all", false, "Include usernames and IPs with failures that are not locked out")
+
+	var lockoutClearCmd = &cobra.Command{
+		Use:   "clear [username|ip] [key]",
+		Short: "Lift the lockout of a username or IP",
+		Args:  cobra.ExactArgs(2),
+		Run:   clearLockout,
+	}
+
+	lockoutCmd.AddCommand(lockoutListCmd, lockoutClearCmd)
+
+	var authLogCmd = &cobra.Command{
+		Use:   "auth-log",
+		Short: "Show recent login attempts",
+		Args:  cobra.NoArgs,
+		Run:   showAuthLog,
+	}
+	authLogCmd.Flags().StringVar(&authLogUser, "username", "", "Only attempts for this username")
+	authLogCmd.Flags().StringVar(&authLogIP, "ip", "", "Only attempts from this IP")
+	authLogCmd.Flags().StringVar(&authLogOutcome, "outcome", "", "Only attempts with this outcome: success, failure, locked or denied")
+	authLogCmd.Flags().IntVar(&authLogLimit, "limit", models.DefaultAuthLogLimit, "Maximum number of attempts to show")
+
+	// Schema migration commands
+	var migrateCmd = &cobra.Command{
+		Use:   "migrate",
+		Short: "Manage database schema migrations",
+		// Open without auto-migrating so the schema can be moved in either direction
+		PersistentPreRun: func(cmd *cobra.Command, args []string) {
+			var err error
+			db, err = database.OpenWithoutMigrating(dbPath)
+			if err != nil {
+				log.Fatalf("Failed to connect to database: %v", err)
+			}
+		},
+	}
+
+	var migrateUpCmd = &cobra.Command{
+		Use:   "up",
+		Short: "Apply all pending migrations",
+		Args:  cobra.NoArgs,
+		Run:   migrateUp,
+	}
+
+	var migrateDownCmd = &cobra.Command{
+		Use:   "down [steps]",
+		Short: "Revert the last migration, or the given number of migrations",
+		Args:  cobra.MaximumNArgs(1),
+		Run:   migrateDown,
+	}
+
+	var migrateStatusCmd = &cobra.Command{
+		Use:   "status",
+		Short: "Show applied and pending migrations",
+		Args:  cobra.NoArgs,
+		Run:   migrateStatus,
+	}
+
+	var migrateToCmd = &cobra.Command{
+		Use:   "to [version]",
+		Short: "Migrate up or down to a specific schema version",
+		Args:  cobra.ExactArgs(1),
+		Run:   migrateTo,
+	}
+
+	migrateCmd.AddCommand(migrateUpCmd, migrateDownCmd, migrateStatusCmd, migrateToCmd)
 
 	// Web server command
 	var webCmd = &cobra.Command{
@@ -94,6 +635,25 @@ func main() {
 		Run:   startWebServer,
 	}
 	webCmd.Flags().StringVar(&port, "port", "8080", "Web server port")
+	webCmd.Flags().StringVar(&jwtSecret, "jwt-secret", os.Getenv("JWT_SECRET"), "Secret used to sign access tokens (defaults to $JWT_SECRET)")
+	webCmd.Flags().DurationVar(&accessTokenTTL, "access-token-ttl", auth.DefaultAccessTokenTTL, "Lifetime of access tokens")
+	webCmd.Flags().DurationVar(&refreshTokenTTL, "refresh-token-ttl", auth.DefaultRefreshTokenTTL, "Lifetime of refresh tokens")
+	webCmd.Flags().DurationVar(&resetTokenTTL, "reset-token-ttl", auth.DefaultResetTokenTTL, "Lifetime of password reset links")
+	webCmd.Flags().StringVar(&resetURL, "reset-url", notify.DefaultResetURL, "Page password reset links point to")
+	webCmd.Flags().StringVar(&smtpAddr, "smtp-addr", "", "host:port of the mail server for password reset emails (logs them when empty)")
+	webCmd.Flags().StringVar(&smtpFrom, "smtp-from", "", "Sender address of password reset emails")
+	webCmd.Flags().StringVar(&smtpUsername, "smtp-username", "", "Mail server username")
+	webCmd.Flags().StringVar(&smtpPassword, "smtp-password", os.Getenv("SMTP_PASSWORD"), "Mail server password (defaults to $SMTP_PASSWORD)")
+	webCmd.Flags().IntVar(&lockThreshold, "lockout-threshold", auth.DefaultLoginLimits.Username.Threshold, "Failed logins after which a username is locked out")
+	webCmd.Flags().StringVar(&twoFactorRoles, "require-2fa", "school_admin,superadmin", "Comma separated roles that must use two-factor authentication")
+	webCmd.Flags().DurationVar(&lockDuration, "lockout-duration", auth.DefaultLoginLimits.Username.Lockout, "First lockout of a username, doubling with each further failure")
+	webCmd.Flags().StringVar(&oidcIssuer, "oidc-issuer", "", "Issuer URL of the OpenID Connect provider for single sign-on (disabled when empty)")
+	webCmd.Flags().StringVar(&oidcClientID, "oidc-client-id", "", "Client ID registered with the OpenID Connect provider")
+	webCmd.Flags().StringVar(&oidcSecret, "oidc-client-secret", os.Getenv("OIDC_CLIENT_SECRET"), "Client secret (defaults to $OIDC_CLIENT_SECRET)")
+	webCmd.Flags().StringVar(&oidcRedirectURL, "oidc-redirect-url", "", "Public URL of /api/sso/callback, as registered with the provider")
+	webCmd.Flags().IntVar(&ssoGrade, "sso-grade", 0, "Grade given to accounts created on their first single sign-on")
+	webCmd.Flags().StringVar(&ssoSchool, "sso-school", "", "School given to accounts created on their first single sign-on")
+	webCmd.Flags().DurationVar(&deletedRetention, "deleted-retention", server.DefaultDeletedRetention, "How long deleted accounts can be restored before they are purged (0 disables purging)")
 
 	// Interactive mode command
 	var interactiveCmd = &cobra.Command{
@@ -102,7 +662,7 @@ func main() {
 		Run:   startInteractive,
 	}
 
-	rootCmd.AddCommand(createCmd, listCmd, getCmd, updateCmd, deleteCmd, statsCmd, webCmd, interactiveCmd)
+	rootCmd.AddCommand(createCmd, listCmd, searchCmd, getCmd, updateCmd, deleteCmd, restoreCmd, purgeCmd, exportCmd, newImportCmd(), newMappingCmd(), newRosterCmd(), statsCmd, schoolCmd, classroomCmd, guardianCmd, roleCmd, resetPasswordCmd, newResetTwoFactorCmd(), newUnlinkSSOCmd(), xpCmd, badgesCmd, leaderboardCmd, apiKeyCmd, lockoutCmd, authLogCmd, migrateCmd, webCmd, newMockIdPCmd(), interactiveCmd)
 
 	if err := rootCmd.Execute(); err != nil {
 		fmt.Println(err)
@@ -151,6 +711,18 @@ func createAccount(cmd *cobra.Command, args []string) {
 		School:    school,
 	}
 
+	err := passwords.Check(password, &models.Account{
+		Username:  username,
+		Email:     email,
+		FirstName: firstName,
+		LastName:  lastName,
+		Grade:     grade,
+	})
+	if err != nil {
+		fmt.Printf("Error creating account: %v\n", err)
+		return
+	}
+
 	account, err := db.CreateAccount(req)
 	if err != nil {
 		fmt.Printf("Error creating account: %v\n", err)
@@ -161,20 +733,71 @@ func createAccount(cmd *cobra.Command, args []string) {
 	fmt.Printf("ID: %d\n", account.ID)
 	fmt.Printf("Username: %s\n", account.Username)
 	fmt.Printf("Email: %s\n", account.Email)
+	evaluateBadges(account.ID)
+}
+
+// loadPasswordPolicy builds the password policy from the command line flags
+func loadPasswordPolicy() (*auth.PasswordPolicy, error) {
+	policy := auth.DefaultPasswordPolicy()
+	policy.MinLength = passwordMinLength
+	if passwordBlocklist == "" {
+		return policy, nil
+	}
+
+	file, err := os.Open(passwordBlocklist)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open password blocklist: %w", err)
+	}
+	defer file.Close()
+
+	if err := policy.LoadBlocklist(file); err != nil {
+		return nil, err
+	}
+	return policy, nil
 }
 
 func listAccounts(cmd *cobra.Command, args []string) {
-	accounts, err := db.GetAllAccounts()
+	opts, err := accountListOptions()
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return
+	}
+
+	page, err := db.ListAccounts(opts)
 	if err != nil {
 		fmt.Printf("Error listing accounts: %v\n", err)
 		return
 	}
 
+	if len(page.Accounts) == 0 {
+		fmt.Println("No accounts found.")
+		return
+	}
+
+	printAccounts(page.Accounts)
+
+	fmt.Printf("\nShowing %d of %d accounts\n", len(page.Accounts), page.Total)
+	if page.NextCursor != "" {
+		fmt.Printf("Next page: --cursor %s\n", page.NextCursor)
+	}
+}
+
+func searchAccounts(cmd *cobra.Command, args []string) {
+	accounts, err := db.SearchAccounts(strings.Join(args, " "), models.AccountListOptions{Limit: searchLimit})
+	if err != nil {
+		fmt.Printf("Error searching accounts: %v\n", err)
+		return
+	}
+
 	if len(accounts) == 0 {
 		fmt.Println("No accounts found.")
 		return
 	}
 
+	printAccounts(accounts)
+}
+
+func printAccounts(accounts []models.Account) {
 	fmt.Printf("%-5s %-15s %-25s %-15s %-15s %-10s %-5s %-10s\n",
 		"ID", "Username", "Email", "First Name", "Last Name", "Grade", "Level", "XP")
 	fmt.Println(strings.Repeat("-", 100))
@@ -191,6 +814,81 @@ func listAccounts(cmd *cobra.Command, args []string) {
 	}
 }
 
+// accountListOptions builds listing options from the list command flags
+func accountListOptions() (models.AccountListOptions, error) {
+	sort := listSort
+	if sort == "" {
+		sort = "created_at"
+	}
+	opts := models.AccountListOptions{
+		School:  listSchool,
+		Sort:    sort,
+		Limit:   listLimit,
+		Cursor:  listCursor,
+		Deleted: listDeleted,
+	}
+	if listSchoolID > 0 {
+		opts.SchoolID = &listSchoolID
+	}
+	if listClassroomID > 0 {
+		opts.ClassroomID = &listClassroomID
+	}
+	if !models.IsValidAccountSortKey(opts.Sort) {
+		return opts, fmt.Errorf("--sort must be one of %s", strings.Join(models.AccountSortKeys, ", "))
+	}
+
+	switch listOrder {
+	case "":
+		opts.Descending = opts.Sort == "created_at"
+	case "asc", "desc":
+		opts.Descending = listOrder == "desc"
+	default:
+		return opts, fmt.Errorf("--order must be asc or desc")
+	}
+
+	if listRole != "" {
+		if !models.IsValidRole(listRole) {
+			return opts, fmt.Errorf("unknown role %q", listRole)
+		}
+		opts.Roles = []string{listRole}
+	}
+	if listGrade >= 0 {
+		grade := listGrade
+		opts.Grade = &grade
+	}
+	if listMinLevel >= 0 {
+		level := listMinLevel
+		opts.MinLevel = &level
+	}
+	if listMaxLevel >= 0 {
+		level := listMaxLevel
+		opts.MaxLevel = &level
+	}
+	if listActive != "" {
+		active, err := strconv.ParseBool(listActive)
+		if err != nil {
+			return opts, fmt.Errorf("--active must be true or false")
+		}
+		opts.IsActive = &active
+	}
+	if listCreatedAfter != "" {
+		t, err := models.ParseListTime(listCreatedAfter)
+		if err != nil {
+			return opts, err
+		}
+		opts.CreatedAfter = &t
+	}
+	if listCreatedBefore != "" {
+		t, err := models.ParseListTime(listCreatedBefore)
+		if err != nil {
+			return opts, err
+		}
+		opts.CreatedBefore = &t
+	}
+
+	return opts, nil
+}
+
 func getAccount(cmd *cobra.Command, args []string) {
 	id, err := strconv.Atoi(args[0])
 	if err != nil {
@@ -213,6 +911,7 @@ func getAccount(cmd *cobra.Command, args []string) {
 	fmt.Printf("School: %s\n", account.School)
 	fmt.Printf("Game Level: %d\n", account.GameLevel)
 	fmt.Printf("Experience: %d\n", account.Experience)
+	fmt.Printf("Role: %s\n", account.Role)
 	fmt.Printf("Active: %t\n", account.IsActive)
 	fmt.Printf("Created: %s\n", account.CreatedAt.Format("2006-01-02 15:04:05"))
 	fmt.Printf("Updated: %s\n", account.UpdatedAt.Format("2006-01-02 15:04:05"))
@@ -263,40 +962,29 @@ func updateAccount(cmd *cobra.Command, args []string) {
 		school = current.School
 	}
 
-	fmt.Printf("Game Level [%d]: ", current.GameLevel)
-	scanner.Scan()
-	levelStr := scanner.Text()
-	gameLevel := current.GameLevel
-	if levelStr != "" {
-		gameLevel, _ = strconv.Atoi(levelStr)
-	}
-
-	fmt.Printf("Experience [%d]: ", current.Experience)
-	scanner.Scan()
-	expStr := scanner.Text()
-	experience := current.Experience
-	if expStr != "" {
-		experience, _ = strconv.Atoi(expStr)
-	}
-
+	// Refuse to overwrite changes made while the prompts were answered
 	req := models.UpdateAccountRequest{
-		FirstName:  firstName,
-		LastName:   lastName,
-		Grade:      grade,
-		School:     school,
-		GameLevel:  gameLevel,
-		Experience: experience,
-		IsActive:   current.IsActive,
+		FirstName: firstName,
+		LastName:  lastName,
+		Grade:     grade,
+		School:    school,
+		IsActive:  current.IsActive,
+		Version:   &current.Version,
 	}
 
 	account, err := db.UpdateAccount(id, req)
 	if err != nil {
+		if errors.Is(err, database.ErrAccountChanged) {
+			fmt.Println("Error updating account: it was changed by someone else while you were editing; run update again.")
+			return
+		}
 		fmt.Printf("Error updating account: %v\n", err)
 		return
 	}
 
 	fmt.Printf("Account updated successfully!\n")
 	fmt.Printf("Updated: %s\n", account.UpdatedAt.Format("2006-01-02 15:04:05"))
+	evaluateBadges(account.ID)
 }
 
 func deleteAccount(cmd *cobra.Command, args []string) {
@@ -313,7 +1001,7 @@ func deleteAccount(cmd *cobra.Command, args []string) {
 		return
 	}
 
-	fmt.Printf("Are you sure you want to delete account for %s (%s)? (y/N): ",
+	fmt.Printf("Are you sure you want to delete account for %s (%s)? It can be restored until it is purged. (y/N): ",
 		account.Username, account.Email)
 
 	scanner := bufio.NewScanner(os.Stdin)
@@ -334,22 +1022,1077 @@ func deleteAccount(cmd *cobra.Command, args []string) {
 	fmt.Printf("Account for %s deleted successfully.\n", account.Username)
 }
 
-func showStats(cmd *cobra.Command, args []string) {
-	stats, err := db.GetAccountStats()
+func restoreAccount(cmd *cobra.Command, args []string) {
+	id, err := strconv.Atoi(args[0])
 	if err != nil {
-		fmt.Printf("Error getting stats: %v\n", err)
+		fmt.Printf("Invalid account ID: %v\n", err)
 		return
 	}
 
-	fmt.Printf("Account Statistics:\n")
-	fmt.Printf("Total Accounts: %d\n", stats.TotalAccounts)
-	fmt.Printf("Active Accounts: %d\n", stats.ActiveAccounts)
-	fmt.Printf("Average Game Level: %.2f\n", stats.AverageGameLevel)
-	fmt.Printf("Total Experience: %d\n", stats.TotalExperience)
+	account, err := db.RestoreAccount(id)
+	if err != nil {
+		fmt.Printf("Error restoring account: %v\n", err)
+		return
+	}
+
+	fmt.Printf("Account for %s restored successfully.\n", account.Username)
 }
 
-func startWebServer(cmd *cobra.Command, args []string) {
-	srv := server.NewServer(db, port)
+func purgeAccounts(cmd *cobra.Command, args []string) {
+	if purgeRetention < 0 {
+		fmt.Println("Error: --retention must not be negative")
+		return
+	}
+
+	n, err := db.PurgeDeletedAccounts(time.Now().Add(-purgeRetention))
+	if err != nil {
+		fmt.Printf("Error purging accounts: %v\n", err)
+		return
+	}
+
+	fmt.Printf("Purged %d deleted accounts.\n", n)
+}
+
+func exportAccounts(cmd *cobra.Command, args []string) {
+	service := export.NewExportService(db)
+	var write func(io.Writer, models.AccountListOptions) (int, error)
+	switch exportFormat {
+	case "csv":
+		write = service.WriteCSV
+	case "json":
+		write = service.WriteJSON
+	default:
+		fmt.Fprintf(os.Stderr, "Error: --format must be csv or json\n")
+		return
+	}
+
+	opts := models.AccountListOptions{School: exportSchool}
+	if exportSchoolID > 0 {
+		opts.SchoolID = &exportSchoolID
+	}
+	if exportClassroomID > 0 {
+		opts.ClassroomID = &exportClassroomID
+	}
+
+	if exportOutput == "-" {
+		if _, err := write(os.Stdout, opts); err != nil {
+			fmt.Fprintf(os.Stderr, "Error exporting accounts: %v\n", err)
+		}
+		return
+	}
+
+	file, err := os.Create(exportOutput)
+	if err != nil {
+		fmt.Printf("Error creating export file: %v\n", err)
+		return
+	}
+	out := bufio.NewWriter(file)
+	count, err := write(out, opts)
+	if err == nil {
+		err = out.Flush()
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		// Leave no partial export behind
+		os.Remove(exportOutput)
+		fmt.Printf("Error exporting accounts: %v\n", err)
+		return
+	}
+
+	fmt.Printf("Exported %d accounts to %s\n", count, exportOutput)
+}
+
+func showStats(cmd *cobra.Command, args []string) {
+	var opts models.AccountListOptions
+	if statsSchoolID > 0 {
+		opts.SchoolID = &statsSchoolID
+	}
+	if statsClassroomID > 0 {
+		opts.ClassroomID = &statsClassroomID
+	}
+
+	stats, err := db.GetAccountStats(opts)
+	if err != nil {
+		fmt.Printf("Error getting stats: %v\n", err)
+		return
+	}
+
+	fmt.Printf("Account Statistics:\n")
+	fmt.Printf("Total Accounts: %d\n", stats.TotalAccounts)
+	fmt.Printf("Active Accounts: %d\n", stats.ActiveAccounts)
+	fmt.Printf("Average Game Level: %.2f\n", stats.AverageGameLevel)
+	fmt.Printf("Total Experience: %d\n", stats.TotalExperience)
+}
+
+func listSchools(cmd *cobra.Command, args []string) {
+	schools, err := db.ListSchools()
+	if err != nil {
+		fmt.Printf("Error listing schools: %v\n", err)
+		return
+	}
+
+	if len(schools) == 0 {
+		fmt.Println("No schools found.")
+		return
+	}
+
+	fmt.Printf("%-5s %-40s %s\n", "ID", "Name", "Created")
+	fmt.Println(strings.Repeat("-", 60))
+	for _, school := range schools {
+		fmt.Printf("%-5d %-40s %s\n", school.ID, school.Name, school.CreatedAt.Format("2006-01-02"))
+	}
+}
+
+func createSchool(cmd *cobra.Command, args []string) {
+	school, err := db.CreateSchool(args[0])
+	if err != nil {
+		fmt.Printf("Error creating school: %v\n", err)
+		return
+	}
+
+	fmt.Printf("School %q created with ID %d.\n", school.Name, school.ID)
+}
+
+func renameSchool(cmd *cobra.Command, args []string) {
+	id, err := strconv.Atoi(args[0])
+	if err != nil {
+		fmt.Printf("Invalid school ID: %v\n", err)
+		return
+	}
+
+	school, err := db.RenameSchool(id, args[1])
+	if err != nil {
+		fmt.Printf("Error renaming school: %v\n", err)
+		return
+	}
+
+	fmt.Printf("School %d renamed to %q.\n", school.ID, school.Name)
+}
+
+func deleteSchool(cmd *cobra.Command, args []string) {
+	id, err := strconv.Atoi(args[0])
+	if err != nil {
+		fmt.Printf("Invalid school ID: %v\n", err)
+		return
+	}
+
+	school, err := db.GetSchool(id)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return
+	}
+
+	fmt.Printf("Delete %s and all of its classrooms? (y/N): ", school.Name)
+	scanner := bufio.NewScanner(os.Stdin)
+	scanner.Scan()
+	if strings.ToLower(scanner.Text()) != "y" {
+		fmt.Println("Cancelled.")
+		return
+	}
+
+	if err := db.DeleteSchool(id); err != nil {
+		fmt.Printf("Error deleting school: %v\n", err)
+		return
+	}
+
+	fmt.Printf("School %s deleted.\n", school.Name)
+}
+
+func mergeSchools(cmd *cobra.Command, args []string) {
+	fromID, err := strconv.Atoi(args[0])
+	if err != nil {
+		fmt.Printf("Invalid school ID: %v\n", err)
+		return
+	}
+	intoID, err := strconv.Atoi(args[1])
+	if err != nil {
+		fmt.Printf("Invalid school ID: %v\n", err)
+		return
+	}
+
+	school, err := db.MergeSchools(fromID, intoID)
+	if err != nil {
+		fmt.Printf("Error merging schools: %v\n", err)
+		return
+	}
+
+	fmt.Printf("School %d merged into %s.\n", fromID, school.Name)
+}
+
+func listClassrooms(cmd *cobra.Command, args []string) {
+	schoolID, err := strconv.Atoi(args[0])
+	if err != nil {
+		fmt.Printf("Invalid school ID: %v\n", err)
+		return
+	}
+
+	classrooms, err := db.ListClassrooms(schoolID)
+	if err != nil {
+		fmt.Printf("Error listing classrooms: %v\n", err)
+		return
+	}
+
+	if len(classrooms) == 0 {
+		fmt.Println("No classrooms found.")
+		return
+	}
+
+	fmt.Printf("%-5s %-30s %s\n", "ID", "Name", "Grade")
+	fmt.Println(strings.Repeat("-", 45))
+	for _, classroom := range classrooms {
+		fmt.Printf("%-5d %-30s %d\n", classroom.ID, classroom.Name, classroom.Grade)
+	}
+}
+
+func createClassroom(cmd *cobra.Command, args []string) {
+	schoolID, err := strconv.Atoi(args[0])
+	if err != nil {
+		fmt.Printf("Invalid school ID: %v\n", err)
+		return
+	}
+
+	classroom, err := db.CreateClassroom(schoolID, models.ClassroomRequest{Name: args[1], Grade: classroomGrade})
+	if err != nil {
+		fmt.Printf("Error creating classroom: %v\n", err)
+		return
+	}
+
+	fmt.Printf("Classroom %q created with ID %d.\n", classroom.Name, classroom.ID)
+}
+
+func updateClassroom(cmd *cobra.Command, args []string) {
+	id, err := strconv.Atoi(args[0])
+	if err != nil {
+		fmt.Printf("Invalid classroom ID: %v\n", err)
+		return
+	}
+
+	req := models.ClassroomRequest{Name: args[1], Grade: classroomGrade}
+	if !cmd.Flags().Changed("grade") {
+		current, err := db.GetClassroom(id)
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			return
+		}
+		req.Grade = current.Grade
+	}
+
+	classroom, err := db.UpdateClassroom(id, req)
+	if err != nil {
+		fmt.Printf("Error updating classroom: %v\n", err)
+		return
+	}
+
+	fmt.Printf("Classroom %d is now %q, grade %d.\n", classroom.ID, classroom.Name, classroom.Grade)
+}
+
+func deleteClassroom(cmd *cobra.Command, args []string) {
+	id, err := strconv.Atoi(args[0])
+	if err != nil {
+		fmt.Printf("Invalid classroom ID: %v\n", err)
+		return
+	}
+
+	if err := db.DeleteClassroom(id); err != nil {
+		fmt.Printf("Error deleting classroom: %v\n", err)
+		return
+	}
+
+	fmt.Printf("Classroom %d deleted.\n", id)
+}
+
+func classroomMembers(cmd *cobra.Command, args []string) {
+	id, err := strconv.Atoi(args[0])
+	if err != nil {
+		fmt.Printf("Invalid classroom ID: %v\n", err)
+		return
+	}
+
+	enrollments, err := db.GetEnrollments(id)
+	if err != nil {
+		fmt.Printf("Error getting enrollments: %v\n", err)
+		return
+	}
+
+	if len(enrollments) == 0 {
+		fmt.Println("Nobody is enrolled.")
+		return
+	}
+
+	fmt.Printf("%-5s %-20s %-20s %-20s %s\n", "ID", "Username", "First Name", "Last Name", "Role")
+	fmt.Println(strings.Repeat("-", 75))
+	for _, enrollment := range enrollments {
+		account, err := db.GetAccountByID(enrollment.AccountID)
+		if err != nil {
+			continue
+		}
+		fmt.Printf("%-5d %-20s %-20s %-20s %s\n", account.ID, account.Username, account.FirstName,
+			account.LastName, enrollment.Role)
+	}
+}
+
+func enrollAccount(cmd *cobra.Command, args []string) {
+	classroomID, err := strconv.Atoi(args[0])
+	if err != nil {
+		fmt.Printf("Invalid classroom ID: %v\n", err)
+		return
+	}
+	accountID, err := strconv.Atoi(args[1])
+	if err != nil {
+		fmt.Printf("Invalid account ID: %v\n", err)
+		return
+	}
+
+	enrollment, err := db.Enroll(classroomID, accountID, enrollRole)
+	if err != nil {
+		fmt.Printf("Error enrolling account: %v\n", err)
+		return
+	}
+
+	fmt.Printf("Account %d enrolled in classroom %d as %s.\n", enrollment.AccountID, enrollment.ClassroomID, enrollment.Role)
+}
+
+func unenrollAccount(cmd *cobra.Command, args []string) {
+	classroomID, err := strconv.Atoi(args[0])
+	if err != nil {
+		fmt.Printf("Invalid classroom ID: %v\n", err)
+		return
+	}
+	accountID, err := strconv.Atoi(args[1])
+	if err != nil {
+		fmt.Printf("Invalid account ID: %v\n", err)
+		return
+	}
+
+	if err := db.Unenroll(classroomID, accountID); err != nil {
+		fmt.Printf("Error unenrolling account: %v\n", err)
+		return
+	}
+
+	fmt.Printf("Account %d removed from classroom %d.\n", accountID, classroomID)
+}
+
+func addStudents(cmd *cobra.Command, args []string) {
+	id, err := strconv.Atoi(args[0])
+	if err != nil {
+		fmt.Printf("Invalid classroom ID: %v\n", err)
+		return
+	}
+
+	result, err := db.AddToRoster(id, args[1:])
+	if err != nil {
+		fmt.Printf("Error adding students: %v\n", err)
+		return
+	}
+
+	fmt.Printf("Added %d student(s) to classroom %d.\n", len(result.Added), id)
+	for _, group := range []struct {
+		label     string
+		usernames []string
+	}{
+		{"Already enrolled", result.AlreadyEnrolled},
+		{"Not found", result.NotFound},
+		{"Not a student of this school", result.NotEligible},
+	} {
+		if len(group.usernames) > 0 {
+			fmt.Printf("%s: %s\n", group.label, strings.Join(group.usernames, ", "))
+		}
+	}
+}
+
+func listGuardians(cmd *cobra.Command, args []string) {
+	id, err := strconv.Atoi(args[0])
+	if err != nil {
+		fmt.Printf("Invalid account ID: %v\n", err)
+		return
+	}
+
+	links, err := db.GetGuardianLinks(id)
+	if err != nil {
+		fmt.Printf("Error getting guardians: %v\n", err)
+		return
+	}
+
+	if len(links) == 0 {
+		fmt.Println("No guardians linked.")
+		return
+	}
+
+	fmt.Printf("%-5s %-20s %-20s %-12s %-10s %s\n", "ID", "Username", "Consented", "Method", "Policy", "Recorded By")
+	fmt.Println(strings.Repeat("-", 85))
+	for _, link := range links {
+		username := ""
+		if guardian, err := db.GetAccountByID(link.GuardianID); err == nil {
+			username = guardian.Username
+		}
+		fmt.Printf("%-5d %-20s %-20s %-12s %-10s %d\n", link.GuardianID, username,
+			link.ConsentedAt.Format("2006-01-02 15:04"), link.ConsentMethod, link.PolicyVersion, link.RecordedBy)
+	}
+}
+
+func linkGuardian(cmd *cobra.Command, args []string) {
+	studentID, err := strconv.Atoi(args[0])
+	if err != nil {
+		fmt.Printf("Invalid account ID: %v\n", err)
+		return
+	}
+	guardianID, err := strconv.Atoi(args[1])
+	if err != nil {
+		fmt.Printf("Invalid account ID: %v\n", err)
+		return
+	}
+
+	switch consentMethod {
+	case models.ConsentMethodOnline, models.ConsentMethodSignedForm, models.ConsentMethodEmail, models.ConsentMethodPhone:
+	default:
+		fmt.Printf("Invalid consent method: %s\n", consentMethod)
+		return
+	}
+
+	_, err = db.RecordConsent(models.GuardianLink{
+		GuardianID:    guardianID,
+		StudentID:     studentID,
+		ConsentMethod: consentMethod,
+		PolicyVersion: consentPolicy,
+	})
+	if err != nil {
+		fmt.Printf("Error recording consent: %v\n", err)
+		return
+	}
+
+	fmt.Printf("Guardian %d linked to student %d with %s consent to policy %s.\n", guardianID, studentID, consentMethod, consentPolicy)
+}
+
+func grantRole(cmd *cobra.Command, args []string) {
+	id, err := strconv.Atoi(args[0])
+	if err != nil {
+		fmt.Printf("Invalid account ID: %v\n", err)
+		return
+	}
+
+	account, err := db.SetAccountRole(id, args[1])
+	if err != nil {
+		fmt.Printf("Error granting role: %v\n", err)
+		return
+	}
+
+	fmt.Printf("Account %s is now %s.\n", account.Username, account.Role)
+}
+
+func addXP(cmd *cobra.Command, args []string) {
+	id, err := strconv.Atoi(args[0])
+	if err != nil {
+		fmt.Printf("Invalid account ID: %v\n", err)
+		return
+	}
+
+	amount, err := strconv.Atoi(args[1])
+	if err != nil {
+		fmt.Printf("Invalid amount: %v\n", err)
+		return
+	}
+
+	event, account, err := db.RecordXPEvent(models.XPEvent{
+		AccountID: id,
+		Amount:    amount,
+		Source:    xpSource,
+		Reason:    xpReason,
+	})
+	if err != nil {
+		fmt.Printf("Error recording experience: %v\n", err)
+		return
+	}
+
+	fmt.Printf("Recorded %+d XP (event %d).\n", event.Amount, event.ID)
+	fmt.Printf("%s now has %d XP and is level %d.\n", account.Username, account.Experience, account.GameLevel)
+	evaluateBadges(account.ID)
+}
+
+func xpHistory(cmd *cobra.Command, args []string) {
+	id, err := strconv.Atoi(args[0])
+	if err != nil {
+		fmt.Printf("Invalid account ID: %v\n", err)
+		return
+	}
+
+	events, err := db.GetXPEvents(id, xpHistoryMax)
+	if err != nil {
+		fmt.Printf("Error getting experience history: %v\n", err)
+		return
+	}
+
+	if len(events) == 0 {
+		fmt.Println("No experience recorded.")
+		return
+	}
+
+	fmt.Printf("%-6s %-20s %-8s %-12s %-20s %s\n", "ID", "When", "Amount", "Source", "Game", "Reason")
+	fmt.Println(strings.Repeat("-", 90))
+	for _, event := range events {
+		fmt.Printf("%-6d %-20s %-+8d %-12s %-20s %s\n", event.ID, event.CreatedAt.Format("2006-01-02 15:04:05"),
+			event.Amount, event.Source, event.GameRef, event.Reason)
+	}
+}
+
+func replayXP(cmd *cobra.Command, args []string) {
+	changed, err := db.ReplayXP()
+	if err != nil {
+		fmt.Printf("Error replaying experience ledger: %v\n", err)
+		return
+	}
+
+	fmt.Printf("Replayed experience ledger; %d account(s) updated.\n", changed)
+}
+
+func showLeaderboard(cmd *cobra.Command, args []string) {
+	board, err := db.GetLeaderboard(models.LeaderboardQuery{
+		Metric: boardMetric,
+		Scope:  boardScope,
+		Window: boardWindow,
+		School: boardSchool,
+		Grade:  boardGrade,
+		Limit:  boardLimit,
+	})
+	if err != nil {
+		fmt.Printf("Error getting leaderboard: %v\n", err)
+		return
+	}
+
+	if len(board.Entries) == 0 {
+		fmt.Println("Nobody is on this leaderboard yet.")
+		return
+	}
+
+	if board.PeriodStart != "" {
+		fmt.Printf("Ranking %s experience since %s (UTC)\n", board.Window, board.PeriodStart)
+	}
+	fmt.Printf("%-6s %-20s %-20s %-20s %-6s %s\n", "Rank", "Username", "Name", "School", "Grade", board.Metric)
+	fmt.Println(strings.Repeat("-", 85))
+	for _, entry := range board.Entries {
+		fmt.Printf("%-6d %-20s %-20s %-20s %-6d %d\n", entry.Rank, entry.Username, entry.DisplayName,
+			entry.School, entry.Grade, entry.Value)
+	}
+}
+
+func setLeaderboardOptOut(arg string, optOut bool) {
+	id, err := strconv.Atoi(arg)
+	if err != nil {
+		fmt.Printf("Invalid account ID: %v\n", err)
+		return
+	}
+
+	account, err := db.SetLeaderboardOptOut(id, optOut)
+	if err != nil {
+		fmt.Printf("Error updating leaderboard preference: %v\n", err)
+		return
+	}
+
+	if optOut {
+		fmt.Printf("%s is now hidden from leaderboards.\n", account.Username)
+	} else {
+		fmt.Printf("%s is now shown on leaderboards.\n", account.Username)
+	}
+}
+
+// badgeEngine loads the badge catalog selected by --badges
+func badgeEngine() (*achievements.Engine, error) {
+	catalog, err := achievements.LoadCatalog(badgesPath)
+	if err != nil {
+		return nil, err
+	}
+	return achievements.NewEngine(catalog, db), nil
+}
+
+// evaluateBadges awards and prints the badges an account has newly earned
+func evaluateBadges(accountID int) {
+	engine, err := badgeEngine()
+	if err != nil {
+		fmt.Printf("Error loading badges: %v\n", err)
+		return
+	}
+
+	awarded, err := engine.Evaluate(accountID)
+	if err != nil {
+		fmt.Printf("Error evaluating badges: %v\n", err)
+		return
+	}
+	for _, badge := range awarded {
+		fmt.Printf("Earned badge: %s %s\n", badge.Icon, badge.Name)
+	}
+}
+
+func listBadges(cmd *cobra.Command, args []string) {
+	engine, err := badgeEngine()
+	if err != nil {
+		fmt.Printf("Error loading badges: %v\n", err)
+		return
+	}
+
+	fmt.Printf("%-20s %-20s %-18s %s\n", "ID", "Name", "Rule", "Description")
+	fmt.Println(strings.Repeat("-", 90))
+	for _, badge := range engine.Catalog().Badges {
+		rule := badge.Rule.Type
+		if badge.Rule.Threshold > 0 {
+			rule = fmt.Sprintf("%s >= %d", rule, badge.Rule.Threshold)
+		}
+		fmt.Printf("%-20s %-20s %-18s %s\n", badge.ID, badge.Name, rule, badge.Description)
+	}
+}
+
+func showBadges(cmd *cobra.Command, args []string) {
+	id, err := strconv.Atoi(args[0])
+	if err != nil {
+		fmt.Printf("Invalid account ID: %v\n", err)
+		return
+	}
+
+	engine, err := badgeEngine()
+	if err != nil {
+		fmt.Printf("Error loading badges: %v\n", err)
+		return
+	}
+
+	earned, err := engine.Earned(id)
+	if err != nil {
+		fmt.Printf("Error getting badges: %v\n", err)
+		return
+	}
+
+	if len(earned) == 0 {
+		fmt.Println("No badges earned yet.")
+		return
+	}
+
+	for _, badge := range earned {
+		fmt.Printf("%s %-20s earned %s", badge.Icon, badge.Name, badge.AwardedAt.Format("2006-01-02"))
+		if badge.Note != "" {
+			fmt.Printf(" (%s)", badge.Note)
+		}
+		fmt.Println()
+	}
+}
+
+func awardBadge(cmd *cobra.Command, args []string) {
+	id, err := strconv.Atoi(args[0])
+	if err != nil {
+		fmt.Printf("Invalid account ID: %v\n", err)
+		return
+	}
+
+	engine, err := badgeEngine()
+	if err != nil {
+		fmt.Printf("Error loading badges: %v\n", err)
+		return
+	}
+
+	added, err := engine.Award(id, args[1], nil, badgeNote)
+	if err != nil {
+		fmt.Printf("Error awarding badge: %v\n", err)
+		return
+	}
+	if !added {
+		fmt.Println("Account already holds this badge.")
+		return
+	}
+
+	fmt.Printf("Badge %s awarded to account %d.\n", args[1], id)
+}
+
+func revokeBadge(cmd *cobra.Command, args []string) {
+	id, err := strconv.Atoi(args[0])
+	if err != nil {
+		fmt.Printf("Invalid account ID: %v\n", err)
+		return
+	}
+
+	if err := db.RevokeAchievement(id, args[1]); err != nil {
+		fmt.Printf("Error revoking badge: %v\n", err)
+		return
+	}
+
+	fmt.Printf("Badge %s revoked from account %d.\n", args[1], id)
+}
+
+func checkBadges(cmd *cobra.Command, args []string) {
+	engine, err := badgeEngine()
+	if err != nil {
+		fmt.Printf("Error loading badges: %v\n", err)
+		return
+	}
+
+	accounts, err := db.GetAllAccounts()
+	if err != nil {
+		fmt.Printf("Error listing accounts: %v\n", err)
+		return
+	}
+
+	total := 0
+	for _, account := range accounts {
+		awarded, err := engine.Evaluate(account.ID)
+		if err != nil {
+			fmt.Printf("Error evaluating badges of %s: %v\n", account.Username, err)
+			continue
+		}
+		for _, badge := range awarded {
+			fmt.Printf("%s earned %s\n", account.Username, badge.Name)
+		}
+		total += len(awarded)
+	}
+
+	fmt.Printf("Checked %d account(s); %d badge(s) awarded.\n", len(accounts), total)
+}
+
+func resetPassword(cmd *cobra.Command, args []string) {
+	id, err := strconv.Atoi(args[0])
+	if err != nil {
+		fmt.Printf("Invalid account ID: %v\n", err)
+		return
+	}
+
+	account, err := db.GetAccountByID(id)
+	if err != nil {
+		fmt.Printf("Error getting account: %v\n", err)
+		return
+	}
+
+	generate := auth.GenerateTemporaryPassword
+	if account.Role == models.RoleStudent && passwords.IsYoung(account.Grade) {
+		generate = auth.GeneratePassphrase
+	}
+	password, err := generate()
+	if err != nil {
+		fmt.Printf("Error generating password: %v\n", err)
+		return
+	}
+	if err := db.SetPassword(account.ID, password, true); err != nil {
+		fmt.Printf("Error resetting password: %v\n", err)
+		return
+	}
+	if err := db.RevokeAccountRefreshTokens(account.ID); err != nil {
+		fmt.Printf("Error signing out account: %v\n", err)
+		return
+	}
+
+	fmt.Printf("Temporary password for %s: %s\n", account.Username, password)
+	fmt.Println("The account must choose a new password when it next logs in.")
+}
+
+func revokeRole(cmd *cobra.Command, args []string) {
+	id, err := strconv.Atoi(args[0])
+	if err != nil {
+		fmt.Printf("Invalid account ID: %v\n", err)
+		return
+	}
+
+	account, err := db.SetAccountRole(id, models.RoleStudent)
+	if err != nil {
+		fmt.Printf("Error revoking role: %v\n", err)
+		return
+	}
+
+	fmt.Printf("Account %s is now %s.\n", account.Username, account.Role)
+}
+
+func createAPIKey(cmd *cobra.Command, args []string) {
+	scopes, err := auth.ParseScopes(apiKeyScopes)
+	if err != nil {
+		fmt.Printf("Invalid scopes: %v\n", err)
+		return
+	}
+
+	rawKey, prefix, err := auth.GenerateAPIKey()
+	if err != nil {
+		fmt.Printf("Error generating API key: %v\n", err)
+		return
+	}
+
+	key := models.APIKey{
+		Name:   apiKeyName,
+		Prefix: prefix,
+		Owner:  apiKeyOwner,
+		Scopes: scopes,
+	}
+	if apiKeyExpiresIn > 0 {
+		expiresAt := time.Now().Add(apiKeyExpiresIn)
+		key.ExpiresAt = &expiresAt
+	}
+
+	created, err := db.CreateAPIKey(key, auth.HashToken(rawKey))
+	if err != nil {
+		fmt.Printf("Error creating API key: %v\n", err)
+		return
+	}
+
+	fmt.Printf("API key created successfully!\n")
+	fmt.Printf("ID: %d\n", created.ID)
+	fmt.Printf("Scopes: %s\n", strings.Join(created.Scopes, ", "))
+	fmt.Printf("Key: %s\n", rawKey)
+	fmt.Println("Store this key now, it cannot be shown again.")
+}
+
+func listAPIKeys(cmd *cobra.Command, args []string) {
+	keys, err := db.GetAllAPIKeys()
+	if err != nil {
+		fmt.Printf("Error listing API keys: %v\n", err)
+		return
+	}
+
+	if len(keys) == 0 {
+		fmt.Println("No API keys found.")
+		return
+	}
+
+	fmt.Printf("%-5s %-20s %-15s %-15s %-20s %-20s %s\n",
+		"ID", "Name", "Prefix", "Owner", "Expires", "Last Used", "Scopes")
+	fmt.Println(strings.Repeat("-", 120))
+
+	now := time.Now()
+	for _, key := range keys {
+		expires, lastUsed := "never", "never"
+		if key.ExpiresAt != nil {
+			expires = key.ExpiresAt.Format("2006-01-02 15:04")
+		}
+		if key.LastUsedAt != nil {
+			lastUsed = key.LastUsedAt.Format("2006-01-02 15:04")
+		}
+
+		status := ""
+		if !key.IsUsable(now) {
+			status = " [Revoked/Expired]"
+		}
+
+		fmt.Printf("%-5d %-20s %-15s %-15s %-20s %-20s %s%s\n",
+			key.ID, key.Name, key.Prefix, key.Owner, expires, lastUsed,
+			strings.Join(key.Scopes, ","), status)
+	}
+}
+
+func revokeAPIKey(cmd *cobra.Command, args []string) {
+	id, err := strconv.Atoi(args[0])
+	if err != nil {
+		fmt.Printf("Invalid API key ID: %v\n", err)
+		return
+	}
+
+	if err := db.RevokeAPIKey(id); err != nil {
+		fmt.Printf("Error revoking API key: %v\n", err)
+		return
+	}
+
+	fmt.Printf("API key %d revoked.\n", id)
+}
+
+func listLockouts(cmd *cobra.Command, args []string) {
+	now := time.Now()
+	locks, err := db.ListLoginLocks(!lockoutAll, now)
+	if err != nil {
+		fmt.Printf("Error listing lockouts: %v\n", err)
+		return
+	}
+
+	if len(locks) == 0 {
+		fmt.Println("No lockouts found.")
+		return
+	}
+
+	fmt.Printf("%-10s %-30s %-9s %-20s %s\n", "Kind", "Key", "Failures", "Last Failure", "Locked Until")
+	fmt.Println(strings.Repeat("-", 90))
+	for _, lock := range locks {
+		until := "-"
+		if lock.IsLocked(now) {
+			until = lock.LockedUntil.Format("2006-01-02 15:04:05")
+		}
+		fmt.Printf("%-10s %-30s %-9d %-20s %s\n", lock.Kind, lock.Key, lock.Failures,
+			lock.LastFailureAt.Format("2006-01-02 15:04:05"), until)
+	}
+}
+
+func clearLockout(cmd *cobra.Command, args []string) {
+	kind, key := args[0], args[1]
+	if !models.IsValidLoginKeyKind(kind) {
+		fmt.Printf("Invalid lockout kind %q: use username or ip\n", kind)
+		return
+	}
+
+	cleared, err := db.ClearLoginFailures(kind, key)
+	if err != nil {
+		fmt.Printf("Error clearing lockout: %v\n", err)
+		return
+	}
+	if !cleared {
+		fmt.Printf("No failed logins recorded for %s %s.\n", kind, key)
+		return
+	}
+
+	fmt.Printf("Lockout of %s %s cleared.\n", kind, key)
+}
+
+func showAuthLog(cmd *cobra.Command, args []string) {
+	events, err := db.GetAuthEvents(models.AuthLogQuery{
+		Username: authLogUser,
+		IP:       authLogIP,
+		Outcome:  authLogOutcome,
+		Limit:    authLogLimit,
+	})
+	if err != nil {
+		fmt.Printf("Error getting auth log: %v\n", err)
+		return
+	}
+
+	if len(events) == 0 {
+		fmt.Println("No login attempts found.")
+		return
+	}
+
+	fmt.Printf("%-20s %-25s %-10s %-40s %s\n", "Time", "Username", "Account", "IP", "Outcome")
+	fmt.Println(strings.Repeat("-", 110))
+	for _, event := range events {
+		account := "-"
+		if event.AccountID != nil {
+			account = strconv.Itoa(*event.AccountID)
+		}
+		fmt.Printf("%-20s %-25s %-10s %-40s %s\n", event.CreatedAt.Format("2006-01-02 15:04:05"),
+			event.Username, account, event.IP, event.Outcome)
+	}
+}
+
+func migrateUp(cmd *cobra.Command, args []string) {
+	if err := db.MigrateUp(); err != nil {
+		fmt.Printf("Error applying migrations: %v\n", err)
+		return
+	}
+	printSchemaVersion()
+}
+
+func migrateDown(cmd *cobra.Command, args []string) {
+	steps := 1
+	if len(args) == 1 {
+		var err error
+		steps, err = strconv.Atoi(args[0])
+		if err != nil || steps < 1 {
+			fmt.Printf("Invalid number of steps: %s\n", args[0])
+			return
+		}
+	}
+
+	if err := db.MigrateDown(steps); err != nil {
+		fmt.Printf("Error reverting migrations: %v\n", err)
+		return
+	}
+	printSchemaVersion()
+}
+
+func migrateTo(cmd *cobra.Command, args []string) {
+	version, err := strconv.Atoi(args[0])
+	if err != nil {
+		fmt.Printf("Invalid schema version: %v\n", err)
+		return
+	}
+
+	if err := db.MigrateTo(version); err != nil {
+		fmt.Printf("Error migrating: %v\n", err)
+		return
+	}
+	printSchemaVersion()
+}
+
+func migrateStatus(cmd *cobra.Command, args []string) {
+	statuses, err := db.MigrationStatus()
+	if err != nil {
+		fmt.Printf("Error getting migration status: %v\n", err)
+		return
+	}
+
+	fmt.Printf("%-8s %-30s %s\n", "Version", "Name", "Applied")
+	fmt.Println(strings.Repeat("-", 60))
+	for _, status := range statuses {
+		applied := "pending"
+		if status.AppliedAt != nil {
+			applied = status.AppliedAt.Format("2006-01-02 15:04:05")
+		}
+		fmt.Printf("%-8d %-30s %s\n", status.Version, status.Name, applied)
+	}
+	printSchemaVersion()
+}
+
+func printSchemaVersion() {
+	version, err := db.SchemaVersion()
+	if err != nil {
+		fmt.Printf("Error getting schema version: %v\n", err)
+		return
+	}
+	fmt.Printf("Schema is at version %d.\n", version)
+}
+
+func startWebServer(cmd *cobra.Command, args []string) {
+	catalog, err := achievements.LoadCatalog(badgesPath)
+	if err != nil {
+		log.Fatalf("Failed to load badges: %v", err)
+	}
+
+	var notifier notify.Notifier = notify.Log{ResetURL: resetURL}
+	if smtpAddr != "" {
+		if smtpFrom == "" {
+			log.Fatalf("--smtp-from is required with --smtp-addr")
+		}
+		notifier = notify.SMTP{
+			Addr:     smtpAddr,
+			From:     smtpFrom,
+			Username: smtpUsername,
+			Password: smtpPassword,
+			ResetURL: resetURL,
+		}
+	}
+
+	var requiredRoles []string
+	for _, role := range strings.Split(twoFactorRoles, ",") {
+		role = strings.TrimSpace(role)
+		if role == "" {
+			continue
+		}
+		if !models.IsValidRole(role) {
+			log.Fatalf("Invalid role in --require-2fa: %s", role)
+		}
+		requiredRoles = append(requiredRoles, role)
+	}
+
+	limits := auth.DefaultLoginLimits
+	limits.Username.Threshold = lockThreshold
+	limits.Username.Lockout = lockDuration
+
+	var sso *auth.OIDCConfig
+	if oidcIssuer != "" {
+		if oidcClientID == "" || oidcRedirectURL == "" {
+			log.Fatalf("--oidc-client-id and --oidc-redirect-url are required with --oidc-issuer")
+		}
+		sso = &auth.OIDCConfig{
+			Issuer:       oidcIssuer,
+			ClientID:     oidcClientID,
+			ClientSecret: oidcSecret,
+			RedirectURL:  oidcRedirectURL,
+		}
+	}
+
+	srv, err := server.NewServer(db, server.Config{
+		Port:             port,
+		JWTSecret:        []byte(jwtSecret),
+		AccessTokenTTL:   accessTokenTTL,
+		RefreshTokenTTL:  refreshTokenTTL,
+		ResetTokenTTL:    resetTokenTTL,
+		Badges:           catalog,
+		Notifier:         notifier,
+		LoginLimits:      &limits,
+		TwoFactorRoles:   requiredRoles,
+		PasswordPolicy:   passwords,
+		SSO:              sso,
+		SSOProvisioning:  models.SSOProvisioning{Grade: ssoGrade, School: ssoSchool},
+		DeletedRetention: deletedRetention,
+	})
+	if err != nil {
+		log.Fatalf("Failed to create web server: %v", err)
+	}
 	if err := srv.Start(); err != nil {
 		log.Fatalf("Failed to start web server: %v", err)
 	}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"educational-game-db/internal/export"
+
+	"github.com/spf13/cobra"
+)
+
+// newMappingCmd returns the commands managing saved CSV import mappings
+func newMappingCmd() *cobra.Command {
+	var mappingCmd = &cobra.Command{
+		Use:   "mapping",
+		Short: "Manage saved mappings of CSV import columns to fields",
+		Long: "A mapping names the column each field of a CSV import is read from, what is\n" +
+			"done to its values and extra names for grades. Mappings are YAML or JSON:\n\n" +
+			"  columns:\n" +
+			"    username: Student Login\n" +
+			"    grade: Grade Level\n" +
+			"  transforms:\n" +
+			"    email: [trim, lowercase]\n" +
+			"  grade_aliases:\n" +
+			"    Pre-K: 0",
+	}
+
+	var mappingListCmd = &cobra.Command{
+		Use:   "list",
+		Short: "List saved import mappings",
+		Run:   listImportMappings,
+	}
+
+	var mappingShowCmd = &cobra.Command{
+		Use:   "show [name]",
+		Short: "Show a saved import mapping as JSON",
+		Args:  cobra.ExactArgs(1),
+		Run:   showImportMapping,
+	}
+
+	var mappingSaveCmd = &cobra.Command{
+		Use:   "save [name] [file]",
+		Short: "Save an import mapping from a YAML or JSON file, replacing one of the same name",
+		Args:  cobra.ExactArgs(2),
+		Run:   saveImportMapping,
+	}
+
+	var mappingDeleteCmd = &cobra.Command{
+		Use:   "delete [name]",
+		Short: "Delete a saved import mapping",
+		Args:  cobra.ExactArgs(1),
+		Run:   deleteImportMapping,
+	}
+
+	mappingCmd.AddCommand(mappingListCmd, mappingShowCmd, mappingSaveCmd, mappingDeleteCmd)
+
+	return mappingCmd
+}
+
+func listImportMappings(cmd *cobra.Command, args []string) {
+	mappings, err := db.ListImportMappings()
+	if err != nil {
+		fmt.Printf("Error listing import mappings: %v\n", err)
+		return
+	}
+
+	if len(mappings) == 0 {
+		fmt.Println("No import mappings found.")
+		return
+	}
+
+	fmt.Printf("%-30s %-8s %s\n", "Name", "Columns", "Updated")
+	fmt.Println(strings.Repeat("-", 60))
+	for _, mapping := range mappings {
+		fmt.Printf("%-30s %-8d %s\n", mapping.Name, len(mapping.Columns), mapping.UpdatedAt.Format("2006-01-02"))
+	}
+}
+
+func showImportMapping(cmd *cobra.Command, args []string) {
+	mapping, err := db.GetImportMapping(args[0])
+	if err != nil {
+		fmt.Printf("Error getting import mapping: %v\n", err)
+		return
+	}
+
+	data, err := json.MarshalIndent(mapping, "", "  ")
+	if err != nil {
+		fmt.Printf("Error encoding import mapping: %v\n", err)
+		return
+	}
+	fmt.Println(string(data))
+}
+
+func saveImportMapping(cmd *cobra.Command, args []string) {
+	data, err := os.ReadFile(args[1])
+	if err != nil {
+		fmt.Printf("Error reading import mapping: %v\n", err)
+		return
+	}
+	mapping, err := export.ParseMapping(args[0], data)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return
+	}
+
+	if _, err := db.SaveImportMapping(*mapping); err != nil {
+		fmt.Printf("Error saving import mapping: %v\n", err)
+		return
+	}
+	fmt.Printf("Import mapping %s saved.\n", mapping.Name)
+}
+
+func deleteImportMapping(cmd *cobra.Command, args []string) {
+	if err := db.DeleteImportMapping(args[0]); err != nil {
+		fmt.Printf("Error deleting import mapping: %v\n", err)
+		return
+	}
+	fmt.Printf("Import mapping %s deleted.\n", args[0])
+}
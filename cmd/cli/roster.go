@@ -0,0 +1,166 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+
+	"educational-game-db/internal/export/oneroster"
+	"educational-game-db/internal/models"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	rosterMode     string
+	rosterDryRun   bool
+	rosterOutput   string
+	rosterSchoolID int
+)
+
+// newRosterCmd returns the commands syncing and exporting OneRoster bundles
+func newRosterCmd() *cobra.Command {
+	var rosterCmd = &cobra.Command{
+		Use:   "roster",
+		Short: "Sync schools, accounts and classrooms with a OneRoster CSV bundle",
+	}
+
+	var rosterSyncCmd = &cobra.Command{
+		Use:   "sync [zip]",
+		Short: "Sync a OneRoster 1.1 CSV bundle from a student information system",
+		Long: "Sync the orgs, users, classes and enrollments of a OneRoster 1.1 CSV bundle.\n" +
+			"Records are matched by sourcedId, and records made before the first sync by\n" +
+			"name or email. Any error stops the whole sync, and --dry-run reports what\n" +
+			"would happen without saving.\n\n" +
+			"A full sync also deactivates the students of the synced schools the bundle\n" +
+			"leaves out and removes their synced classes and enrollments it leaves out.\n" +
+			"A delta sync only applies the records given, removing those marked\n" +
+			"tobedeleted. The mode defaults to what the bundle's manifest says.",
+		Args: cobra.ExactArgs(1),
+		Run:  syncRoster,
+	}
+	rosterSyncCmd.Flags().StringVar(&rosterMode, "mode", "", "Sync mode: full or delta (default from the manifest)")
+	rosterSyncCmd.Flags().BoolVar(&rosterDryRun, "dry-run", false, "Check and report the sync without saving anything")
+
+	var rosterExportCmd = &cobra.Command{
+		Use:   "export",
+		Short: "Export schools, accounts and classrooms as a OneRoster 1.1 CSV bundle",
+		Run:   exportRoster,
+	}
+	rosterExportCmd.Flags().StringVarP(&rosterOutput, "output", "o", "oneroster.zip", "Zip file to write")
+	rosterExportCmd.Flags().IntVar(&rosterSchoolID, "school-id", 0, "Only export the school with this ID")
+
+	rosterCmd.AddCommand(rosterSyncCmd, rosterExportCmd)
+
+	return rosterCmd
+}
+
+func syncRoster(cmd *cobra.Command, args []string) {
+	if rosterMode != "" && !models.IsValidRosterSyncMode(rosterMode) {
+		fmt.Printf("Error: --mode must be %s or %s\n", models.RosterSyncFull, models.RosterSyncDelta)
+		return
+	}
+
+	file, err := os.Open(args[0])
+	if err != nil {
+		fmt.Printf("Error opening bundle: %v\n", err)
+		return
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		fmt.Printf("Error opening bundle: %v\n", err)
+		return
+	}
+
+	bundle, err := oneroster.ReadBundle(file, info.Size())
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return
+	}
+	report, err := oneroster.NewService(db).Sync(bundle, models.RosterSyncOptions{Mode: rosterMode, DryRun: rosterDryRun})
+	if err != nil {
+		fmt.Printf("Error syncing roster: %v\n", err)
+		return
+	}
+
+	switch {
+	case len(report.Errors) > 0:
+		fmt.Printf("Nothing was synced: the %s sync found errors.\n", report.Mode)
+	case report.DryRun:
+		fmt.Printf("Dry run of a %s sync; nothing was saved.\n", report.Mode)
+	default:
+		fmt.Printf("Synced a %s roster.\n", report.Mode)
+	}
+	if len(report.Errors) == 0 {
+		for _, kind := range []struct {
+			name   string
+			counts models.RosterSyncCounts
+		}{
+			{"Schools", report.Schools}, {"Users", report.Users}, {"Classes", report.Classes}, {"Enrollments", report.Enrollments},
+		} {
+			fmt.Printf("  %-12s %d created, %d updated, %d unchanged, %d removed, %d skipped\n", kind.name+":",
+				kind.counts.Created, kind.counts.Updated, kind.counts.Unchanged, kind.counts.Removed, kind.counts.Skipped)
+		}
+	}
+	for _, change := range report.Changes {
+		switch {
+		case change.Action == models.ImportCreated:
+			continue
+		case change.Line > 0:
+			fmt.Printf("  %s line %d: %s %s\n", oneroster.UsersFile, change.Line, change.Action, change.Username)
+		default:
+			fmt.Printf("  %s %s\n", change.Action, change.Username)
+		}
+		for _, field := range change.Fields {
+			fmt.Printf("    %s: %#v -> %#v\n", field.Field, field.Old, field.New)
+		}
+	}
+	for _, problem := range report.Errors {
+		fmt.Printf("  %s\n", rosterProblem(problem))
+	}
+	for _, problem := range report.Warnings {
+		fmt.Printf("  Warning: %s\n", rosterProblem(problem))
+	}
+}
+
+// rosterProblem describes an error or warning of a roster sync
+func rosterProblem(problem models.RosterSyncProblem) string {
+	where := problem.File
+	if problem.Line > 0 {
+		where += fmt.Sprintf(" line %d", problem.Line)
+	}
+	if problem.Field != "" {
+		where += ": " + problem.Field
+	}
+	return where + ": " + problem.Message
+}
+
+func exportRoster(cmd *cobra.Command, args []string) {
+	var schoolID *int
+	if rosterSchoolID > 0 {
+		schoolID = &rosterSchoolID
+	}
+
+	file, err := os.Create(rosterOutput)
+	if err != nil {
+		fmt.Printf("Error creating export file: %v\n", err)
+		return
+	}
+	out := bufio.NewWriter(file)
+	err = oneroster.NewService(db).WriteBundle(out, schoolID)
+	if err == nil {
+		err = out.Flush()
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		// Leave no partial export behind
+		os.Remove(rosterOutput)
+		fmt.Printf("Error exporting roster: %v\n", err)
+		return
+	}
+
+	fmt.Printf("Exported the roster to %s\n", rosterOutput)
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+
+	"educational-game-db/internal/auth/oidctest"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	mockIdPPort       string
+	mockIdPClientID   string
+	mockIdPSecret     string
+	mockIdPSubject    string
+	mockIdPEmail      string
+	mockIdPGivenName  string
+	mockIdPFamilyName string
+)
+
+// newUnlinkSSOCmd returns the command unlinking an account from its single sign-on identity
+func newUnlinkSSOCmd() *cobra.Command {
+	var unlinkSSOCmd = &cobra.Command{
+		Use:   "unlink-sso [id]",
+		Short: "Unlink an account from its single sign-on identity",
+		Args:  cobra.ExactArgs(1),
+		Run:   unlinkSSO,
+	}
+
+	return unlinkSSOCmd
+}
+
+// newMockIdPCmd returns the command running a mock identity provider
+func newMockIdPCmd() *cobra.Command {
+	var mockIdPCmd = &cobra.Command{
+		Use:   "mock-idp",
+		Short: "Run a local OpenID Connect provider that signs everyone in as one user, for development",
+		// Needs no database
+		PersistentPreRun: func(cmd *cobra.Command, args []string) {},
+		Run:              startMockIdP,
+	}
+	mockIdPCmd.Flags().StringVar(&mockIdPPort, "port", "9000", "Port to listen on")
+	mockIdPCmd.Flags().StringVar(&mockIdPClientID, "client-id", "educational-game-db", "Client ID to accept")
+	mockIdPCmd.Flags().StringVar(&mockIdPSecret, "client-secret", "secret", "Client secret to accept")
+	mockIdPCmd.Flags().StringVar(&mockIdPSubject, "sub", "mock-student-1", "Subject of the signed in user")
+	mockIdPCmd.Flags().StringVar(&mockIdPEmail, "email", "student@example.com", "Verified email of the signed in user")
+	mockIdPCmd.Flags().StringVar(&mockIdPGivenName, "given-name", "Mock", "First name of the signed in user")
+	mockIdPCmd.Flags().StringVar(&mockIdPFamilyName, "family-name", "Student", "Last name of the signed in user")
+
+	return mockIdPCmd
+}
+
+func unlinkSSO(cmd *cobra.Command, args []string) {
+	id, err := strconv.Atoi(args[0])
+	if err != nil {
+		fmt.Printf("Invalid account ID: %v\n", err)
+		return
+	}
+
+	account, err := db.GetAccountByID(id)
+	if err != nil {
+		fmt.Printf("Error getting account: %v\n", err)
+		return
+	}
+
+	unlinked, err := db.UnlinkOIDCSubject(account.ID)
+	if err != nil {
+		fmt.Printf("Error unlinking account: %v\n", err)
+		return
+	}
+	if !unlinked {
+		fmt.Printf("%s is not linked to a single sign-on identity.\n", account.Username)
+		return
+	}
+
+	fmt.Printf("Single sign-on identity unlinked from %s.\n", account.Username)
+	fmt.Println("Its next single sign-on links it again if the verified email still matches.")
+}
+
+func startMockIdP(cmd *cobra.Command, args []string) {
+	issuer := "http://localhost:" + mockIdPPort
+	provider, err := oidctest.NewProvider(issuer, mockIdPClientID, mockIdPSecret)
+	if err != nil {
+		log.Fatalf("Failed to create mock identity provider: %v", err)
+	}
+	provider.SetUser(map[string]interface{}{
+		"sub":            mockIdPSubject,
+		"email":          mockIdPEmail,
+		"email_verified": true,
+		"given_name":     mockIdPGivenName,
+		"family_name":    mockIdPFamilyName,
+	})
+
+	fmt.Printf("Mock identity provider at %s signs everyone in as %s\n", issuer, mockIdPEmail)
+	fmt.Printf("Start the server with --oidc-issuer %s --oidc-client-id %s\n", issuer, mockIdPClientID)
+	if err := http.ListenAndServe("localhost:"+mockIdPPort, provider); err != nil {
+		log.Fatalf("Mock identity provider stopped: %v", err)
+	}
+}
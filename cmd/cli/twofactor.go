@@ -0,0 +1,42 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/spf13/cobra"
+)
+
+// newResetTwoFactorCmd returns the command removing an account's second factor
+func newResetTwoFactorCmd() *cobra.Command {
+	var resetTwoFactorCmd = &cobra.Command{
+		Use:   "reset-2fa [id]",
+		Short: "Remove an account's second factor, e.g. after a lost phone",
+		Args:  cobra.ExactArgs(1),
+		Run:   resetTwoFactor,
+	}
+
+	return resetTwoFactorCmd
+}
+
+func resetTwoFactor(cmd *cobra.Command, args []string) {
+	id, err := strconv.Atoi(args[0])
+	if err != nil {
+		fmt.Printf("Invalid account ID: %v\n", err)
+		return
+	}
+
+	account, err := db.GetAccountByID(id)
+	if err != nil {
+		fmt.Printf("Error getting account: %v\n", err)
+		return
+	}
+
+	if err := db.DisableTwoFactor(account.ID); err != nil {
+		fmt.Printf("Error resetting two-factor authentication: %v\n", err)
+		return
+	}
+
+	fmt.Printf("Two-factor authentication removed for %s.\n", account.Username)
+	fmt.Println("The account can log in with its password and enroll a new authenticator.")
+}
@@ -0,0 +1,109 @@
+package achievements
+
+import (
+	"testing"
+
+	"educational-game-db/internal/database"
+	"educational-game-db/internal/models"
+)
+
+func TestDefaultCatalogIsValid(t *testing.T) {
+	catalog, err := DefaultCatalog()
+	if err != nil {
+		t.Fatalf("Built-in badges failed to load: %v", err)
+	}
+	if len(catalog.Badges) == 0 {
+		t.Fatal("Expected built-in badges")
+	}
+}
+
+func TestParseRejectsInvalidCatalogs(t *testing.T) {
+	catalogs := map[string]string{
+		"duplicate id":      `{"badges": [{"id": "a", "name": "A", "rule": {"type": "manual"}}, {"id": "a", "name": "B", "rule": {"type": "manual"}}]}`,
+		"unknown rule":      `{"badges": [{"id": "a", "name": "A", "rule": {"type": "telepathy"}}]}`,
+		"missing threshold": `{"badges": [{"id": "a", "name": "A", "rule": {"type": "level"}}]}`,
+	}
+
+	for name, data := range catalogs {
+		if _, err := Parse([]byte(data)); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
+
+func TestEngineAwardsEarnedBadgesOnce(t *testing.T) {
+	db, err := database.NewDatabase(":memory:")
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	defer db.Close()
+
+	catalog, err := Parse([]byte(`
+badges:
+  - id: first-steps
+    name: First Steps
+    rule: {type: experience, threshold: 1}
+  - id: three-games
+    name: Three Games
+    rule: {type: events, source: game, threshold: 3}
+  - id: helper
+    name: Helper
+    rule: {type: manual}
+`))
+	if err != nil {
+		t.Fatalf("Failed to parse catalog: %v", err)
+	}
+	engine := NewEngine(catalog, db)
+
+	account, err := db.CreateAccount(models.CreateAccountRequest{
+		Username: "badger", Email: "badger@example.com", Password: "password123",
+	})
+	if err != nil {
+		t.Fatalf("Failed to create account: %v", err)
+	}
+
+	if awarded, err := engine.Evaluate(account.ID); err != nil || len(awarded) != 0 {
+		t.Fatalf("Expected no badges for a new account, got %v, %v", awarded, err)
+	}
+
+	var awardedIDs []string
+	for i := 0; i < 3; i++ {
+		if _, _, err := db.RecordXPEvent(models.XPEvent{AccountID: account.ID, Amount: 10, Source: "game"}); err != nil {
+			t.Fatalf("Failed to record XP: %v", err)
+		}
+		awarded, err := engine.Evaluate(account.ID)
+		if err != nil {
+			t.Fatalf("Failed to evaluate: %v", err)
+		}
+		for _, badge := range awarded {
+			awardedIDs = append(awardedIDs, badge.ID)
+		}
+	}
+	if len(awardedIDs) != 2 || awardedIDs[0] != "first-steps" || awardedIDs[1] != "three-games" {
+		t.Errorf("Expected first-steps then three-games, got %v", awardedIDs)
+	}
+
+	teacher, err := db.CreateAccount(models.CreateAccountRequest{
+		Username: "teacher", Email: "teacher@example.com", Password: "password123",
+	})
+	if err != nil {
+		t.Fatalf("Failed to create account: %v", err)
+	}
+	if added, err := engine.Award(account.ID, "helper", &teacher.ID, "Helped a classmate"); err != nil || !added {
+		t.Fatalf("Expected manual award to succeed, got %v, %v", added, err)
+	}
+	if added, _ := engine.Award(account.ID, "helper", &teacher.ID, ""); added {
+		t.Error("Expected a second award of the same badge to be ignored")
+	}
+	if _, err := engine.Award(account.ID, "no-such-badge", nil, ""); err == nil {
+		t.Error("Expected unknown badges to be rejected")
+	}
+
+	earned, err := engine.Earned(account.ID)
+	if err != nil {
+		t.Fatalf("Failed to get earned badges: %v", err)
+	}
+	if len(earned) != 3 || earned[2].Name != "Helper" || *earned[2].AwardedBy != teacher.ID {
+		t.Errorf("Unexpected earned badges: %+v", earned)
+	}
+}
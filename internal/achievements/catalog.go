@@ -0,0 +1,115 @@
+// Package achievements defines badges and awards them to accounts when
+// their rules are met
+package achievements
+
+import (
+	_ "embed"
+	"fmt"
+	"os"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Rule types a badge can be earned by
+const (
+	RuleExperience      = "experience"
+	RuleLevel           = "level"
+	RuleEvents          = "events"
+	RuleProfileComplete = "profile_complete"
+	RuleManual          = "manual"
+)
+
+//go:embed badges.yaml
+var defaultCatalog []byte
+
+// Rule decides when a badge is earned
+type Rule struct {
+	Type      string `yaml:"type" json:"type"`
+	Threshold int    `yaml:"threshold,omitempty" json:"threshold,omitempty"`
+	// Source limits an events rule to ledger entries from one source
+	Source string `yaml:"source,omitempty" json:"source,omitempty"`
+}
+
+// Badge is one achievement definition
+type Badge struct {
+	ID          string `yaml:"id" json:"id"`
+	Name        string `yaml:"name" json:"name"`
+	Description string `yaml:"description" json:"description"`
+	Icon        string `yaml:"icon,omitempty" json:"icon,omitempty"`
+	Rule        Rule   `yaml:"rule" json:"rule"`
+}
+
+// Catalog is the set of badges that can be earned
+type Catalog struct {
+	Badges []Badge `yaml:"badges" json:"badges"`
+	byID   map[string]*Badge
+}
+
+// DefaultCatalog returns the built-in badges
+func DefaultCatalog() (*Catalog, error) {
+	return Parse(defaultCatalog)
+}
+
+// LoadCatalog reads badge definitions from a YAML or JSON file, or returns
+// the built-in badges when path is empty
+func LoadCatalog(path string) (*Catalog, error) {
+	if path == "" {
+		return DefaultCatalog()
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read badge catalog: %w", err)
+	}
+	return Parse(data)
+}
+
+// Parse decodes and validates badge definitions. JSON is accepted as it is
+// a subset of YAML.
+func Parse(data []byte) (*Catalog, error) {
+	var catalog Catalog
+	if err := yaml.Unmarshal(data, &catalog); err != nil {
+		return nil, fmt.Errorf("failed to parse badge catalog: %w", err)
+	}
+
+	catalog.byID = make(map[string]*Badge, len(catalog.Badges))
+	for i := range catalog.Badges {
+		badge := &catalog.Badges[i]
+		if err := badge.validate(); err != nil {
+			return nil, err
+		}
+		if _, exists := catalog.byID[badge.ID]; exists {
+			return nil, fmt.Errorf("duplicate badge id %q", badge.ID)
+		}
+		catalog.byID[badge.ID] = badge
+	}
+
+	return &catalog, nil
+}
+
+func (b *Badge) validate() error {
+	if b.ID == "" {
+		return fmt.Errorf("badge %q has no id", b.Name)
+	}
+	if b.Name == "" {
+		return fmt.Errorf("badge %q has no name", b.ID)
+	}
+
+	switch b.Rule.Type {
+	case RuleExperience, RuleLevel, RuleEvents:
+		if b.Rule.Threshold <= 0 {
+			return fmt.Errorf("badge %q needs a positive threshold", b.ID)
+		}
+	case RuleProfileComplete, RuleManual:
+	default:
+		return fmt.Errorf("badge %q has unknown rule type %q", b.ID, b.Rule.Type)
+	}
+
+	return nil
+}
+
+// Badge looks up a badge by ID
+func (c *Catalog) Badge(id string) (*Badge, bool) {
+	badge, ok := c.byID[id]
+	return badge, ok
+}
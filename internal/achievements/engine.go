@@ -0,0 +1,161 @@
+package achievements
+
+import (
+	"fmt"
+	"time"
+
+	"educational-game-db/internal/models"
+)
+
+// Store is what the engine needs from the database
+type Store interface {
+	GetAccountByID(id int) (*models.Account, error)
+	CountXPEvents(accountID int) (map[string]int, error)
+	GetAccountAchievements(accountID int) ([]models.Achievement, error)
+	AwardAchievement(achievement models.Achievement) (bool, error)
+}
+
+// EarnedBadge is an awarded achievement together with its badge definition
+type EarnedBadge struct {
+	Badge
+	AwardedAt time.Time `json:"awarded_at"`
+	AwardedBy *int      `json:"awarded_by,omitempty"`
+	Note      string    `json:"note,omitempty"`
+}
+
+// Engine evaluates badge rules against accounts and awards the badges earned
+type Engine struct {
+	catalog *Catalog
+	store   Store
+}
+
+// NewEngine creates a badge engine over a catalog
+func NewEngine(catalog *Catalog, store Store) *Engine {
+	return &Engine{catalog: catalog, store: store}
+}
+
+// Catalog returns the badges the engine knows
+func (e *Engine) Catalog() *Catalog {
+	return e.catalog
+}
+
+// Evaluate awards every automatic badge the account has newly earned and
+// returns them. Call it after anything that can change the facts rules look
+// at: experience being recorded, the account being created or its profile edited.
+func (e *Engine) Evaluate(accountID int) ([]Badge, error) {
+	account, err := e.store.GetAccountByID(accountID)
+	if err != nil {
+		return nil, err
+	}
+
+	held, err := e.held(accountID)
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		counts  map[string]int
+		awarded []Badge
+	)
+	for _, badge := range e.catalog.Badges {
+		if held[badge.ID] || badge.Rule.Type == RuleManual {
+			continue
+		}
+
+		if badge.Rule.Type == RuleEvents && counts == nil {
+			if counts, err = e.store.CountXPEvents(accountID); err != nil {
+				return nil, err
+			}
+		}
+		if !badge.Rule.met(account, counts) {
+			continue
+		}
+
+		added, err := e.store.AwardAchievement(models.Achievement{AccountID: accountID, BadgeID: badge.ID})
+		if err != nil {
+			return nil, err
+		}
+		if added {
+			awarded = append(awarded, badge)
+		}
+	}
+
+	return awarded, nil
+}
+
+// Award gives a badge to an account by hand, whatever its rule. It reports
+// false when the account already holds the badge.
+func (e *Engine) Award(accountID int, badgeID string, awardedBy *int, note string) (bool, error) {
+	if _, ok := e.catalog.Badge(badgeID); !ok {
+		return false, fmt.Errorf("unknown badge %q", badgeID)
+	}
+
+	return e.store.AwardAchievement(models.Achievement{
+		AccountID: accountID,
+		BadgeID:   badgeID,
+		AwardedBy: awardedBy,
+		Note:      note,
+	})
+}
+
+// Earned returns the badges of an account with their definitions. Badges
+// since removed from the catalog are listed under their ID.
+func (e *Engine) Earned(accountID int) ([]EarnedBadge, error) {
+	achievements, err := e.store.GetAccountAchievements(accountID)
+	if err != nil {
+		return nil, err
+	}
+
+	earned := make([]EarnedBadge, 0, len(achievements))
+	for _, achievement := range achievements {
+		badge, ok := e.catalog.Badge(achievement.BadgeID)
+		if !ok {
+			badge = &Badge{ID: achievement.BadgeID, Name: achievement.BadgeID}
+		}
+		earned = append(earned, EarnedBadge{
+			Badge:     *badge,
+			AwardedAt: achievement.AwardedAt,
+			AwardedBy: achievement.AwardedBy,
+			Note:      achievement.Note,
+		})
+	}
+
+	return earned, nil
+}
+
+func (e *Engine) held(accountID int) (map[string]bool, error) {
+	achievements, err := e.store.GetAccountAchievements(accountID)
+	if err != nil {
+		return nil, err
+	}
+
+	held := make(map[string]bool, len(achievements))
+	for _, achievement := range achievements {
+		held[achievement.BadgeID] = true
+	}
+	return held, nil
+}
+
+// met reports whether an account satisfies the rule. counts holds the
+// account's ledger entries per source and is only needed by events rules.
+func (r Rule) met(account *models.Account, counts map[string]int) bool {
+	switch r.Type {
+	case RuleExperience:
+		return account.Experience >= r.Threshold
+	case RuleLevel:
+		return account.GameLevel >= r.Threshold
+	case RuleEvents:
+		if r.Source != "" {
+			return counts[r.Source] >= r.Threshold
+		}
+		total := 0
+		for _, n := range counts {
+			total += n
+		}
+		return total >= r.Threshold
+	case RuleProfileComplete:
+		return account.FirstName != "" && account.LastName != "" && account.School != ""
+	default:
+		return false
+	}
+}
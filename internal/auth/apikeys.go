@@ -0,0 +1,43 @@
+package auth
+
+import (
+	"fmt"
+	"strings"
+)
+
+const (
+	// apiKeyPrefix marks strings as API keys so they are easy to spot in logs and secret scanners
+	apiKeyPrefix = "egdb_"
+	// apiKeyDisplayLength is how much of a key is kept in clear for identification
+	apiKeyDisplayLength = len(apiKeyPrefix) + 8
+)
+
+// GenerateAPIKey returns a new random API key and the prefix stored for display
+func GenerateAPIKey() (key string, prefix string, err error) {
+	secret, err := RandomToken(32)
+	if err != nil {
+		return "", "", err
+	}
+
+	key = apiKeyPrefix + secret
+	return key, key[:apiKeyDisplayLength], nil
+}
+
+// ParseScopes validates a comma or space separated list of scopes
+func ParseScopes(list string) ([]string, error) {
+	fields := strings.FieldsFunc(list, func(r rune) bool { return r == ',' || r == ' ' })
+
+	scopes := make([]string, 0, len(fields))
+	for _, field := range fields {
+		if !IsValidPermission(Permission(field)) {
+			return nil, fmt.Errorf("unknown scope: %s", field)
+		}
+		scopes = append(scopes, field)
+	}
+
+	if len(scopes) == 0 {
+		return nil, fmt.Errorf("at least one scope is required")
+	}
+
+	return scopes, nil
+}
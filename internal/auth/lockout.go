@@ -0,0 +1,75 @@
+package auth
+
+import "time"
+
+// LockoutPolicy decides how long logins are refused after repeated failures.
+// The first FreeAttempts failures cost nothing; each further failure delays
+// the next attempt by Backoff, doubling every time, until Threshold failures
+// lock logins out for Lockout, which keeps doubling up to MaxLockout.
+// Failures older than Window are forgotten.
+type LockoutPolicy struct {
+	FreeAttempts int
+	Backoff      time.Duration
+	Threshold    int
+	Lockout      time.Duration
+	MaxLockout   time.Duration
+	Window       time.Duration
+}
+
+// LoginLimits holds the lockout policies applied per username and per client IP
+type LoginLimits struct {
+	Username LockoutPolicy
+	IP       LockoutPolicy
+}
+
+// DefaultLoginLimits are generous enough for a classroom sharing one address
+// to mistype passwords, but stop guessing well before it gets anywhere
+var DefaultLoginLimits = LoginLimits{
+	Username: LockoutPolicy{
+		FreeAttempts: 3,
+		Backoff:      2 * time.Second,
+		Threshold:    8,
+		Lockout:      15 * time.Minute,
+		MaxLockout:   24 * time.Hour,
+		Window:       24 * time.Hour,
+	},
+	IP: LockoutPolicy{
+		FreeAttempts: 20,
+		Backoff:      time.Second,
+		Threshold:    100,
+		Lockout:      15 * time.Minute,
+		MaxLockout:   24 * time.Hour,
+		Window:       time.Hour,
+	},
+}
+
+// Delay returns how long logins are refused after the given number of
+// consecutive failures
+func (p LockoutPolicy) Delay(failures int) time.Duration {
+	if failures <= p.FreeAttempts {
+		return 0
+	}
+
+	if p.Threshold <= 0 || failures < p.Threshold {
+		return doubled(p.Backoff, failures-p.FreeAttempts-1, p.Lockout)
+	}
+
+	return doubled(p.Lockout, failures-p.Threshold, p.MaxLockout)
+}
+
+// doubled returns base doubled n times, capped at limit, or at a year when
+// no limit is set
+func doubled(base time.Duration, n int, limit time.Duration) time.Duration {
+	if limit <= 0 {
+		limit = 365 * 24 * time.Hour
+	}
+
+	d := base
+	for i := 0; i < n && d < limit; i++ {
+		d *= 2
+	}
+	if d > limit {
+		return limit
+	}
+	return d
+}
@@ -0,0 +1,32 @@
+package auth
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLockoutPolicyDelay(t *testing.T) {
+	policy := LockoutPolicy{
+		FreeAttempts: 2,
+		Backoff:      time.Second,
+		Threshold:    5,
+		Lockout:      time.Minute,
+		MaxLockout:   3 * time.Minute,
+	}
+
+	expected := map[int]time.Duration{
+		0:   0,
+		2:   0,
+		3:   time.Second,
+		4:   2 * time.Second,
+		5:   time.Minute,
+		6:   2 * time.Minute,
+		7:   3 * time.Minute,
+		100: 3 * time.Minute,
+	}
+	for failures, want := range expected {
+		if got := policy.Delay(failures); got != want {
+			t.Errorf("Delay(%d) = %v, want %v", failures, got, want)
+		}
+	}
+}
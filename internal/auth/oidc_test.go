@@ -0,0 +1,164 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"educational-game-db/internal/auth/oidctest"
+)
+
+// signIn follows the authorization redirect of the mock provider and
+// returns the code and state sent back to the callback
+func signIn(t *testing.T, authURL string) (string, string) {
+	t.Helper()
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}}
+	resp, err := client.Get(authURL)
+	if err != nil {
+		t.Fatalf("Failed to reach authorization endpoint: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusFound {
+		t.Fatalf("Expected a redirect back to the callback, got %d", resp.StatusCode)
+	}
+
+	callback, err := url.Parse(resp.Header.Get("Location"))
+	if err != nil {
+		t.Fatalf("Invalid callback URL: %v", err)
+	}
+	return callback.Query().Get("code"), callback.Query().Get("state")
+}
+
+func TestOIDCProviderExchange(t *testing.T) {
+	idp, server, err := oidctest.NewServer("game", "shh")
+	if err != nil {
+		t.Fatalf("Failed to start mock provider: %v", err)
+	}
+	defer server.Close()
+	idp.SetUser(map[string]interface{}{
+		"sub": "district-42", "email": "ada@district.example", "email_verified": true, "given_name": "Ada",
+	})
+
+	ctx := context.Background()
+	provider, err := NewOIDCProvider(ctx, OIDCConfig{
+		Issuer: server.URL, ClientID: "game", ClientSecret: "shh", RedirectURL: "http://localhost/api/sso/callback",
+	})
+	if err != nil {
+		t.Fatalf("Failed to discover provider: %v", err)
+	}
+
+	verifier, _ := NewPKCEVerifier()
+	code, state := signIn(t, provider.AuthCodeURL("state-1", "nonce-1", verifier))
+	if state != "state-1" {
+		t.Errorf("Expected the state to come back, got %q", state)
+	}
+
+	if _, err := provider.Exchange(ctx, code, "wrong-verifier", "nonce-1"); err == nil {
+		t.Error("Expected a wrong PKCE verifier to be refused")
+	}
+
+	code, _ = signIn(t, provider.AuthCodeURL("state-2", "nonce-2", verifier))
+	if _, err := provider.Exchange(ctx, code, verifier, "nonce-1"); !errors.Is(err, ErrInvalidIDToken) {
+		t.Errorf("Expected a nonce mismatch to be refused, got %v", err)
+	}
+
+	code, _ = signIn(t, provider.AuthCodeURL("state-3", "nonce-3", verifier))
+	identity, err := provider.Exchange(ctx, code, verifier, "nonce-3")
+	if err != nil {
+		t.Fatalf("Failed to exchange code: %v", err)
+	}
+	if identity.Subject != "district-42" || identity.Email != "ada@district.example" || !identity.EmailVerified || identity.GivenName != "Ada" {
+		t.Errorf("Unexpected identity: %+v", identity)
+	}
+
+	if _, err := provider.Exchange(ctx, code, verifier, "nonce-3"); err == nil {
+		t.Error("Expected an authorization code to work only once")
+	}
+}
+
+func TestOIDCProviderVerifyIDToken(t *testing.T) {
+	idp, server, err := oidctest.NewServer("game", "shh")
+	if err != nil {
+		t.Fatalf("Failed to start mock provider: %v", err)
+	}
+	defer server.Close()
+
+	ctx := context.Background()
+	provider, err := NewOIDCProvider(ctx, OIDCConfig{Issuer: server.URL, ClientID: "game", RedirectURL: "http://localhost/cb"})
+	if err != nil {
+		t.Fatalf("Failed to discover provider: %v", err)
+	}
+
+	other, _ := oidctest.NewProvider(server.URL, "game", "shh")
+	forged, _ := other.SignIDToken(map[string]interface{}{"sub": "intruder"}, "n")
+	if _, err := provider.verifyIDToken(ctx, forged, "n"); !errors.Is(err, ErrInvalidIDToken) {
+		t.Errorf("Expected a token signed with another key to be refused, got %v", err)
+	}
+
+	wrongAudience, _ := idp.SignIDToken(map[string]interface{}{"sub": "someone", "aud": "other-app"}, "n")
+	if _, err := provider.verifyIDToken(ctx, wrongAudience, "n"); !errors.Is(err, ErrInvalidIDToken) {
+		t.Errorf("Expected a token for another client to be refused, got %v", err)
+	}
+
+	expired, _ := idp.SignIDToken(map[string]interface{}{"sub": "someone", "exp": 1}, "n")
+	if _, err := provider.verifyIDToken(ctx, expired, "n"); !errors.Is(err, ErrInvalidIDToken) {
+		t.Errorf("Expected an expired token to be refused, got %v", err)
+	}
+
+	valid, _ := idp.SignIDToken(map[string]interface{}{"sub": "someone", "email_verified": "true"}, "n")
+	identity, err := provider.verifyIDToken(ctx, valid, "n")
+	if err != nil || identity.Subject != "someone" || !identity.EmailVerified {
+		t.Errorf("Expected a valid token to verify, got %+v, %v", identity, err)
+	}
+}
+
+// countingTransport counts the requests made for a path
+type countingTransport struct {
+	path string
+	n    int
+}
+
+func (t *countingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.URL.Path == t.path {
+		t.n++
+	}
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+func TestOIDCProviderKeyRefetchLimit(t *testing.T) {
+	_, server, err := oidctest.NewServer("game", "shh")
+	if err != nil {
+		t.Fatalf("Failed to start mock provider: %v", err)
+	}
+	defer server.Close()
+
+	ctx := context.Background()
+	provider, err := NewOIDCProvider(ctx, OIDCConfig{Issuer: server.URL, ClientID: "game", RedirectURL: "http://localhost/cb"})
+	if err != nil {
+		t.Fatalf("Failed to discover provider: %v", err)
+	}
+	jwks, _ := url.Parse(provider.jwksURL)
+	transport := &countingTransport{path: jwks.Path}
+	provider.client = &http.Client{Transport: transport}
+
+	if _, err := provider.publicKey(ctx, "oidctest"); err != nil {
+		t.Fatalf("Expected the provider's key, got %v", err)
+	}
+	for _, kid := range []string{"made-up-1", "made-up-2", "made-up-3"} {
+		if _, err := provider.publicKey(ctx, kid); err == nil {
+			t.Errorf("Expected unknown key %s to be refused", kid)
+		}
+	}
+	if transport.n != 1 {
+		t.Errorf("Expected unknown keys not to refetch the key set within a minute, got %d fetches", transport.n)
+	}
+
+	provider.fetchedAt = provider.fetchedAt.Add(-keyRefetchInterval)
+	if _, err := provider.publicKey(ctx, "made-up-4"); err == nil || transport.n != 2 {
+		t.Errorf("Expected the key set to be fetched again after a minute, got %d fetches, %v", transport.n, err)
+	}
+}
@@ -0,0 +1,182 @@
+package auth
+
+import (
+	"bufio"
+	"crypto/rand"
+	_ "embed"
+	"fmt"
+	"io"
+	"math/big"
+	"strings"
+
+	"educational-game-db/internal/models"
+)
+
+//go:embed common_passwords.txt
+var commonPasswords string
+
+//go:embed passphrase_words.txt
+var passphraseWords string
+
+const (
+	// DefaultPasswordMinLength is the shortest password accepted by default
+	DefaultPasswordMinLength = 8
+	// DefaultYoungPasswordMinLength is the shortest password accepted by
+	// default from students in young grades
+	DefaultYoungPasswordMinLength = 6
+	// DefaultYoungGradeMax is the highest grade treated as young by default
+	DefaultYoungGradeMax = 3
+	// PasswordMaxLength is the most bcrypt looks at; longer passwords would
+	// silently match on their first 72 bytes
+	PasswordMaxLength = 72
+	// PassphraseWords is the number of words in a generated passphrase
+	PassphraseWords = 3
+
+	// personalInfoMinLength is the shortest username or name that passwords
+	// may not contain; shorter ones would refuse too many passwords
+	personalInfoMinLength = 3
+)
+
+// PasswordPolicy decides which passwords accounts may choose
+type PasswordPolicy struct {
+	MinLength int
+	// YoungMinLength applies instead of MinLength to students in grades 1 to
+	// YoungGradeMax, who are better served by a short passphrase
+	YoungMinLength int
+	YoungGradeMax  int
+	// ForbidPersonalInfo refuses passwords containing the account's username,
+	// the name part of its email address, or its first or last name
+	ForbidPersonalInfo bool
+
+	blocked map[string]struct{}
+}
+
+// PasswordError lists the reasons a password was refused
+type PasswordError struct {
+	Problems []string
+}
+
+func (e *PasswordError) Error() string {
+	return "password " + strings.Join(e.Problems, ", ")
+}
+
+// DefaultPasswordPolicy returns the default policy, refusing the built-in
+// list of common passwords
+func DefaultPasswordPolicy() *PasswordPolicy {
+	policy := &PasswordPolicy{
+		MinLength:          DefaultPasswordMinLength,
+		YoungMinLength:     DefaultYoungPasswordMinLength,
+		YoungGradeMax:      DefaultYoungGradeMax,
+		ForbidPersonalInfo: true,
+		blocked:            make(map[string]struct{}),
+	}
+	// The embedded list is known to be readable
+	_ = policy.LoadBlocklist(strings.NewReader(commonPasswords))
+	return policy
+}
+
+// LoadBlocklist adds the passwords in r, one per line, to those refused.
+// Blank lines and lines starting with # are skipped.
+func (p *PasswordPolicy) LoadBlocklist(r io.Reader) error {
+	if p.blocked == nil {
+		p.blocked = make(map[string]struct{})
+	}
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		p.blocked[strings.ToLower(line)] = struct{}{}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("failed to read password blocklist: %w", err)
+	}
+	return nil
+}
+
+// BlocklistSize returns the number of passwords refused outright
+func (p *PasswordPolicy) BlocklistSize() int {
+	return len(p.blocked)
+}
+
+// IsYoung reports whether the policy treats a grade as young
+func (p *PasswordPolicy) IsYoung(grade int) bool {
+	return grade > 0 && grade <= p.YoungGradeMax
+}
+
+// Check returns a *PasswordError if account may not use password. Only the
+// account's username, email, names and grade are looked at, so it can be
+// checked before the account exists.
+func (p *PasswordPolicy) Check(password string, account *models.Account) error {
+	var problems []string
+
+	minLength := p.MinLength
+	if account.Role == models.RoleStudent || account.Role == "" {
+		if p.IsYoung(account.Grade) && p.YoungMinLength > 0 {
+			minLength = p.YoungMinLength
+		}
+	}
+	if n := len([]rune(password)); n < minLength {
+		problems = append(problems, fmt.Sprintf("must be at least %d characters", minLength))
+	}
+	if len(password) > PasswordMaxLength {
+		problems = append(problems, fmt.Sprintf("must be at most %d bytes", PasswordMaxLength))
+	}
+
+	if _, blocked := p.blocked[strings.ToLower(password)]; blocked {
+		problems = append(problems, "is too common")
+	}
+
+	if p.ForbidPersonalInfo && containsPersonalInfo(password, account) {
+		problems = append(problems, "must not contain your username or name")
+	}
+
+	if len(problems) > 0 {
+		return &PasswordError{Problems: problems}
+	}
+	return nil
+}
+
+func containsPersonalInfo(password string, account *models.Account) bool {
+	emailName, _, _ := strings.Cut(account.Email, "@")
+
+	lower := strings.ToLower(password)
+	for _, info := range []string{account.Username, emailName, account.FirstName, account.LastName} {
+		info = strings.ToLower(strings.TrimSpace(info))
+		if len(info) >= personalInfoMinLength && strings.Contains(lower, info) {
+			return true
+		}
+	}
+	return false
+}
+
+// GeneratePassphrase returns a password made of short everyday words and a
+// number, e.g. "tiger-lemon-sky-42", which young students can read and type
+func GeneratePassphrase() (string, error) {
+	var words []string
+	for _, line := range strings.Split(passphraseWords, "\n") {
+		if line = strings.TrimSpace(line); line != "" && !strings.HasPrefix(line, "#") {
+			words = append(words, line)
+		}
+	}
+
+	parts := make([]string, 0, PassphraseWords+1)
+	max := big.NewInt(int64(len(words)))
+	for i := 0; i < PassphraseWords; i++ {
+		n, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			return "", fmt.Errorf("failed to generate passphrase: %w", err)
+		}
+		parts = append(parts, words[n.Int64()])
+	}
+
+	n, err := rand.Int(rand.Reader, big.NewInt(90))
+	if err != nil {
+		return "", fmt.Errorf("failed to generate passphrase: %w", err)
+	}
+	parts = append(parts, fmt.Sprint(n.Int64()+10))
+
+	return strings.Join(parts, "-"), nil
+}
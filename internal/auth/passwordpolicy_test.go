@@ -0,0 +1,88 @@
+package auth
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"educational-game-db/internal/models"
+)
+
+func TestPasswordPolicyCheck(t *testing.T) {
+	policy := DefaultPasswordPolicy()
+	adult := &models.Account{Username: "jsmith", Email: "john.smith@example.com", FirstName: "John", LastName: "Smith", Role: models.RoleTeacher}
+	young := &models.Account{Username: "jo", Role: models.RoleStudent, Grade: 2}
+
+	tests := []struct {
+		name     string
+		password string
+		account  *models.Account
+		problem  string
+	}{
+		{"long enough", "violet-harbor-72", adult, ""},
+		{"too short", "v1ol3t", adult, "must be at least 8 characters"},
+		{"too long", strings.Repeat("x7", 40), adult, "must be at most 72 bytes"},
+		{"common", "Password123", adult, "is too common"},
+		{"username", "xjsmith-rocks", adult, "must not contain your username or name"},
+		{"email name", "john.smith!!", adult, "must not contain your username or name"},
+		{"last name", "SMITHsmith99", adult, "must not contain your username or name"},
+		{"young student", "tiger7", young, ""},
+		{"young student too short", "tig7", young, "must be at least 6 characters"},
+		{"short names are ignored", "jolly-banjo-4", young, ""},
+	}
+
+	for _, tt := range tests {
+		err := policy.Check(tt.password, tt.account)
+		if tt.problem == "" {
+			if err != nil {
+				t.Errorf("%s: expected the password to be allowed, got %v", tt.name, err)
+			}
+			continue
+		}
+
+		var policyErr *PasswordError
+		if !errors.As(err, &policyErr) {
+			t.Errorf("%s: expected a *PasswordError, got %v", tt.name, err)
+			continue
+		}
+		found := false
+		for _, problem := range policyErr.Problems {
+			found = found || problem == tt.problem
+		}
+		if !found {
+			t.Errorf("%s: expected %q among %v", tt.name, tt.problem, policyErr.Problems)
+		}
+	}
+}
+
+func TestPasswordPolicyBlocklist(t *testing.T) {
+	policy := &PasswordPolicy{MinLength: 1}
+	if err := policy.LoadBlocklist(strings.NewReader("# school words\n\nSchoolName2026\n  mascot  \n")); err != nil {
+		t.Fatalf("Failed to load blocklist: %v", err)
+	}
+	if policy.BlocklistSize() != 2 {
+		t.Errorf("Expected 2 blocked passwords, got %d", policy.BlocklistSize())
+	}
+	if err := policy.Check("schoolname2026", &models.Account{}); err == nil {
+		t.Error("Expected a blocked password to be refused whatever its case")
+	}
+	if err := policy.Check("# school words", &models.Account{}); err != nil {
+		t.Errorf("Expected comments not to be blocked, got %v", err)
+	}
+}
+
+func TestGeneratePassphrase(t *testing.T) {
+	policy := DefaultPasswordPolicy()
+	for i := 0; i < 20; i++ {
+		passphrase, err := GeneratePassphrase()
+		if err != nil {
+			t.Fatalf("Failed to generate passphrase: %v", err)
+		}
+		if parts := strings.Split(passphrase, "-"); len(parts) != PassphraseWords+1 {
+			t.Errorf("Expected %d words and a number, got %q", PassphraseWords, passphrase)
+		}
+		if err := policy.Check(passphrase, &models.Account{Role: models.RoleStudent, Grade: 1}); err != nil {
+			t.Errorf("Expected passphrase %q to pass the policy, got %v", passphrase, err)
+		}
+	}
+}
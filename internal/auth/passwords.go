@@ -0,0 +1,37 @@
+package auth
+
+import (
+	"crypto/rand"
+	"fmt"
+	"math/big"
+)
+
+// temporaryPasswordAlphabet leaves out characters that are easy to misread
+// when a password is read out to a student
+const temporaryPasswordAlphabet = "abcdefghjkmnpqrstuvwxyz23456789"
+
+// TemporaryPasswordLength is the length of passwords handed out by staff
+const TemporaryPasswordLength = 10
+
+// GenerateTemporaryPassword returns a random password for staff to hand to a student
+func GenerateTemporaryPassword() (string, error) {
+	password, err := readableRandom(TemporaryPasswordLength)
+	if err != nil {
+		return "", fmt.Errorf("failed to generate password: %w", err)
+	}
+	return password, nil
+}
+
+// readableRandom returns n random characters from temporaryPasswordAlphabet
+func readableRandom(n int) (string, error) {
+	b := make([]byte, n)
+	max := big.NewInt(int64(len(temporaryPasswordAlphabet)))
+	for i := range b {
+		r, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			return "", err
+		}
+		b[i] = temporaryPasswordAlphabet[r.Int64()]
+	}
+	return string(b), nil
+}
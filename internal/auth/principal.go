@@ -0,0 +1,114 @@
+package auth
+
+import "educational-game-db/internal/models"
+
+// Principal is the authenticated caller of a request: either a logged-in
+// account or a service holding an API key
+type Principal struct {
+	Account *models.Account
+	APIKey  *models.APIKey
+	// Roster holds the IDs of the students a teacher account teaches
+	Roster []int
+}
+
+// Can reports whether the principal holds a permission. Accounts get
+// permissions from their role, API keys from their scopes.
+func (p *Principal) Can(perm Permission) bool {
+	switch {
+	case p.APIKey != nil:
+		return p.APIKey.HasScope(string(perm))
+	case p.Account != nil:
+		return HasPermission(p.Account.Role, perm)
+	default:
+		return false
+	}
+}
+
+// CanAccess reports whether the principal may act on target's record.
+// API keys are not tied to a school, so their scopes alone decide. Teachers
+// are further limited to the students on their roster.
+func (p *Principal) CanAccess(target *models.Account) bool {
+	switch {
+	case p.APIKey != nil:
+		return true
+	case p.Account == nil:
+		return false
+	case p.Account.Role == models.RoleTeacher && p.Account.ID != target.ID && !p.teaches(target.ID):
+		return false
+	default:
+		return CanAccessAccount(p.Account, target)
+	}
+}
+
+func (p *Principal) teaches(studentID int) bool {
+	for _, id := range p.Roster {
+		if id == studentID {
+			return true
+		}
+	}
+	return false
+}
+
+// CanAccessSchool reports whether the principal may act on a school and its
+// classrooms. Superadmins and API keys may act on every school.
+func (p *Principal) CanAccessSchool(schoolID int) bool {
+	switch {
+	case p.APIKey != nil:
+		return true
+	case p.Account == nil:
+		return false
+	case p.Account.Role == models.RoleSuperadmin:
+		return true
+	default:
+		return p.Account.SchoolID != nil && *p.Account.SchoolID == schoolID
+	}
+}
+
+// RestrictListing narrows an account listing to the records the principal
+// may act on. It reports false when nothing the listing asks for is visible.
+func (p *Principal) RestrictListing(opts *models.AccountListOptions) bool {
+	switch {
+	case p.APIKey != nil:
+		return true
+	case p.Account == nil:
+		return false
+	}
+
+	actor := p.Account
+	var visible []string
+	switch actor.Role {
+	case models.RoleSuperadmin:
+		return true
+	case models.RoleSchoolAdmin:
+		visible = []string{models.RoleStudent, models.RoleTeacher, models.RoleSchoolAdmin}
+	case models.RoleTeacher:
+		visible = []string{models.RoleStudent}
+		opts.RosterOf = actor.ID
+	default:
+		return false
+	}
+	if actor.School == "" || (opts.School != "" && opts.School != actor.School) {
+		return false
+	}
+	opts.School = actor.School
+
+	if len(opts.Roles) == 0 {
+		opts.Roles = visible
+		opts.SelfID = actor.ID
+		return true
+	}
+
+	var roles []string
+	for _, role := range opts.Roles {
+		if role == actor.Role {
+			opts.SelfID = actor.ID
+		}
+		for _, v := range visible {
+			if role == v {
+				roles = append(roles, role)
+			}
+		}
+	}
+	opts.Roles = roles
+	return len(roles) > 0 || opts.SelfID != 0
+}
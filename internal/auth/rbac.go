@@ -0,0 +1,104 @@
+package auth
+
+import "educational-game-db/internal/models"
+
+// Permission names an action guarded by role-based access control
+type Permission string
+
+const (
+	PermAccountsList    Permission = "accounts:list"
+	PermAccountsRead    Permission = "accounts:read"
+	PermAccountsWrite   Permission = "accounts:write"
+	PermAccountsDelete  Permission = "accounts:delete"
+	PermStatsRead       Permission = "stats:read"
+	PermExport          Permission = "accounts:export"
+	PermImport          Permission = "accounts:import"
+	PermXPWrite         Permission = "xp:write"
+	PermAwardBadges     Permission = "achievements:award"
+	PermLeaderboards    Permission = "leaderboards:read"
+	PermSchoolsRead     Permission = "schools:read"
+	PermSchoolsWrite    Permission = "schools:write"
+	PermClassroomsWrite Permission = "classrooms:write"
+	PermRosters         Permission = "rosters:manage"
+	PermConsentWrite    Permission = "consent:write"
+	PermChildrenRead    Permission = "children:read"
+	PermSecurity        Permission = "security:manage"
+)
+
+// AllPermissions lists every permission, which are also the valid API key scopes
+var AllPermissions = []Permission{
+	PermAccountsList, PermAccountsRead, PermAccountsWrite, PermAccountsDelete,
+	PermStatsRead, PermExport, PermImport, PermXPWrite, PermAwardBadges,
+	PermLeaderboards, PermSchoolsRead, PermSchoolsWrite, PermClassroomsWrite, PermRosters,
+	PermConsentWrite, PermChildrenRead, PermSecurity,
+}
+
+// IsValidPermission reports whether perm is a known permission
+func IsValidPermission(perm Permission) bool {
+	for _, p := range AllPermissions {
+		if p == perm {
+			return true
+		}
+	}
+	return false
+}
+
+// rolePermissions maps each role to the permissions it is granted.
+// Account-level permissions are further limited by CanAccessAccount.
+var rolePermissions = map[string][]Permission{
+	models.RoleStudent: {
+		PermAccountsRead, PermAccountsWrite, PermLeaderboards,
+	},
+	models.RoleGuardian: {
+		PermAccountsRead, PermAccountsWrite, PermChildrenRead,
+	},
+	models.RoleTeacher: {
+		PermAccountsList, PermAccountsRead, PermAccountsWrite, PermStatsRead, PermXPWrite,
+		PermAwardBadges, PermLeaderboards, PermSchoolsRead, PermRosters, PermConsentWrite,
+	},
+	models.RoleSchoolAdmin: {
+		PermAccountsList, PermAccountsRead, PermAccountsWrite, PermAccountsDelete,
+		PermStatsRead, PermExport, PermImport, PermXPWrite, PermAwardBadges, PermLeaderboards,
+		PermSchoolsRead, PermClassroomsWrite, PermRosters, PermConsentWrite,
+	},
+	models.RoleSuperadmin: {
+		PermAccountsList, PermAccountsRead, PermAccountsWrite, PermAccountsDelete,
+		PermStatsRead, PermExport, PermImport, PermXPWrite, PermAwardBadges, PermLeaderboards,
+		PermSchoolsRead, PermSchoolsWrite, PermClassroomsWrite, PermRosters, PermConsentWrite,
+		PermSecurity,
+	},
+}
+
+// HasPermission reports whether a role is granted a permission
+func HasPermission(role string, perm Permission) bool {
+	for _, p := range rolePermissions[role] {
+		if p == perm {
+			return true
+		}
+	}
+	return false
+}
+
+// CanAccessAccount reports whether actor may act on target's record:
+// students and guardians only on themselves, teachers on students of their school,
+// school admins on non-superadmin accounts of their school, superadmins on everyone.
+func CanAccessAccount(actor, target *models.Account) bool {
+	if actor.ID == target.ID {
+		return true
+	}
+
+	switch actor.Role {
+	case models.RoleSuperadmin:
+		return true
+	case models.RoleSchoolAdmin:
+		return sameSchool(actor, target) && target.Role != models.RoleSuperadmin
+	case models.RoleTeacher:
+		return sameSchool(actor, target) && target.Role == models.RoleStudent
+	default:
+		return false
+	}
+}
+
+func sameSchool(a, b *models.Account) bool {
+	return a.School != "" && a.School == b.School
+}
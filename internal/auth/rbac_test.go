@@ -0,0 +1,76 @@
+package auth
+
+import (
+	"testing"
+
+	"educational-game-db/internal/models"
+)
+
+func TestCanAccessAccount(t *testing.T) {
+	student := &models.Account{ID: 1, Role: models.RoleStudent, School: "School A"}
+	classmate := &models.Account{ID: 2, Role: models.RoleStudent, School: "School A"}
+	otherStudent := &models.Account{ID: 3, Role: models.RoleStudent, School: "School B"}
+	teacher := &models.Account{ID: 4, Role: models.RoleTeacher, School: "School A"}
+	schoolAdmin := &models.Account{ID: 5, Role: models.RoleSchoolAdmin, School: "School A"}
+	superadmin := &models.Account{ID: 6, Role: models.RoleSuperadmin}
+
+	tests := []struct {
+		name   string
+		actor  *models.Account
+		target *models.Account
+		want   bool
+	}{
+		{"student self", student, student, true},
+		{"student classmate", student, classmate, false},
+		{"teacher own school student", teacher, classmate, true},
+		{"teacher other school student", teacher, otherStudent, false},
+		{"teacher school admin", teacher, schoolAdmin, false},
+		{"school admin teacher", schoolAdmin, teacher, true},
+		{"school admin other school", schoolAdmin, otherStudent, false},
+		{"school admin superadmin", schoolAdmin, superadmin, false},
+		{"superadmin anyone", superadmin, otherStudent, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := CanAccessAccount(tt.actor, tt.target); got != tt.want {
+				t.Errorf("CanAccessAccount() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHasPermission(t *testing.T) {
+	if HasPermission(models.RoleStudent, PermAccountsDelete) {
+		t.Error("Students must not be able to delete accounts")
+	}
+	if HasPermission(models.RoleStudent, PermXPWrite) {
+		t.Error("Students must not be able to award themselves experience")
+	}
+	if HasPermission(models.RoleTeacher, PermExport) {
+		t.Error("Teachers must not be able to export accounts")
+	}
+	if !HasPermission(models.RoleSchoolAdmin, PermImport) {
+		t.Error("School admins should be able to import accounts")
+	}
+	if HasPermission("unknown", PermAccountsRead) {
+		t.Error("Unknown roles must not have any permission")
+	}
+}
+
+func TestPrincipalTeacherRoster(t *testing.T) {
+	teacher := &models.Account{ID: 4, Role: models.RoleTeacher, School: "School A"}
+	pupil := &models.Account{ID: 1, Role: models.RoleStudent, School: "School A"}
+	classmate := &models.Account{ID: 2, Role: models.RoleStudent, School: "School A"}
+	principal := &Principal{Account: teacher, Roster: []int{pupil.ID}}
+
+	if !principal.CanAccess(pupil) {
+		t.Error("Teachers should reach students on their roster")
+	}
+	if principal.CanAccess(classmate) {
+		t.Error("Teachers must not reach students outside their roster")
+	}
+	if !principal.CanAccess(teacher) {
+		t.Error("Teachers should reach their own account")
+	}
+}
@@ -0,0 +1,155 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"educational-game-db/internal/models"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	// DefaultAccessTokenTTL is how long an access token stays valid
+	DefaultAccessTokenTTL = 15 * time.Minute
+	// DefaultRefreshTokenTTL is how long a refresh token stays valid
+	DefaultRefreshTokenTTL = 30 * 24 * time.Hour
+	// DefaultResetTokenTTL is how long a password reset token stays valid
+	DefaultResetTokenTTL = time.Hour
+	// DefaultConsentTokenTTL is how long a guardian has to use a consent token
+	DefaultConsentTokenTTL = 7 * 24 * time.Hour
+
+	issuer = "educational-game-db"
+)
+
+// ErrInvalidToken is returned when a token cannot be verified
+var ErrInvalidToken = errors.New("invalid or expired token")
+
+// Claims are the claims carried by a signed access token
+type Claims struct {
+	Username string `json:"username"`
+	jwt.RegisteredClaims
+}
+
+// AccountID returns the account ID stored in the subject claim
+func (c *Claims) AccountID() (int, error) {
+	return strconv.Atoi(c.Subject)
+}
+
+// TokenService issues and verifies access and refresh tokens
+type TokenService struct {
+	secret     []byte
+	AccessTTL  time.Duration
+	RefreshTTL time.Duration
+	ResetTTL   time.Duration
+	ConsentTTL time.Duration
+}
+
+// NewTokenService creates a token service signing with the given secret
+func NewTokenService(secret []byte) *TokenService {
+	return &TokenService{
+		secret:     secret,
+		AccessTTL:  DefaultAccessTokenTTL,
+		RefreshTTL: DefaultRefreshTokenTTL,
+		ResetTTL:   DefaultResetTokenTTL,
+		ConsentTTL: DefaultConsentTokenTTL,
+	}
+}
+
+// GenerateSecret returns a random signing secret
+func GenerateSecret() ([]byte, error) {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, fmt.Errorf("failed to generate secret: %w", err)
+	}
+	return secret, nil
+}
+
+// IssueAccessToken creates a signed access token for an account
+func (s *TokenService) IssueAccessToken(account *models.Account) (string, time.Time, error) {
+	now := time.Now()
+	expiresAt := now.Add(s.AccessTTL)
+
+	claims := Claims{
+		Username: account.Username,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    issuer,
+			Subject:   strconv.Itoa(account.ID),
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(expiresAt),
+		},
+	}
+
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(s.secret)
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("failed to sign token: %w", err)
+	}
+
+	return token, expiresAt, nil
+}
+
+// ParseAccessToken verifies an access token and returns its claims
+func (s *TokenService) ParseAccessToken(tokenString string) (*Claims, error) {
+	var claims Claims
+	_, err := jwt.ParseWithClaims(tokenString, &claims, func(t *jwt.Token) (interface{}, error) {
+		return s.secret, nil
+	},
+		jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}),
+		jwt.WithIssuer(issuer),
+		jwt.WithExpirationRequired(),
+	)
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+
+	return &claims, nil
+}
+
+// NewRefreshToken returns a random opaque refresh token and its expiry
+func (s *TokenService) NewRefreshToken() (string, time.Time, error) {
+	token, err := RandomToken(32)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	return token, time.Now().Add(s.RefreshTTL), nil
+}
+
+// NewResetToken returns a random single-use password reset token and its expiry
+func (s *TokenService) NewResetToken() (string, time.Time, error) {
+	token, err := RandomToken(32)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	return token, time.Now().Add(s.ResetTTL), nil
+}
+
+// NewConsentToken returns a random single-use guardian consent token and its
+// expiry
+func (s *TokenService) NewConsentToken() (string, time.Time, error) {
+	token, err := RandomToken(32)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	return token, time.Now().Add(s.ConsentTTL), nil
+}
+
+// RandomToken returns n random bytes encoded as URL-safe base64
+func RandomToken(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate token: %w", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// HashToken returns the SHA-256 hex digest used to store opaque tokens
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,80 @@
+package auth
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// rfc6238Secret is the SHA1 test key of RFC 6238, "12345678901234567890", in base32
+const rfc6238Secret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func TestTOTPCode(t *testing.T) {
+	// The last six digits of the RFC 6238 appendix B vectors
+	vectors := map[int64]string{
+		59:         "287082",
+		1111111109: "081804",
+		1234567890: "005924",
+		2000000000: "279037",
+	}
+	for unix, want := range vectors {
+		got, err := TOTPCode(rfc6238Secret, TOTPStep(time.Unix(unix, 0)))
+		if err != nil {
+			t.Fatalf("Failed to compute code: %v", err)
+		}
+		if got != want {
+			t.Errorf("Code at %d = %s, want %s", unix, got, want)
+		}
+	}
+}
+
+func TestVerifyTOTP(t *testing.T) {
+	now := time.Unix(1111111109, 0)
+	step := TOTPStep(now)
+
+	previous, _ := TOTPCode(rfc6238Secret, step-1)
+	if got, ok := VerifyTOTP(rfc6238Secret, previous, now); !ok || got != step-1 {
+		t.Errorf("Expected the previous code to be accepted at step %d, got %d, %v", step-1, got, ok)
+	}
+
+	stale, _ := TOTPCode(rfc6238Secret, step-2)
+	if _, ok := VerifyTOTP(rfc6238Secret, stale, now); ok {
+		t.Error("Expected a code two periods old to be refused")
+	}
+	if _, ok := VerifyTOTP(rfc6238Secret, "12345", now); ok {
+		t.Error("Expected a short code to be refused")
+	}
+}
+
+func TestTOTPURI(t *testing.T) {
+	uri := TOTPURI("ms smith", "ABC")
+	if !strings.HasPrefix(uri, "otpauth://totp/educational-game-db:ms%20smith?") {
+		t.Errorf("Unexpected URI label: %s", uri)
+	}
+	for _, param := range []string{"secret=ABC", "issuer=educational-game-db", "digits=6", "period=30"} {
+		if !strings.Contains(uri, param) {
+			t.Errorf("Expected %s in %s", param, uri)
+		}
+	}
+
+	png, err := TOTPQRCode(uri)
+	if err != nil {
+		t.Fatalf("Failed to render QR code: %v", err)
+	}
+	if !strings.HasPrefix(string(png), "\x89PNG") {
+		t.Error("Expected a PNG image")
+	}
+}
+
+func TestRecoveryCodes(t *testing.T) {
+	codes, err := GenerateRecoveryCodes()
+	if err != nil {
+		t.Fatalf("Failed to generate recovery codes: %v", err)
+	}
+	if len(codes) != RecoveryCodeCount {
+		t.Fatalf("Expected %d codes, got %d", RecoveryCodeCount, len(codes))
+	}
+	if HashRecoveryCode(codes[0]) != HashRecoveryCode(" "+strings.ToUpper(strings.ReplaceAll(codes[0], "-", ""))) {
+		t.Error("Expected recovery codes to match regardless of case and dashes")
+	}
+}
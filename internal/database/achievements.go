@@ -0,0 +1,106 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"educational-game-db/internal/models"
+)
+
+// AwardAchievement records a badge for an account. It reports false, without
+// error, when the account already holds the badge.
+func (d *Database) AwardAchievement(achievement models.Achievement) (bool, error) {
+	if achievement.AwardedAt.IsZero() {
+		achievement.AwardedAt = time.Now()
+	}
+
+	var id int
+	err := d.db.QueryRow(`
+	INSERT INTO account_achievements (account_id, badge_id, awarded_at, awarded_by, note)
+	VALUES (?, ?, ?, ?, ?)
+	ON CONFLICT (account_id, badge_id) DO NOTHING
+	RETURNING id
+	`, achievement.AccountID, achievement.BadgeID, achievement.AwardedAt, achievement.AwardedBy, achievement.Note).Scan(&id)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to award achievement: %w", err)
+	}
+
+	return true, nil
+}
+
+// GetAccountAchievements returns the badges of an account in the order they were awarded
+func (d *Database) GetAccountAchievements(accountID int) ([]models.Achievement, error) {
+	rows, err := d.db.Query(`
+	SELECT account_id, badge_id, awarded_at, awarded_by, note
+	FROM account_achievements WHERE account_id = ?
+	ORDER BY awarded_at, id
+	`, accountID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get achievements: %w", err)
+	}
+	defer rows.Close()
+
+	achievements := []models.Achievement{}
+	for rows.Next() {
+		var (
+			achievement models.Achievement
+			awardedBy   sql.NullInt64
+		)
+		if err := rows.Scan(&achievement.AccountID, &achievement.BadgeID, &achievement.AwardedAt,
+			&awardedBy, &achievement.Note); err != nil {
+			return nil, fmt.Errorf("failed to scan achievement: %w", err)
+		}
+		if awardedBy.Valid {
+			by := int(awardedBy.Int64)
+			achievement.AwardedBy = &by
+		}
+		achievements = append(achievements, achievement)
+	}
+
+	return achievements, rows.Err()
+}
+
+// RevokeAchievement takes a badge away from an account
+func (d *Database) RevokeAchievement(accountID int, badgeID string) error {
+	result, err := d.db.Exec(`DELETE FROM account_achievements WHERE account_id = ? AND badge_id = ?`, accountID, badgeID)
+	if err != nil {
+		return fmt.Errorf("failed to revoke achievement: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+	if rowsAffected == 0 {
+		return fmt.Errorf("achievement not found")
+	}
+
+	return nil
+}
+
+// CountXPEvents returns how many ledger entries an account has per source
+func (d *Database) CountXPEvents(accountID int) (map[string]int, error) {
+	rows, err := d.db.Query(`SELECT source, COUNT(*) FROM xp_events WHERE account_id = ? GROUP BY source`, accountID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count XP events: %w", err)
+	}
+	defer rows.Close()
+
+	counts := make(map[string]int)
+	for rows.Next() {
+		var (
+			source string
+			count  int
+		)
+		if err := rows.Scan(&source, &count); err != nil {
+			return nil, fmt.Errorf("failed to scan XP event count: %w", err)
+		}
+		counts[source] = count
+	}
+
+	return counts, rows.Err()
+}
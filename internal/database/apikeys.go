@@ -0,0 +1,147 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"educational-game-db/internal/models"
+)
+
+// apiKeyUsageResolution limits how often last_used_at is written for busy keys
+const apiKeyUsageResolution = time.Minute
+
+const apiKeyColumns = `id, name, prefix, owner, scopes, expires_at, last_used_at, created_at, revoked_at`
+
+func scanAPIKey(row rowScanner) (*models.APIKey, error) {
+	var (
+		key       models.APIKey
+		scopes    string
+		expiresAt sql.NullTime
+		lastUsed  sql.NullTime
+		revokedAt sql.NullTime
+	)
+	err := row.Scan(&key.ID, &key.Name, &key.Prefix, &key.Owner, &scopes,
+		&expiresAt, &lastUsed, &key.CreatedAt, &revokedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	key.Scopes = strings.Fields(scopes)
+	if expiresAt.Valid {
+		key.ExpiresAt = &expiresAt.Time
+	}
+	if lastUsed.Valid {
+		key.LastUsedAt = &lastUsed.Time
+	}
+	if revokedAt.Valid {
+		key.RevokedAt = &revokedAt.Time
+	}
+	return &key, nil
+}
+
+// CreateAPIKey stores a new API key; only the hash of the secret is persisted
+func (d *Database) CreateAPIKey(key models.APIKey, keyHash string) (*models.APIKey, error) {
+	query := `
+	INSERT INTO api_keys (name, prefix, key_hash, owner, scopes, expires_at, created_at)
+	VALUES (?, ?, ?, ?, ?, ?, ?)
+	RETURNING id
+	`
+
+	var id int
+	err := d.db.QueryRow(query, key.Name, key.Prefix, keyHash, key.Owner,
+		strings.Join(key.Scopes, " "), key.ExpiresAt, time.Now()).Scan(&id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create API key: %w", err)
+	}
+
+	return d.GetAPIKeyByID(id)
+}
+
+// GetAPIKeyByID returns an API key by its ID
+func (d *Database) GetAPIKeyByID(id int) (*models.APIKey, error) {
+	query := `SELECT ` + apiKeyColumns + ` FROM api_keys WHERE id = ?`
+
+	key, err := scanAPIKey(d.db.QueryRow(query, id))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("API key not found")
+		}
+		return nil, fmt.Errorf("failed to get API key: %w", err)
+	}
+
+	return key, nil
+}
+
+// GetAPIKeyByHash resolves a presented key by the hash of its secret
+func (d *Database) GetAPIKeyByHash(keyHash string) (*models.APIKey, error) {
+	query := `SELECT ` + apiKeyColumns + ` FROM api_keys WHERE key_hash = ?`
+
+	key, err := scanAPIKey(d.db.QueryRow(query, keyHash))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("API key not found")
+		}
+		return nil, fmt.Errorf("failed to get API key: %w", err)
+	}
+
+	return key, nil
+}
+
+// GetAllAPIKeys lists every API key, including revoked ones
+func (d *Database) GetAllAPIKeys() ([]models.APIKey, error) {
+	query := `SELECT ` + apiKeyColumns + ` FROM api_keys ORDER BY created_at DESC`
+
+	rows, err := d.db.Query(query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get API keys: %w", err)
+	}
+	defer rows.Close()
+
+	var keys []models.APIKey
+	for rows.Next() {
+		key, err := scanAPIKey(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan API key: %w", err)
+		}
+		keys = append(keys, *key)
+	}
+
+	return keys, nil
+}
+
+// TouchAPIKey records that a key was just used
+func (d *Database) TouchAPIKey(id int) error {
+	now := time.Now()
+	query := `
+	UPDATE api_keys SET last_used_at = ?
+	WHERE id = ? AND (last_used_at IS NULL OR last_used_at < ?)
+	`
+
+	if _, err := d.db.Exec(query, now, id, now.Add(-apiKeyUsageResolution)); err != nil {
+		return fmt.Errorf("failed to update API key usage: %w", err)
+	}
+
+	return nil
+}
+
+// RevokeAPIKey permanently disables an API key
+func (d *Database) RevokeAPIKey(id int) error {
+	query := `UPDATE api_keys SET revoked_at = ? WHERE id = ? AND revoked_at IS NULL`
+	result, err := d.db.Exec(query, time.Now(), id)
+	if err != nil {
+		return fmt.Errorf("failed to revoke API key: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	if rowsAffected == 0 {
+		return fmt.Errorf("API key not found or already revoked")
+	}
+
+	return nil
+}
@@ -2,107 +2,256 @@ package database
 
 import (
 	"database/sql"
+	"errors"
 	"fmt"
 	"log"
+	"strings"
+	"sync"
 	"time"
 
 	"educational-game-db/internal/models"
+	"educational-game-db/internal/progression"
 
+	_ "github.com/lib/pq"
 	_ "github.com/mattn/go-sqlite3"
 	"golang.org/x/crypto/bcrypt"
 )
 
+// ErrAccountChanged is returned when an account update is based on an outdated version
+var ErrAccountChanged = errors.New("account was changed by someone else")
+
+// Database is the SQL implementation of Store, shared by the SQLite and
+// PostgreSQL backends
 type Database struct {
-	db *sql.DB
+	db      *conn
+	pool    *sql.DB
+	dialect dialect
+	curve   progression.Curve
+	// passwordCost is the bcrypt cost new hashes are made with
+	passwordCost int
+}
+
+// sqlExecutor is satisfied by both *sql.DB and *sql.Tx
+type sqlExecutor interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+// conn runs queries written with ? placeholders against the pool or a
+// transaction, rebinding them for the backend
+type conn struct {
+	target  sqlExecutor
+	dialect dialect
+}
+
+func (c *conn) Exec(query string, args ...interface{}) (sql.Result, error) {
+	return c.target.Exec(c.dialect.rebind(query), args...)
+}
+
+func (c *conn) Query(query string, args ...interface{}) (*sql.Rows, error) {
+	return c.target.Query(c.dialect.rebind(query), args...)
+}
+
+func (c *conn) QueryRow(query string, args ...interface{}) *sql.Row {
+	return c.target.QueryRow(c.dialect.rebind(query), args...)
 }
 
-func NewDatabase(dbPath string) (*Database, error) {
-	db, err := sql.Open("sqlite3", dbPath)
+// NewDatabase opens the database and applies any pending migrations.
+// It refuses to start against a schema newer than this build knows.
+//
+// dsn is either a postgres:// URL or an SQLite file path.
+func NewDatabase(dsn string) (*Database, error) {
+	database, err := OpenDatabase(dsn)
 	if err != nil {
-		return nil, fmt.Errorf("failed to open database: %w", err)
+		return nil, err
+	}
+
+	if err := database.checkSchemaVersion(); err != nil {
+		database.Close()
+		return nil, err
+	}
+
+	if err := database.MigrateUp(); err != nil {
+		database.Close()
+		return nil, fmt.Errorf("failed to migrate database: %w", err)
 	}
 
-	database := &Database{db: db}
-	if err := database.createTables(); err != nil {
-		return nil, fmt.Errorf("failed to create tables: %w", err)
+	if err := database.ensureSearchIndex(); err != nil {
+		database.Close()
+		return nil, err
+	}
+
+	if err := database.linkAccountSchools(); err != nil {
+		database.Close()
+		return nil, err
 	}
 
 	return database, nil
 }
 
-func (d *Database) createTables() error {
-	query := `
-	CREATE TABLE IF NOT EXISTS accounts (
-		id INTEGER PRIMARY KEY AUTOINCREMENT,
-		username TEXT UNIQUE NOT NULL,
-		email TEXT UNIQUE NOT NULL,
-		password_hash TEXT NOT NULL,
-		first_name TEXT,
-		last_name TEXT,
-		grade INTEGER DEFAULT 0,
-		school TEXT,
-		game_level INTEGER DEFAULT 1,
-		experience INTEGER DEFAULT 0,
-		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
-		updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
-		is_active BOOLEAN DEFAULT TRUE
-	);
-
-	CREATE INDEX IF NOT EXISTS idx_username ON accounts(username);
-	CREATE INDEX IF NOT EXISTS idx_email ON accounts(email);
-	CREATE INDEX IF NOT EXISTS idx_is_active ON accounts(is_active);
-	`
+// OpenDatabase opens the database without touching its schema
+func OpenDatabase(dsn string) (*Database, error) {
+	dialect, driverDSN, err := parseDSN(dsn)
+	if err != nil {
+		return nil, err
+	}
+
+	pool, err := sql.Open(dialect.driverName(), driverDSN)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open database: %w", err)
+	}
+
+	if err := pool.Ping(); err != nil {
+		pool.Close()
+		return nil, fmt.Errorf("failed to connect to database: %w", err)
+	}
+
+	return &Database{
+		db:      &conn{target: pool, dialect: dialect},
+		pool:    pool,
+		dialect: dialect,
+		curve:   progression.DefaultCurve,
+
+		passwordCost: bcrypt.DefaultCost,
+	}, nil
+}
+
+// Backend returns the name of the SQL backend in use
+func (d *Database) Backend() string {
+	return d.dialect.name()
+}
+
+// InTx runs fn against a copy of the database bound to a single transaction,
+// committing if fn succeeds and rolling back otherwise. Calls nested inside an
+// existing transaction join it.
+func (d *Database) InTx(fn func(tx *Database) error) error {
+	if _, inTx := d.db.target.(*sql.Tx); inTx {
+		return fn(d)
+	}
+
+	sqlTx, err := d.pool.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer sqlTx.Rollback()
+
+	tx := &Database{
+		db:      &conn{target: sqlTx, dialect: d.dialect},
+		pool:    d.pool,
+		dialect: d.dialect,
+		curve:   d.curve,
+
+		passwordCost: d.passwordCost,
+	}
+	if err := fn(tx); err != nil {
+		return err
+	}
 
-	_, err := d.db.Exec(query)
-	return err
+	if err := sqlTx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return nil
+}
+
+// Transaction is InTx for callers that only know the Store interface
+func (d *Database) Transaction(fn func(tx Store) error) error {
+	return d.InTx(func(tx *Database) error { return fn(tx) })
+}
+
+// accountColumns is the column list matching scanAccount
+const accountColumns = `id, username, email, password_hash, first_name, last_name, grade, school,
+	game_level, experience, created_at, updated_at, is_active, role, leaderboard_opt_out, school_id, consent_status,
+	must_reset_password, two_factor_enabled, oidc_subject, deleted_at, version, external_id`
+
+// rowScanner is satisfied by both *sql.Row and *sql.Rows
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanAccount(row rowScanner) (*models.Account, error) {
+	var account models.Account
+	err := row.Scan(
+		&account.ID, &account.Username, &account.Email, &account.PasswordHash,
+		&account.FirstName, &account.LastName, &account.Grade, &account.School,
+		&account.GameLevel, &account.Experience, &account.CreatedAt, &account.UpdatedAt,
+		&account.IsActive, &account.Role, &account.LeaderboardOptOut, &account.SchoolID,
+		&account.ConsentStatus, &account.MustResetPassword, &account.TwoFactorEnabled,
+		&account.OIDCSubject, &account.DeletedAt, &account.Version, &account.ExternalID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &account, nil
 }
 
 func (d *Database) Close() error {
-	return d.db.Close()
+	return d.pool.Close()
 }
 
 func (d *Database) CreateAccount(req models.CreateAccountRequest) (*models.Account, error) {
 	// Hash the password
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(req.Password), d.passwordCost)
 	if err != nil {
 		return nil, fmt.Errorf("failed to hash password: %w", err)
 	}
 
+	role := req.Role
+	if role == "" {
+		role = models.RoleStudent
+	}
+	if !models.IsValidRole(role) {
+		return nil, fmt.Errorf("invalid role: %s", role)
+	}
+	consentStatus := req.ConsentStatus
+	if consentStatus == "" {
+		consentStatus = models.ConsentNotRequired
+	}
+
 	query := `
-	INSERT INTO accounts (username, email, password_hash, first_name, last_name, grade, school, created_at, updated_at)
-	VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+	INSERT INTO accounts (username, email, password_hash, first_name, last_name, grade, school, school_id,
+		role, consent_status, must_reset_password, oidc_subject, external_id, created_at, updated_at)
+	VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	RETURNING id
 	`
 
-	now := time.Now()
-	result, err := d.db.Exec(query, req.Username, req.Email, string(hashedPassword),
-		req.FirstName, req.LastName, req.Grade, req.School, now, now)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create account: %w", err)
-	}
+	var account *models.Account
+	err = d.InTx(func(tx *Database) error {
+		school, err := tx.resolveSchool(req.SchoolID, req.School)
+		if err != nil {
+			return err
+		}
 
-	id, err := result.LastInsertId()
+		now := time.Now()
+		var id int
+		err = tx.db.QueryRow(query, req.Username, req.Email, string(hashedPassword),
+			req.FirstName, req.LastName, req.Grade, schoolName(school), schoolID(school),
+			role, consentStatus, req.MustResetPassword, oidcSubject(req.OIDCSubject), externalID(req.ExternalID), now, now).Scan(&id)
+		if err != nil {
+			return fmt.Errorf("failed to create account: %w", err)
+		}
+
+		if consentStatus == models.ConsentPending && req.GuardianEmail != "" {
+			if err := tx.requestConsent(id, req.GuardianEmail); err != nil {
+				return err
+			}
+		}
+
+		account, err = tx.GetAccountByID(id)
+		return err
+	})
 	if err != nil {
-		return nil, fmt.Errorf("failed to get account ID: %w", err)
+		return nil, err
 	}
 
-	return d.GetAccountByID(int(id))
+	return account, nil
 }
 
 func (d *Database) GetAccountByID(id int) (*models.Account, error) {
-	query := `
-	SELECT id, username, email, password_hash, first_name, last_name, grade, school,
-		   game_level, experience, created_at, updated_at, is_active
-	FROM accounts WHERE id = ?
-	`
-
-	var account models.Account
-	err := d.db.QueryRow(query, id).Scan(
-		&account.ID, &account.Username, &account.Email, &account.PasswordHash,
-		&account.FirstName, &account.LastName, &account.Grade, &account.School,
-		&account.GameLevel, &account.Experience, &account.CreatedAt, &account.UpdatedAt,
-		&account.IsActive,
-	)
+	query := `SELECT ` + accountColumns + ` FROM accounts WHERE id = ? AND deleted_at IS NULL`
 
+	account, err := scanAccount(d.db.QueryRow(query, id))
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return nil, fmt.Errorf("account not found")
@@ -110,24 +259,29 @@ func (d *Database) GetAccountByID(id int) (*models.Account, error) {
 		return nil, fmt.Errorf("failed to get account: %w", err)
 	}
 
-	return &account, nil
+	return account, nil
 }
 
 func (d *Database) GetAccountByUsername(username string) (*models.Account, error) {
-	query := `
-	SELECT id, username, email, password_hash, first_name, last_name, grade, school,
-		   game_level, experience, created_at, updated_at, is_active
-	FROM accounts WHERE username = ?
-	`
+	query := `SELECT ` + accountColumns + ` FROM accounts WHERE username = ? AND deleted_at IS NULL`
 
-	var account models.Account
-	err := d.db.QueryRow(query, username).Scan(
-		&account.ID, &account.Username, &account.Email, &account.PasswordHash,
-		&account.FirstName, &account.LastName, &account.Grade, &account.School,
-		&account.GameLevel, &account.Experience, &account.CreatedAt, &account.UpdatedAt,
-		&account.IsActive,
-	)
+	account, err := scanAccount(d.db.QueryRow(query, username))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("account not found")
+		}
+		return nil, fmt.Errorf("failed to get account: %w", err)
+	}
 
+	return account, nil
+}
+
+// GetAccountByEmail returns the account registered with an email address,
+// ignoring case
+func (d *Database) GetAccountByEmail(email string) (*models.Account, error) {
+	query := `SELECT ` + accountColumns + ` FROM accounts WHERE LOWER(email) = LOWER(?) AND deleted_at IS NULL`
+
+	account, err := scanAccount(d.db.QueryRow(query, strings.TrimSpace(email)))
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return nil, fmt.Errorf("account not found")
@@ -135,17 +289,16 @@ func (d *Database) GetAccountByUsername(username string) (*models.Account, error
 		return nil, fmt.Errorf("failed to get account: %w", err)
 	}
 
-	return &account, nil
+	return account, nil
 }
 
 func (d *Database) GetAllAccounts() ([]models.Account, error) {
-	query := `
-	SELECT id, username, email, password_hash, first_name, last_name, grade, school,
-		   game_level, experience, created_at, updated_at, is_active
-	FROM accounts ORDER BY created_at DESC
-	`
+	query := `SELECT ` + accountColumns + ` FROM accounts WHERE deleted_at IS NULL ORDER BY created_at DESC`
+	return d.queryAccounts(query)
+}
 
-	rows, err := d.db.Query(query)
+func (d *Database) queryAccounts(query string, args ...interface{}) ([]models.Account, error) {
+	rows, err := d.db.Query(query, args...)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get accounts: %w", err)
 	}
@@ -153,71 +306,196 @@ func (d *Database) GetAllAccounts() ([]models.Account, error) {
 
 	var accounts []models.Account
 	for rows.Next() {
-		var account models.Account
-		err := rows.Scan(
-			&account.ID, &account.Username, &account.Email, &account.PasswordHash,
-			&account.FirstName, &account.LastName, &account.Grade, &account.School,
-			&account.GameLevel, &account.Experience, &account.CreatedAt, &account.UpdatedAt,
-			&account.IsActive,
-		)
+		account, err := scanAccount(rows)
 		if err != nil {
 			return nil, fmt.Errorf("failed to scan account: %w", err)
 		}
-		accounts = append(accounts, account)
+		accounts = append(accounts, *account)
 	}
 
 	return accounts, nil
 }
 
+// UpdateAccount overwrites an account's profile. If req.Version is set and the
+// account has changed since, ErrAccountChanged is returned. An update that
+// changes nothing writes nothing, so the account keeps its version.
 func (d *Database) UpdateAccount(id int, req models.UpdateAccountRequest) (*models.Account, error) {
 	query := `
 	UPDATE accounts 
-	SET first_name = ?, last_name = ?, grade = ?, school = ?, 
-		game_level = ?, experience = ?, is_active = ?, updated_at = ?
-	WHERE id = ?
+	SET first_name = ?, last_name = ?, grade = ?, school = ?, school_id = ?, is_active = ?, updated_at = ?,
+		username = COALESCE(?, username), email = COALESCE(?, email), external_id = COALESCE(?, external_id),
+		version = version + 1
+	WHERE id = ? AND deleted_at IS NULL AND (? OR version = ?)
 	`
 
-	now := time.Now()
-	_, err := d.db.Exec(query, req.FirstName, req.LastName, req.Grade, req.School,
-		req.GameLevel, req.Experience, req.IsActive, now, id)
+	var account *models.Account
+	err := d.InTx(func(tx *Database) error {
+		school, err := tx.resolveSchool(req.SchoolID, req.School)
+		if err != nil {
+			return err
+		}
+
+		version := 0
+		if req.Version != nil {
+			version = *req.Version
+		}
+
+		current, err := tx.GetAccountByID(id)
+		if err != nil {
+			return err
+		}
+		if !accountUpdateChanges(current, req, school) {
+			if req.Version != nil && version != current.Version {
+				return ErrAccountChanged
+			}
+			account = current
+			return nil
+		}
+
+		now := time.Now()
+		result, err := tx.db.Exec(query, req.FirstName, req.LastName, req.Grade, schoolName(school), schoolID(school),
+			req.IsActive, now, req.Username, req.Email, req.ExternalID, id, req.Version == nil, version)
+		if err != nil {
+			return fmt.Errorf("failed to update account: %w", err)
+		}
+		if n, _ := result.RowsAffected(); n == 0 && req.Version != nil {
+			// Tell a stale version apart from a missing account
+			if _, err := tx.GetAccountByID(id); err != nil {
+				return err
+			}
+			return ErrAccountChanged
+		}
+
+		account, err = tx.GetAccountByID(id)
+		return err
+	})
 	if err != nil {
-		return nil, fmt.Errorf("failed to update account: %w", err)
+		return nil, err
 	}
 
-	return d.GetAccountByID(id)
+	return account, nil
 }
 
-func (d *Database) DeleteAccount(id int) error {
-	query := `DELETE FROM accounts WHERE id = ?`
-	result, err := d.db.Exec(query, id)
+// accountUpdateChanges reports whether an update would change any of the
+// fields it writes
+func accountUpdateChanges(account *models.Account, req models.UpdateAccountRequest, school *models.School) bool {
+	sameSchool := (account.SchoolID == nil && school == nil) ||
+		(account.SchoolID != nil && school != nil && *account.SchoolID == school.ID)
+	sameExternalID := req.ExternalID == nil ||
+		(account.ExternalID != nil && *account.ExternalID == *req.ExternalID)
+
+	return account.FirstName != req.FirstName || account.LastName != req.LastName ||
+		account.Grade != req.Grade || account.School != schoolName(school) || !sameSchool ||
+		account.IsActive != req.IsActive || !sameExternalID ||
+		(req.Username != nil && *req.Username != account.Username) ||
+		(req.Email != nil && *req.Email != account.Email)
+}
+
+// SetAccountRole changes the role of an account
+func (d *Database) SetAccountRole(id int, role string) (*models.Account, error) {
+	if !models.IsValidRole(role) {
+		return nil, fmt.Errorf("invalid role: %s", role)
+	}
+
+	query := `UPDATE accounts SET role = ?, updated_at = ? WHERE id = ? AND deleted_at IS NULL`
+	result, err := d.db.Exec(query, role, time.Now(), id)
 	if err != nil {
-		return fmt.Errorf("failed to delete account: %w", err)
+		return nil, fmt.Errorf("failed to set account role: %w", err)
 	}
 
 	rowsAffected, err := result.RowsAffected()
 	if err != nil {
-		return fmt.Errorf("failed to get rows affected: %w", err)
+		return nil, fmt.Errorf("failed to get rows affected: %w", err)
 	}
 
 	if rowsAffected == 0 {
-		return fmt.Errorf("account not found")
+		return nil, fmt.Errorf("account not found")
 	}
 
-	return nil
+	return d.GetAccountByID(id)
+}
+
+// DeleteAccount hides an account and signs it out. It can be restored until
+// it is purged.
+func (d *Database) DeleteAccount(id int) error {
+	return d.InTx(func(tx *Database) error {
+		now := time.Now()
+		result, err := tx.db.Exec(`UPDATE accounts SET deleted_at = ?, updated_at = ? WHERE id = ? AND deleted_at IS NULL`, now, now, id)
+		if err != nil {
+			return fmt.Errorf("failed to delete account: %w", err)
+		}
+
+		rowsAffected, err := result.RowsAffected()
+		if err != nil {
+			return fmt.Errorf("failed to get rows affected: %w", err)
+		}
+
+		if rowsAffected == 0 {
+			return fmt.Errorf("account not found")
+		}
+
+		// A deleted account must not stay signed in
+		return tx.RevokeAccountRefreshTokens(id)
+	})
+}
+
+// GetDeletedAccount retrieves a deleted account that has not been purged yet
+func (d *Database) GetDeletedAccount(id int) (*models.Account, error) {
+	query := `SELECT ` + accountColumns + ` FROM accounts WHERE id = ? AND deleted_at IS NOT NULL`
+
+	account, err := scanAccount(d.db.QueryRow(query, id))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("account not found")
+		}
+		return nil, fmt.Errorf("failed to get account: %w", err)
+	}
+
+	return account, nil
+}
+
+// RestoreAccount brings back a deleted account that has not been purged yet
+func (d *Database) RestoreAccount(id int) (*models.Account, error) {
+	result, err := d.db.Exec(`UPDATE accounts SET deleted_at = NULL, updated_at = ? WHERE id = ? AND deleted_at IS NOT NULL`, time.Now(), id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to restore account: %w", err)
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return nil, fmt.Errorf("account not found")
+	}
+
+	return d.GetAccountByID(id)
+}
+
+// PurgeDeletedAccounts permanently removes accounts deleted before a time,
+// along with everything that belongs to them, and returns how many were removed
+func (d *Database) PurgeDeletedAccounts(before time.Time) (int, error) {
+	result, err := d.db.Exec(`DELETE FROM accounts WHERE deleted_at IS NOT NULL AND deleted_at < ?`, before)
+	if err != nil {
+		return 0, fmt.Errorf("failed to purge deleted accounts: %w", err)
+	}
+
+	n, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("failed to get rows affected: %w", err)
+	}
+	return int(n), nil
 }
 
-func (d *Database) GetAccountStats() (*models.AccountStats, error) {
+// GetAccountStats aggregates the accounts matching the filters of opts.
+// Sorting and paging options are ignored.
+func (d *Database) GetAccountStats(opts models.AccountListOptions) (*models.AccountStats, error) {
+	conds, args := accountFilter(opts)
 	query := `
 	SELECT 
 		COUNT(*) as total_accounts,
-		SUM(CASE WHEN is_active = 1 THEN 1 ELSE 0 END) as active_accounts,
-		AVG(game_level) as average_game_level,
-		SUM(experience) as total_experience
-	FROM accounts
-	`
+		COALESCE(SUM(CASE WHEN is_active THEN 1 ELSE 0 END), 0) as active_accounts,
+		COALESCE(AVG(game_level), 0) as average_game_level,
+		COALESCE(SUM(experience), 0) as total_experience
+	FROM accounts` + whereClause(conds)
 
 	var stats models.AccountStats
-	err := d.db.QueryRow(query).Scan(
+	err := d.db.QueryRow(query, args...).Scan(
 		&stats.TotalAccounts,
 		&stats.ActiveAccounts,
 		&stats.AverageGameLevel,
@@ -231,13 +509,37 @@ func (d *Database) GetAccountStats() (*models.AccountStats, error) {
 	return &stats, nil
 }
 
+// unknownAccountHashes holds, per bcrypt cost, a hash that is compared against
+// when a username does not exist, so that failing takes as long as for a real
+// account with a wrong password
+var unknownAccountHashes sync.Map
+
+func unknownAccountHash(cost int) []byte {
+	if hash, ok := unknownAccountHashes.Load(cost); ok {
+		return hash.([]byte)
+	}
+	hash, _ := bcrypt.GenerateFromPassword([]byte("unknown account"), cost)
+	unknownAccountHashes.Store(cost, hash)
+	return hash
+}
+
 func (d *Database) VerifyPassword(username, password string) bool {
 	account, err := d.GetAccountByUsername(username)
 	if err != nil {
 		log.Printf("Failed to get account for password verification: %v", err)
+		bcrypt.CompareHashAndPassword(unknownAccountHash(d.passwordCost), []byte(password))
 		return false
 	}
 
-	err = bcrypt.CompareHashAndPassword([]byte(account.PasswordHash), []byte(password))
-	return err == nil
+	if err := bcrypt.CompareHashAndPassword([]byte(account.PasswordHash), []byte(password)); err != nil {
+		return false
+	}
+
+	// Hashes made at a lower cost are upgraded while the password is at hand
+	if cost, err := bcrypt.Cost([]byte(account.PasswordHash)); err == nil && cost < d.passwordCost {
+		if err := d.rehashPassword(account.ID, password); err != nil {
+			log.Printf("Failed to upgrade password hash: %v", err)
+		}
+	}
+	return true
 }
@@ -1,8 +1,11 @@
 package database
 
 import (
+	"errors"
+	"fmt"
 	"os"
 	"testing"
+	"time"
 
 	"educational-game-db/internal/models"
 )
@@ -24,187 +27,490 @@ func setupTestDB(t *testing.T) *Database {
 }
 
 func TestNewDatabase(t *testing.T) {
-	db := setupTestDB(t)
-	defer db.Close()
-
-	if db == nil {
-		t.Fatal("Database should not be nil")
-	}
+	forEachBackend(t, func(t *testing.T, db *Database) {
+		if db == nil {
+			t.Fatal("Database should not be nil")
+		}
+	})
 }
 
 func TestCreateAccount(t *testing.T) {
-	db := setupTestDB(t)
-	defer db.Close()
-
-	req := models.CreateAccountRequest{
-		Username:  "testuser",
-		Email:     "test@example.com",
-		Password:  "password123",
-		FirstName: "Test",
-		LastName:  "User",
-		Grade:     5,
-		School:    "Test School",
-	}
+	forEachBackend(t, func(t *testing.T, db *Database) {
+		req := models.CreateAccountRequest{
+			Username:  "testuser",
+			Email:     "test@example.com",
+			Password:  "password123",
+			FirstName: "Test",
+			LastName:  "User",
+			Grade:     5,
+			School:    "Test School",
+		}
 
-	account, err := db.CreateAccount(req)
-	if err != nil {
-		t.Fatalf("Failed to create account: %v", err)
-	}
+		account, err := db.CreateAccount(req)
+		if err != nil {
+			t.Fatalf("Failed to create account: %v", err)
+		}
 
-	if account.ID == 0 {
-		t.Error("Account ID should be set after creation")
-	}
+		if account.ID == 0 {
+			t.Error("Account ID should be set after creation")
+		}
 
-	if account.CreatedAt.IsZero() {
-		t.Error("CreatedAt should be set after creation")
-	}
+		if account.CreatedAt.IsZero() {
+			t.Error("CreatedAt should be set after creation")
+		}
 
-	if account.Username != req.Username {
-		t.Errorf("Expected username %s, got %s", req.Username, account.Username)
-	}
+		if account.Username != req.Username {
+			t.Errorf("Expected username %s, got %s", req.Username, account.Username)
+		}
+	})
 }
 
 func TestCreateAccountDuplicate(t *testing.T) {
-	db := setupTestDB(t)
-	defer db.Close()
-
-	req1 := models.CreateAccountRequest{
-		Username:  "duplicate",
-		Email:     "test1@example.com",
-		Password:  "password123",
-		FirstName: "Test",
-		LastName:  "User",
-		Grade:     5,
-		School:    "Test School",
-	}
+	forEachBackend(t, func(t *testing.T, db *Database) {
+		req1 := models.CreateAccountRequest{
+			Username:  "duplicate",
+			Email:     "test1@example.com",
+			Password:  "password123",
+			FirstName: "Test",
+			LastName:  "User",
+			Grade:     5,
+			School:    "Test School",
+		}
 
-	req2 := models.CreateAccountRequest{
-		Username:  "duplicate", // Same username
-		Email:     "test2@example.com",
-		Password:  "password123",
-		FirstName: "Test",
-		LastName:  "User2",
-		Grade:     6,
-		School:    "Test School",
-	}
+		req2 := models.CreateAccountRequest{
+			Username:  "duplicate", // Same username
+			Email:     "test2@example.com",
+			Password:  "password123",
+			FirstName: "Test",
+			LastName:  "User2",
+			Grade:     6,
+			School:    "Test School",
+		}
 
-	// First account should succeed
-	_, err := db.CreateAccount(req1)
-	if err != nil {
-		t.Fatalf("Failed to create first account: %v", err)
-	}
+		// First account should succeed
+		_, err := db.CreateAccount(req1)
+		if err != nil {
+			t.Fatalf("Failed to create first account: %v", err)
+		}
 
-	// Second account with same username should fail
-	_, err = db.CreateAccount(req2)
-	if err == nil {
-		t.Error("Expected error when creating account with duplicate username")
-	}
+		// Second account with same username should fail
+		_, err = db.CreateAccount(req2)
+		if err == nil {
+			t.Error("Expected error when creating account with duplicate username")
+		}
+	})
 }
 
 func TestGetAccountByID(t *testing.T) {
-	db := setupTestDB(t)
-	defer db.Close()
-
-	// Create test account
-	req := models.CreateAccountRequest{
-		Username:  "gettest",
-		Email:     "gettest@example.com",
-		Password:  "password123",
-		FirstName: "Get",
-		LastName:  "Test",
-		Grade:     7,
-		School:    "Test School",
-	}
+	forEachBackend(t, func(t *testing.T, db *Database) {
+		// Create test account
+		req := models.CreateAccountRequest{
+			Username:  "gettest",
+			Email:     "gettest@example.com",
+			Password:  "password123",
+			FirstName: "Get",
+			LastName:  "Test",
+			Grade:     7,
+			School:    "Test School",
+		}
 
-	account, err := db.CreateAccount(req)
-	if err != nil {
-		t.Fatalf("Failed to create account: %v", err)
-	}
+		account, err := db.CreateAccount(req)
+		if err != nil {
+			t.Fatalf("Failed to create account: %v", err)
+		}
 
-	// Retrieve account
-	retrieved, err := db.GetAccountByID(account.ID)
-	if err != nil {
-		t.Fatalf("Failed to get account by ID: %v", err)
-	}
+		// Retrieve account
+		retrieved, err := db.GetAccountByID(account.ID)
+		if err != nil {
+			t.Fatalf("Failed to get account by ID: %v", err)
+		}
 
-	if retrieved.Username != account.Username {
-		t.Errorf("Expected username %s, got %s", account.Username, retrieved.Username)
-	}
+		if retrieved.Username != account.Username {
+			t.Errorf("Expected username %s, got %s", account.Username, retrieved.Username)
+		}
 
-	if retrieved.Email != account.Email {
-		t.Errorf("Expected email %s, got %s", account.Email, retrieved.Email)
-	}
+		if retrieved.Email != account.Email {
+			t.Errorf("Expected email %s, got %s", account.Email, retrieved.Email)
+		}
+	})
 }
 
 func TestGetAccountByIDNotFound(t *testing.T) {
-	db := setupTestDB(t)
-	defer db.Close()
-
-	_, err := db.GetAccountByID(99999)
-	if err == nil {
-		t.Error("Expected error when getting non-existent account")
-	}
+	forEachBackend(t, func(t *testing.T, db *Database) {
+		_, err := db.GetAccountByID(99999)
+		if err == nil {
+			t.Error("Expected error when getting non-existent account")
+		}
+	})
 }
 
 func TestGetAccountByUsername(t *testing.T) {
-	db := setupTestDB(t)
-	defer db.Close()
+	forEachBackend(t, func(t *testing.T, db *Database) {
+		// Create test account
+		req := models.CreateAccountRequest{
+			Username:  "usernametest",
+			Email:     "usernametest@example.com",
+			Password:  "password123",
+			FirstName: "Username",
+			LastName:  "Test",
+			Grade:     8,
+			School:    "Test School",
+		}
 
-	// Create test account
-	req := models.CreateAccountRequest{
-		Username:  "usernametest",
-		Email:     "usernametest@example.com",
-		Password:  "password123",
-		FirstName: "Username",
-		LastName:  "Test",
-		Grade:     8,
-		School:    "Test School",
-	}
+		account, err := db.CreateAccount(req)
+		if err != nil {
+			t.Fatalf("Failed to create account: %v", err)
+		}
 
-	account, err := db.CreateAccount(req)
-	if err != nil {
-		t.Fatalf("Failed to create account: %v", err)
-	}
+		// Retrieve account by username
+		retrieved, err := db.GetAccountByUsername("usernametest")
+		if err != nil {
+			t.Fatalf("Failed to get account by username: %v", err)
+		}
 
-	// Retrieve account by username
-	retrieved, err := db.GetAccountByUsername("usernametest")
-	if err != nil {
-		t.Fatalf("Failed to get account by username: %v", err)
-	}
+		if retrieved.ID != account.ID {
+			t.Errorf("Expected ID %d, got %d", account.ID, retrieved.ID)
+		}
+	})
+}
 
-	if retrieved.ID != account.ID {
-		t.Errorf("Expected ID %d, got %d", account.ID, retrieved.ID)
-	}
+func TestSetAccountRole(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, db *Database) {
+		account, err := db.CreateAccount(models.CreateAccountRequest{
+			Username: "roletest",
+			Email:    "roletest@example.com",
+			Password: "password123",
+		})
+		if err != nil {
+			t.Fatalf("Failed to create account: %v", err)
+		}
+
+		if account.Role != models.RoleStudent {
+			t.Errorf("Expected new accounts to be %s, got %s", models.RoleStudent, account.Role)
+		}
+
+		updated, err := db.SetAccountRole(account.ID, models.RoleTeacher)
+		if err != nil {
+			t.Fatalf("Failed to set role: %v", err)
+		}
+		if updated.Role != models.RoleTeacher {
+			t.Errorf("Expected role %s, got %s", models.RoleTeacher, updated.Role)
+		}
+
+		if _, err := db.SetAccountRole(account.ID, "wizard"); err == nil {
+			t.Error("Expected error when setting an unknown role")
+		}
+	})
 }
 
-func TestGetStats(t *testing.T) {
-	db := setupTestDB(t)
-	defer db.Close()
+func TestListAccounts(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, db *Database) {
+		for i := 1; i <= 5; i++ {
+			school := "North"
+			if i > 3 {
+				school = "South"
+			}
+			_, err := db.CreateAccount(models.CreateAccountRequest{
+				Username: fmt.Sprintf("list%d", i),
+				Email:    fmt.Sprintf("list%d@example.com", i),
+				Password: "password123",
+				Grade:    i % 2,
+				School:   school,
+			})
+			if err != nil {
+				t.Fatalf("Failed to create account: %v", err)
+			}
+		}
 
-	// Create test accounts with different grades and schools
-	requests := []models.CreateAccountRequest{
-		{Username: "stats1", Email: "stats1@example.com", Password: "password123", FirstName: "Stats", LastName: "One", Grade: 4, School: "School A"},
-		{Username: "stats2", Email: "stats2@example.com", Password: "password123", FirstName: "Stats", LastName: "Two", Grade: 5, School: "School A"},
-		{Username: "stats3", Email: "stats3@example.com", Password: "password123", FirstName: "Stats", LastName: "Three", Grade: 4, School: "School B"},
-		{Username: "stats4", Email: "stats4@example.com", Password: "password123", FirstName: "Stats", LastName: "Four", Grade: 6, School: "School B"},
-	}
+		// Walk every page and make sure nothing repeats or goes missing,
+		// including across ties in the sort column
+		for _, sort := range []string{"", "grade"} {
+			seen := make(map[int]bool)
+			opts := models.AccountListOptions{Sort: sort, Limit: 2}
+			for pages := 0; ; pages++ {
+				if pages > 5 {
+					t.Fatal("Pagination did not terminate")
+				}
+				page, err := db.ListAccounts(opts)
+				if err != nil {
+					t.Fatalf("Failed to list accounts: %v", err)
+				}
+				if page.Total != 5 {
+					t.Errorf("Expected total 5, got %d", page.Total)
+				}
+				for _, account := range page.Accounts {
+					if seen[account.ID] {
+						t.Errorf("Sort %q returned account %d twice", sort, account.ID)
+					}
+					seen[account.ID] = true
+				}
+				if page.NextCursor == "" {
+					break
+				}
+				opts.Cursor = page.NextCursor
+			}
+			if len(seen) != 5 {
+				t.Errorf("Sort %q: expected to see 5 accounts, saw %d", sort, len(seen))
+			}
+		}
+
+		grade := 1
+		page, err := db.ListAccounts(models.AccountListOptions{School: "North", Grade: &grade})
+		if err != nil {
+			t.Fatalf("Failed to list accounts: %v", err)
+		}
+		if page.Total != 2 || len(page.Accounts) != 2 {
+			t.Errorf("Expected 2 grade 1 accounts in North, got %d", page.Total)
+		}
+
+		page, err = db.ListAccounts(models.AccountListOptions{Sort: "username", Descending: true, Limit: 1})
+		if err != nil {
+			t.Fatalf("Failed to list accounts: %v", err)
+		}
+		if page.Accounts[0].Username != "list5" {
+			t.Errorf("Expected list5 first, got %s", page.Accounts[0].Username)
+		}
+
+		if _, err := db.ListAccounts(models.AccountListOptions{Sort: "username", Cursor: page.NextCursor}); err != ErrInvalidCursor {
+			t.Errorf("Expected ErrInvalidCursor for a cursor from another sort order, got %v", err)
+		}
+	})
+}
+
+func TestSearchAccounts(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, db *Database) {
+		people := []models.CreateAccountRequest{
+			{Username: "jsmith", Email: "john.smith@example.com", Password: "password123", FirstName: "John", LastName: "Smith", School: "Lincoln Elementary"},
+			{Username: "jsmythe", Email: "joanna@example.com", Password: "password123", FirstName: "Joanna", LastName: "Smythe", School: "Lincoln Elementary"},
+			{Username: "bobby", Email: "bob@example.com", Password: "password123", FirstName: "Bob", LastName: "Jones", School: "Washington Middle"},
+		}
+		for _, req := range people {
+			if _, err := db.CreateAccount(req); err != nil {
+				t.Fatalf("Failed to create account: %v", err)
+			}
+		}
+
+		search := func(query string, opts models.AccountListOptions) []string {
+			accounts, err := db.SearchAccounts(query, opts)
+			if err != nil {
+				t.Fatalf("Failed to search %q: %v", query, err)
+			}
+			var usernames []string
+			for _, account := range accounts {
+				usernames = append(usernames, account.Username)
+			}
+			return usernames
+		}
+
+		if got := search("jo smi", models.AccountListOptions{}); len(got) != 1 || got[0] != "jsmith" {
+			t.Errorf("Expected jo smi to find jsmith, got %v", got)
+		}
+		if got := search("sm", models.AccountListOptions{}); len(got) != 2 {
+			t.Errorf("Expected sm to find 2 accounts, got %v", got)
+		}
+		if got := search("jo", models.AccountListOptions{School: "Washington Middle"}); len(got) != 1 || got[0] != "bobby" {
+			t.Errorf("Expected a school-scoped search to find bobby, got %v", got)
+		}
+		if got := search("!!", models.AccountListOptions{}); len(got) != 0 {
+			t.Errorf("Expected punctuation-only query to find nothing, got %v", got)
+		}
+
+		// Renames and deletes must be reflected in the index
+		bob, _ := db.GetAccountByUsername("bobby")
+		if _, err := db.UpdateAccount(bob.ID, models.UpdateAccountRequest{
+			FirstName: "Robert", LastName: "Jones", School: bob.School, IsActive: true,
+		}); err != nil {
+			t.Fatalf("Failed to update account: %v", err)
+		}
+		if got := search("robert", models.AccountListOptions{}); len(got) != 1 {
+			t.Errorf("Expected renamed account to be found, got %v", got)
+		}
 
-	for _, req := range requests {
-		_, err := db.CreateAccount(req)
+		if err := db.DeleteAccount(bob.ID); err != nil {
+			t.Fatalf("Failed to delete account: %v", err)
+		}
+		if got := search("robert", models.AccountListOptions{}); len(got) != 0 {
+			t.Errorf("Expected deleted account to be gone, got %v", got)
+		}
+	})
+}
+
+func TestUpdateAccountVersion(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, db *Database) {
+		account, err := db.CreateAccount(models.CreateAccountRequest{Username: "versioned", Email: "v@example.com", Password: "password123"})
 		if err != nil {
 			t.Fatalf("Failed to create account: %v", err)
 		}
-	}
+		if account.Version != 1 {
+			t.Errorf("Expected a new account to be version 1, got %d", account.Version)
+		}
 
-	// Test that we have accounts (basic verification without GetStats method)
-	// We'll verify by getting accounts individually
-	account1, err := db.GetAccountByUsername("stats1")
-	if err != nil {
-		t.Fatalf("Failed to get stats1 account: %v", err)
-	}
-	if account1.Grade != 4 {
-		t.Errorf("Expected grade 4, got %d", account1.Grade)
-	}
+		stale := account.Version
+		updated, err := db.UpdateAccount(account.ID, models.UpdateAccountRequest{FirstName: "Vera", IsActive: true, Version: &stale})
+		if err != nil {
+			t.Fatalf("Failed to update account: %v", err)
+		}
+		if updated.Version != stale+1 {
+			t.Errorf("Expected version %d, got %d", stale+1, updated.Version)
+		}
+
+		_, err = db.UpdateAccount(account.ID, models.UpdateAccountRequest{FirstName: "Val", IsActive: true, Version: &stale})
+		if !errors.Is(err, ErrAccountChanged) {
+			t.Errorf("Expected an update of a stale version to fail with ErrAccountChanged, got %v", err)
+		}
+		if _, err = db.UpdateAccount(account.ID, models.UpdateAccountRequest{FirstName: "Vera", IsActive: true, Version: &stale}); !errors.Is(err, ErrAccountChanged) {
+			t.Errorf("Expected a stale version to fail even when nothing would change, got %v", err)
+		}
+
+		// Saving the account unchanged keeps its version, and so its ETag
+		current := updated.Version
+		if same, err := db.UpdateAccount(account.ID, models.UpdateAccountRequest{FirstName: "Vera", IsActive: true, Version: &current}); err != nil || same.Version != current {
+			t.Errorf("Expected an update changing nothing to keep version %d, got %+v, %v", current, same, err)
+		}
+		missing := 1
+		if _, err := db.UpdateAccount(9999, models.UpdateAccountRequest{Version: &missing}); err == nil || errors.Is(err, ErrAccountChanged) {
+			t.Errorf("Expected a missing account to be reported as not found, got %v", err)
+		}
+
+		// Other writers of the same fields move the version on too
+		if deactivated, _ := db.SetAccountActive(account.ID, false); deactivated.Version != updated.Version+1 {
+			t.Errorf("Expected deactivating to bump the version, got %d", deactivated.Version)
+		}
+	})
+}
+
+func TestSoftDeleteAccount(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, db *Database) {
+		account, err := db.CreateAccount(models.CreateAccountRequest{
+			Username: "leaving", Email: "leaving@example.com", Password: "password123", FirstName: "Lee", LastName: "Ving",
+		})
+		if err != nil {
+			t.Fatalf("Failed to create account: %v", err)
+		}
+		if err := db.CreateRefreshToken(account.ID, "refresh-hash", time.Now().Add(time.Hour)); err != nil {
+			t.Fatalf("Failed to create refresh token: %v", err)
+		}
+
+		if err := db.DeleteAccount(account.ID); err != nil {
+			t.Fatalf("Failed to delete account: %v", err)
+		}
+		if err := db.DeleteAccount(account.ID); err == nil {
+			t.Error("Expected deleting a deleted account to fail")
+		}
+		if _, err := db.GetAccountByID(account.ID); err == nil {
+			t.Error("Expected a deleted account to be hidden")
+		}
+		if _, err := db.GetAccountByUsername("leaving"); err == nil {
+			t.Error("Expected a deleted account to be hidden by username")
+		}
+		if page, _ := db.ListAccounts(models.AccountListOptions{}); page.Total != 0 {
+			t.Errorf("Expected no live accounts, got %d", page.Total)
+		}
+		if page, _ := db.ListAccounts(models.AccountListOptions{Deleted: true}); page.Total != 1 || page.Accounts[0].DeletedAt == nil {
+			t.Errorf("Expected the deleted account to be listed, got %+v", page)
+		}
+		if _, err := db.RotateRefreshToken("refresh-hash", "next-hash", time.Now().Add(time.Hour)); err == nil {
+			t.Error("Expected deleting to revoke refresh tokens")
+		}
+
+		restored, err := db.RestoreAccount(account.ID)
+		if err != nil {
+			t.Fatalf("Failed to restore account: %v", err)
+		}
+		if restored.DeletedAt != nil || restored.Username != "leaving" {
+			t.Errorf("Unexpected restored account: %+v", restored)
+		}
+		if _, err := db.RestoreAccount(account.ID); err == nil {
+			t.Error("Expected restoring a live account to fail")
+		}
+
+		if err := db.DeleteAccount(account.ID); err != nil {
+			t.Fatalf("Failed to delete account: %v", err)
+		}
+		if n, err := db.PurgeDeletedAccounts(time.Now().Add(-time.Hour)); err != nil || n != 0 {
+			t.Errorf("Expected a recent delete to be kept, purged %d: %v", n, err)
+		}
+		if n, err := db.PurgeDeletedAccounts(time.Now().Add(time.Second)); err != nil || n != 1 {
+			t.Errorf("Expected one account to be purged, purged %d: %v", n, err)
+		}
+		if _, err := db.GetDeletedAccount(account.ID); err == nil {
+			t.Error("Expected a purged account to be gone")
+		}
+	})
+}
+
+func TestAPIKeyLifecycle(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, db *Database) {
+		expiresAt := time.Now().Add(time.Hour)
+		created, err := db.CreateAPIKey(models.APIKey{
+			Name:      "game server",
+			Prefix:    "egdb_abcdefgh",
+			Owner:     "platform team",
+			Scopes:    []string{"accounts:read", "accounts:write"},
+			ExpiresAt: &expiresAt,
+		}, "hash-of-secret")
+		if err != nil {
+			t.Fatalf("Failed to create API key: %v", err)
+		}
+
+		key, err := db.GetAPIKeyByHash("hash-of-secret")
+		if err != nil {
+			t.Fatalf("Failed to get API key by hash: %v", err)
+		}
+		if key.ID != created.ID || !key.HasScope("accounts:write") {
+			t.Errorf("Unexpected API key returned: %+v", key)
+		}
+		if !key.IsUsable(time.Now()) {
+			t.Error("Fresh API key should be usable")
+		}
+
+		if err := db.TouchAPIKey(key.ID); err != nil {
+			t.Fatalf("Failed to touch API key: %v", err)
+		}
+		if err := db.RevokeAPIKey(key.ID); err != nil {
+			t.Fatalf("Failed to revoke API key: %v", err)
+		}
+
+		key, err = db.GetAPIKeyByID(created.ID)
+		if err != nil {
+			t.Fatalf("Failed to get API key: %v", err)
+		}
+		if key.LastUsedAt == nil {
+			t.Error("Expected last_used_at to be recorded")
+		}
+		if key.IsUsable(time.Now()) {
+			t.Error("Revoked API key should not be usable")
+		}
+	})
+}
+
+func TestGetStats(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, db *Database) {
+		// Create test accounts with different grades and schools
+		requests := []models.CreateAccountRequest{
+			{Username: "stats1", Email: "stats1@example.com", Password: "password123", FirstName: "Stats", LastName: "One", Grade: 4, School: "School A"},
+			{Username: "stats2", Email: "stats2@example.com", Password: "password123", FirstName: "Stats", LastName: "Two", Grade: 5, School: "School A"},
+			{Username: "stats3", Email: "stats3@example.com", Password: "password123", FirstName: "Stats", LastName: "Three", Grade: 4, School: "School B"},
+			{Username: "stats4", Email: "stats4@example.com", Password: "password123", FirstName: "Stats", LastName: "Four", Grade: 6, School: "School B"},
+		}
+
+		for _, req := range requests {
+			_, err := db.CreateAccount(req)
+			if err != nil {
+				t.Fatalf("Failed to create account: %v", err)
+			}
+		}
+
+		// Test that we have accounts (basic verification without GetStats method)
+		// We'll verify by getting accounts individually
+		account1, err := db.GetAccountByUsername("stats1")
+		if err != nil {
+			t.Fatalf("Failed to get stats1 account: %v", err)
+		}
+		if account1.Grade != 4 {
+			t.Errorf("Expected grade 4, got %d", account1.Grade)
+		}
+	})
 }
 
 func BenchmarkCreateAccount(b *testing.B) {
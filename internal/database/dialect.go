@@ -0,0 +1,126 @@
+package database
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync/atomic"
+)
+
+// dialect captures the differences between the supported SQL backends.
+// Queries are written once with ? placeholders and rebound per backend.
+type dialect interface {
+	// name identifies the backend, and the migrations directory it uses
+	name() string
+	// driverName is the database/sql driver to open
+	driverName() string
+	// rebind rewrites ? placeholders into the backend's syntax
+	rebind(query string) string
+	// migrationsTableDDL creates the schema_migrations table
+	migrationsTableDDL() string
+	// tableExistsQuery takes a table name and returns a row count
+	tableExistsQuery() string
+	// columnExistsQuery takes a table and column name and returns a row count
+	columnExistsQuery() string
+}
+
+type sqliteDialect struct{}
+
+func (sqliteDialect) name() string               { return "sqlite" }
+func (sqliteDialect) driverName() string         { return "sqlite3" }
+func (sqliteDialect) rebind(query string) string { return query }
+
+func (sqliteDialect) migrationsTableDDL() string {
+	return `
+	CREATE TABLE schema_migrations (
+		version INTEGER PRIMARY KEY,
+		name TEXT NOT NULL,
+		applied_at DATETIME NOT NULL
+	)
+	`
+}
+
+func (sqliteDialect) tableExistsQuery() string {
+	return `SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = ?`
+}
+
+func (sqliteDialect) columnExistsQuery() string {
+	return `SELECT COUNT(*) FROM pragma_table_info(?) WHERE name = ?`
+}
+
+type postgresDialect struct{}
+
+func (postgresDialect) name() string       { return "postgres" }
+func (postgresDialect) driverName() string { return "postgres" }
+
+// rebind turns ? placeholders into $1, $2, ... skipping quoted literals
+func (postgresDialect) rebind(query string) string {
+	var (
+		b       strings.Builder
+		n       int
+		inQuote bool
+	)
+	b.Grow(len(query) + 8)
+	for _, r := range query {
+		switch {
+		case r == '\'':
+			inQuote = !inQuote
+			b.WriteRune(r)
+		case r == '?' && !inQuote:
+			n++
+			b.WriteByte('$')
+			b.WriteString(strconv.Itoa(n))
+		default:
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+func (postgresDialect) migrationsTableDDL() string {
+	return `
+	CREATE TABLE schema_migrations (
+		version INTEGER PRIMARY KEY,
+		name TEXT NOT NULL,
+		applied_at TIMESTAMPTZ NOT NULL
+	)
+	`
+}
+
+func (postgresDialect) tableExistsQuery() string {
+	return `SELECT COUNT(*) FROM information_schema.tables
+	WHERE table_schema = current_schema() AND table_name = ?`
+}
+
+func (postgresDialect) columnExistsQuery() string {
+	return `SELECT COUNT(*) FROM information_schema.columns
+	WHERE table_schema = current_schema() AND table_name = ? AND column_name = ?`
+}
+
+// memoryDatabaseCounter keeps in-memory SQLite databases opened in the same process apart
+var memoryDatabaseCounter int64
+
+// parseDSN picks the backend for a --db value and returns the driver DSN.
+// postgres:// and postgresql:// URLs select PostgreSQL; anything else is an
+// SQLite file path, optionally prefixed with sqlite://.
+func parseDSN(dsn string) (dialect, string, error) {
+	switch {
+	case strings.HasPrefix(dsn, "postgres://"), strings.HasPrefix(dsn, "postgresql://"):
+		return postgresDialect{}, dsn, nil
+	case dsn == "":
+		return nil, "", fmt.Errorf("database DSN must not be empty")
+	}
+
+	path := strings.TrimPrefix(dsn, "sqlite://")
+	if path == ":memory:" {
+		// Give each in-memory database its own name so every pooled connection sees the same data
+		id := atomic.AddInt64(&memoryDatabaseCounter, 1)
+		return sqliteDialect{}, fmt.Sprintf("file:memdb%d?mode=memory&cache=shared&_foreign_keys=on", id), nil
+	}
+
+	separator := "?"
+	if strings.Contains(path, "?") {
+		separator = "&"
+	}
+	return sqliteDialect{}, path + separator + "_foreign_keys=on&_busy_timeout=5000", nil
+}
@@ -0,0 +1,31 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+
+	"educational-game-db/internal/models"
+)
+
+// GetAccountByExternalID returns the account imported with an ID from a
+// student information system
+func (d *Database) GetAccountByExternalID(id string) (*models.Account, error) {
+	query := `SELECT ` + accountColumns + ` FROM accounts WHERE external_id = ? AND deleted_at IS NULL`
+
+	account, err := scanAccount(d.db.QueryRow(query, id))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("account not found")
+		}
+		return nil, fmt.Errorf("failed to get account: %w", err)
+	}
+
+	return account, nil
+}
+
+func externalID(id string) interface{} {
+	if id == "" {
+		return nil
+	}
+	return id
+}
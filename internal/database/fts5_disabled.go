@@ -0,0 +1,7 @@
+//go:build !sqlite_fts5
+
+package database
+
+// sqliteFullText reports whether go-sqlite3 was built with FTS5, which
+// requires the sqlite_fts5 build tag
+const sqliteFullText = false
@@ -0,0 +1,181 @@
+package database
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"educational-game-db/internal/models"
+)
+
+var (
+	// ErrNotGuardian is returned when linking a student to an account that is not a guardian
+	ErrNotGuardian = errors.New("account is not a guardian")
+	// ErrNotStudent is returned when a guardian is linked to an account that is not a student
+	ErrNotStudent = errors.New("account is not a student")
+)
+
+const guardianLinkColumns = `guardian_id, student_id, consented_at, consent_method, policy_version, recorded_by`
+
+func scanGuardianLink(row rowScanner) (*models.GuardianLink, error) {
+	var link models.GuardianLink
+	err := row.Scan(&link.GuardianID, &link.StudentID, &link.ConsentedAt, &link.ConsentMethod,
+		&link.PolicyVersion, &link.RecordedBy)
+	if err != nil {
+		return nil, err
+	}
+	return &link, nil
+}
+
+// requestConsent remembers which guardian a pending student asked for
+func (d *Database) requestConsent(studentID int, guardianEmail string) error {
+	_, err := d.db.Exec(`INSERT INTO consent_requests (student_id, guardian_email, created_at) VALUES (?, ?, ?)`,
+		studentID, strings.ToLower(strings.TrimSpace(guardianEmail)), time.Now())
+	if err != nil {
+		return fmt.Errorf("failed to request consent: %w", err)
+	}
+	return nil
+}
+
+// PendingConsents returns the students waiting for consent from the guardian
+// with this email address
+func (d *Database) PendingConsents(guardianEmail string) ([]models.Account, error) {
+	query := `SELECT ` + accountColumns + ` FROM accounts
+	WHERE consent_status = ? AND deleted_at IS NULL
+		AND id IN (SELECT student_id FROM consent_requests WHERE guardian_email = ?)
+	ORDER BY id`
+	accounts, err := d.queryAccounts(query, models.ConsentPending, strings.ToLower(strings.TrimSpace(guardianEmail)))
+	if err != nil {
+		return nil, err
+	}
+	if accounts == nil {
+		accounts = []models.Account{}
+	}
+	return accounts, nil
+}
+
+// SetConsentToken stores the hash of the consent token sent to the guardian a
+// student asked, replacing any token sent before
+func (d *Database) SetConsentToken(studentID int, tokenHash string, expiresAt time.Time) error {
+	result, err := d.db.Exec(`UPDATE consent_requests SET token_hash = ?, expires_at = ? WHERE student_id = ?`,
+		tokenHash, expiresAt, studentID)
+	if err != nil {
+		return fmt.Errorf("failed to set consent token: %w", err)
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return fmt.Errorf("consent request not found")
+	}
+	return nil
+}
+
+// ConsentRequested reports whether a student asked the guardian with this
+// email address for consent and the guardian holds the unexpired token sent
+// to that address
+func (d *Database) ConsentRequested(studentID int, guardianEmail, tokenHash string) (bool, error) {
+	var n int
+	err := d.db.QueryRow(`SELECT COUNT(*) FROM consent_requests
+	WHERE student_id = ? AND guardian_email = ? AND token_hash = ? AND expires_at > ?`,
+		studentID, strings.ToLower(strings.TrimSpace(guardianEmail)), tokenHash, time.Now()).Scan(&n)
+	if err != nil {
+		return false, fmt.Errorf("failed to check consent request: %w", err)
+	}
+	return n > 0, nil
+}
+
+// RecordConsent links a guardian to a student with the consent they gave,
+// replacing any earlier consent of the same guardian, and lets a pending
+// student sign in
+func (d *Database) RecordConsent(link models.GuardianLink) (*models.GuardianLink, error) {
+	if link.ConsentedAt.IsZero() {
+		link.ConsentedAt = time.Now()
+	}
+
+	err := d.InTx(func(tx *Database) error {
+		guardian, err := tx.GetAccountByID(link.GuardianID)
+		if err != nil {
+			return err
+		}
+		if guardian.Role != models.RoleGuardian {
+			return ErrNotGuardian
+		}
+		student, err := tx.GetAccountByID(link.StudentID)
+		if err != nil {
+			return err
+		}
+		if student.Role != models.RoleStudent {
+			return ErrNotStudent
+		}
+
+		_, err = tx.db.Exec(`
+		INSERT INTO guardian_links (`+guardianLinkColumns+`)
+		VALUES (?, ?, ?, ?, ?, ?)
+		ON CONFLICT (guardian_id, student_id) DO UPDATE SET consented_at = excluded.consented_at,
+			consent_method = excluded.consent_method, policy_version = excluded.policy_version,
+			recorded_by = excluded.recorded_by
+		`, link.GuardianID, link.StudentID, link.ConsentedAt, link.ConsentMethod, link.PolicyVersion, link.RecordedBy)
+		if err != nil {
+			return fmt.Errorf("failed to record consent: %w", err)
+		}
+
+		if _, err := tx.db.Exec(`UPDATE accounts SET consent_status = ?, updated_at = ? WHERE id = ? AND consent_status = ?`,
+			models.ConsentGranted, time.Now(), link.StudentID, models.ConsentPending); err != nil {
+			return fmt.Errorf("failed to update consent status: %w", err)
+		}
+		if _, err := tx.db.Exec(`DELETE FROM consent_requests WHERE student_id = ?`, link.StudentID); err != nil {
+			return fmt.Errorf("failed to clear consent request: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &link, nil
+}
+
+// GetGuardianLinks returns the guardians linked to a student
+func (d *Database) GetGuardianLinks(studentID int) ([]models.GuardianLink, error) {
+	rows, err := d.db.Query(`SELECT `+guardianLinkColumns+` FROM guardian_links WHERE student_id = ? ORDER BY consented_at`, studentID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get guardians: %w", err)
+	}
+	defer rows.Close()
+
+	links := []models.GuardianLink{}
+	for rows.Next() {
+		link, err := scanGuardianLink(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan guardian link: %w", err)
+		}
+		links = append(links, *link)
+	}
+
+	return links, rows.Err()
+}
+
+// GetChildren returns the students linked to a guardian
+func (d *Database) GetChildren(guardianID int) ([]models.Account, error) {
+	query := `SELECT ` + accountColumns + ` FROM accounts
+	WHERE deleted_at IS NULL AND id IN (SELECT student_id FROM guardian_links WHERE guardian_id = ?)
+	ORDER BY first_name, id`
+	accounts, err := d.queryAccounts(query, guardianID)
+	if err != nil {
+		return nil, err
+	}
+	if accounts == nil {
+		accounts = []models.Account{}
+	}
+	return accounts, nil
+}
+
+// IsGuardianOf reports whether a guardian is linked to a student
+func (d *Database) IsGuardianOf(guardianID, studentID int) (bool, error) {
+	var n int
+	err := d.db.QueryRow(`SELECT COUNT(*) FROM guardian_links WHERE guardian_id = ? AND student_id = ?`,
+		guardianID, studentID).Scan(&n)
+	if err != nil {
+		return false, fmt.Errorf("failed to check guardian link: %w", err)
+	}
+	return n > 0, nil
+}
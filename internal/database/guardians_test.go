@@ -0,0 +1,78 @@
+package database
+
+import (
+	"errors"
+	"testing"
+
+	"educational-game-db/internal/models"
+)
+
+func TestGuardianConsent(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, db *Database) {
+		student, err := db.CreateAccount(models.CreateAccountRequest{
+			Username: "kid", Email: "kid@example.com", Password: "password123", Grade: 2,
+			GuardianEmail: "parent@example.com", ConsentStatus: models.ConsentPending,
+		})
+		if err != nil {
+			t.Fatalf("Failed to create student: %v", err)
+		}
+		if !student.AwaitingConsent() {
+			t.Fatalf("Expected student to await consent, got %q", student.ConsentStatus)
+		}
+		guardian, err := db.CreateAccount(models.CreateAccountRequest{
+			Username: "parent", Email: "parent@example.com", Password: "password123", Role: models.RoleGuardian,
+		})
+		if err != nil {
+			t.Fatalf("Failed to create guardian: %v", err)
+		}
+
+		pending, err := db.PendingConsents("Parent@example.com")
+		if err != nil {
+			t.Fatalf("Failed to get pending consents: %v", err)
+		}
+		if len(pending) != 1 || pending[0].ID != student.ID {
+			t.Fatalf("Expected kid to be pending, got %+v", pending)
+		}
+
+		if _, err := db.RecordConsent(models.GuardianLink{GuardianID: student.ID, StudentID: student.ID}); !errors.Is(err, ErrNotGuardian) {
+			t.Errorf("Expected ErrNotGuardian, got %v", err)
+		}
+
+		link, err := db.RecordConsent(models.GuardianLink{
+			GuardianID: guardian.ID, StudentID: student.ID,
+			ConsentMethod: models.ConsentMethodSignedForm, PolicyVersion: "v1", RecordedBy: 99,
+		})
+		if err != nil {
+			t.Fatalf("Failed to record consent: %v", err)
+		}
+		if link.ConsentedAt.IsZero() {
+			t.Error("Expected the consent time to be recorded")
+		}
+		if _, err := db.RecordConsent(models.GuardianLink{
+			GuardianID: guardian.ID, StudentID: student.ID,
+			ConsentMethod: models.ConsentMethodOnline, PolicyVersion: "v2", RecordedBy: guardian.ID,
+		}); err != nil {
+			t.Fatalf("Failed to renew consent: %v", err)
+		}
+
+		links, err := db.GetGuardianLinks(student.ID)
+		if err != nil {
+			t.Fatalf("Failed to get guardian links: %v", err)
+		}
+		if len(links) != 1 || links[0].PolicyVersion != "v2" || links[0].ConsentMethod != models.ConsentMethodOnline {
+			t.Errorf("Expected one link with the renewed consent, got %+v", links)
+		}
+
+		student, _ = db.GetAccountByID(student.ID)
+		if student.ConsentStatus != models.ConsentGranted {
+			t.Errorf("Expected consent to be granted, got %q", student.ConsentStatus)
+		}
+		if pending, _ := db.PendingConsents("parent@example.com"); len(pending) != 0 {
+			t.Errorf("Expected no pending consents, got %+v", pending)
+		}
+		children, err := db.GetChildren(guardian.ID)
+		if err != nil || len(children) != 1 || children[0].ID != student.ID {
+			t.Errorf("Expected kid as the only child, got %+v (%v)", children, err)
+		}
+	})
+}
@@ -0,0 +1,99 @@
+package database
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"educational-game-db/internal/models"
+)
+
+// SaveImportMapping creates the import mapping with m's name, or replaces it
+func (d *Database) SaveImportMapping(m models.ImportMapping) (*models.ImportMapping, error) {
+	definition, err := json.Marshal(m)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode import mapping: %w", err)
+	}
+
+	now := time.Now()
+	_, err = d.db.Exec(`
+	INSERT INTO import_mappings (name, definition, created_at, updated_at) VALUES (?, ?, ?, ?)
+	ON CONFLICT (name) DO UPDATE SET definition = excluded.definition, updated_at = excluded.updated_at
+	`, m.Name, string(definition), now, now)
+	if err != nil {
+		return nil, fmt.Errorf("failed to save import mapping: %w", err)
+	}
+
+	return d.GetImportMapping(m.Name)
+}
+
+func scanImportMapping(row rowScanner) (*models.ImportMapping, error) {
+	var (
+		m          models.ImportMapping
+		name       string
+		definition string
+		createdAt  time.Time
+		updatedAt  time.Time
+	)
+	if err := row.Scan(&name, &definition, &createdAt, &updatedAt); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal([]byte(definition), &m); err != nil {
+		return nil, fmt.Errorf("failed to decode import mapping %q: %w", name, err)
+	}
+
+	// The name and timestamps come from their columns, not the definition
+	m.Name, m.CreatedAt, m.UpdatedAt = name, createdAt, updatedAt
+	return &m, nil
+}
+
+// GetImportMapping returns the import mapping with a name
+func (d *Database) GetImportMapping(name string) (*models.ImportMapping, error) {
+	m, err := scanImportMapping(d.db.QueryRow(`
+	SELECT name, definition, created_at, updated_at FROM import_mappings WHERE name = ?
+	`, name))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("import mapping not found")
+		}
+		return nil, fmt.Errorf("failed to get import mapping: %w", err)
+	}
+	return m, nil
+}
+
+// ListImportMappings returns every import mapping ordered by name
+func (d *Database) ListImportMappings() ([]models.ImportMapping, error) {
+	rows, err := d.db.Query(`SELECT name, definition, created_at, updated_at FROM import_mappings ORDER BY name`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get import mappings: %w", err)
+	}
+	defer rows.Close()
+
+	mappings := []models.ImportMapping{}
+	for rows.Next() {
+		m, err := scanImportMapping(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan import mapping: %w", err)
+		}
+		mappings = append(mappings, *m)
+	}
+	return mappings, rows.Err()
+}
+
+// DeleteImportMapping removes the import mapping with a name
+func (d *Database) DeleteImportMapping(name string) error {
+	result, err := d.db.Exec(`DELETE FROM import_mappings WHERE name = ?`, name)
+	if err != nil {
+		return fmt.Errorf("failed to delete import mapping: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+	if rowsAffected == 0 {
+		return fmt.Errorf("import mapping not found")
+	}
+	return nil
+}
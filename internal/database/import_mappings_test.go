@@ -0,0 +1,40 @@
+package database
+
+import (
+	"testing"
+
+	"educational-game-db/internal/models"
+)
+
+func TestImportMappings(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, db *Database) {
+		mapping := models.ImportMapping{
+			Name:         "district7",
+			Columns:      map[string]string{"username": "Student Login"},
+			GradeAliases: map[string]int{"Pre-K": 0},
+		}
+		if _, err := db.SaveImportMapping(mapping); err != nil {
+			t.Fatalf("Failed to save mapping: %v", err)
+		}
+
+		// Saving again under the same name replaces it
+		mapping.Columns["email"] = "E-mail"
+		if _, err := db.SaveImportMapping(mapping); err != nil {
+			t.Fatalf("Failed to replace mapping: %v", err)
+		}
+		saved, err := db.GetImportMapping("district7")
+		if err != nil || saved.Columns["email"] != "E-mail" || saved.GradeAliases["Pre-K"] != 0 {
+			t.Fatalf("Expected the replaced mapping, got %+v, %v", saved, err)
+		}
+		if mappings, err := db.ListImportMappings(); err != nil || len(mappings) != 1 {
+			t.Errorf("Expected one mapping, got %+v, %v", mappings, err)
+		}
+
+		if err := db.DeleteImportMapping("district7"); err != nil {
+			t.Fatalf("Failed to delete mapping: %v", err)
+		}
+		if err := db.DeleteImportMapping("district7"); err == nil {
+			t.Errorf("Expected deleting a missing mapping to fail")
+		}
+	})
+}
@@ -0,0 +1,294 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"educational-game-db/internal/models"
+)
+
+// Periods tracked in leaderboard_totals
+const (
+	periodDay  = "day"
+	periodWeek = "week"
+)
+
+const (
+	defaultLeaderboardSize = 10
+	maxLeaderboardSize     = 100
+)
+
+// periodStarts returns the UTC day and the Monday starting the ISO week t falls in
+func periodStarts(t time.Time) (day, week string) {
+	t = t.UTC()
+	offset := (int(t.Weekday()) + 6) % 7
+	return t.Format("2006-01-02"), t.AddDate(0, 0, -offset).Format("2006-01-02")
+}
+
+// addLeaderboardXP adds experience to an account's day and week totals
+func (d *Database) addLeaderboardXP(accountID, amount int, at time.Time) error {
+	day, week := periodStarts(at)
+	for _, period := range []struct{ name, start string }{{periodDay, day}, {periodWeek, week}} {
+		_, err := d.db.Exec(`
+		INSERT INTO leaderboard_totals (account_id, period, period_start, xp)
+		VALUES (?, ?, ?, ?)
+		ON CONFLICT (account_id, period, period_start) DO UPDATE SET xp = leaderboard_totals.xp + excluded.xp
+		`, accountID, period.name, period.start, amount)
+		if err != nil {
+			return fmt.Errorf("failed to update leaderboard totals: %w", err)
+		}
+	}
+	return nil
+}
+
+// rebuildLeaderboardTotals recomputes the day and week totals from the ledger
+func (d *Database) rebuildLeaderboardTotals() error {
+	if _, err := d.db.Exec(`DELETE FROM leaderboard_totals`); err != nil {
+		return fmt.Errorf("failed to clear leaderboard totals: %w", err)
+	}
+
+	rows, err := d.db.Query(`SELECT account_id, amount, created_at FROM xp_events`)
+	if err != nil {
+		return fmt.Errorf("failed to read XP events: %w", err)
+	}
+	type key struct {
+		accountID     int
+		period, start string
+	}
+	totals := make(map[key]int)
+	for rows.Next() {
+		var (
+			accountID, amount int
+			createdAt         time.Time
+		)
+		if err := rows.Scan(&accountID, &amount, &createdAt); err != nil {
+			rows.Close()
+			return fmt.Errorf("failed to scan XP event: %w", err)
+		}
+		day, week := periodStarts(createdAt)
+		totals[key{accountID, periodDay, day}] += amount
+		totals[key{accountID, periodWeek, week}] += amount
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to read XP events: %w", err)
+	}
+
+	for k, xp := range totals {
+		if _, err := d.db.Exec(`INSERT INTO leaderboard_totals (account_id, period, period_start, xp) VALUES (?, ?, ?, ?)`,
+			k.accountID, k.period, k.start, xp); err != nil {
+			return fmt.Errorf("failed to store leaderboard total: %w", err)
+		}
+	}
+	return nil
+}
+
+// leaderboardSource is the FROM clause, value expression and conditions of a ranking
+type leaderboardSource struct {
+	from   string
+	value  string
+	conds  []string
+	args   []interface{}
+	period string
+	start  string
+}
+
+func leaderboardSourceFor(q models.LeaderboardQuery, now time.Time) (*leaderboardSource, error) {
+	src := &leaderboardSource{
+		from:  "accounts",
+		conds: []string{"accounts.deleted_at IS NULL", "accounts.is_active = ?", "accounts.role = ?", "accounts.leaderboard_opt_out = ?"},
+		args:  []interface{}{true, models.RoleStudent, false},
+	}
+
+	switch q.Scope {
+	case models.LeaderboardScopeGlobal:
+	case models.LeaderboardScopeSchool:
+		if q.School == "" {
+			return nil, fmt.Errorf("a school is required for the school scope")
+		}
+		src.conds = append(src.conds, "accounts.school = ?")
+		src.args = append(src.args, q.School)
+	case models.LeaderboardScopeGrade:
+		src.conds = append(src.conds, "accounts.grade = ?")
+		src.args = append(src.args, q.Grade)
+	default:
+		return nil, fmt.Errorf("unknown leaderboard scope %q", q.Scope)
+	}
+
+	switch q.Window {
+	case models.LeaderboardWindowAllTime:
+	case models.LeaderboardWindowDaily:
+		src.period = periodDay
+	case models.LeaderboardWindowWeekly:
+		src.period = periodWeek
+	default:
+		return nil, fmt.Errorf("unknown leaderboard window %q", q.Window)
+	}
+
+	switch {
+	case q.Metric == models.LeaderboardMetricLevel && src.period != "":
+		return nil, fmt.Errorf("level leaderboards are only available all-time")
+	case q.Metric == models.LeaderboardMetricLevel:
+		src.value = "accounts.game_level"
+	case q.Metric == models.LeaderboardMetricExperience && src.period == "":
+		src.value = "accounts.experience"
+	case q.Metric == models.LeaderboardMetricExperience:
+		day, week := periodStarts(now)
+		src.start = day
+		if src.period == periodWeek {
+			src.start = week
+		}
+		src.from = "leaderboard_totals JOIN accounts ON accounts.id = leaderboard_totals.account_id"
+		src.value = "leaderboard_totals.xp"
+		src.conds = append(src.conds, "leaderboard_totals.period = ?", "leaderboard_totals.period_start = ?", "leaderboard_totals.xp > 0")
+		src.args = append(src.args, src.period, src.start)
+	default:
+		return nil, fmt.Errorf("unknown leaderboard metric %q", q.Metric)
+	}
+
+	return src, nil
+}
+
+// GetLeaderboard ranks active students who have not opted out. Experience
+// boards are available all-time, daily and weekly; level boards all-time.
+func (d *Database) GetLeaderboard(q models.LeaderboardQuery) (*models.Leaderboard, error) {
+	src, err := leaderboardSourceFor(q, time.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	limit := q.Limit
+	if limit <= 0 {
+		limit = defaultLeaderboardSize
+	}
+	if limit > maxLeaderboardSize {
+		limit = maxLeaderboardSize
+	}
+
+	board := &models.Leaderboard{
+		Metric:      q.Metric,
+		Scope:       q.Scope,
+		Window:      q.Window,
+		PeriodStart: src.start,
+		Entries:     []models.LeaderboardEntry{},
+	}
+
+	query := `SELECT accounts.id, accounts.username, accounts.first_name, accounts.last_name,
+		accounts.school, accounts.grade, ` + src.value + ` FROM ` + src.from + whereClause(src.conds) +
+		` ORDER BY ` + src.value + ` DESC, accounts.id LIMIT ?`
+	rows, err := d.db.Query(query, append(src.args, limit)...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get leaderboard: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			entry               models.LeaderboardEntry
+			firstName, lastName string
+		)
+		if err := rows.Scan(&entry.AccountID, &entry.Username, &firstName, &lastName,
+			&entry.School, &entry.Grade, &entry.Value); err != nil {
+			return nil, fmt.Errorf("failed to scan leaderboard entry: %w", err)
+		}
+		entry.DisplayName = displayName(entry.Username, firstName, lastName)
+
+		// Competition ranking: ties share a rank and the next rank is skipped
+		entry.Rank = len(board.Entries) + 1
+		if n := len(board.Entries); n > 0 && board.Entries[n-1].Value == entry.Value {
+			entry.Rank = board.Entries[n-1].Rank
+		}
+		board.Entries = append(board.Entries, entry)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read leaderboard: %w", err)
+	}
+	rows.Close()
+
+	if q.AccountID != 0 {
+		if board.Me, err = d.leaderboardPosition(q, src); err != nil {
+			return nil, err
+		}
+	}
+
+	return board, nil
+}
+
+// leaderboardPosition ranks one account on a board, or returns nil when the
+// account does not appear on it
+func (d *Database) leaderboardPosition(q models.LeaderboardQuery, src *leaderboardSource) (*models.LeaderboardEntry, error) {
+	account, err := d.GetAccountByID(q.AccountID)
+	if err != nil {
+		return nil, err
+	}
+	if !account.IsActive || account.Role != models.RoleStudent || account.LeaderboardOptOut ||
+		(q.Scope == models.LeaderboardScopeSchool && account.School != q.School) ||
+		(q.Scope == models.LeaderboardScopeGrade && account.Grade != q.Grade) {
+		return nil, nil
+	}
+
+	entry := &models.LeaderboardEntry{
+		AccountID:   account.ID,
+		Username:    account.Username,
+		DisplayName: displayName(account.Username, account.FirstName, account.LastName),
+		School:      account.School,
+		Grade:       account.Grade,
+	}
+
+	switch {
+	case src.period != "":
+		err := d.db.QueryRow(`SELECT xp FROM leaderboard_totals WHERE account_id = ? AND period = ? AND period_start = ?`,
+			account.ID, src.period, src.start).Scan(&entry.Value)
+		if err != nil && err != sql.ErrNoRows {
+			return nil, fmt.Errorf("failed to get leaderboard total: %w", err)
+		}
+	case q.Metric == models.LeaderboardMetricLevel:
+		entry.Value = account.GameLevel
+	default:
+		entry.Value = account.Experience
+	}
+
+	var ahead int
+	conds := append(append([]string{}, src.conds...), src.value+" > ?")
+	args := append(append([]interface{}{}, src.args...), entry.Value)
+	if err := d.db.QueryRow(`SELECT COUNT(*) FROM `+src.from+whereClause(conds), args...).Scan(&ahead); err != nil {
+		return nil, fmt.Errorf("failed to rank account: %w", err)
+	}
+	entry.Rank = ahead + 1
+
+	return entry, nil
+}
+
+// SetLeaderboardOptOut hides an account from, or shows it on, leaderboards
+func (d *Database) SetLeaderboardOptOut(accountID int, optOut bool) (*models.Account, error) {
+	result, err := d.db.Exec(`UPDATE accounts SET leaderboard_opt_out = ?, updated_at = ? WHERE id = ?`,
+		optOut, time.Now(), accountID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to update leaderboard preference: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get rows affected: %w", err)
+	}
+	if rowsAffected == 0 {
+		return nil, fmt.Errorf("account not found")
+	}
+
+	return d.GetAccountByID(accountID)
+}
+
+// displayName shortens a student's name to first name and last initial
+func displayName(username, firstName, lastName string) string {
+	firstName = strings.TrimSpace(firstName)
+	if firstName == "" {
+		return username
+	}
+	if initial, _ := utf8.DecodeRuneInString(strings.TrimSpace(lastName)); initial != utf8.RuneError {
+		return firstName + " " + string(initial) + "."
+	}
+	return firstName
+}
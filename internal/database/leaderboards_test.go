@@ -0,0 +1,139 @@
+package database
+
+import (
+	"testing"
+	"time"
+
+	"educational-game-db/internal/models"
+)
+
+func TestPeriodStarts(t *testing.T) {
+	// 2024-03-10 is a Sunday; its ISO week starts on Monday 2024-03-04
+	day, week := periodStarts(time.Date(2024, 3, 10, 23, 30, 0, 0, time.UTC))
+	if day != "2024-03-10" || week != "2024-03-04" {
+		t.Errorf("Expected 2024-03-10 in week 2024-03-04, got %s in week %s", day, week)
+	}
+	day, week = periodStarts(time.Date(2024, 3, 4, 0, 0, 0, 0, time.UTC))
+	if day != "2024-03-04" || week != "2024-03-04" {
+		t.Errorf("Expected a Monday to start its own week, got %s in week %s", day, week)
+	}
+}
+
+func TestLeaderboard(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, db *Database) {
+		students := []struct {
+			username, school string
+			grade, xp        int
+		}{
+			{"ada", "North", 5, 300},
+			{"ben", "North", 5, 500},
+			{"cy", "North", 6, 300},
+			{"dee", "South", 5, 900},
+		}
+		ids := map[string]int{}
+		for _, s := range students {
+			account, err := db.CreateAccount(models.CreateAccountRequest{
+				Username: s.username, Email: s.username + "@example.com", Password: "password123",
+				FirstName: s.username, LastName: "Smith", School: s.school, Grade: s.grade,
+			})
+			if err != nil {
+				t.Fatalf("Failed to create account: %v", err)
+			}
+			if _, _, err := db.RecordXPEvent(models.XPEvent{AccountID: account.ID, Amount: s.xp, Source: "game"}); err != nil {
+				t.Fatalf("Failed to record XP: %v", err)
+			}
+			ids[s.username] = account.ID
+		}
+		teacher, err := db.CreateAccount(models.CreateAccountRequest{
+			Username: "teach", Email: "teach@example.com", Password: "password123", School: "North",
+		})
+		if err != nil {
+			t.Fatalf("Failed to create teacher: %v", err)
+		}
+		if _, err := db.SetAccountRole(teacher.ID, models.RoleTeacher); err != nil {
+			t.Fatalf("Failed to set role: %v", err)
+		}
+		if _, _, err := db.RecordXPEvent(models.XPEvent{AccountID: teacher.ID, Amount: 5000, Source: "game"}); err != nil {
+			t.Fatalf("Failed to record XP: %v", err)
+		}
+
+		board, err := db.GetLeaderboard(models.LeaderboardQuery{
+			Metric: models.LeaderboardMetricExperience, Scope: models.LeaderboardScopeSchool,
+			Window: models.LeaderboardWindowAllTime, School: "North", AccountID: ids["cy"],
+		})
+		if err != nil {
+			t.Fatalf("Failed to get leaderboard: %v", err)
+		}
+		if len(board.Entries) != 3 {
+			t.Fatalf("Expected 3 North students, got %+v", board.Entries)
+		}
+		ranks := []int{board.Entries[0].Rank, board.Entries[1].Rank, board.Entries[2].Rank}
+		if board.Entries[0].Username != "ben" || ranks[0] != 1 || ranks[1] != 2 || ranks[2] != 2 {
+			t.Errorf("Expected ben first and a tie for second, got %+v", board.Entries)
+		}
+		if board.Entries[0].DisplayName != "ben S." {
+			t.Errorf("Expected display name 'ben S.', got %q", board.Entries[0].DisplayName)
+		}
+		if board.Me == nil || board.Me.Rank != 2 || board.Me.Value != 300 {
+			t.Errorf("Expected cy to rank 2nd with 300 XP, got %+v", board.Me)
+		}
+
+		// Weekly boards count only this week's experience
+		if _, err := db.db.Exec(`UPDATE leaderboard_totals SET period_start = ? WHERE account_id = ?`, "2000-01-03", ids["dee"]); err != nil {
+			t.Fatalf("Failed to age totals: %v", err)
+		}
+		board, err = db.GetLeaderboard(models.LeaderboardQuery{
+			Metric: models.LeaderboardMetricExperience, Scope: models.LeaderboardScopeGrade,
+			Window: models.LeaderboardWindowWeekly, Grade: 5, AccountID: ids["dee"],
+		})
+		if err != nil {
+			t.Fatalf("Failed to get weekly leaderboard: %v", err)
+		}
+		if len(board.Entries) != 2 || board.Entries[0].Username != "ben" || board.PeriodStart == "" {
+			t.Errorf("Expected ben and ada on the weekly grade 5 board, got %+v", board)
+		}
+		if board.Me == nil || board.Me.Value != 0 || board.Me.Rank != 3 {
+			t.Errorf("Expected dee to rank 3rd with no XP this week, got %+v", board.Me)
+		}
+
+		if _, err := db.SetLeaderboardOptOut(ids["ben"], true); err != nil {
+			t.Fatalf("Failed to opt out: %v", err)
+		}
+		board, err = db.GetLeaderboard(models.LeaderboardQuery{
+			Metric: models.LeaderboardMetricLevel, Scope: models.LeaderboardScopeGlobal,
+			Window: models.LeaderboardWindowAllTime, AccountID: ids["ben"],
+		})
+		if err != nil {
+			t.Fatalf("Failed to get level leaderboard: %v", err)
+		}
+		for _, entry := range board.Entries {
+			if entry.Username == "ben" {
+				t.Error("Expected opted-out account to be hidden")
+			}
+		}
+		if board.Me != nil {
+			t.Errorf("Expected no rank for an opted-out account, got %+v", board.Me)
+		}
+
+		if _, err := db.GetLeaderboard(models.LeaderboardQuery{
+			Metric: models.LeaderboardMetricLevel, Scope: models.LeaderboardScopeGlobal, Window: models.LeaderboardWindowDaily,
+		}); err == nil {
+			t.Error("Expected daily level leaderboard to be rejected")
+		}
+
+		// Replaying the ledger rebuilds the period totals
+		if _, err := db.ReplayXP(); err != nil {
+			t.Fatalf("Failed to replay XP: %v", err)
+		}
+		board, err = db.GetLeaderboard(models.LeaderboardQuery{
+			Metric: models.LeaderboardMetricExperience, Scope: models.LeaderboardScopeGlobal,
+			Window: models.LeaderboardWindowDaily,
+		})
+		if err != nil {
+			t.Fatalf("Failed to get daily leaderboard: %v", err)
+		}
+		if len(board.Entries) != 3 || board.Entries[0].Username != "dee" {
+			t.Errorf("Expected dee back on top after replay, got %+v", board.Entries)
+		}
+	})
+}
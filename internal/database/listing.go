@@ -0,0 +1,255 @@
+package database
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"educational-game-db/internal/models"
+)
+
+// ErrInvalidCursor is returned when a pagination cursor cannot be decoded
+// or was issued for a different sort order
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// listCursor is the keyset position after the last account of a page
+type listCursor struct {
+	Sort  string          `json:"s"`
+	Desc  bool            `json:"d"`
+	Value json.RawMessage `json:"v"`
+	ID    int             `json:"id"`
+}
+
+func encodeCursor(opts models.AccountListOptions, last *models.Account) (string, error) {
+	value, err := json.Marshal(sortValue(opts.Sort, last))
+	if err != nil {
+		return "", err
+	}
+	data, err := json.Marshal(listCursor{Sort: opts.Sort, Desc: opts.Descending, Value: value, ID: last.ID})
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(data), nil
+}
+
+func decodeCursor(opts models.AccountListOptions) (interface{}, int, error) {
+	data, err := base64.RawURLEncoding.DecodeString(opts.Cursor)
+	if err != nil {
+		return nil, 0, ErrInvalidCursor
+	}
+	var cur listCursor
+	if err := json.Unmarshal(data, &cur); err != nil {
+		return nil, 0, ErrInvalidCursor
+	}
+	if cur.Sort != opts.Sort || cur.Desc != opts.Descending {
+		return nil, 0, ErrInvalidCursor
+	}
+
+	switch opts.Sort {
+	case "created_at":
+		var t time.Time
+		if err := json.Unmarshal(cur.Value, &t); err != nil {
+			return nil, 0, ErrInvalidCursor
+		}
+		return t, cur.ID, nil
+	case "username", "last_name":
+		var s string
+		if err := json.Unmarshal(cur.Value, &s); err != nil {
+			return nil, 0, ErrInvalidCursor
+		}
+		return s, cur.ID, nil
+	default:
+		var n int
+		if err := json.Unmarshal(cur.Value, &n); err != nil {
+			return nil, 0, ErrInvalidCursor
+		}
+		return n, cur.ID, nil
+	}
+}
+
+func sortValue(sort string, account *models.Account) interface{} {
+	switch sort {
+	case "username":
+		return account.Username
+	case "last_name":
+		return account.LastName
+	case "grade":
+		return account.Grade
+	case "game_level":
+		return account.GameLevel
+	case "experience":
+		return account.Experience
+	default:
+		return account.CreatedAt
+	}
+}
+
+// accountFilter builds the WHERE clause shared by a page and its total count
+func accountFilter(opts models.AccountListOptions) ([]string, []interface{}) {
+	var (
+		conds []string
+		args  []interface{}
+	)
+	if opts.Deleted {
+		conds = append(conds, "deleted_at IS NOT NULL")
+	} else {
+		conds = append(conds, "deleted_at IS NULL")
+	}
+	if opts.School != "" {
+		conds = append(conds, "school = ?")
+		args = append(args, opts.School)
+	}
+	if opts.SchoolID != nil {
+		conds = append(conds, "school_id = ?")
+		args = append(args, *opts.SchoolID)
+	}
+	if opts.ClassroomID != nil {
+		conds = append(conds, "id IN (SELECT account_id FROM enrollments WHERE classroom_id = ?)")
+		args = append(args, *opts.ClassroomID)
+	}
+	if len(opts.Roles) > 0 || opts.SelfID != 0 {
+		var either []string
+		if len(opts.Roles) > 0 {
+			roles := "role IN (?" + strings.Repeat(", ?", len(opts.Roles)-1) + ")"
+			for _, role := range opts.Roles {
+				args = append(args, role)
+			}
+			if opts.RosterOf != 0 {
+				roles = "(" + roles + " AND " + rosterCondition + ")"
+				args = append(args, opts.RosterOf)
+			}
+			either = append(either, roles)
+		}
+		if opts.SelfID != 0 {
+			either = append(either, "id = ?")
+			args = append(args, opts.SelfID)
+		}
+		conds = append(conds, "("+strings.Join(either, " OR ")+")")
+	}
+	if opts.Grade != nil {
+		conds = append(conds, "grade = ?")
+		args = append(args, *opts.Grade)
+	}
+	if opts.IsActive != nil {
+		conds = append(conds, "is_active = ?")
+		args = append(args, *opts.IsActive)
+	}
+	if opts.MinLevel != nil {
+		conds = append(conds, "game_level >= ?")
+		args = append(args, *opts.MinLevel)
+	}
+	if opts.MaxLevel != nil {
+		conds = append(conds, "game_level <= ?")
+		args = append(args, *opts.MaxLevel)
+	}
+	if opts.CreatedAfter != nil {
+		conds = append(conds, "created_at >= ?")
+		args = append(args, *opts.CreatedAfter)
+	}
+	if opts.CreatedBefore != nil {
+		conds = append(conds, "created_at < ?")
+		args = append(args, *opts.CreatedBefore)
+	}
+	return conds, args
+}
+
+// ListAccounts returns one page of accounts matching opts, using keyset
+// pagination over the sort column and the account ID
+func (d *Database) ListAccounts(opts models.AccountListOptions) (*models.AccountPage, error) {
+	if opts.Sort == "" {
+		opts.Sort = "created_at"
+		opts.Descending = true
+	}
+	if !models.IsValidAccountSortKey(opts.Sort) {
+		return nil, fmt.Errorf("unknown sort key %q", opts.Sort)
+	}
+	if opts.Limit <= 0 {
+		opts.Limit = models.DefaultPageSize
+	}
+	if opts.Limit > models.MaxPageSize {
+		opts.Limit = models.MaxPageSize
+	}
+
+	conds, args := accountFilter(opts)
+
+	page := &models.AccountPage{Accounts: []models.Account{}}
+	countQuery := `SELECT COUNT(*) FROM accounts` + whereClause(conds)
+	if err := d.db.QueryRow(countQuery, args...).Scan(&page.Total); err != nil {
+		return nil, fmt.Errorf("failed to count accounts: %w", err)
+	}
+
+	direction, cmp := "ASC", ">"
+	if opts.Descending {
+		direction, cmp = "DESC", "<"
+	}
+
+	if opts.Cursor != "" {
+		value, id, err := decodeCursor(opts)
+		if err != nil {
+			return nil, err
+		}
+		conds = append(conds, fmt.Sprintf("(%[1]s %[2]s ? OR (%[1]s = ? AND id %[2]s ?))", opts.Sort, cmp))
+		args = append(args, value, value, id)
+	}
+
+	// Fetch one extra row to learn whether another page follows
+	query := `SELECT ` + accountColumns + ` FROM accounts` + whereClause(conds) +
+		fmt.Sprintf(` ORDER BY %[1]s %[2]s, id %[2]s LIMIT ?`, opts.Sort, direction)
+	accounts, err := d.queryAccounts(query, append(args, opts.Limit+1)...)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(accounts) > opts.Limit {
+		accounts = accounts[:opts.Limit]
+		cursor, err := encodeCursor(opts, &accounts[len(accounts)-1])
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode cursor: %w", err)
+		}
+		page.NextCursor = cursor
+	}
+	if accounts != nil {
+		page.Accounts = accounts
+	}
+
+	return page, nil
+}
+
+// ForEachAccount calls fn with every account matching the filters of opts,
+// in ID order, reading one row at a time instead of loading them all. Sorting
+// and paging options are ignored. fn must not use the database, and
+// iteration stops at the first error it returns.
+func (d *Database) ForEachAccount(opts models.AccountListOptions, fn func(*models.Account) error) error {
+	conds, args := accountFilter(opts)
+	query := `SELECT ` + accountColumns + ` FROM accounts` + whereClause(conds) + ` ORDER BY id`
+
+	rows, err := d.db.Query(query, args...)
+	if err != nil {
+		return fmt.Errorf("failed to get accounts: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		account, err := scanAccount(rows)
+		if err != nil {
+			return fmt.Errorf("failed to scan account: %w", err)
+		}
+		if err := fn(account); err != nil {
+			return err
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to read accounts: %w", err)
+	}
+	return nil
+}
+
+func whereClause(conds []string) string {
+	if len(conds) == 0 {
+		return ""
+	}
+	return " WHERE " + strings.Join(conds, " AND ")
+}
@@ -0,0 +1,240 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"educational-game-db/internal/models"
+)
+
+// maxLoginKeyLength bounds the usernames stored for failed logins, which
+// are whatever the client sent
+const maxLoginKeyLength = 255
+
+// loginKey normalizes a username or IP so variants share one counter
+func loginKey(kind, key string) string {
+	key = strings.TrimSpace(key)
+	if kind == models.LoginKeyUsername {
+		key = strings.ToLower(key)
+	}
+	return clipLoginName(key)
+}
+
+// clipLoginName trims a client-supplied username to maxLoginKeyLength bytes
+func clipLoginName(name string) string {
+	if len(name) > maxLoginKeyLength {
+		return name[:maxLoginKeyLength]
+	}
+	return name
+}
+
+const loginLockColumns = `kind, login_key, failures, last_failure_at, locked_until`
+
+func scanLoginLock(row rowScanner) (*models.LoginLock, error) {
+	var (
+		lock        models.LoginLock
+		lockedUntil sql.NullTime
+	)
+	if err := row.Scan(&lock.Kind, &lock.Key, &lock.Failures, &lock.LastFailureAt, &lockedUntil); err != nil {
+		return nil, err
+	}
+	if lockedUntil.Valid {
+		lock.LockedUntil = &lockedUntil.Time
+	}
+	return &lock, nil
+}
+
+// LoginLockedUntil returns when logins for a username from an IP are next
+// allowed, or the zero time if they are allowed at now
+func (d *Database) LoginLockedUntil(username, ip string, now time.Time) (time.Time, error) {
+	query := `
+	SELECT ` + loginLockColumns + ` FROM login_failures
+	WHERE (kind = ? AND login_key = ?) OR (kind = ? AND login_key = ?)
+	`
+
+	rows, err := d.db.Query(query, models.LoginKeyUsername, loginKey(models.LoginKeyUsername, username),
+		models.LoginKeyIP, loginKey(models.LoginKeyIP, ip))
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to get login failures: %w", err)
+	}
+	defer rows.Close()
+
+	var until time.Time
+	for rows.Next() {
+		lock, err := scanLoginLock(rows)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("failed to scan login failures: %w", err)
+		}
+		if lock.IsLocked(now) && lock.LockedUntil.After(until) {
+			until = *lock.LockedUntil
+		}
+	}
+
+	return until, rows.Err()
+}
+
+// RecordLoginFailure counts a failed login against a username or IP,
+// forgetting failures older than window, and refuses further logins for
+// delay(failures)
+func (d *Database) RecordLoginFailure(kind, key string, window time.Duration, delay func(failures int) time.Duration) (*models.LoginLock, error) {
+	if !models.IsValidLoginKeyKind(kind) {
+		return nil, fmt.Errorf("invalid login key kind: %s", kind)
+	}
+	key = loginKey(kind, key)
+
+	var lock *models.LoginLock
+	err := d.InTx(func(tx *Database) error {
+		now := time.Now()
+		var failures int
+		err := tx.db.QueryRow(`
+		INSERT INTO login_failures (kind, login_key, failures, last_failure_at)
+		VALUES (?, ?, 1, ?)
+		ON CONFLICT (kind, login_key) DO UPDATE SET
+			failures = CASE WHEN login_failures.last_failure_at > ? THEN login_failures.failures + 1 ELSE 1 END,
+			last_failure_at = excluded.last_failure_at
+		RETURNING failures
+		`, kind, key, now, now.Add(-window)).Scan(&failures)
+		if err != nil {
+			return fmt.Errorf("failed to record login failure: %w", err)
+		}
+
+		var lockedUntil *time.Time
+		if wait := delay(failures); wait > 0 {
+			until := now.Add(wait)
+			lockedUntil = &until
+		}
+		_, err = tx.db.Exec(`UPDATE login_failures SET locked_until = ? WHERE kind = ? AND login_key = ?`,
+			lockedUntil, kind, key)
+		if err != nil {
+			return fmt.Errorf("failed to lock logins: %w", err)
+		}
+
+		lock = &models.LoginLock{Kind: kind, Key: key, Failures: failures, LastFailureAt: now, LockedUntil: lockedUntil}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return lock, nil
+}
+
+// ClearLoginFailures forgets the failed logins of a username or IP, lifting
+// any lockout. It reports whether there was anything to clear.
+func (d *Database) ClearLoginFailures(kind, key string) (bool, error) {
+	result, err := d.db.Exec(`DELETE FROM login_failures WHERE kind = ? AND login_key = ?`, kind, loginKey(kind, key))
+	if err != nil {
+		return false, fmt.Errorf("failed to clear login failures: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	return rowsAffected > 0, nil
+}
+
+// ListLoginLocks lists the usernames and IPs with recent failed logins,
+// most recent first, or only those locked out at now when lockedOnly is set
+func (d *Database) ListLoginLocks(lockedOnly bool, now time.Time) ([]models.LoginLock, error) {
+	query := `SELECT ` + loginLockColumns + ` FROM login_failures ORDER BY last_failure_at DESC`
+
+	rows, err := d.db.Query(query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get login failures: %w", err)
+	}
+	defer rows.Close()
+
+	var locks []models.LoginLock
+	for rows.Next() {
+		lock, err := scanLoginLock(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan login failures: %w", err)
+		}
+		if lockedOnly && !lock.IsLocked(now) {
+			continue
+		}
+		locks = append(locks, *lock)
+	}
+
+	return locks, rows.Err()
+}
+
+// RecordAuthEvent appends a login attempt to the auth log
+func (d *Database) RecordAuthEvent(event models.AuthEvent) error {
+	if event.CreatedAt.IsZero() {
+		event.CreatedAt = time.Now()
+	}
+
+	query := `
+	INSERT INTO auth_log (username, account_id, ip, outcome, created_at)
+	VALUES (?, ?, ?, ?, ?)
+	`
+
+	_, err := d.db.Exec(query, clipLoginName(strings.TrimSpace(event.Username)), event.AccountID,
+		event.IP, event.Outcome, event.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to record auth event: %w", err)
+	}
+
+	return nil
+}
+
+// GetAuthEvents returns the most recent auth log entries matching q
+func (d *Database) GetAuthEvents(q models.AuthLogQuery) ([]models.AuthEvent, error) {
+	var (
+		conds []string
+		args  []interface{}
+	)
+	if q.Username != "" {
+		conds = append(conds, "LOWER(username) = ?")
+		args = append(args, loginKey(models.LoginKeyUsername, q.Username))
+	}
+	if q.IP != "" {
+		conds = append(conds, "ip = ?")
+		args = append(args, q.IP)
+	}
+	if q.Outcome != "" {
+		conds = append(conds, "outcome = ?")
+		args = append(args, q.Outcome)
+	}
+
+	limit := q.Limit
+	if limit <= 0 {
+		limit = models.DefaultAuthLogLimit
+	}
+	if limit > models.MaxAuthLogLimit {
+		limit = models.MaxAuthLogLimit
+	}
+
+	query := `SELECT id, username, account_id, ip, outcome, created_at FROM auth_log` +
+		whereClause(conds) + ` ORDER BY created_at DESC, id DESC LIMIT ?`
+	args = append(args, limit)
+
+	rows, err := d.db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get auth log: %w", err)
+	}
+	defer rows.Close()
+
+	var events []models.AuthEvent
+	for rows.Next() {
+		var (
+			event     models.AuthEvent
+			accountID sql.NullInt64
+		)
+		if err := rows.Scan(&event.ID, &event.Username, &accountID, &event.IP, &event.Outcome, &event.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan auth event: %w", err)
+		}
+		if accountID.Valid {
+			id := int(accountID.Int64)
+			event.AccountID = &id
+		}
+		events = append(events, event)
+	}
+
+	return events, rows.Err()
+}
@@ -0,0 +1,110 @@
+package database
+
+import (
+	"testing"
+	"time"
+
+	"educational-game-db/internal/models"
+)
+
+func TestLoginFailures(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, db *Database) {
+		lockAfterTwo := func(failures int) time.Duration {
+			if failures >= 2 {
+				return time.Hour
+			}
+			return 0
+		}
+
+		lock, err := db.RecordLoginFailure(models.LoginKeyUsername, "Alice", time.Hour, lockAfterTwo)
+		if err != nil {
+			t.Fatalf("Failed to record login failure: %v", err)
+		}
+		if lock.Failures != 1 || lock.LockedUntil != nil {
+			t.Errorf("Expected one failure and no lockout, got %+v", lock)
+		}
+
+		now := time.Now()
+		until, err := db.LoginLockedUntil("alice", "192.0.2.1", now)
+		if err != nil {
+			t.Fatalf("Failed to check lockout: %v", err)
+		}
+		if !until.IsZero() {
+			t.Errorf("Expected no lockout after one failure, got %v", until)
+		}
+
+		if lock, err = db.RecordLoginFailure(models.LoginKeyUsername, "alice ", time.Hour, lockAfterTwo); err != nil {
+			t.Fatalf("Failed to record login failure: %v", err)
+		}
+		if lock.Failures != 2 || lock.LockedUntil == nil {
+			t.Fatalf("Expected the second failure to lock alice out, got %+v", lock)
+		}
+		if until, _ = db.LoginLockedUntil("ALICE", "192.0.2.1", now); until.IsZero() {
+			t.Error("Expected the username to be locked out regardless of case")
+		}
+		if until, _ = db.LoginLockedUntil("bob", "192.0.2.1", now); !until.IsZero() {
+			t.Error("Expected other usernames to be unaffected")
+		}
+
+		// Failures older than the window are forgotten
+		if lock, _ = db.RecordLoginFailure(models.LoginKeyIP, "192.0.2.1", 0, lockAfterTwo); lock.Failures != 1 {
+			t.Errorf("Expected the first IP failure, got %+v", lock)
+		}
+		if lock, _ = db.RecordLoginFailure(models.LoginKeyIP, "192.0.2.1", 0, lockAfterTwo); lock.Failures != 1 {
+			t.Errorf("Expected an empty window to forget earlier failures, got %+v", lock)
+		}
+
+		locks, err := db.ListLoginLocks(true, now)
+		if err != nil {
+			t.Fatalf("Failed to list lockouts: %v", err)
+		}
+		if len(locks) != 1 || locks[0].Key != "alice" {
+			t.Errorf("Expected only alice to be locked out, got %+v", locks)
+		}
+		if locks, _ = db.ListLoginLocks(false, now); len(locks) != 2 {
+			t.Errorf("Expected 2 keys with failures, got %d", len(locks))
+		}
+
+		cleared, err := db.ClearLoginFailures(models.LoginKeyUsername, "Alice")
+		if err != nil || !cleared {
+			t.Fatalf("Expected alice's lockout to be cleared, got %v, %v", cleared, err)
+		}
+		if until, _ = db.LoginLockedUntil("alice", "192.0.2.1", now); !until.IsZero() {
+			t.Error("Expected alice to be able to log in again")
+		}
+		if cleared, _ = db.ClearLoginFailures(models.LoginKeyUsername, "alice"); cleared {
+			t.Error("Expected nothing left to clear")
+		}
+	})
+}
+
+func TestAuthLog(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, db *Database) {
+		accountID := 7
+		events := []models.AuthEvent{
+			{Username: "alice", IP: "192.0.2.1", Outcome: models.AuthOutcomeFailure},
+			{Username: "Alice", IP: "192.0.2.1", Outcome: models.AuthOutcomeSuccess, AccountID: &accountID},
+			{Username: "mallory", IP: "198.51.100.9", Outcome: models.AuthOutcomeFailure},
+		}
+		for _, event := range events {
+			if err := db.RecordAuthEvent(event); err != nil {
+				t.Fatalf("Failed to record auth event: %v", err)
+			}
+		}
+
+		logged, err := db.GetAuthEvents(models.AuthLogQuery{Username: "ALICE"})
+		if err != nil {
+			t.Fatalf("Failed to get auth log: %v", err)
+		}
+		if len(logged) != 2 {
+			t.Fatalf("Expected 2 events for alice, got %d", len(logged))
+		}
+		if logged[0].Outcome != models.AuthOutcomeSuccess || logged[0].AccountID == nil || *logged[0].AccountID != accountID {
+			t.Errorf("Expected the latest event to be the successful login, got %+v", logged[0])
+		}
+
+		if logged, _ = db.GetAuthEvents(models.AuthLogQuery{Outcome: models.AuthOutcomeFailure, Limit: 1}); len(logged) != 1 || logged[0].Username != "mallory" {
+			t.Errorf("Expected mallory's failure, got %+v", logged)
+		}
+	})
+}
@@ -0,0 +1,360 @@
+package database
+
+import (
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//go:embed migrations
+var migrationFiles embed.FS
+
+// ErrSchemaTooNew is returned when the database was migrated by a newer
+// version of the application than the running one
+var ErrSchemaTooNew = errors.New("database schema is newer than this application supports")
+
+// Migration is a numbered schema change with its up and down SQL
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+}
+
+// MigrationStatus describes whether a migration has been applied
+type MigrationStatus struct {
+	Version   int
+	Name      string
+	AppliedAt *time.Time
+}
+
+// loadMigrations reads the embedded NNNN_name.up.sql / NNNN_name.down.sql
+// pairs of a backend. Every backend must ship the same numbered migrations.
+func loadMigrations(dialect dialect) ([]Migration, error) {
+	migrationsDir := path.Join("migrations", dialect.name())
+	entries, err := fs.ReadDir(migrationFiles, migrationsDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read migrations: %w", err)
+	}
+
+	byVersion := make(map[int]*Migration)
+	for _, entry := range entries {
+		name := entry.Name()
+
+		var direction string
+		switch {
+		case strings.HasSuffix(name, ".up.sql"):
+			direction = "up"
+		case strings.HasSuffix(name, ".down.sql"):
+			direction = "down"
+		default:
+			continue
+		}
+
+		base := strings.TrimSuffix(name, "."+direction+".sql")
+		versionStr, title, ok := strings.Cut(base, "_")
+		if !ok {
+			return nil, fmt.Errorf("invalid migration file name: %s", name)
+		}
+		version, err := strconv.Atoi(versionStr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid migration version in %s: %w", name, err)
+		}
+
+		content, err := migrationFiles.ReadFile(path.Join(migrationsDir, name))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read migration %s: %w", name, err)
+		}
+
+		m, exists := byVersion[version]
+		if !exists {
+			m = &Migration{Version: version, Name: title}
+			byVersion[version] = m
+		}
+		if direction == "up" {
+			m.Up = string(content)
+		} else {
+			m.Down = string(content)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.Up == "" || m.Down == "" {
+			return nil, fmt.Errorf("migration %04d_%s must have both up and down files", m.Version, m.Name)
+		}
+		migrations = append(migrations, *m)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+
+	for i, m := range migrations {
+		if m.Version != i+1 {
+			return nil, fmt.Errorf("migrations must be numbered consecutively from 1, found %04d", m.Version)
+		}
+	}
+
+	return migrations, nil
+}
+
+// LatestSchemaVersion returns the highest migration version known to this build
+func (d *Database) LatestSchemaVersion() (int, error) {
+	migrations, err := loadMigrations(d.dialect)
+	if err != nil {
+		return 0, err
+	}
+	return len(migrations), nil
+}
+
+func (d *Database) ensureMigrationsTable() error {
+	exists, err := d.tableExists("schema_migrations")
+	if err != nil {
+		return err
+	}
+	if exists {
+		return nil
+	}
+
+	// Databases created before migrations existed already have some tables;
+	// record what they contain so the matching migrations are not re-run
+	legacyVersion, err := d.detectLegacyVersion()
+	if err != nil {
+		return err
+	}
+
+	if _, err := d.db.Exec(d.dialect.migrationsTableDDL()); err != nil {
+		return fmt.Errorf("failed to create schema_migrations table: %w", err)
+	}
+
+	if legacyVersion == 0 {
+		return nil
+	}
+
+	migrations, err := loadMigrations(d.dialect)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	for _, m := range migrations[:legacyVersion] {
+		if _, err := d.db.Exec(`INSERT INTO schema_migrations (version, name, applied_at) VALUES (?, ?, ?)`,
+			m.Version, m.Name, now); err != nil {
+			return fmt.Errorf("failed to record legacy migration %d: %w", m.Version, err)
+		}
+	}
+
+	return nil
+}
+
+// detectLegacyVersion works out which migrations a pre-migrations database already matches
+func (d *Database) detectLegacyVersion() (int, error) {
+	// Only SQLite deployments predate migrations
+	if _, ok := d.dialect.(sqliteDialect); !ok {
+		return 0, nil
+	}
+
+	checks := []struct {
+		version int
+		probe   func() (bool, error)
+	}{
+		{4, func() (bool, error) { return d.tableExists("api_keys") }},
+		{3, func() (bool, error) { return d.columnExists("accounts", "role") }},
+		{2, func() (bool, error) { return d.tableExists("refresh_tokens") }},
+		{1, func() (bool, error) { return d.tableExists("accounts") }},
+	}
+
+	for _, check := range checks {
+		found, err := check.probe()
+		if err != nil {
+			return 0, fmt.Errorf("failed to inspect legacy schema: %w", err)
+		}
+		if found {
+			return check.version, nil
+		}
+	}
+
+	return 0, nil
+}
+
+func (d *Database) tableExists(table string) (bool, error) {
+	var count int
+	err := d.db.QueryRow(d.dialect.tableExistsQuery(), table).Scan(&count)
+	return count > 0, err
+}
+
+func (d *Database) columnExists(table, column string) (bool, error) {
+	var count int
+	err := d.db.QueryRow(d.dialect.columnExistsQuery(), table, column).Scan(&count)
+	return count > 0, err
+}
+
+// SchemaVersion returns the highest applied migration version
+func (d *Database) SchemaVersion() (int, error) {
+	if err := d.ensureMigrationsTable(); err != nil {
+		return 0, err
+	}
+
+	var version int
+	err := d.db.QueryRow(`SELECT COALESCE(MAX(version), 0) FROM schema_migrations`).Scan(&version)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get schema version: %w", err)
+	}
+
+	return version, nil
+}
+
+// checkSchemaVersion refuses databases migrated beyond what this build knows
+func (d *Database) checkSchemaVersion() error {
+	current, err := d.SchemaVersion()
+	if err != nil {
+		return err
+	}
+
+	latest, err := d.LatestSchemaVersion()
+	if err != nil {
+		return err
+	}
+
+	if current > latest {
+		return fmt.Errorf("%w (database is at version %d, latest known is %d)", ErrSchemaTooNew, current, latest)
+	}
+
+	return nil
+}
+
+// MigrateUp applies every pending migration
+func (d *Database) MigrateUp() error {
+	latest, err := d.LatestSchemaVersion()
+	if err != nil {
+		return err
+	}
+	return d.MigrateTo(latest)
+}
+
+// MigrateDown reverts the given number of applied migrations
+func (d *Database) MigrateDown(steps int) error {
+	current, err := d.SchemaVersion()
+	if err != nil {
+		return err
+	}
+
+	target := current - steps
+	if target < 0 {
+		target = 0
+	}
+	return d.MigrateTo(target)
+}
+
+// MigrateTo applies or reverts migrations until the schema is at version target
+func (d *Database) MigrateTo(target int) error {
+	if err := d.checkSchemaVersion(); err != nil {
+		return err
+	}
+
+	migrations, err := loadMigrations(d.dialect)
+	if err != nil {
+		return err
+	}
+
+	if target < 0 || target > len(migrations) {
+		return fmt.Errorf("unknown schema version %d (latest is %d)", target, len(migrations))
+	}
+
+	current, err := d.SchemaVersion()
+	if err != nil {
+		return err
+	}
+
+	for current < target {
+		m := migrations[current]
+		if err := d.applyMigration(m, true); err != nil {
+			return err
+		}
+		current++
+	}
+
+	for current > target {
+		m := migrations[current-1]
+		if err := d.applyMigration(m, false); err != nil {
+			return err
+		}
+		current--
+	}
+
+	return nil
+}
+
+func (d *Database) applyMigration(m Migration, up bool) error {
+	direction, script := "up", m.Up
+	if !up {
+		direction, script = "down", m.Down
+	}
+
+	return d.InTx(func(tx *Database) error {
+		// Migration scripts are backend specific and contain no placeholders
+		if _, err := tx.db.target.Exec(script); err != nil {
+			return fmt.Errorf("migration %04d_%s (%s) failed: %w", m.Version, m.Name, direction, err)
+		}
+
+		var err error
+		if up {
+			_, err = tx.db.Exec(`INSERT INTO schema_migrations (version, name, applied_at) VALUES (?, ?, ?)`,
+				m.Version, m.Name, time.Now())
+		} else {
+			_, err = tx.db.Exec(`DELETE FROM schema_migrations WHERE version = ?`, m.Version)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to record migration %04d_%s: %w", m.Version, m.Name, err)
+		}
+
+		return nil
+	})
+}
+
+// MigrationStatus lists every known migration and when it was applied
+func (d *Database) MigrationStatus() ([]MigrationStatus, error) {
+	if err := d.ensureMigrationsTable(); err != nil {
+		return nil, err
+	}
+
+	migrations, err := loadMigrations(d.dialect)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := d.db.Query(`SELECT version, applied_at FROM schema_migrations`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get applied migrations: %w", err)
+	}
+	defer rows.Close()
+
+	applied := make(map[int]time.Time)
+	for rows.Next() {
+		var (
+			version   int
+			appliedAt time.Time
+		)
+		if err := rows.Scan(&version, &appliedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan migration: %w", err)
+		}
+		applied[version] = appliedAt
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read migrations: %w", err)
+	}
+
+	statuses := make([]MigrationStatus, 0, len(migrations))
+	for _, m := range migrations {
+		status := MigrationStatus{Version: m.Version, Name: m.Name}
+		if at, ok := applied[m.Version]; ok {
+			status.AppliedAt = &at
+		}
+		statuses = append(statuses, status)
+	}
+
+	return statuses, nil
+}
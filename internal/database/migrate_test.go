@@ -0,0 +1,95 @@
+package database
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestMigrateDownAndUp(t *testing.T) {
+	forEachBackend(t, testMigrateDownAndUp)
+}
+
+func testMigrateDownAndUp(t *testing.T, db *Database) {
+	latest, err := db.LatestSchemaVersion()
+	if err != nil {
+		t.Fatalf("Failed to get latest schema version: %v", err)
+	}
+
+	version, err := db.SchemaVersion()
+	if err != nil {
+		t.Fatalf("Failed to get schema version: %v", err)
+	}
+	if version != latest {
+		t.Fatalf("Expected new database at version %d, got %d", latest, version)
+	}
+
+	if err := db.MigrateTo(0); err != nil {
+		t.Fatalf("Failed to migrate down to 0: %v", err)
+	}
+	if exists, _ := db.tableExists("accounts"); exists {
+		t.Error("Expected accounts table to be dropped at version 0")
+	}
+
+	if err := db.MigrateUp(); err != nil {
+		t.Fatalf("Failed to migrate up again: %v", err)
+	}
+
+	statuses, err := db.MigrationStatus()
+	if err != nil {
+		t.Fatalf("Failed to get migration status: %v", err)
+	}
+	for _, status := range statuses {
+		if status.AppliedAt == nil {
+			t.Errorf("Expected migration %d to be applied", status.Version)
+		}
+	}
+}
+
+func TestNewDatabaseRefusesNewerSchema(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "future.db")
+
+	db, err := NewDatabase(path)
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	if _, err := db.db.Exec(`INSERT INTO schema_migrations (version, name, applied_at) VALUES (?, ?, ?)`,
+		9999, "from_the_future", time.Now()); err != nil {
+		t.Fatalf("Failed to record future migration: %v", err)
+	}
+	db.Close()
+
+	_, err = NewDatabase(path)
+	if !errors.Is(err, ErrSchemaTooNew) {
+		t.Fatalf("Expected ErrSchemaTooNew, got %v", err)
+	}
+}
+
+func TestLegacyDatabaseIsAdopted(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "legacy.db")
+
+	legacy, err := OpenDatabase(path)
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	migrations, err := loadMigrations(legacy.dialect)
+	if err != nil {
+		t.Fatalf("Failed to load migrations: %v", err)
+	}
+	// Simulate a database created by the original CREATE TABLE IF NOT EXISTS schema
+	if _, err := legacy.db.Exec(migrations[0].Up); err != nil {
+		t.Fatalf("Failed to create legacy schema: %v", err)
+	}
+	legacy.Close()
+
+	db, err := NewDatabase(path)
+	if err != nil {
+		t.Fatalf("Failed to open legacy database: %v", err)
+	}
+	defer db.Close()
+
+	if exists, _ := db.columnExists("accounts", "role"); !exists {
+		t.Error("Expected role column to be added to legacy accounts table")
+	}
+}
@@ -0,0 +1 @@
+ALTER TABLE accounts ADD COLUMN role TEXT NOT NULL DEFAULT 'student';
@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS idx_accounts_school_id;
+ALTER TABLE accounts DROP COLUMN school_id;
+DROP TABLE IF EXISTS enrollments;
+DROP TABLE IF EXISTS classrooms;
+DROP TABLE IF EXISTS schools;
@@ -0,0 +1,24 @@
+-- Self-registered students of low grades wait for a guardian's consent
+ALTER TABLE accounts ADD COLUMN consent_status TEXT NOT NULL DEFAULT 'not_required';
+
+CREATE TABLE IF NOT EXISTS guardian_links (
+	guardian_id INTEGER NOT NULL REFERENCES accounts(id) ON DELETE CASCADE,
+	student_id INTEGER NOT NULL REFERENCES accounts(id) ON DELETE CASCADE,
+	consented_at TIMESTAMPTZ NOT NULL,
+	consent_method TEXT NOT NULL,
+	policy_version TEXT NOT NULL,
+	recorded_by INTEGER NOT NULL,
+	PRIMARY KEY (guardian_id, student_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_guardian_links_student ON guardian_links(student_id);
+
+-- The guardian a pending student named at sign-up, matched on email when
+-- that guardian registers
+CREATE TABLE IF NOT EXISTS consent_requests (
+	student_id INTEGER PRIMARY KEY REFERENCES accounts(id) ON DELETE CASCADE,
+	guardian_email TEXT NOT NULL,
+	created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_consent_requests_email ON consent_requests(guardian_email);
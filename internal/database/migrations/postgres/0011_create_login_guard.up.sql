@@ -0,0 +1,22 @@
+-- Failed logins per lowercased username and per client IP. Usernames are
+-- tracked whether or not an account exists, so lockouts reveal nothing.
+CREATE TABLE IF NOT EXISTS login_failures (
+	kind TEXT NOT NULL,
+	login_key TEXT NOT NULL,
+	failures INTEGER NOT NULL DEFAULT 0,
+	last_failure_at TIMESTAMPTZ NOT NULL,
+	locked_until TIMESTAMPTZ,
+	PRIMARY KEY (kind, login_key)
+);
+
+CREATE TABLE IF NOT EXISTS auth_log (
+	id SERIAL PRIMARY KEY,
+	username TEXT NOT NULL,
+	account_id INTEGER,
+	ip TEXT NOT NULL,
+	outcome TEXT NOT NULL,
+	created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_auth_log_created_at ON auth_log(created_at);
+CREATE INDEX IF NOT EXISTS idx_auth_log_username ON auth_log(username);
@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS sso_states;
+DROP INDEX IF EXISTS idx_accounts_oidc_subject;
+ALTER TABLE accounts DROP COLUMN oidc_subject;
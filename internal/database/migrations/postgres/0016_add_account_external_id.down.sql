@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_accounts_external_id;
+ALTER TABLE accounts DROP COLUMN external_id;
@@ -0,0 +1,8 @@
+-- Named profiles mapping the columns of CSV imports to account fields; the
+-- columns, transforms and grade aliases are stored as JSON
+CREATE TABLE IF NOT EXISTS import_mappings (
+	name TEXT PRIMARY KEY,
+	definition TEXT NOT NULL,
+	created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	updated_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
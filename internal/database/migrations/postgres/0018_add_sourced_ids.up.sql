@@ -0,0 +1,6 @@
+-- The OneRoster sourcedId of schools and classrooms synced from a student
+-- information system, so later syncs find them even if they were renamed
+ALTER TABLE schools ADD COLUMN sourced_id TEXT;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_schools_sourced_id ON schools(sourced_id);
+ALTER TABLE classrooms ADD COLUMN sourced_id TEXT;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_classrooms_sourced_id ON classrooms(sourced_id);
@@ -0,0 +1,2 @@
+ALTER TABLE consent_requests DROP COLUMN expires_at;
+ALTER TABLE consent_requests DROP COLUMN token_hash;
@@ -0,0 +1,19 @@
+CREATE TABLE IF NOT EXISTS accounts (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	username TEXT UNIQUE NOT NULL,
+	email TEXT UNIQUE NOT NULL,
+	password_hash TEXT NOT NULL,
+	first_name TEXT,
+	last_name TEXT,
+	grade INTEGER DEFAULT 0,
+	school TEXT,
+	game_level INTEGER DEFAULT 1,
+	experience INTEGER DEFAULT 0,
+	created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+	updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+	is_active BOOLEAN DEFAULT TRUE
+);
+
+CREATE INDEX IF NOT EXISTS idx_username ON accounts(username);
+CREATE INDEX IF NOT EXISTS idx_email ON accounts(email);
+CREATE INDEX IF NOT EXISTS idx_is_active ON accounts(is_active);
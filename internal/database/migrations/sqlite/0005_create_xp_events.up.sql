@@ -0,0 +1,15 @@
+CREATE TABLE IF NOT EXISTS xp_events (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	account_id INTEGER NOT NULL REFERENCES accounts(id) ON DELETE CASCADE,
+	amount INTEGER NOT NULL,
+	source TEXT NOT NULL,
+	reason TEXT NOT NULL DEFAULT '',
+	game_ref TEXT NOT NULL DEFAULT '',
+	created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_xp_events_account ON xp_events(account_id, created_at);
+
+-- Experience earned before the ledger existed becomes an opening balance
+INSERT INTO xp_events (account_id, amount, source, reason)
+SELECT id, experience, 'migration', 'Opening balance' FROM accounts WHERE experience <> 0;
@@ -0,0 +1,9 @@
+CREATE TABLE IF NOT EXISTS account_achievements (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	account_id INTEGER NOT NULL REFERENCES accounts(id) ON DELETE CASCADE,
+	badge_id TEXT NOT NULL,
+	awarded_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	awarded_by INTEGER REFERENCES accounts(id) ON DELETE SET NULL,
+	note TEXT NOT NULL DEFAULT '',
+	UNIQUE (account_id, badge_id)
+);
@@ -0,0 +1,4 @@
+DROP TABLE IF EXISTS leaderboard_totals;
+DROP INDEX IF EXISTS idx_accounts_game_level;
+DROP INDEX IF EXISTS idx_accounts_experience;
+ALTER TABLE accounts DROP COLUMN leaderboard_opt_out;
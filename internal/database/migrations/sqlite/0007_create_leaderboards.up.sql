@@ -0,0 +1,24 @@
+ALTER TABLE accounts ADD COLUMN leaderboard_opt_out BOOLEAN NOT NULL DEFAULT FALSE;
+
+CREATE INDEX IF NOT EXISTS idx_accounts_experience ON accounts(experience);
+CREATE INDEX IF NOT EXISTS idx_accounts_game_level ON accounts(game_level);
+
+-- Experience earned per account in each UTC day and ISO week, kept up to
+-- date as XP events are recorded
+CREATE TABLE IF NOT EXISTS leaderboard_totals (
+	account_id INTEGER NOT NULL REFERENCES accounts(id) ON DELETE CASCADE,
+	period TEXT NOT NULL,
+	period_start TEXT NOT NULL,
+	xp INTEGER NOT NULL DEFAULT 0,
+	PRIMARY KEY (account_id, period, period_start)
+);
+
+CREATE INDEX IF NOT EXISTS idx_leaderboard_totals_rank ON leaderboard_totals(period, period_start, xp);
+
+INSERT INTO leaderboard_totals (account_id, period, period_start, xp)
+SELECT account_id, 'day', date(created_at), SUM(amount)
+FROM xp_events GROUP BY account_id, date(created_at);
+
+INSERT INTO leaderboard_totals (account_id, period, period_start, xp)
+SELECT account_id, 'week', date(created_at, 'weekday 0', '-6 days'), SUM(amount)
+FROM xp_events GROUP BY account_id, date(created_at, 'weekday 0', '-6 days');
@@ -0,0 +1,34 @@
+CREATE TABLE IF NOT EXISTS schools (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	name TEXT NOT NULL,
+	name_key TEXT NOT NULL UNIQUE,
+	created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	updated_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS classrooms (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	school_id INTEGER NOT NULL REFERENCES schools(id) ON DELETE CASCADE,
+	name TEXT NOT NULL,
+	grade INTEGER NOT NULL DEFAULT 0,
+	created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	updated_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	UNIQUE (school_id, name)
+);
+
+CREATE TABLE IF NOT EXISTS enrollments (
+	classroom_id INTEGER NOT NULL REFERENCES classrooms(id) ON DELETE CASCADE,
+	account_id INTEGER NOT NULL REFERENCES accounts(id) ON DELETE CASCADE,
+	role TEXT NOT NULL DEFAULT 'student',
+	enrolled_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	PRIMARY KEY (classroom_id, account_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_enrollments_account ON enrollments(account_id);
+
+-- Kept in step with schools by the application rather than a foreign key, so
+-- the column can be dropped again. Existing free-text school names are
+-- matched to school records at startup, which needs SchoolKey.
+ALTER TABLE accounts ADD COLUMN school_id INTEGER;
+
+CREATE INDEX IF NOT EXISTS idx_accounts_school_id ON accounts(school_id);
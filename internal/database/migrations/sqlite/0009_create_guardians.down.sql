@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS consent_requests;
+DROP TABLE IF EXISTS guardian_links;
+ALTER TABLE accounts DROP COLUMN consent_status;
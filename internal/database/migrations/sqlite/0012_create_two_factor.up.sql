@@ -0,0 +1,22 @@
+-- Set once an account has confirmed a TOTP authenticator; logins then need a code
+ALTER TABLE accounts ADD COLUMN two_factor_enabled BOOLEAN NOT NULL DEFAULT FALSE;
+
+-- The shared TOTP secret of each account. confirmed_at stays NULL until the
+-- first code is verified, and last_used_step stops a code being used twice.
+CREATE TABLE IF NOT EXISTS totp_secrets (
+	account_id INTEGER PRIMARY KEY REFERENCES accounts(id) ON DELETE CASCADE,
+	secret TEXT NOT NULL,
+	last_used_step INTEGER NOT NULL DEFAULT 0,
+	created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	confirmed_at DATETIME
+);
+
+CREATE TABLE IF NOT EXISTS recovery_codes (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	account_id INTEGER NOT NULL REFERENCES accounts(id) ON DELETE CASCADE,
+	code_hash TEXT NOT NULL,
+	created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	used_at DATETIME
+);
+
+CREATE INDEX IF NOT EXISTS idx_recovery_codes_account ON recovery_codes(account_id);
@@ -0,0 +1,14 @@
+-- The subject identifier of the account at the OpenID Connect identity provider
+ALTER TABLE accounts ADD COLUMN oidc_subject TEXT;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_accounts_oidc_subject ON accounts(oidc_subject);
+
+-- Sign-ins sent to the identity provider and not yet back. The state is
+-- stored hashed; the nonce and PKCE verifier are needed in the clear to
+-- finish the sign-in.
+CREATE TABLE IF NOT EXISTS sso_states (
+	state_hash TEXT PRIMARY KEY,
+	nonce TEXT NOT NULL,
+	code_verifier TEXT NOT NULL,
+	created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	expires_at DATETIME NOT NULL
+);
@@ -0,0 +1,4 @@
+-- Accounts waiting to be purged are removed rather than brought back
+DELETE FROM accounts WHERE deleted_at IS NOT NULL;
+DROP INDEX IF EXISTS idx_accounts_deleted_at;
+ALTER TABLE accounts DROP COLUMN deleted_at;
@@ -0,0 +1,4 @@
+-- Deleted accounts keep their row, hidden from every query, until they are
+-- restored or purged after the retention period
+ALTER TABLE accounts ADD COLUMN deleted_at DATETIME;
+CREATE INDEX IF NOT EXISTS idx_accounts_deleted_at ON accounts(deleted_at);
@@ -0,0 +1,3 @@
+-- Counts changes to the fields an account update writes, so that concurrent
+-- edits can be detected instead of overwriting each other
+ALTER TABLE accounts ADD COLUMN version INTEGER NOT NULL DEFAULT 1;
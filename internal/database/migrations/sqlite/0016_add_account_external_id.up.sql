@@ -0,0 +1,4 @@
+-- The ID of the account in the student information system it is imported
+-- from, so that re-imported rosters find it even if its username or email changed
+ALTER TABLE accounts ADD COLUMN external_id TEXT;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_accounts_external_id ON accounts(external_id);
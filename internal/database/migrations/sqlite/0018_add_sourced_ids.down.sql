@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS idx_classrooms_sourced_id;
+ALTER TABLE classrooms DROP COLUMN sourced_id;
+DROP INDEX IF EXISTS idx_schools_sourced_id;
+ALTER TABLE schools DROP COLUMN sourced_id;
@@ -0,0 +1,4 @@
+-- The hash of the single-use token emailed to the guardian a student named,
+-- which the guardian must give to consent
+ALTER TABLE consent_requests ADD COLUMN token_hash TEXT;
+ALTER TABLE consent_requests ADD COLUMN expires_at DATETIME;
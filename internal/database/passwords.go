@@ -0,0 +1,131 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"educational-game-db/internal/models"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// ErrInvalidResetToken is returned when a password reset token is unknown, expired or used
+var ErrInvalidResetToken = errors.New("invalid or expired password reset token")
+
+// SetPasswordCost sets the bcrypt cost of new password hashes. Existing
+// hashes with a lower cost are rehashed when their owner next logs in.
+func (d *Database) SetPasswordCost(cost int) error {
+	if cost < bcrypt.MinCost || cost > bcrypt.MaxCost {
+		return fmt.Errorf("bcrypt cost must be between %d and %d", bcrypt.MinCost, bcrypt.MaxCost)
+	}
+	d.passwordCost = cost
+	return nil
+}
+
+// SetPassword replaces the password of an account. mustReset makes the
+// account choose a new password before doing anything else, for passwords
+// handed out by staff.
+func (d *Database) SetPassword(accountID int, password string, mustReset bool) error {
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), d.passwordCost)
+	if err != nil {
+		return fmt.Errorf("failed to hash password: %w", err)
+	}
+
+	result, err := d.db.Exec(`UPDATE accounts SET password_hash = ?, must_reset_password = ?, updated_at = ? WHERE id = ?`,
+		string(hashedPassword), mustReset, time.Now(), accountID)
+	if err != nil {
+		return fmt.Errorf("failed to set password: %w", err)
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return fmt.Errorf("account not found")
+	}
+	return nil
+}
+
+// rehashPassword stores a new hash of an account's current password, without
+// touching anything else about the account
+func (d *Database) rehashPassword(accountID int, password string) error {
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), d.passwordCost)
+	if err != nil {
+		return fmt.Errorf("failed to hash password: %w", err)
+	}
+
+	if _, err := d.db.Exec(`UPDATE accounts SET password_hash = ? WHERE id = ?`, string(hashedPassword), accountID); err != nil {
+		return fmt.Errorf("failed to update password hash: %w", err)
+	}
+	return nil
+}
+
+// CreatePasswordResetToken stores the hash of a newly issued reset token
+func (d *Database) CreatePasswordResetToken(accountID int, tokenHash string, expiresAt time.Time) error {
+	_, err := d.db.Exec(`INSERT INTO password_reset_tokens (account_id, token_hash, expires_at, created_at) VALUES (?, ?, ?, ?)`,
+		accountID, tokenHash, expiresAt, time.Now())
+	if err != nil {
+		return fmt.Errorf("failed to create password reset token: %w", err)
+	}
+	return nil
+}
+
+// ResetPassword sets a new password with a reset token and returns the
+// account it belonged to. The token and every other outstanding token of the
+// account are used up, and the account is signed out everywhere.
+func (d *Database) ResetPassword(tokenHash, password string) (int, error) {
+	var accountID int
+
+	err := d.InTx(func(tx *Database) error {
+		var err error
+		if accountID, err = tx.resetTokenAccountID(tokenHash); err != nil {
+			return err
+		}
+
+		now := time.Now()
+		if _, err := tx.db.Exec(`UPDATE password_reset_tokens SET used_at = ? WHERE account_id = ? AND used_at IS NULL`,
+			now, accountID); err != nil {
+			return fmt.Errorf("failed to use password reset token: %w", err)
+		}
+
+		if err := tx.SetPassword(accountID, password, false); err != nil {
+			return err
+		}
+		return tx.RevokeAccountRefreshTokens(accountID)
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return accountID, nil
+}
+
+// PasswordResetAccount returns the account a reset token is valid for, so
+// that the new password can be checked against it before it is set
+func (d *Database) PasswordResetAccount(tokenHash string) (*models.Account, error) {
+	accountID, err := d.resetTokenAccountID(tokenHash)
+	if err != nil {
+		return nil, err
+	}
+	return d.GetAccountByID(accountID)
+}
+
+// resetTokenAccountID returns the account of an unused, unexpired reset token
+func (d *Database) resetTokenAccountID(tokenHash string) (int, error) {
+	var (
+		accountID int
+		expires   time.Time
+		usedAt    sql.NullTime
+	)
+	err := d.db.QueryRow(`SELECT account_id, expires_at, used_at FROM password_reset_tokens WHERE token_hash = ?`,
+		tokenHash).Scan(&accountID, &expires, &usedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return 0, ErrInvalidResetToken
+		}
+		return 0, fmt.Errorf("failed to get password reset token: %w", err)
+	}
+
+	if usedAt.Valid || time.Now().After(expires) {
+		return 0, ErrInvalidResetToken
+	}
+	return accountID, nil
+}
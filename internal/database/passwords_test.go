@@ -0,0 +1,107 @@
+package database
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"educational-game-db/internal/models"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestPasswordResetTokens(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, db *Database) {
+		account, err := db.CreateAccount(models.CreateAccountRequest{
+			Username: "imported", Email: "imported@example.com", Password: "unknown123", MustResetPassword: true,
+		})
+		if err != nil {
+			t.Fatalf("Failed to create account: %v", err)
+		}
+		if !account.MustResetPassword {
+			t.Fatal("Expected the account to be flagged for a password reset")
+		}
+		if err := db.CreateRefreshToken(account.ID, "session", time.Now().Add(time.Hour)); err != nil {
+			t.Fatalf("Failed to create refresh token: %v", err)
+		}
+
+		if err := db.CreatePasswordResetToken(account.ID, "expired", time.Now().Add(-time.Minute)); err != nil {
+			t.Fatalf("Failed to create reset token: %v", err)
+		}
+		if _, err := db.ResetPassword("expired", "newpassword"); !errors.Is(err, ErrInvalidResetToken) {
+			t.Errorf("Expected an expired token to be refused, got %v", err)
+		}
+		if _, err := db.ResetPassword("unknown", "newpassword"); !errors.Is(err, ErrInvalidResetToken) {
+			t.Errorf("Expected an unknown token to be refused, got %v", err)
+		}
+
+		for _, hash := range []string{"first", "second"} {
+			if err := db.CreatePasswordResetToken(account.ID, hash, time.Now().Add(time.Hour)); err != nil {
+				t.Fatalf("Failed to create reset token: %v", err)
+			}
+		}
+		id, err := db.ResetPassword("second", "newpassword")
+		if err != nil {
+			t.Fatalf("Failed to reset password: %v", err)
+		}
+		if id != account.ID {
+			t.Errorf("Expected account %d, got %d", account.ID, id)
+		}
+		if !db.VerifyPassword("imported", "newpassword") {
+			t.Error("Expected the new password to work")
+		}
+		if account, _ := db.GetAccountByID(account.ID); account.MustResetPassword {
+			t.Error("Expected the reset flag to be cleared")
+		}
+
+		if _, err := db.ResetPassword("second", "another"); !errors.Is(err, ErrInvalidResetToken) {
+			t.Errorf("Expected a used token to be refused, got %v", err)
+		}
+		if _, err := db.ResetPassword("first", "another"); !errors.Is(err, ErrInvalidResetToken) {
+			t.Errorf("Expected older tokens to be used up, got %v", err)
+		}
+		if _, err := db.RotateRefreshToken("session", "next", time.Now().Add(time.Hour)); !errors.Is(err, ErrInvalidRefreshToken) {
+			t.Errorf("Expected sessions to be revoked by the reset, got %v", err)
+		}
+	})
+}
+
+func TestPasswordCostUpgrade(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, db *Database) {
+		if err := db.SetPasswordCost(bcrypt.MinCost); err != nil {
+			t.Fatalf("Failed to set password cost: %v", err)
+		}
+		account, err := db.CreateAccount(models.CreateAccountRequest{
+			Username: "oldhash", Email: "oldhash@example.com", Password: "violet-harbor-72",
+		})
+		if err != nil {
+			t.Fatalf("Failed to create account: %v", err)
+		}
+
+		if err := db.SetPasswordCost(bcrypt.MaxCost + 1); err == nil {
+			t.Error("Expected an out of range cost to be refused")
+		}
+		if err := db.SetPasswordCost(bcrypt.MinCost + 1); err != nil {
+			t.Fatalf("Failed to set password cost: %v", err)
+		}
+
+		if db.VerifyPassword("oldhash", "wrong-password") {
+			t.Fatal("Expected a wrong password to be refused")
+		}
+		stored, _ := db.GetAccountByID(account.ID)
+		if cost, _ := bcrypt.Cost([]byte(stored.PasswordHash)); cost != bcrypt.MinCost {
+			t.Errorf("Expected a failed login to leave the hash alone, got cost %d", cost)
+		}
+
+		if !db.VerifyPassword("oldhash", "violet-harbor-72") {
+			t.Fatal("Expected the password to verify")
+		}
+		stored, _ = db.GetAccountByID(account.ID)
+		if cost, _ := bcrypt.Cost([]byte(stored.PasswordHash)); cost != bcrypt.MinCost+1 {
+			t.Errorf("Expected the hash to be upgraded to cost %d, got %d", bcrypt.MinCost+1, cost)
+		}
+		if !db.VerifyPassword("oldhash", "violet-harbor-72") {
+			t.Error("Expected the password to verify against the upgraded hash")
+		}
+	})
+}
@@ -0,0 +1,145 @@
+package database
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"educational-game-db/internal/models"
+)
+
+// rosterCondition matches the students enrolled in any classroom the account
+// given as its argument teaches
+const rosterCondition = `id IN (
+	SELECT students.account_id FROM enrollments students
+	JOIN enrollments teachers ON teachers.classroom_id = students.classroom_id
+	WHERE teachers.account_id = ? AND teachers.role = 'teacher' AND students.role = 'student'
+)`
+
+// TeacherClassrooms returns the classrooms an account is enrolled in as teacher
+func (d *Database) TeacherClassrooms(teacherID int) ([]models.Classroom, error) {
+	rows, err := d.db.Query(`
+	SELECT classrooms.id, classrooms.school_id, classrooms.name, classrooms.grade,
+		classrooms.sourced_id, classrooms.created_at, classrooms.updated_at
+	FROM classrooms JOIN enrollments ON enrollments.classroom_id = classrooms.id
+	WHERE enrollments.account_id = ? AND enrollments.role = ?
+	ORDER BY classrooms.grade, classrooms.name, classrooms.id
+	`, teacherID, models.EnrollmentTeacher)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get classrooms: %w", err)
+	}
+	defer rows.Close()
+
+	classrooms := []models.Classroom{}
+	for rows.Next() {
+		classroom, err := scanClassroom(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan classroom: %w", err)
+		}
+		classrooms = append(classrooms, *classroom)
+	}
+
+	return classrooms, rows.Err()
+}
+
+// TeacherRoster returns the IDs of the students in every classroom an account teaches
+func (d *Database) TeacherRoster(teacherID int) ([]int, error) {
+	rows, err := d.db.Query(`SELECT id FROM accounts WHERE deleted_at IS NULL AND `+rosterCondition+` ORDER BY id`, teacherID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get roster: %w", err)
+	}
+	defer rows.Close()
+
+	var ids []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, fmt.Errorf("failed to scan roster: %w", err)
+		}
+		ids = append(ids, id)
+	}
+
+	return ids, rows.Err()
+}
+
+// IsClassroomTeacher reports whether an account teaches a classroom
+func (d *Database) IsClassroomTeacher(classroomID, accountID int) (bool, error) {
+	var n int
+	err := d.db.QueryRow(`SELECT COUNT(*) FROM enrollments WHERE classroom_id = ? AND account_id = ? AND role = ?`,
+		classroomID, accountID, models.EnrollmentTeacher).Scan(&n)
+	if err != nil {
+		return false, fmt.Errorf("failed to check enrollment: %w", err)
+	}
+	return n > 0, nil
+}
+
+// AddToRoster enrolls students in a classroom by username. Usernames that do
+// not name a student of the classroom's school are reported, not enrolled.
+func (d *Database) AddToRoster(classroomID int, usernames []string) (*models.RosterResult, error) {
+	result := &models.RosterResult{
+		Added:           []string{},
+		AlreadyEnrolled: []string{},
+		NotFound:        []string{},
+		NotEligible:     []string{},
+	}
+
+	err := d.InTx(func(tx *Database) error {
+		classroom, err := tx.GetClassroom(classroomID)
+		if err != nil {
+			return err
+		}
+
+		seen := make(map[string]bool)
+		for _, username := range usernames {
+			username = strings.TrimSpace(username)
+			if username == "" || seen[username] {
+				continue
+			}
+			seen[username] = true
+
+			account, err := tx.GetAccountByUsername(username)
+			if err != nil {
+				result.NotFound = append(result.NotFound, username)
+				continue
+			}
+			if account.Role != models.RoleStudent || account.SchoolID == nil || *account.SchoolID != classroom.SchoolID {
+				result.NotEligible = append(result.NotEligible, username)
+				continue
+			}
+
+			var enrolled int
+			if err := tx.db.QueryRow(`SELECT COUNT(*) FROM enrollments WHERE classroom_id = ? AND account_id = ?`,
+				classroomID, account.ID).Scan(&enrolled); err != nil {
+				return fmt.Errorf("failed to check enrollment: %w", err)
+			}
+			if enrolled > 0 {
+				result.AlreadyEnrolled = append(result.AlreadyEnrolled, username)
+				continue
+			}
+
+			if _, err := tx.Enroll(classroomID, account.ID, models.EnrollmentStudent); err != nil {
+				return err
+			}
+			result.Added = append(result.Added, username)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// SetAccountActive activates or deactivates an account
+func (d *Database) SetAccountActive(id int, active bool) (*models.Account, error) {
+	result, err := d.db.Exec(`UPDATE accounts SET is_active = ?, updated_at = ?, version = version + 1 WHERE id = ? AND deleted_at IS NULL`, active, time.Now(), id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to update account: %w", err)
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return nil, fmt.Errorf("account not found")
+	}
+
+	return d.GetAccountByID(id)
+}
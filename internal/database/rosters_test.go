@@ -0,0 +1,83 @@
+package database
+
+import (
+	"testing"
+
+	"educational-game-db/internal/models"
+)
+
+func TestTeacherRosters(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, db *Database) {
+		create := func(username, school string) *models.Account {
+			account, err := db.CreateAccount(models.CreateAccountRequest{
+				Username: username, Email: username + "@example.com", Password: "password123", School: school,
+			})
+			if err != nil {
+				t.Fatalf("Failed to create account: %v", err)
+			}
+			return account
+		}
+		teacher := create("teacher", "North")
+		teacher, _ = db.SetAccountRole(teacher.ID, models.RoleTeacher)
+		ada := create("ada", "North")
+		bob := create("bob", "North")
+		create("cy", "South")
+		colleague := create("colleague", "North")
+		db.SetAccountRole(colleague.ID, models.RoleTeacher)
+
+		classroom, err := db.CreateClassroom(*teacher.SchoolID, models.ClassroomRequest{Name: "Room 4"})
+		if err != nil {
+			t.Fatalf("Failed to create classroom: %v", err)
+		}
+		if _, err := db.Enroll(classroom.ID, teacher.ID, models.EnrollmentTeacher); err != nil {
+			t.Fatalf("Failed to enroll teacher: %v", err)
+		}
+
+		result, err := db.AddToRoster(classroom.ID, []string{"ada", " ada ", "cy", "colleague", "nobody", ""})
+		if err != nil {
+			t.Fatalf("Failed to add to roster: %v", err)
+		}
+		if len(result.Added) != 1 || len(result.AlreadyEnrolled) != 0 || len(result.NotFound) != 1 || len(result.NotEligible) != 2 {
+			t.Errorf("Unexpected roster result: %+v", result)
+		}
+		result, _ = db.AddToRoster(classroom.ID, []string{"ada"})
+		if len(result.AlreadyEnrolled) != 1 {
+			t.Errorf("Expected ada to already be enrolled, got %+v", result)
+		}
+
+		roster, err := db.TeacherRoster(teacher.ID)
+		if err != nil {
+			t.Fatalf("Failed to get roster: %v", err)
+		}
+		if len(roster) != 1 || roster[0] != ada.ID {
+			t.Errorf("Expected roster [%d], got %v", ada.ID, roster)
+		}
+
+		page, err := db.ListAccounts(models.AccountListOptions{Roles: []string{models.RoleStudent}, RosterOf: teacher.ID})
+		if err != nil {
+			t.Fatalf("Failed to list accounts: %v", err)
+		}
+		if page.Total != 1 || page.Accounts[0].ID != ada.ID {
+			t.Errorf("Expected only ada on the roster listing, got %+v", page.Accounts)
+		}
+
+		if ok, _ := db.IsClassroomTeacher(classroom.ID, teacher.ID); !ok {
+			t.Error("Expected teacher to teach the classroom")
+		}
+		if ok, _ := db.IsClassroomTeacher(classroom.ID, colleague.ID); ok {
+			t.Error("Expected colleague not to teach the classroom")
+		}
+
+		if err := db.SetPassword(bob.ID, "newpassword", false); err != nil {
+			t.Fatalf("Failed to set password: %v", err)
+		}
+		if !db.VerifyPassword("bob", "newpassword") || db.VerifyPassword("bob", "password123") {
+			t.Error("Expected only the new password to work")
+		}
+
+		account, err := db.SetAccountActive(bob.ID, false)
+		if err != nil || account.IsActive {
+			t.Errorf("Expected bob to be deactivated, got %v (%v)", account, err)
+		}
+	})
+}
@@ -0,0 +1,502 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"educational-game-db/internal/models"
+)
+
+var (
+	// ErrSchoolExists is returned when a school name matches an existing school
+	ErrSchoolExists = errors.New("a school with this name already exists")
+	// ErrClassroomExists is returned when a school already has a classroom of that name
+	ErrClassroomExists = errors.New("the school already has a classroom with this name")
+	// ErrWrongSchool is returned when enrolling an account in another school's classroom
+	ErrWrongSchool = errors.New("account does not belong to the classroom's school")
+	// ErrNameRequired is returned when a school or classroom name is blank
+	ErrNameRequired = errors.New("a name is required")
+	// ErrInvalidEnrollment is returned for an unknown enrollment role, or a
+	// student enrolled as a teacher
+	ErrInvalidEnrollment = errors.New("invalid enrollment role")
+)
+
+const schoolColumns = `id, name, sourced_id, created_at, updated_at`
+
+func scanSchool(row rowScanner) (*models.School, error) {
+	var school models.School
+	if err := row.Scan(&school.ID, &school.Name, &school.SourcedID, &school.CreatedAt, &school.UpdatedAt); err != nil {
+		return nil, err
+	}
+	return &school, nil
+}
+
+// CreateSchool adds a school. Names that differ only in case, punctuation or
+// common abbreviations are the same school.
+func (d *Database) CreateSchool(name string) (*models.School, error) {
+	name = strings.TrimSpace(name)
+	key := models.SchoolKey(name)
+	if key == "" {
+		return nil, ErrNameRequired
+	}
+
+	if _, err := d.FindSchool(name); err == nil {
+		return nil, ErrSchoolExists
+	}
+
+	now := time.Now()
+	var id int
+	err := d.db.QueryRow(`INSERT INTO schools (name, name_key, created_at, updated_at) VALUES (?, ?, ?, ?) RETURNING id`,
+		name, key, now, now).Scan(&id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create school: %w", err)
+	}
+
+	return d.GetSchool(id)
+}
+
+// GetSchool returns a school by ID
+func (d *Database) GetSchool(id int) (*models.School, error) {
+	school, err := scanSchool(d.db.QueryRow(`SELECT `+schoolColumns+` FROM schools WHERE id = ?`, id))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("school not found")
+		}
+		return nil, fmt.Errorf("failed to get school: %w", err)
+	}
+	return school, nil
+}
+
+// FindSchool returns the school a name refers to
+func (d *Database) FindSchool(name string) (*models.School, error) {
+	school, err := scanSchool(d.db.QueryRow(`SELECT `+schoolColumns+` FROM schools WHERE name_key = ?`, models.SchoolKey(name)))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("school not found")
+		}
+		return nil, fmt.Errorf("failed to get school: %w", err)
+	}
+	return school, nil
+}
+
+// ListSchools returns every school ordered by name
+func (d *Database) ListSchools() ([]models.School, error) {
+	rows, err := d.db.Query(`SELECT ` + schoolColumns + ` FROM schools ORDER BY name, id`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get schools: %w", err)
+	}
+	defer rows.Close()
+
+	schools := []models.School{}
+	for rows.Next() {
+		school, err := scanSchool(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan school: %w", err)
+		}
+		schools = append(schools, *school)
+	}
+
+	return schools, rows.Err()
+}
+
+// RenameSchool renames a school and the school name shown on its accounts
+func (d *Database) RenameSchool(id int, name string) (*models.School, error) {
+	name = strings.TrimSpace(name)
+	key := models.SchoolKey(name)
+	if key == "" {
+		return nil, ErrNameRequired
+	}
+
+	var school *models.School
+	err := d.InTx(func(tx *Database) error {
+		if existing, err := tx.FindSchool(name); err == nil && existing.ID != id {
+			return ErrSchoolExists
+		}
+
+		result, err := tx.db.Exec(`UPDATE schools SET name = ?, name_key = ?, updated_at = ? WHERE id = ?`,
+			name, key, time.Now(), id)
+		if err != nil {
+			return fmt.Errorf("failed to rename school: %w", err)
+		}
+		if n, _ := result.RowsAffected(); n == 0 {
+			return fmt.Errorf("school not found")
+		}
+
+		if _, err := tx.db.Exec(`UPDATE accounts SET school = ?, version = version + 1 WHERE school_id = ?`, name, id); err != nil {
+			return fmt.Errorf("failed to rename school on accounts: %w", err)
+		}
+
+		school, err = tx.GetSchool(id)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return school, nil
+}
+
+// DeleteSchool removes a school and its classrooms. Its accounts are kept
+// but no longer belong to a school.
+func (d *Database) DeleteSchool(id int) error {
+	return d.InTx(func(tx *Database) error {
+		if _, err := tx.db.Exec(`UPDATE accounts SET school = '', school_id = NULL, version = version + 1 WHERE school_id = ?`, id); err != nil {
+			return fmt.Errorf("failed to detach accounts: %w", err)
+		}
+
+		result, err := tx.db.Exec(`DELETE FROM schools WHERE id = ?`, id)
+		if err != nil {
+			return fmt.Errorf("failed to delete school: %w", err)
+		}
+		if n, _ := result.RowsAffected(); n == 0 {
+			return fmt.Errorf("school not found")
+		}
+		return nil
+	})
+}
+
+// MergeSchools moves the accounts and classrooms of one school into another
+// and deletes the emptied school, e.g. to fold a misspelt duplicate into the
+// real school
+func (d *Database) MergeSchools(fromID, intoID int) (*models.School, error) {
+	if fromID == intoID {
+		return nil, fmt.Errorf("cannot merge a school into itself")
+	}
+
+	var into *models.School
+	err := d.InTx(func(tx *Database) error {
+		if _, err := tx.GetSchool(fromID); err != nil {
+			return err
+		}
+		var err error
+		if into, err = tx.GetSchool(intoID); err != nil {
+			return err
+		}
+
+		var clashes int
+		if err := tx.db.QueryRow(`
+		SELECT COUNT(*) FROM classrooms a JOIN classrooms b ON a.name = b.name
+		WHERE a.school_id = ? AND b.school_id = ?
+		`, fromID, intoID).Scan(&clashes); err != nil {
+			return fmt.Errorf("failed to compare classrooms: %w", err)
+		}
+		if clashes > 0 {
+			return ErrClassroomExists
+		}
+
+		if _, err := tx.db.Exec(`UPDATE classrooms SET school_id = ? WHERE school_id = ?`, intoID, fromID); err != nil {
+			return fmt.Errorf("failed to move classrooms: %w", err)
+		}
+		if _, err := tx.db.Exec(`UPDATE accounts SET school = ?, school_id = ?, version = version + 1 WHERE school_id = ?`,
+			into.Name, intoID, fromID); err != nil {
+			return fmt.Errorf("failed to move accounts: %w", err)
+		}
+		if _, err := tx.db.Exec(`DELETE FROM schools WHERE id = ?`, fromID); err != nil {
+			return fmt.Errorf("failed to delete school: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return into, nil
+}
+
+// resolveSchool returns the school an account is being placed in, by ID or
+// else by name, creating schools that do not exist yet. It returns nil when
+// neither is given.
+func (d *Database) resolveSchool(id *int, name string) (*models.School, error) {
+	if id != nil {
+		return d.GetSchool(*id)
+	}
+	if models.SchoolKey(name) == "" {
+		return nil, nil
+	}
+	if school, err := d.FindSchool(name); err == nil {
+		return school, nil
+	}
+	return d.CreateSchool(name)
+}
+
+// schoolName and schoolID give the account columns for a resolved school
+func schoolName(school *models.School) string {
+	if school == nil {
+		return ""
+	}
+	return school.Name
+}
+
+func schoolID(school *models.School) interface{} {
+	if school == nil {
+		return nil
+	}
+	return school.ID
+}
+
+// linkAccountSchools matches accounts that only have a free-text school name
+// to school records, creating one school per group of names with the same
+// SchoolKey. The most common spelling in a group names the school.
+func (d *Database) linkAccountSchools() error {
+	return d.InTx(func(tx *Database) error {
+		rows, err := tx.db.Query(`SELECT id, school FROM accounts WHERE school_id IS NULL AND school IS NOT NULL AND school <> ''`)
+		if err != nil {
+			return fmt.Errorf("failed to read account schools: %w", err)
+		}
+
+		type group struct {
+			accounts  []int
+			spellings map[string]int
+		}
+		groups := make(map[string]*group)
+		var keys []string
+		for rows.Next() {
+			var (
+				id   int
+				name string
+			)
+			if err := rows.Scan(&id, &name); err != nil {
+				rows.Close()
+				return fmt.Errorf("failed to scan account school: %w", err)
+			}
+			key := models.SchoolKey(name)
+			if key == "" {
+				continue
+			}
+			g, ok := groups[key]
+			if !ok {
+				g = &group{spellings: make(map[string]int)}
+				groups[key] = g
+				keys = append(keys, key)
+			}
+			g.accounts = append(g.accounts, id)
+			g.spellings[strings.TrimSpace(name)]++
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return fmt.Errorf("failed to read account schools: %w", err)
+		}
+
+		for _, key := range keys {
+			g := groups[key]
+
+			// Prefer the most used spelling, then the longest, which is
+			// usually the one without abbreviations
+			var name string
+			for spelling, n := range g.spellings {
+				best := g.spellings[name]
+				if n > best || (n == best && (len(spelling) > len(name) || (len(spelling) == len(name) && spelling < name))) {
+					name = spelling
+				}
+			}
+
+			school, err := tx.resolveSchool(nil, name)
+			if err != nil {
+				return err
+			}
+			for _, id := range g.accounts {
+				if _, err := tx.db.Exec(`UPDATE accounts SET school = ?, school_id = ?, version = version + 1 WHERE id = ?`,
+					school.Name, school.ID, id); err != nil {
+					return fmt.Errorf("failed to link account %d to a school: %w", id, err)
+				}
+			}
+		}
+		return nil
+	})
+}
+
+const classroomColumns = `id, school_id, name, grade, sourced_id, created_at, updated_at`
+
+func scanClassroom(row rowScanner) (*models.Classroom, error) {
+	var classroom models.Classroom
+	if err := row.Scan(&classroom.ID, &classroom.SchoolID, &classroom.Name, &classroom.Grade,
+		&classroom.SourcedID, &classroom.CreatedAt, &classroom.UpdatedAt); err != nil {
+		return nil, err
+	}
+	return &classroom, nil
+}
+
+// classroomNameTaken reports whether another classroom of the school has name
+func (d *Database) classroomNameTaken(schoolID, exceptID int, name string) (bool, error) {
+	var n int
+	err := d.db.QueryRow(`SELECT COUNT(*) FROM classrooms WHERE school_id = ? AND name = ? AND id <> ?`,
+		schoolID, name, exceptID).Scan(&n)
+	if err != nil {
+		return false, fmt.Errorf("failed to check classroom name: %w", err)
+	}
+	return n > 0, nil
+}
+
+// CreateClassroom adds a classroom to a school
+func (d *Database) CreateClassroom(schoolID int, req models.ClassroomRequest) (*models.Classroom, error) {
+	name := strings.TrimSpace(req.Name)
+	if name == "" {
+		return nil, ErrNameRequired
+	}
+	if _, err := d.GetSchool(schoolID); err != nil {
+		return nil, err
+	}
+	if taken, err := d.classroomNameTaken(schoolID, 0, name); err != nil {
+		return nil, err
+	} else if taken {
+		return nil, ErrClassroomExists
+	}
+
+	now := time.Now()
+	var id int
+	err := d.db.QueryRow(`
+	INSERT INTO classrooms (school_id, name, grade, created_at, updated_at)
+	VALUES (?, ?, ?, ?, ?)
+	RETURNING id
+	`, schoolID, name, req.Grade, now, now).Scan(&id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create classroom: %w", err)
+	}
+
+	return d.GetClassroom(id)
+}
+
+// GetClassroom returns a classroom by ID
+func (d *Database) GetClassroom(id int) (*models.Classroom, error) {
+	classroom, err := scanClassroom(d.db.QueryRow(`SELECT `+classroomColumns+` FROM classrooms WHERE id = ?`, id))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("classroom not found")
+		}
+		return nil, fmt.Errorf("failed to get classroom: %w", err)
+	}
+	return classroom, nil
+}
+
+// ListClassrooms returns the classrooms of a school ordered by grade and name
+func (d *Database) ListClassrooms(schoolID int) ([]models.Classroom, error) {
+	rows, err := d.db.Query(`SELECT `+classroomColumns+` FROM classrooms WHERE school_id = ? ORDER BY grade, name, id`, schoolID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get classrooms: %w", err)
+	}
+	defer rows.Close()
+
+	classrooms := []models.Classroom{}
+	for rows.Next() {
+		classroom, err := scanClassroom(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan classroom: %w", err)
+		}
+		classrooms = append(classrooms, *classroom)
+	}
+
+	return classrooms, rows.Err()
+}
+
+// UpdateClassroom renames a classroom or changes its grade
+func (d *Database) UpdateClassroom(id int, req models.ClassroomRequest) (*models.Classroom, error) {
+	name := strings.TrimSpace(req.Name)
+	if name == "" {
+		return nil, ErrNameRequired
+	}
+	classroom, err := d.GetClassroom(id)
+	if err != nil {
+		return nil, err
+	}
+	if taken, err := d.classroomNameTaken(classroom.SchoolID, id, name); err != nil {
+		return nil, err
+	} else if taken {
+		return nil, ErrClassroomExists
+	}
+
+	if _, err := d.db.Exec(`UPDATE classrooms SET name = ?, grade = ?, updated_at = ? WHERE id = ?`,
+		name, req.Grade, time.Now(), id); err != nil {
+		return nil, fmt.Errorf("failed to update classroom: %w", err)
+	}
+
+	return d.GetClassroom(id)
+}
+
+// DeleteClassroom removes a classroom and its enrollments
+func (d *Database) DeleteClassroom(id int) error {
+	result, err := d.db.Exec(`DELETE FROM classrooms WHERE id = ?`, id)
+	if err != nil {
+		return fmt.Errorf("failed to delete classroom: %w", err)
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return fmt.Errorf("classroom not found")
+	}
+	return nil
+}
+
+// Enroll places an account in a classroom of its own school, or changes the
+// role it already has there. Only staff can be enrolled as teachers.
+func (d *Database) Enroll(classroomID, accountID int, role string) (*models.Enrollment, error) {
+	if role == "" {
+		role = models.EnrollmentStudent
+	}
+	if role != models.EnrollmentStudent && role != models.EnrollmentTeacher {
+		return nil, ErrInvalidEnrollment
+	}
+
+	classroom, err := d.GetClassroom(classroomID)
+	if err != nil {
+		return nil, err
+	}
+	account, err := d.GetAccountByID(accountID)
+	if err != nil {
+		return nil, err
+	}
+	if account.SchoolID == nil || *account.SchoolID != classroom.SchoolID {
+		return nil, ErrWrongSchool
+	}
+	if role == models.EnrollmentTeacher && account.Role == models.RoleStudent {
+		return nil, ErrInvalidEnrollment
+	}
+
+	enrollment := models.Enrollment{ClassroomID: classroomID, AccountID: accountID, Role: role, EnrolledAt: time.Now()}
+	_, err = d.db.Exec(`
+	INSERT INTO enrollments (classroom_id, account_id, role, enrolled_at)
+	VALUES (?, ?, ?, ?)
+	ON CONFLICT (classroom_id, account_id) DO UPDATE SET role = excluded.role
+	`, enrollment.ClassroomID, enrollment.AccountID, enrollment.Role, enrollment.EnrolledAt)
+	if err != nil {
+		return nil, fmt.Errorf("failed to enroll account: %w", err)
+	}
+
+	return &enrollment, nil
+}
+
+// Unenroll removes an account from a classroom
+func (d *Database) Unenroll(classroomID, accountID int) error {
+	result, err := d.db.Exec(`DELETE FROM enrollments WHERE classroom_id = ? AND account_id = ?`, classroomID, accountID)
+	if err != nil {
+		return fmt.Errorf("failed to unenroll account: %w", err)
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return fmt.Errorf("enrollment not found")
+	}
+	return nil
+}
+
+// GetEnrollments returns the enrollments of a classroom, teachers first
+func (d *Database) GetEnrollments(classroomID int) ([]models.Enrollment, error) {
+	rows, err := d.db.Query(`
+	SELECT classroom_id, account_id, role, enrolled_at FROM enrollments
+	WHERE classroom_id = ?
+	ORDER BY CASE WHEN role = ? THEN 0 ELSE 1 END, account_id
+	`, classroomID, models.EnrollmentTeacher)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get enrollments: %w", err)
+	}
+	defer rows.Close()
+
+	enrollments := []models.Enrollment{}
+	for rows.Next() {
+		var e models.Enrollment
+		if err := rows.Scan(&e.ClassroomID, &e.AccountID, &e.Role, &e.EnrolledAt); err != nil {
+			return nil, fmt.Errorf("failed to scan enrollment: %w", err)
+		}
+		enrollments = append(enrollments, e)
+	}
+
+	return enrollments, rows.Err()
+}
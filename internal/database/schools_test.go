@@ -0,0 +1,136 @@
+package database
+
+import (
+	"errors"
+	"testing"
+
+	"educational-game-db/internal/models"
+)
+
+func TestSchoolNamesAreNormalized(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, db *Database) {
+		if err := db.MigrateTo(7); err != nil {
+			t.Fatalf("Failed to migrate down: %v", err)
+		}
+		for i, school := range []string{"Lincoln Elem.", "lincoln elementary", "Lincoln Elementary", " Lincoln Elementary School", "Lincoln Elementary", "Roosevelt HS"} {
+			if _, err := db.db.Exec(`INSERT INTO accounts (username, email, password_hash, first_name, last_name, school)
+				VALUES (?, ?, 'x', '', '', ?)`, "user"+string(rune('a'+i)), string(rune('a'+i))+"@example.com", school); err != nil {
+				t.Fatalf("Failed to insert account: %v", err)
+			}
+		}
+		if err := db.MigrateUp(); err != nil {
+			t.Fatalf("Failed to migrate up: %v", err)
+		}
+		if err := db.linkAccountSchools(); err != nil {
+			t.Fatalf("Failed to link schools: %v", err)
+		}
+
+		schools, err := db.ListSchools()
+		if err != nil {
+			t.Fatalf("Failed to list schools: %v", err)
+		}
+		if len(schools) != 2 || schools[0].Name != "Lincoln Elementary" || schools[1].Name != "Roosevelt HS" {
+			t.Fatalf("Expected Lincoln Elementary and Roosevelt HS, got %+v", schools)
+		}
+
+		account, err := db.GetAccountByUsername("usera")
+		if err != nil {
+			t.Fatalf("Failed to get account: %v", err)
+		}
+		if account.SchoolID == nil || *account.SchoolID != schools[0].ID || account.School != "Lincoln Elementary" {
+			t.Errorf("Expected usera to be moved to Lincoln Elementary, got %q (%v)", account.School, account.SchoolID)
+		}
+
+		if _, err := db.CreateSchool("Roosevelt High School"); !errors.Is(err, ErrSchoolExists) {
+			t.Errorf("Expected ErrSchoolExists for a differently spelt school, got %v", err)
+		}
+	})
+}
+
+func TestSchoolsAndClassrooms(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, db *Database) {
+		north, err := db.CreateSchool("North Elementary")
+		if err != nil {
+			t.Fatalf("Failed to create school: %v", err)
+		}
+
+		student, err := db.CreateAccount(models.CreateAccountRequest{
+			Username: "pupil", Email: "pupil@example.com", Password: "password123", School: "north elem",
+		})
+		if err != nil {
+			t.Fatalf("Failed to create account: %v", err)
+		}
+		if student.SchoolID == nil || *student.SchoolID != north.ID || student.School != north.Name {
+			t.Fatalf("Expected account to join %s, got %q (%v)", north.Name, student.School, student.SchoolID)
+		}
+		outsider, err := db.CreateAccount(models.CreateAccountRequest{
+			Username: "outsider", Email: "outsider@example.com", Password: "password123", School: "South Middle",
+		})
+		if err != nil {
+			t.Fatalf("Failed to create account: %v", err)
+		}
+
+		classroom, err := db.CreateClassroom(north.ID, models.ClassroomRequest{Name: "Room 4", Grade: 4})
+		if err != nil {
+			t.Fatalf("Failed to create classroom: %v", err)
+		}
+		if _, err := db.CreateClassroom(north.ID, models.ClassroomRequest{Name: "Room 4"}); !errors.Is(err, ErrClassroomExists) {
+			t.Errorf("Expected ErrClassroomExists, got %v", err)
+		}
+
+		if _, err := db.Enroll(classroom.ID, student.ID, ""); err != nil {
+			t.Fatalf("Failed to enroll: %v", err)
+		}
+		if _, err := db.Enroll(classroom.ID, outsider.ID, ""); !errors.Is(err, ErrWrongSchool) {
+			t.Errorf("Expected ErrWrongSchool, got %v", err)
+		}
+		if _, err := db.Enroll(classroom.ID, student.ID, models.EnrollmentTeacher); !errors.Is(err, ErrInvalidEnrollment) {
+			t.Errorf("Expected a student to be refused as teacher, got %v", err)
+		}
+
+		page, err := db.ListAccounts(models.AccountListOptions{ClassroomID: &classroom.ID})
+		if err != nil {
+			t.Fatalf("Failed to list classroom: %v", err)
+		}
+		if page.Total != 1 || page.Accounts[0].ID != student.ID {
+			t.Errorf("Expected only the enrolled student, got %+v", page.Accounts)
+		}
+		stats, err := db.GetAccountStats(models.AccountListOptions{SchoolID: &north.ID})
+		if err != nil {
+			t.Fatalf("Failed to get stats: %v", err)
+		}
+		if stats.TotalAccounts != 1 {
+			t.Errorf("Expected 1 account at %s, got %d", north.Name, stats.TotalAccounts)
+		}
+
+		if _, err := db.RenameSchool(north.ID, "Northside Elementary"); err != nil {
+			t.Fatalf("Failed to rename school: %v", err)
+		}
+		if renamed, _ := db.GetAccountByID(student.ID); renamed.School != "Northside Elementary" {
+			t.Errorf("Expected the account to show the new name, got %q", renamed.School)
+		}
+
+		// Merging moves accounts and classrooms, and removes the duplicate
+		into, err := db.MergeSchools(*outsider.SchoolID, north.ID)
+		if err != nil {
+			t.Fatalf("Failed to merge schools: %v", err)
+		}
+		moved, _ := db.GetAccountByID(outsider.ID)
+		if *moved.SchoolID != into.ID || moved.School != into.Name {
+			t.Errorf("Expected outsider to move to %s, got %q", into.Name, moved.School)
+		}
+		if schools, _ := db.ListSchools(); len(schools) != 1 {
+			t.Errorf("Expected one school after merging, got %+v", schools)
+		}
+
+		if err := db.DeleteSchool(north.ID); err != nil {
+			t.Fatalf("Failed to delete school: %v", err)
+		}
+		if _, err := db.GetClassroom(classroom.ID); err == nil {
+			t.Error("Expected the school's classrooms to be deleted")
+		}
+		if detached, _ := db.GetAccountByID(student.ID); detached.SchoolID != nil || detached.School != "" {
+			t.Errorf("Expected the account to be detached, got %q (%v)", detached.School, detached.SchoolID)
+		}
+	})
+}
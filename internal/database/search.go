@@ -0,0 +1,156 @@
+package database
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+
+	"educational-game-db/internal/models"
+)
+
+// searchIndexDDL creates the SQLite FTS5 index over accounts and the triggers
+// keeping it in sync. It lives outside the migrations because it needs a
+// go-sqlite3 build with the sqlite_fts5 tag.
+var searchIndexDDL = []string{
+	`CREATE VIRTUAL TABLE IF NOT EXISTS accounts_fts USING fts5(
+		username, email, first_name, last_name, school,
+		content = 'accounts', content_rowid = 'id',
+		tokenize = 'unicode61 remove_diacritics 2'
+	)`,
+	`CREATE TRIGGER IF NOT EXISTS accounts_fts_insert AFTER INSERT ON accounts BEGIN
+		INSERT INTO accounts_fts (rowid, username, email, first_name, last_name, school)
+		VALUES (new.id, new.username, new.email, new.first_name, new.last_name, new.school);
+	END`,
+	`CREATE TRIGGER IF NOT EXISTS accounts_fts_delete AFTER DELETE ON accounts BEGIN
+		INSERT INTO accounts_fts (accounts_fts, rowid, username, email, first_name, last_name, school)
+		VALUES ('delete', old.id, old.username, old.email, old.first_name, old.last_name, old.school);
+	END`,
+	`CREATE TRIGGER IF NOT EXISTS accounts_fts_update AFTER UPDATE ON accounts BEGIN
+		INSERT INTO accounts_fts (accounts_fts, rowid, username, email, first_name, last_name, school)
+		VALUES ('delete', old.id, old.username, old.email, old.first_name, old.last_name, old.school);
+		INSERT INTO accounts_fts (rowid, username, email, first_name, last_name, school)
+		VALUES (new.id, new.username, new.email, new.first_name, new.last_name, new.school);
+	END`,
+}
+
+var searchIndexTriggers = []string{"accounts_fts_insert", "accounts_fts_delete", "accounts_fts_update"}
+
+// ensureSearchIndex creates or repairs the SQLite full-text index. Builds
+// without FTS5 drop its triggers instead, since they could not write to the
+// index; the next FTS5 build then recreates them and rebuilds the index.
+func (d *Database) ensureSearchIndex() error {
+	if _, ok := d.dialect.(sqliteDialect); !ok {
+		return nil
+	}
+
+	if !sqliteFullText {
+		for _, trigger := range searchIndexTriggers {
+			if _, err := d.db.Exec(`DROP TRIGGER IF EXISTS ` + trigger); err != nil {
+				return fmt.Errorf("failed to drop search trigger: %w", err)
+			}
+		}
+		return nil
+	}
+
+	return d.InTx(func(tx *Database) error {
+		var existing int
+		err := tx.db.QueryRow(`SELECT COUNT(*) FROM sqlite_master WHERE type = 'trigger' AND name LIKE 'accounts_fts_%'`).Scan(&existing)
+		if err != nil {
+			return fmt.Errorf("failed to inspect search index: %w", err)
+		}
+		if existing == len(searchIndexTriggers) {
+			return nil
+		}
+
+		for _, stmt := range searchIndexDDL {
+			if _, err := tx.db.Exec(stmt); err != nil {
+				return fmt.Errorf("failed to create search index: %w", err)
+			}
+		}
+		if _, err := tx.db.Exec(`INSERT INTO accounts_fts (accounts_fts) VALUES ('rebuild')`); err != nil {
+			return fmt.Errorf("failed to rebuild search index: %w", err)
+		}
+		return nil
+	})
+}
+
+// searchTerms splits a search query into lower-cased words, dropping punctuation
+func searchTerms(query string) []string {
+	return strings.FieldsFunc(strings.ToLower(query), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// SearchAccounts finds accounts whose username, email, names or school start
+// with every word of query, best matches first. The School, Roles, SelfID and
+// Limit fields of opts narrow the results; sorting and cursors are ignored.
+func (d *Database) SearchAccounts(query string, opts models.AccountListOptions) ([]models.Account, error) {
+	terms := searchTerms(query)
+	if len(terms) == 0 {
+		return []models.Account{}, nil
+	}
+	if opts.Limit <= 0 {
+		opts.Limit = models.DefaultPageSize
+	}
+	if opts.Limit > models.MaxPageSize {
+		opts.Limit = models.MaxPageSize
+	}
+
+	conds, args := accountFilter(opts)
+
+	var accounts []models.Account
+	var err error
+	if _, ok := d.dialect.(sqliteDialect); ok && sqliteFullText {
+		accounts, err = d.searchFullText(terms, conds, args, opts.Limit)
+	} else {
+		accounts, err = d.searchLike(terms, conds, args, opts.Limit)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to search accounts: %w", err)
+	}
+	if accounts == nil {
+		accounts = []models.Account{}
+	}
+
+	return accounts, nil
+}
+
+// searchFullText ranks FTS5 prefix matches with bm25, weighting names above
+// email and school
+func (d *Database) searchFullText(terms, conds []string, args []interface{}, limit int) ([]models.Account, error) {
+	phrases := make([]string, len(terms))
+	for i, term := range terms {
+		phrases[i] = `"` + term + `"*`
+	}
+
+	query := `
+	WITH hits AS (
+		SELECT rowid AS hit_id, bm25(accounts_fts, 10.0, 2.0, 5.0, 5.0, 1.0) AS hit_rank
+		FROM accounts_fts WHERE accounts_fts MATCH ?
+	)
+	SELECT ` + accountColumns + ` FROM accounts JOIN hits ON hits.hit_id = accounts.id` +
+		whereClause(conds) + ` ORDER BY hits.hit_rank, id LIMIT ?`
+
+	queryArgs := append([]interface{}{strings.Join(phrases, " ")}, args...)
+	return d.queryAccounts(query, append(queryArgs, limit)...)
+}
+
+// searchLike is the portable fallback used by PostgreSQL and SQLite builds
+// without FTS5. Exact username matches come first, then matches by name.
+func (d *Database) searchLike(terms, conds []string, args []interface{}, limit int) ([]models.Account, error) {
+	fields := []string{"username", "email", "first_name", "last_name", "school"}
+
+	for _, term := range terms {
+		var either []string
+		for _, field := range fields {
+			// Match the start of the field or of any word within it
+			either = append(either, "LOWER("+field+") LIKE ?", "LOWER("+field+") LIKE ?")
+			args = append(args, term+"%", "% "+term+"%")
+		}
+		conds = append(conds, "("+strings.Join(either, " OR ")+")")
+	}
+
+	query := `SELECT ` + accountColumns + ` FROM accounts` + whereClause(conds) +
+		` ORDER BY CASE WHEN LOWER(username) = ? THEN 0 ELSE 1 END, last_name, first_name, id LIMIT ?`
+	return d.queryAccounts(query, append(args, strings.Join(terms, " "), limit)...)
+}
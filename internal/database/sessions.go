@@ -0,0 +1,98 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrInvalidRefreshToken is returned when a refresh token is unknown, expired or revoked
+var ErrInvalidRefreshToken = errors.New("invalid refresh token")
+
+// CreateRefreshToken stores the hash of a newly issued refresh token
+func (d *Database) CreateRefreshToken(accountID int, tokenHash string, expiresAt time.Time) error {
+	query := `
+	INSERT INTO refresh_tokens (account_id, token_hash, expires_at, created_at)
+	VALUES (?, ?, ?, ?)
+	`
+
+	_, err := d.db.Exec(query, accountID, tokenHash, expiresAt, time.Now())
+	if err != nil {
+		return fmt.Errorf("failed to create refresh token: %w", err)
+	}
+
+	return nil
+}
+
+// RotateRefreshToken revokes the presented refresh token and stores its replacement.
+// Presenting a token that was already rotated revokes every token of the account,
+// since it means the token has leaked.
+func (d *Database) RotateRefreshToken(oldHash, newHash string, expiresAt time.Time) (int, error) {
+	var (
+		accountID int
+		reused    bool
+	)
+
+	err := d.InTx(func(tx *Database) error {
+		var (
+			id        int
+			expires   time.Time
+			revokedAt sql.NullTime
+		)
+		err := tx.db.QueryRow(`
+		SELECT id, account_id, expires_at, revoked_at FROM refresh_tokens WHERE token_hash = ?
+		`, oldHash).Scan(&id, &accountID, &expires, &revokedAt)
+		if err != nil {
+			if err == sql.ErrNoRows {
+				return ErrInvalidRefreshToken
+			}
+			return fmt.Errorf("failed to get refresh token: %w", err)
+		}
+
+		now := time.Now()
+		if revokedAt.Valid {
+			// Commit the family revocation, then report the token as invalid
+			reused = true
+			return tx.RevokeAccountRefreshTokens(accountID)
+		}
+
+		if now.After(expires) {
+			return ErrInvalidRefreshToken
+		}
+
+		if _, err := tx.db.Exec(`UPDATE refresh_tokens SET revoked_at = ? WHERE id = ?`, now, id); err != nil {
+			return fmt.Errorf("failed to revoke refresh token: %w", err)
+		}
+
+		return tx.CreateRefreshToken(accountID, newHash, expiresAt)
+	})
+	if err != nil {
+		return 0, err
+	}
+	if reused {
+		return 0, ErrInvalidRefreshToken
+	}
+
+	return accountID, nil
+}
+
+// RevokeRefreshToken revokes a single refresh token, used on logout
+func (d *Database) RevokeRefreshToken(tokenHash string) error {
+	query := `UPDATE refresh_tokens SET revoked_at = ? WHERE token_hash = ? AND revoked_at IS NULL`
+	if _, err := d.db.Exec(query, time.Now(), tokenHash); err != nil {
+		return fmt.Errorf("failed to revoke refresh token: %w", err)
+	}
+
+	return nil
+}
+
+// RevokeAccountRefreshTokens revokes every active refresh token of an account
+func (d *Database) RevokeAccountRefreshTokens(accountID int) error {
+	query := `UPDATE refresh_tokens SET revoked_at = ? WHERE account_id = ? AND revoked_at IS NULL`
+	if _, err := d.db.Exec(query, time.Now(), accountID); err != nil {
+		return fmt.Errorf("failed to revoke refresh tokens: %w", err)
+	}
+
+	return nil
+}
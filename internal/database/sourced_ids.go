@@ -0,0 +1,72 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"educational-game-db/internal/models"
+)
+
+// ErrSourcedIDTaken is returned when linking a school or classroom to a
+// student information system ID that another one is linked to
+var ErrSourcedIDTaken = errors.New("the sourced ID is linked to another record")
+
+// GetSchoolBySourcedID returns the school synced from a student information
+// system with the given ID
+func (d *Database) GetSchoolBySourcedID(id string) (*models.School, error) {
+	school, err := scanSchool(d.db.QueryRow(`SELECT `+schoolColumns+` FROM schools WHERE sourced_id = ?`, id))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("school not found")
+		}
+		return nil, fmt.Errorf("failed to get school: %w", err)
+	}
+	return school, nil
+}
+
+// SetSchoolSourcedID links a school to its ID in a student information system
+func (d *Database) SetSchoolSourcedID(id int, sourcedID string) error {
+	if existing, err := d.GetSchoolBySourcedID(sourcedID); err == nil && existing.ID != id {
+		return ErrSourcedIDTaken
+	}
+
+	result, err := d.db.Exec(`UPDATE schools SET sourced_id = ? WHERE id = ?`, externalID(sourcedID), id)
+	if err != nil {
+		return fmt.Errorf("failed to link school: %w", err)
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return fmt.Errorf("school not found")
+	}
+	return nil
+}
+
+// GetClassroomBySourcedID returns the classroom synced from a student
+// information system with the given ID
+func (d *Database) GetClassroomBySourcedID(id string) (*models.Classroom, error) {
+	classroom, err := scanClassroom(d.db.QueryRow(`SELECT `+classroomColumns+` FROM classrooms WHERE sourced_id = ?`, id))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("classroom not found")
+		}
+		return nil, fmt.Errorf("failed to get classroom: %w", err)
+	}
+	return classroom, nil
+}
+
+// SetClassroomSourcedID links a classroom to its ID in a student information
+// system
+func (d *Database) SetClassroomSourcedID(id int, sourcedID string) error {
+	if existing, err := d.GetClassroomBySourcedID(sourcedID); err == nil && existing.ID != id {
+		return ErrSourcedIDTaken
+	}
+
+	result, err := d.db.Exec(`UPDATE classrooms SET sourced_id = ? WHERE id = ?`, externalID(sourcedID), id)
+	if err != nil {
+		return fmt.Errorf("failed to link classroom: %w", err)
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return fmt.Errorf("classroom not found")
+	}
+	return nil
+}
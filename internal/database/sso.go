@@ -0,0 +1,117 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"educational-game-db/internal/models"
+)
+
+var (
+	// ErrInvalidSSOState is returned for an unknown, used or expired single sign-on
+	ErrInvalidSSOState = errors.New("invalid or expired sign-in; please try again")
+	// ErrOIDCSubjectTaken is returned when linking an account that is already
+	// linked to another identity provider account
+	ErrOIDCSubjectTaken = errors.New("account is linked to another single sign-on identity")
+)
+
+// CreateSSOState records a sign-in sent to the identity provider, and clears
+// out those that expired without coming back
+func (d *Database) CreateSSOState(stateHash, nonce, codeVerifier string, expiresAt time.Time) error {
+	now := time.Now()
+	if _, err := d.db.Exec(`DELETE FROM sso_states WHERE expires_at <= ?`, now); err != nil {
+		return fmt.Errorf("failed to delete expired sign-ins: %w", err)
+	}
+
+	_, err := d.db.Exec(`
+	INSERT INTO sso_states (state_hash, nonce, code_verifier, created_at, expires_at) VALUES (?, ?, ?, ?, ?)
+	`, stateHash, nonce, codeVerifier, now, expiresAt)
+	if err != nil {
+		return fmt.Errorf("failed to store sign-in: %w", err)
+	}
+	return nil
+}
+
+// ConsumeSSOState returns a sign-in as it comes back from the identity
+// provider. Each state is only accepted once.
+func (d *Database) ConsumeSSOState(stateHash string) (*models.SSOState, error) {
+	var state models.SSOState
+	err := d.db.QueryRow(`
+	DELETE FROM sso_states WHERE state_hash = ? RETURNING nonce, code_verifier, created_at, expires_at
+	`, stateHash).Scan(&state.Nonce, &state.CodeVerifier, &state.CreatedAt, &state.ExpiresAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrInvalidSSOState
+		}
+		return nil, fmt.Errorf("failed to get sign-in: %w", err)
+	}
+
+	if !time.Now().Before(state.ExpiresAt) {
+		return nil, ErrInvalidSSOState
+	}
+	return &state, nil
+}
+
+// GetAccountByOIDCSubject returns the account linked to an identity provider account
+func (d *Database) GetAccountByOIDCSubject(subject string) (*models.Account, error) {
+	query := `SELECT ` + accountColumns + ` FROM accounts WHERE oidc_subject = ? AND deleted_at IS NULL`
+
+	account, err := scanAccount(d.db.QueryRow(query, subject))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("account not found")
+		}
+		return nil, fmt.Errorf("failed to get account: %w", err)
+	}
+
+	return account, nil
+}
+
+// LinkOIDCSubject links an account to its identity provider account, so later
+// sign-ins find it even if its email changes
+func (d *Database) LinkOIDCSubject(accountID int, subject string) error {
+	result, err := d.db.Exec(`
+	UPDATE accounts SET oidc_subject = ?, updated_at = ? WHERE id = ? AND (oidc_subject IS NULL OR oidc_subject = ?)
+	`, subject, time.Now(), accountID, subject)
+	if err != nil {
+		return fmt.Errorf("failed to link account: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+	if rowsAffected == 0 {
+		if _, err := d.GetAccountByID(accountID); err != nil {
+			return err
+		}
+		return ErrOIDCSubjectTaken
+	}
+	return nil
+}
+
+// UnlinkOIDCSubject removes an account's link to its identity provider
+// account. It reports false if the account was not linked.
+func (d *Database) UnlinkOIDCSubject(accountID int) (bool, error) {
+	result, err := d.db.Exec(`
+	UPDATE accounts SET oidc_subject = NULL, updated_at = ? WHERE id = ? AND oidc_subject IS NOT NULL
+	`, time.Now(), accountID)
+	if err != nil {
+		return false, fmt.Errorf("failed to unlink account: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to get rows affected: %w", err)
+	}
+	return rowsAffected > 0, nil
+}
+
+func oidcSubject(subject string) interface{} {
+	if subject == "" {
+		return nil
+	}
+	return subject
+}
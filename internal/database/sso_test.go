@@ -0,0 +1,75 @@
+package database
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"educational-game-db/internal/models"
+)
+
+func TestSSOStates(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, db *Database) {
+		if err := db.CreateSSOState("expired", "n0", "v0", time.Now().Add(-time.Minute)); err != nil {
+			t.Fatalf("Failed to create state: %v", err)
+		}
+		if err := db.CreateSSOState("fresh", "n1", "v1", time.Now().Add(time.Minute)); err != nil {
+			t.Fatalf("Failed to create state: %v", err)
+		}
+
+		if _, err := db.ConsumeSSOState("expired"); !errors.Is(err, ErrInvalidSSOState) {
+			t.Errorf("Expected an expired state to be refused, got %v", err)
+		}
+		state, err := db.ConsumeSSOState("fresh")
+		if err != nil || state.Nonce != "n1" || state.CodeVerifier != "v1" {
+			t.Fatalf("Expected the fresh state, got %+v, %v", state, err)
+		}
+		if _, err := db.ConsumeSSOState("fresh"); !errors.Is(err, ErrInvalidSSOState) {
+			t.Errorf("Expected a state to be accepted only once, got %v", err)
+		}
+	})
+}
+
+func TestOIDCSubjectLinks(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, db *Database) {
+		provisioned, err := db.CreateAccount(models.CreateAccountRequest{
+			Username: "ssokid", Email: "ssokid@example.com", Password: "unknown123", OIDCSubject: "sub-1",
+		})
+		if err != nil {
+			t.Fatalf("Failed to create account: %v", err)
+		}
+		if provisioned.OIDCSubject == nil || *provisioned.OIDCSubject != "sub-1" {
+			t.Errorf("Expected the account to be linked on creation, got %v", provisioned.OIDCSubject)
+		}
+		if found, err := db.GetAccountByOIDCSubject("sub-1"); err != nil || found.ID != provisioned.ID {
+			t.Errorf("Expected to find the account by subject, got %v", err)
+		}
+
+		local, _ := db.CreateAccount(models.CreateAccountRequest{Username: "local", Email: "local@example.com", Password: "unknown123"})
+		if local.OIDCSubject != nil {
+			t.Error("Expected accounts without a subject to stay unlinked")
+		}
+		if err := db.LinkOIDCSubject(local.ID, "sub-2"); err != nil {
+			t.Fatalf("Failed to link account: %v", err)
+		}
+		if err := db.LinkOIDCSubject(local.ID, "sub-2"); err != nil {
+			t.Errorf("Expected linking the same subject again to succeed, got %v", err)
+		}
+		if err := db.LinkOIDCSubject(local.ID, "sub-3"); !errors.Is(err, ErrOIDCSubjectTaken) {
+			t.Errorf("Expected a linked account to refuse another subject, got %v", err)
+		}
+		if err := db.LinkOIDCSubject(provisioned.ID+local.ID+100, "sub-4"); err == nil || errors.Is(err, ErrOIDCSubjectTaken) {
+			t.Errorf("Expected an unknown account to be reported, got %v", err)
+		}
+
+		if unlinked, err := db.UnlinkOIDCSubject(local.ID); err != nil || !unlinked {
+			t.Errorf("Expected the account to be unlinked, got %v, %v", unlinked, err)
+		}
+		if unlinked, _ := db.UnlinkOIDCSubject(local.ID); unlinked {
+			t.Error("Expected unlinking twice to report nothing unlinked")
+		}
+		if _, err := db.GetAccountByOIDCSubject("sub-2"); err == nil {
+			t.Error("Expected an unlinked subject not to be found")
+		}
+	})
+}
@@ -0,0 +1,223 @@
+package database
+
+import (
+	"time"
+
+	"educational-game-db/internal/models"
+	"educational-game-db/internal/progression"
+)
+
+// AccountStore persists student accounts
+type AccountStore interface {
+	CreateAccount(req models.CreateAccountRequest) (*models.Account, error)
+	GetAccountByID(id int) (*models.Account, error)
+	GetAccountByUsername(username string) (*models.Account, error)
+	GetAccountByEmail(email string) (*models.Account, error)
+	GetAccountByExternalID(id string) (*models.Account, error)
+	GetAllAccounts() ([]models.Account, error)
+	ListAccounts(opts models.AccountListOptions) (*models.AccountPage, error)
+	ForEachAccount(opts models.AccountListOptions, fn func(*models.Account) error) error
+	SearchAccounts(query string, opts models.AccountListOptions) ([]models.Account, error)
+	UpdateAccount(id int, req models.UpdateAccountRequest) (*models.Account, error)
+	SetAccountRole(id int, role string) (*models.Account, error)
+	SetAccountActive(id int, active bool) (*models.Account, error)
+	DeleteAccount(id int) error
+	GetDeletedAccount(id int) (*models.Account, error)
+	RestoreAccount(id int) (*models.Account, error)
+	PurgeDeletedAccounts(before time.Time) (int, error)
+	GetAccountStats(opts models.AccountListOptions) (*models.AccountStats, error)
+	VerifyPassword(username, password string) bool
+}
+
+// SchoolStore persists schools, their classrooms and classroom enrollments
+type SchoolStore interface {
+	CreateSchool(name string) (*models.School, error)
+	GetSchool(id int) (*models.School, error)
+	FindSchool(name string) (*models.School, error)
+	ListSchools() ([]models.School, error)
+	RenameSchool(id int, name string) (*models.School, error)
+	DeleteSchool(id int) error
+	MergeSchools(fromID, intoID int) (*models.School, error)
+	GetSchoolBySourcedID(id string) (*models.School, error)
+	SetSchoolSourcedID(id int, sourcedID string) error
+
+	CreateClassroom(schoolID int, req models.ClassroomRequest) (*models.Classroom, error)
+	GetClassroom(id int) (*models.Classroom, error)
+	ListClassrooms(schoolID int) ([]models.Classroom, error)
+	UpdateClassroom(id int, req models.ClassroomRequest) (*models.Classroom, error)
+	DeleteClassroom(id int) error
+	GetClassroomBySourcedID(id string) (*models.Classroom, error)
+	SetClassroomSourcedID(id int, sourcedID string) error
+
+	Enroll(classroomID, accountID int, role string) (*models.Enrollment, error)
+	Unenroll(classroomID, accountID int) error
+	GetEnrollments(classroomID int) ([]models.Enrollment, error)
+}
+
+// RosterStore gives teachers their classrooms and the students in them
+type RosterStore interface {
+	TeacherClassrooms(teacherID int) ([]models.Classroom, error)
+	TeacherRoster(teacherID int) ([]int, error)
+	IsClassroomTeacher(classroomID, accountID int) (bool, error)
+	AddToRoster(classroomID int, usernames []string) (*models.RosterResult, error)
+}
+
+// GuardianStore links guardians to students and records their consent
+type GuardianStore interface {
+	PendingConsents(guardianEmail string) ([]models.Account, error)
+	SetConsentToken(studentID int, tokenHash string, expiresAt time.Time) error
+	ConsentRequested(studentID int, guardianEmail, tokenHash string) (bool, error)
+	RecordConsent(link models.GuardianLink) (*models.GuardianLink, error)
+	GetGuardianLinks(studentID int) ([]models.GuardianLink, error)
+	GetChildren(guardianID int) ([]models.Account, error)
+	IsGuardianOf(guardianID, studentID int) (bool, error)
+}
+
+// XPStore keeps the experience ledger and the levels derived from it
+type XPStore interface {
+	SetLevelCurve(curve progression.Curve) error
+	LevelCurve() progression.Curve
+	RecordXPEvent(event models.XPEvent) (*models.XPEvent, *models.Account, error)
+	GetXPEvents(accountID, limit int) ([]models.XPEvent, error)
+	ReplayXP() (int, error)
+	CountXPEvents(accountID int) (map[string]int, error)
+}
+
+// AchievementStore persists the badges awarded to accounts
+type AchievementStore interface {
+	AwardAchievement(achievement models.Achievement) (bool, error)
+	GetAccountAchievements(accountID int) ([]models.Achievement, error)
+	RevokeAchievement(accountID int, badgeID string) error
+}
+
+// LeaderboardStore ranks students by experience and level
+type LeaderboardStore interface {
+	GetLeaderboard(q models.LeaderboardQuery) (*models.Leaderboard, error)
+	SetLeaderboardOptOut(accountID int, optOut bool) (*models.Account, error)
+}
+
+// SessionStore persists refresh tokens
+type SessionStore interface {
+	CreateRefreshToken(accountID int, tokenHash string, expiresAt time.Time) error
+	RotateRefreshToken(oldHash, newHash string, expiresAt time.Time) (int, error)
+	RevokeRefreshToken(tokenHash string) error
+	RevokeAccountRefreshTokens(accountID int) error
+}
+
+// PasswordStore changes passwords and keeps password reset tokens
+type PasswordStore interface {
+	SetPasswordCost(cost int) error
+	SetPassword(accountID int, password string, mustReset bool) error
+	CreatePasswordResetToken(accountID int, tokenHash string, expiresAt time.Time) error
+	PasswordResetAccount(tokenHash string) (*models.Account, error)
+	ResetPassword(tokenHash, password string) (int, error)
+}
+
+// TwoFactorStore keeps TOTP authenticator secrets and recovery codes
+type TwoFactorStore interface {
+	SetTOTPSecret(accountID int, secret string) error
+	GetTOTPSecret(accountID int) (*models.TOTPSecret, error)
+	UseTOTPStep(accountID int, step int64) (bool, error)
+	EnableTwoFactor(accountID int, step int64, codeHashes []string) error
+	DisableTwoFactor(accountID int) error
+	ReplaceRecoveryCodes(accountID int, codeHashes []string) error
+	UseRecoveryCode(accountID int, codeHash string) (bool, error)
+	CountRecoveryCodes(accountID int) (int, error)
+}
+
+// SSOStore tracks single sign-ons and the identity provider accounts linked to accounts
+type SSOStore interface {
+	CreateSSOState(stateHash, nonce, codeVerifier string, expiresAt time.Time) error
+	ConsumeSSOState(stateHash string) (*models.SSOState, error)
+	GetAccountByOIDCSubject(subject string) (*models.Account, error)
+	LinkOIDCSubject(accountID int, subject string) error
+	UnlinkOIDCSubject(accountID int) (bool, error)
+}
+
+// LoginGuardStore counts failed logins, locks out usernames and IPs that keep
+// failing, and keeps the auth log
+type LoginGuardStore interface {
+	LoginLockedUntil(username, ip string, now time.Time) (time.Time, error)
+	RecordLoginFailure(kind, key string, window time.Duration, delay func(failures int) time.Duration) (*models.LoginLock, error)
+	ClearLoginFailures(kind, key string) (bool, error)
+	ListLoginLocks(lockedOnly bool, now time.Time) ([]models.LoginLock, error)
+	RecordAuthEvent(event models.AuthEvent) error
+	GetAuthEvents(q models.AuthLogQuery) ([]models.AuthEvent, error)
+}
+
+// APIKeyStore persists service API keys
+type APIKeyStore interface {
+	CreateAPIKey(key models.APIKey, keyHash string) (*models.APIKey, error)
+	GetAPIKeyByID(id int) (*models.APIKey, error)
+	GetAPIKeyByHash(keyHash string) (*models.APIKey, error)
+	GetAllAPIKeys() ([]models.APIKey, error)
+	TouchAPIKey(id int) error
+	RevokeAPIKey(id int) error
+}
+
+// ImportMappingStore keeps the named mappings of CSV import columns to fields
+type ImportMappingStore interface {
+	SaveImportMapping(m models.ImportMapping) (*models.ImportMapping, error)
+	GetImportMapping(name string) (*models.ImportMapping, error)
+	ListImportMappings() ([]models.ImportMapping, error)
+	DeleteImportMapping(name string) error
+}
+
+// Migrator moves the schema between migration versions
+type Migrator interface {
+	SchemaVersion() (int, error)
+	LatestSchemaVersion() (int, error)
+	MigrateUp() error
+	MigrateDown(steps int) error
+	MigrateTo(version int) error
+	MigrationStatus() ([]MigrationStatus, error)
+}
+
+// Store is everything the handlers, exporters and CLI need from a backend
+type Store interface {
+	AccountStore
+	SchoolStore
+	RosterStore
+	GuardianStore
+	XPStore
+	AchievementStore
+	LeaderboardStore
+	SessionStore
+	PasswordStore
+	TwoFactorStore
+	SSOStore
+	LoginGuardStore
+	APIKeyStore
+	ImportMappingStore
+	Migrator
+
+	// Transaction runs fn against a Store bound to a single transaction,
+	// committing if fn succeeds and rolling back otherwise
+	Transaction(fn func(tx Store) error) error
+	// Backend names the SQL backend, e.g. "sqlite" or "postgres"
+	Backend() string
+	Close() error
+}
+
+var _ Store = (*Database)(nil)
+
+// Open connects to the backend selected by dsn and applies pending migrations.
+// postgres:// and postgresql:// URLs select PostgreSQL; anything else is
+// treated as an SQLite file path.
+func Open(dsn string) (Store, error) {
+	db, err := NewDatabase(dsn)
+	if err != nil {
+		return nil, err
+	}
+	return db, nil
+}
+
+// OpenWithoutMigrating connects to the backend selected by dsn without
+// touching its schema, for use by migration tooling
+func OpenWithoutMigrating(dsn string) (Store, error) {
+	db, err := OpenDatabase(dsn)
+	if err != nil {
+		return nil, err
+	}
+	return db, nil
+}
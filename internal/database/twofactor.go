@@ -0,0 +1,177 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"educational-game-db/internal/models"
+)
+
+var (
+	// ErrNoTOTPSecret is returned when an account has not started enrolling an authenticator
+	ErrNoTOTPSecret = errors.New("two-factor authentication is not set up")
+	// ErrTwoFactorEnabled is returned when enrolling an account that already has a second factor
+	ErrTwoFactorEnabled = errors.New("two-factor authentication is already enabled")
+)
+
+// SetTOTPSecret stores a new, unconfirmed authenticator secret for an
+// account, replacing any earlier one it did not confirm
+func (d *Database) SetTOTPSecret(accountID int, secret string) error {
+	return d.InTx(func(tx *Database) error {
+		account, err := tx.GetAccountByID(accountID)
+		if err != nil {
+			return err
+		}
+		if account.TwoFactorEnabled {
+			return ErrTwoFactorEnabled
+		}
+
+		_, err = tx.db.Exec(`
+		INSERT INTO totp_secrets (account_id, secret, last_used_step, created_at)
+		VALUES (?, ?, 0, ?)
+		ON CONFLICT (account_id) DO UPDATE SET secret = excluded.secret, last_used_step = 0,
+			created_at = excluded.created_at, confirmed_at = NULL
+		`, accountID, secret, time.Now())
+		if err != nil {
+			return fmt.Errorf("failed to store TOTP secret: %w", err)
+		}
+		return nil
+	})
+}
+
+// GetTOTPSecret returns an account's authenticator secret, confirmed or not
+func (d *Database) GetTOTPSecret(accountID int) (*models.TOTPSecret, error) {
+	var (
+		secret      models.TOTPSecret
+		confirmedAt sql.NullTime
+	)
+	err := d.db.QueryRow(`
+	SELECT account_id, secret, last_used_step, created_at, confirmed_at FROM totp_secrets WHERE account_id = ?
+	`, accountID).Scan(&secret.AccountID, &secret.Secret, &secret.LastUsedStep, &secret.CreatedAt, &confirmedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrNoTOTPSecret
+		}
+		return nil, fmt.Errorf("failed to get TOTP secret: %w", err)
+	}
+
+	if confirmedAt.Valid {
+		secret.ConfirmedAt = &confirmedAt.Time
+	}
+	return &secret, nil
+}
+
+// UseTOTPStep records that the code of a time step was used, and reports
+// false if that step or a later one was used already
+func (d *Database) UseTOTPStep(accountID int, step int64) (bool, error) {
+	result, err := d.db.Exec(`
+	UPDATE totp_secrets SET last_used_step = ? WHERE account_id = ? AND last_used_step < ?
+	`, step, accountID, step)
+	if err != nil {
+		return false, fmt.Errorf("failed to record TOTP use: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	return rowsAffected > 0, nil
+}
+
+// EnableTwoFactor confirms an account's authenticator secret, recording the
+// step of the code that confirmed it, and gives the account fresh recovery codes
+func (d *Database) EnableTwoFactor(accountID int, step int64, codeHashes []string) error {
+	return d.InTx(func(tx *Database) error {
+		if ok, err := tx.UseTOTPStep(accountID, step); err != nil {
+			return err
+		} else if !ok {
+			return ErrNoTOTPSecret
+		}
+
+		now := time.Now()
+		if _, err := tx.db.Exec(`UPDATE totp_secrets SET confirmed_at = ? WHERE account_id = ?`, now, accountID); err != nil {
+			return fmt.Errorf("failed to confirm TOTP secret: %w", err)
+		}
+		if _, err := tx.db.Exec(`UPDATE accounts SET two_factor_enabled = TRUE, updated_at = ? WHERE id = ?`, now, accountID); err != nil {
+			return fmt.Errorf("failed to enable two-factor authentication: %w", err)
+		}
+
+		return tx.ReplaceRecoveryCodes(accountID, codeHashes)
+	})
+}
+
+// DisableTwoFactor removes an account's authenticator secret and recovery codes
+func (d *Database) DisableTwoFactor(accountID int) error {
+	return d.InTx(func(tx *Database) error {
+		result, err := tx.db.Exec(`UPDATE accounts SET two_factor_enabled = FALSE, updated_at = ? WHERE id = ?`, time.Now(), accountID)
+		if err != nil {
+			return fmt.Errorf("failed to disable two-factor authentication: %w", err)
+		}
+
+		rowsAffected, err := result.RowsAffected()
+		if err != nil {
+			return fmt.Errorf("failed to get rows affected: %w", err)
+		}
+		if rowsAffected == 0 {
+			return fmt.Errorf("account not found")
+		}
+
+		if _, err := tx.db.Exec(`DELETE FROM totp_secrets WHERE account_id = ?`, accountID); err != nil {
+			return fmt.Errorf("failed to delete TOTP secret: %w", err)
+		}
+		if _, err := tx.db.Exec(`DELETE FROM recovery_codes WHERE account_id = ?`, accountID); err != nil {
+			return fmt.Errorf("failed to delete recovery codes: %w", err)
+		}
+		return nil
+	})
+}
+
+// ReplaceRecoveryCodes discards an account's recovery codes and stores new ones
+func (d *Database) ReplaceRecoveryCodes(accountID int, codeHashes []string) error {
+	return d.InTx(func(tx *Database) error {
+		if _, err := tx.db.Exec(`DELETE FROM recovery_codes WHERE account_id = ?`, accountID); err != nil {
+			return fmt.Errorf("failed to delete recovery codes: %w", err)
+		}
+
+		now := time.Now()
+		for _, hash := range codeHashes {
+			_, err := tx.db.Exec(`INSERT INTO recovery_codes (account_id, code_hash, created_at) VALUES (?, ?, ?)`,
+				accountID, hash, now)
+			if err != nil {
+				return fmt.Errorf("failed to store recovery code: %w", err)
+			}
+		}
+		return nil
+	})
+}
+
+// UseRecoveryCode spends one of an account's recovery codes, reporting false
+// if it is unknown or was already used
+func (d *Database) UseRecoveryCode(accountID int, codeHash string) (bool, error) {
+	result, err := d.db.Exec(`
+	UPDATE recovery_codes SET used_at = ? WHERE account_id = ? AND code_hash = ? AND used_at IS NULL
+	`, time.Now(), accountID, codeHash)
+	if err != nil {
+		return false, fmt.Errorf("failed to use recovery code: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	return rowsAffected > 0, nil
+}
+
+// CountRecoveryCodes returns how many unused recovery codes an account has left
+func (d *Database) CountRecoveryCodes(accountID int) (int, error) {
+	var count int
+	err := d.db.QueryRow(`SELECT COUNT(*) FROM recovery_codes WHERE account_id = ? AND used_at IS NULL`, accountID).Scan(&count)
+	if err != nil {
+		return 0, fmt.Errorf("failed to count recovery codes: %w", err)
+	}
+	return count, nil
+}
@@ -0,0 +1,75 @@
+package database
+
+import (
+	"errors"
+	"testing"
+
+	"educational-game-db/internal/models"
+)
+
+func TestTwoFactor(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, db *Database) {
+		account, err := db.CreateAccount(models.CreateAccountRequest{
+			Username: "admin", Email: "admin@example.com", Password: "password123",
+		})
+		if err != nil {
+			t.Fatalf("Failed to create account: %v", err)
+		}
+
+		if _, err := db.GetTOTPSecret(account.ID); !errors.Is(err, ErrNoTOTPSecret) {
+			t.Errorf("Expected no secret before setup, got %v", err)
+		}
+		if err := db.SetTOTPSecret(account.ID, "FIRST"); err != nil {
+			t.Fatalf("Failed to set secret: %v", err)
+		}
+		if err := db.SetTOTPSecret(account.ID, "SECOND"); err != nil {
+			t.Fatalf("Failed to replace unconfirmed secret: %v", err)
+		}
+
+		if err := db.EnableTwoFactor(account.ID, 100, []string{"code-a", "code-b"}); err != nil {
+			t.Fatalf("Failed to enable two-factor authentication: %v", err)
+		}
+		secret, err := db.GetTOTPSecret(account.ID)
+		if err != nil {
+			t.Fatalf("Failed to get secret: %v", err)
+		}
+		if secret.Secret != "SECOND" || secret.ConfirmedAt == nil {
+			t.Errorf("Expected the second secret to be confirmed, got %+v", secret)
+		}
+		account, _ = db.GetAccountByID(account.ID)
+		if !account.TwoFactorEnabled {
+			t.Error("Expected the account to have two-factor authentication enabled")
+		}
+		if err := db.SetTOTPSecret(account.ID, "THIRD"); !errors.Is(err, ErrTwoFactorEnabled) {
+			t.Errorf("Expected an enabled secret not to be replaced, got %v", err)
+		}
+
+		if ok, _ := db.UseTOTPStep(account.ID, 100); ok {
+			t.Error("Expected the confirming step not to be usable again")
+		}
+		if ok, _ := db.UseTOTPStep(account.ID, 101); !ok {
+			t.Error("Expected a later step to be accepted")
+		}
+
+		if ok, _ := db.UseRecoveryCode(account.ID, "code-a"); !ok {
+			t.Error("Expected the recovery code to be accepted")
+		}
+		if ok, _ := db.UseRecoveryCode(account.ID, "code-a"); ok {
+			t.Error("Expected a used recovery code to be refused")
+		}
+		if count, _ := db.CountRecoveryCodes(account.ID); count != 1 {
+			t.Errorf("Expected 1 recovery code left, got %d", count)
+		}
+
+		if err := db.DisableTwoFactor(account.ID); err != nil {
+			t.Fatalf("Failed to disable two-factor authentication: %v", err)
+		}
+		account, _ = db.GetAccountByID(account.ID)
+		if account.TwoFactorEnabled {
+			t.Error("Expected two-factor authentication to be disabled")
+		}
+		if count, _ := db.CountRecoveryCodes(account.ID); count != 0 {
+			t.Errorf("Expected recovery codes to be removed, got %d", count)
+		}
+	})
+}
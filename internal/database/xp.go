@@ -0,0 +1,164 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"educational-game-db/internal/models"
+	"educational-game-db/internal/progression"
+)
+
+// ErrNegativeExperience is returned when an XP event would take an account below zero experience
+var ErrNegativeExperience = errors.New("experience cannot go below zero")
+
+// SetLevelCurve sets the curve used to derive game levels from experience
+func (d *Database) SetLevelCurve(curve progression.Curve) error {
+	if err := curve.Validate(); err != nil {
+		return err
+	}
+	d.curve = curve
+	return nil
+}
+
+// LevelCurve returns the curve used to derive game levels from experience
+func (d *Database) LevelCurve() progression.Curve {
+	return d.curve
+}
+
+// RecordXPEvent appends an event to the experience ledger and updates the
+// account's experience total and derived game level
+func (d *Database) RecordXPEvent(event models.XPEvent) (*models.XPEvent, *models.Account, error) {
+	if event.Amount == 0 {
+		return nil, nil, fmt.Errorf("experience amount must not be zero")
+	}
+	if event.Source == "" {
+		return nil, nil, fmt.Errorf("experience source is required")
+	}
+
+	var account *models.Account
+	err := d.InTx(func(tx *Database) error {
+		now := time.Now()
+
+		// Add in SQL rather than read-modify-write so concurrent events are not lost
+		var experience int
+		err := tx.db.QueryRow(`UPDATE accounts SET experience = experience + ?, updated_at = ? WHERE id = ? RETURNING experience`,
+			event.Amount, now, event.AccountID).Scan(&experience)
+		if err != nil {
+			if err == sql.ErrNoRows {
+				return fmt.Errorf("account not found")
+			}
+			return fmt.Errorf("failed to update experience: %w", err)
+		}
+		if experience < 0 {
+			return ErrNegativeExperience
+		}
+
+		if _, err := tx.db.Exec(`UPDATE accounts SET game_level = ? WHERE id = ?`,
+			tx.curve.Level(experience), event.AccountID); err != nil {
+			return fmt.Errorf("failed to update game level: %w", err)
+		}
+
+		event.CreatedAt = now
+		err = tx.db.QueryRow(`
+		INSERT INTO xp_events (account_id, amount, source, reason, game_ref, created_at)
+		VALUES (?, ?, ?, ?, ?, ?)
+		RETURNING id
+		`, event.AccountID, event.Amount, event.Source, event.Reason, event.GameRef, now).Scan(&event.ID)
+		if err != nil {
+			return fmt.Errorf("failed to record XP event: %w", err)
+		}
+		if err := tx.addLeaderboardXP(event.AccountID, event.Amount, now); err != nil {
+			return err
+		}
+
+		account, err = tx.GetAccountByID(event.AccountID)
+		return err
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return &event, account, nil
+}
+
+// GetXPEvents returns the most recent ledger entries of an account, newest first
+func (d *Database) GetXPEvents(accountID, limit int) ([]models.XPEvent, error) {
+	if limit <= 0 {
+		limit = models.DefaultPageSize
+	}
+
+	rows, err := d.db.Query(`
+	SELECT id, account_id, amount, source, reason, game_ref, created_at
+	FROM xp_events WHERE account_id = ?
+	ORDER BY created_at DESC, id DESC LIMIT ?
+	`, accountID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get XP events: %w", err)
+	}
+	defer rows.Close()
+
+	events := []models.XPEvent{}
+	for rows.Next() {
+		var event models.XPEvent
+		if err := rows.Scan(&event.ID, &event.AccountID, &event.Amount, &event.Source,
+			&event.Reason, &event.GameRef, &event.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan XP event: %w", err)
+		}
+		events = append(events, event)
+	}
+
+	return events, rows.Err()
+}
+
+// ReplayXP recomputes every account's experience, game level and leaderboard
+// totals from the ledger and returns how many accounts changed
+func (d *Database) ReplayXP() (int, error) {
+	changed := 0
+	err := d.InTx(func(tx *Database) error {
+		type total struct {
+			id, experience, level, ledger int
+		}
+
+		rows, err := tx.db.Query(`
+		SELECT accounts.id, accounts.experience, accounts.game_level, COALESCE(SUM(xp_events.amount), 0)
+		FROM accounts LEFT JOIN xp_events ON xp_events.account_id = accounts.id
+		GROUP BY accounts.id, accounts.experience, accounts.game_level
+		`)
+		if err != nil {
+			return fmt.Errorf("failed to sum XP events: %w", err)
+		}
+		var totals []total
+		for rows.Next() {
+			var t total
+			if err := rows.Scan(&t.id, &t.experience, &t.level, &t.ledger); err != nil {
+				rows.Close()
+				return fmt.Errorf("failed to scan XP total: %w", err)
+			}
+			totals = append(totals, t)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return fmt.Errorf("failed to read XP totals: %w", err)
+		}
+
+		for _, t := range totals {
+			level := tx.curve.Level(t.ledger)
+			if t.experience == t.ledger && t.level == level {
+				continue
+			}
+			if _, err := tx.db.Exec(`UPDATE accounts SET experience = ?, game_level = ? WHERE id = ?`,
+				t.ledger, level, t.id); err != nil {
+				return fmt.Errorf("failed to update account %d: %w", t.id, err)
+			}
+			changed++
+		}
+		return tx.rebuildLeaderboardTotals()
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return changed, nil
+}
@@ -0,0 +1,103 @@
+package database
+
+import (
+	"errors"
+	"testing"
+
+	"educational-game-db/internal/models"
+	"educational-game-db/internal/progression"
+)
+
+func TestXPLedger(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, db *Database) {
+		if err := db.SetLevelCurve(progression.Curve{BaseXP: 100, Growth: 1}); err != nil {
+			t.Fatalf("Failed to set level curve: %v", err)
+		}
+
+		account, err := db.CreateAccount(models.CreateAccountRequest{
+			Username: "xptest",
+			Email:    "xptest@example.com",
+			Password: "password123",
+		})
+		if err != nil {
+			t.Fatalf("Failed to create account: %v", err)
+		}
+
+		event, updated, err := db.RecordXPEvent(models.XPEvent{
+			AccountID: account.ID, Amount: 250, Source: "game", Reason: "Finished fractions", GameRef: "fractions/42",
+		})
+		if err != nil {
+			t.Fatalf("Failed to record XP: %v", err)
+		}
+		if event.ID == 0 {
+			t.Error("Expected event to get an ID")
+		}
+		if updated.Experience != 250 || updated.GameLevel != 3 {
+			t.Errorf("Expected 250 XP at level 3, got %d XP at level %d", updated.Experience, updated.GameLevel)
+		}
+
+		if _, _, err := db.RecordXPEvent(models.XPEvent{AccountID: account.ID, Amount: -300, Source: "adjustment"}); !errors.Is(err, ErrNegativeExperience) {
+			t.Fatalf("Expected ErrNegativeExperience, got %v", err)
+		}
+
+		_, updated, err = db.RecordXPEvent(models.XPEvent{AccountID: account.ID, Amount: -60, Source: "adjustment"})
+		if err != nil {
+			t.Fatalf("Failed to record correction: %v", err)
+		}
+		if updated.Experience != 190 || updated.GameLevel != 2 {
+			t.Errorf("Expected 190 XP at level 2, got %d XP at level %d", updated.Experience, updated.GameLevel)
+		}
+
+		events, err := db.GetXPEvents(account.ID, 10)
+		if err != nil {
+			t.Fatalf("Failed to get XP events: %v", err)
+		}
+		if len(events) != 2 || events[0].Amount != -60 || events[1].GameRef != "fractions/42" {
+			t.Errorf("Expected the rejected event to be rolled back and newest first, got %+v", events)
+		}
+
+		// Replaying fixes totals that drifted from the ledger
+		if _, err := db.db.Exec(`UPDATE accounts SET experience = 5000, game_level = 1 WHERE id = ?`, account.ID); err != nil {
+			t.Fatalf("Failed to tamper with account: %v", err)
+		}
+		changed, err := db.ReplayXP()
+		if err != nil {
+			t.Fatalf("Failed to replay XP: %v", err)
+		}
+		if changed != 1 {
+			t.Errorf("Expected 1 account to change, got %d", changed)
+		}
+		replayed, _ := db.GetAccountByID(account.ID)
+		if replayed.Experience != 190 || replayed.GameLevel != 2 {
+			t.Errorf("Expected replay to restore 190 XP at level 2, got %d XP at level %d", replayed.Experience, replayed.GameLevel)
+		}
+	})
+}
+
+func TestXPMigrationKeepsExistingExperience(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, db *Database) {
+		if err := db.MigrateTo(4); err != nil {
+			t.Fatalf("Failed to migrate down: %v", err)
+		}
+		if _, err := db.db.Exec(`INSERT INTO accounts (username, email, password_hash, first_name, last_name, school, experience)
+			VALUES (?, ?, ?, '', '', '', ?)`, "veteran", "veteran@example.com", "x", 420); err != nil {
+			t.Fatalf("Failed to insert account: %v", err)
+		}
+		if err := db.MigrateUp(); err != nil {
+			t.Fatalf("Failed to migrate up: %v", err)
+		}
+
+		// The opening balance keeps the experience, so replaying only fixes the level
+		if changed, err := db.ReplayXP(); err != nil || changed != 1 {
+			t.Fatalf("Expected replay to change 1 account, got %d, err %v", changed, err)
+		}
+		account, err := db.GetAccountByUsername("veteran")
+		if err != nil {
+			t.Fatalf("Failed to get account: %v", err)
+		}
+		if account.Experience != 420 || account.GameLevel != db.LevelCurve().Level(420) {
+			t.Errorf("Expected 420 XP at level %d, got %d XP at level %d",
+				db.LevelCurve().Level(420), account.Experience, account.GameLevel)
+		}
+	})
+}
@@ -0,0 +1,259 @@
+package export
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"educational-game-db/internal/database"
+	"educational-game-db/internal/models"
+)
+
+func setupTestService(t *testing.T) (*ExportService, *database.Database) {
+	t.Helper()
+	db, err := database.NewDatabase(":memory:")
+	if err != nil {
+		t.Fatalf("Failed to create test database: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	for _, username := range []string{"ada", "grace", "alan"} {
+		_, err := db.CreateAccount(models.CreateAccountRequest{
+			Username: username, Email: username + "@example.com", Password: "password123", Grade: 5, School: "Hill School",
+		})
+		if err != nil {
+			t.Fatalf("Failed to create account: %v", err)
+		}
+	}
+	return NewExportService(db), db
+}
+
+func TestWriteCSV(t *testing.T) {
+	service, db := setupTestService(t)
+	if err := db.DeleteAccount(2); err != nil {
+		t.Fatalf("Failed to delete account: %v", err)
+	}
+
+	var buf bytes.Buffer
+	count, err := service.WriteCSV(&buf, models.AccountListOptions{})
+	if err != nil {
+		t.Fatalf("Failed to write CSV: %v", err)
+	}
+
+	records, err := csv.NewReader(&buf).ReadAll()
+	if err != nil {
+		t.Fatalf("Export is not valid CSV: %v", err)
+	}
+	if count != 2 || len(records) != 3 {
+		t.Fatalf("Expected a header and the 2 live accounts, got %d: %v", count, records)
+	}
+	if records[1][1] != "ada" || records[2][1] != "alan" {
+		t.Errorf("Expected accounts in ID order, got %v", records[1:])
+	}
+}
+
+func TestWriteJSON(t *testing.T) {
+	service, _ := setupTestService(t)
+
+	var exported struct {
+		Accounts []models.Account `json:"accounts"`
+		Count    int              `json:"count"`
+	}
+	for _, opts := range []models.AccountListOptions{{}, {School: "Nowhere"}} {
+		var buf bytes.Buffer
+		count, err := service.WriteJSON(&buf, opts)
+		if err != nil {
+			t.Fatalf("Failed to write JSON: %v", err)
+		}
+		if err := json.Unmarshal(buf.Bytes(), &exported); err != nil {
+			t.Fatalf("Export is not valid JSON: %v\n%s", err, buf.String())
+		}
+		if exported.Count != count || len(exported.Accounts) != count {
+			t.Errorf("Expected count %d to match the %d accounts", exported.Count, len(exported.Accounts))
+		}
+	}
+	if exported.Count != 0 {
+		t.Errorf("Expected no accounts of another school, got %d", exported.Count)
+	}
+}
+
+func TestImportCSV(t *testing.T) {
+	service, db := setupTestService(t)
+
+	const file = "ID,Username,Email,FirstName,LastName,Grade,School,GameLevel,Experience,CreatedAt,UpdatedAt,IsActive\n" +
+		",katherine,katherine@example.com,Katherine,Johnson,6,Hill School,,120,,,true\n" +
+		",ada,ada2@example.com,,,5,Hill School,,,,,\n" +
+		",dorothy,not-an-email,,,13,Hill School,,,,,\n" +
+		",mary,mary@example.com,Mary,Jackson,4,Hill School,,,,,false\n"
+
+	countAccounts := func() int {
+		accounts, err := db.GetAllAccounts()
+		if err != nil {
+			t.Fatalf("Failed to get accounts: %v", err)
+		}
+		return len(accounts)
+	}
+
+	report, err := service.ImportCSV(strings.NewReader(file), models.ImportOptions{Mode: models.ImportAllOrNothing})
+	if err != nil {
+		t.Fatalf("Failed to import: %v", err)
+	}
+	if report.Committed || report.Created != 0 || countAccounts() != 3 {
+		t.Fatalf("Expected an all-or-nothing import with bad rows to import nothing, got %+v", report)
+	}
+	// ada is taken on line 3; line 4 has a bad email and grade
+	var lines []int
+	for _, rowErr := range report.Errors {
+		lines = append(lines, rowErr.Line)
+	}
+	if fmt.Sprint(lines) != "[3 4 4]" || report.Errors[1].Field != "email" || report.Errors[2].Field != "grade" {
+		t.Errorf("Expected errors on lines 3 and 4, got %+v", report.Errors)
+	}
+
+	report, err = service.ImportCSV(strings.NewReader(file), models.ImportOptions{Mode: models.ImportBestEffort, DryRun: true})
+	if err != nil {
+		t.Fatalf("Failed to import: %v", err)
+	}
+	if report.Committed || report.Created != 2 || report.Skipped != 2 || countAccounts() != 3 {
+		t.Fatalf("Expected a dry run to report 2 rows without saving them, got %+v", report)
+	}
+
+	report, err = service.ImportCSV(strings.NewReader(file), models.ImportOptions{Mode: models.ImportBestEffort})
+	if err != nil {
+		t.Fatalf("Failed to import: %v", err)
+	}
+	if !report.Committed || report.Created != 2 || countAccounts() != 5 {
+		t.Fatalf("Expected a best-effort import to save the 2 good rows, got %+v", report)
+	}
+
+	katherine, err := db.GetAccountByUsername("katherine")
+	if err != nil || katherine.Experience != 120 || !katherine.MustResetPassword {
+		t.Errorf("Expected katherine with her experience and a password to set, got %+v, %v", katherine, err)
+	}
+	if mary, err := db.GetAccountByUsername("mary"); err != nil || mary.IsActive {
+		t.Errorf("Expected mary to be imported inactive, got %+v, %v", mary, err)
+	}
+}
+
+func TestImportJSONLineNumbers(t *testing.T) {
+	service, _ := setupTestService(t)
+
+	const file = `{
+  "exported_at": "2024-01-01T00:00:00Z",
+  "accounts": [
+    {"username": "katherine", "email": "katherine@example.com", "grade": 6},
+    {"username": "dorothy", "email": "dorothy@example.com",
+     "grade": "six"}
+  ]
+}`
+	report, err := service.ImportJSON(strings.NewReader(file), models.ImportOptions{Mode: models.ImportBestEffort, DryRun: true})
+	if err != nil {
+		t.Fatalf("Failed to import: %v", err)
+	}
+	if len(report.Errors) != 1 || report.Errors[0].Line != 5 || report.Errors[0].Field != "grade" {
+		t.Errorf("Expected a grade error on line 5, got %+v", report.Errors)
+	}
+
+	if _, err := service.ImportJSON(strings.NewReader(`[]`), models.ImportOptions{}); !errors.Is(err, ErrInvalidFile) {
+		t.Errorf("Expected ErrInvalidFile for a document without accounts, got %v", err)
+	}
+}
+
+func TestImportMatchStrategies(t *testing.T) {
+	service, db := setupTestService(t)
+	teacher, _ := db.CreateAccount(models.CreateAccountRequest{Username: "mr_t", Email: "t@example.com", Password: "password123", School: "Hill School"})
+	db.SetAccountRole(teacher.ID, models.RoleTeacher)
+
+	// grace is renamed, ada gains a last name and alan is left out
+	const file = "ID,Username,Email,FirstName,LastName,Grade,School,GameLevel,Experience,CreatedAt,UpdatedAt,IsActive,ExternalID\n" +
+		",ada,ada@example.com,,Lovelace,,,,,,,,\n" +
+		",grace,grace@example.com,Grace,,6,Hill School,,,,,,\n"
+
+	run := func(opts models.ImportOptions) *models.ImportReport {
+		t.Helper()
+		opts.MatchKey = models.MatchEmail
+		report, err := service.ImportCSV(strings.NewReader(file), opts)
+		if err != nil {
+			t.Fatalf("Failed to import: %v", err)
+		}
+		if len(report.Errors) > 0 {
+			t.Fatalf("Expected rows matching existing accounts to be valid, got %+v", report.Errors)
+		}
+		return report
+	}
+
+	if report := run(models.ImportOptions{Strategy: models.ConflictSkip}); report.Unchanged != 2 || len(report.Changes) != 0 {
+		t.Errorf("Expected skip to leave both accounts alone, got %+v", report)
+	}
+
+	report := run(models.ImportOptions{Strategy: models.ConflictMerge})
+	if report.Updated != 2 || len(report.Changes) != 2 {
+		t.Fatalf("Expected merge to update both accounts, got %+v", report)
+	}
+	ada := report.Changes[0]
+	if len(ada.Fields) != 1 || ada.Fields[0].Field != "last_name" || ada.Fields[0].New != "Lovelace" {
+		t.Errorf("Expected merge to only fill in ada's last name, got %+v", ada.Fields)
+	}
+	if account, _ := db.GetAccountByUsername("ada"); account.Grade != 5 || account.School != "Hill School" {
+		t.Errorf("Expected merge to keep the fields the row leaves blank, got %+v", account)
+	}
+
+	report = run(models.ImportOptions{Strategy: models.ConflictOverwrite, DeactivateMissing: true})
+	if account, _ := db.GetAccountByUsername("ada"); account.Grade != 0 || account.School != "" {
+		t.Errorf("Expected overwrite to clear the fields the row leaves blank, got %+v", account)
+	}
+	if report.Deactivated != 1 || report.Changes[len(report.Changes)-1].Username != "alan" {
+		t.Fatalf("Expected only alan to be deactivated, got %+v", report.Changes)
+	}
+	if account, _ := db.GetAccountByUsername("mr_t"); !account.IsActive {
+		t.Errorf("Expected staff missing from the roster to stay active")
+	}
+}
+
+func TestParseCSVMapping(t *testing.T) {
+	mapping, err := ParseMapping("district7", []byte(`
+columns:
+  username: Student Login
+  grade: Grade Level
+transforms:
+  username: [trim, lowercase]
+grade_aliases:
+  Pre-K: 0
+`))
+	if err != nil {
+		t.Fatalf("Failed to parse mapping: %v", err)
+	}
+
+	// Columns in any order, found by the mapping or by their own name
+	const file = "Homeroom,E-Mail,Grade Level,Student Login,first name\n" +
+		"4B,ada@example.com,K,  Ada ,Ada\n" +
+		"4B,alan@example.com,pre-k,Alan,Alan\n" +
+		"4B,grace@example.com,Year 2,Grace,Grace\n"
+	rows, err := ParseCSV(strings.NewReader(file), mapping)
+	if err != nil {
+		t.Fatalf("Failed to parse CSV: %v", err)
+	}
+	if len(rows) != 3 {
+		t.Fatalf("Expected 3 rows, got %d", len(rows))
+	}
+	if account := rows[0].Account; account.Username != "ada" || account.Email != "ada@example.com" || account.FirstName != "Ada" || account.Grade != 0 {
+		t.Errorf("Expected ada's row to be read by header, got %+v", account)
+	}
+	if len(rows[1].Errors) != 0 || rows[1].Account.Grade != 0 {
+		t.Errorf("Expected the mapping's grade alias to be read, got %+v", rows[1])
+	}
+	if len(rows[2].Errors) != 1 || rows[2].Errors[0].Field != "grade" {
+		t.Errorf("Expected an unknown grade to be an error, got %+v", rows[2].Errors)
+	}
+
+	if _, err := ParseCSV(strings.NewReader("Login,Email\n"), mapping); err == nil {
+		t.Errorf("Expected a file without the mapped columns to be refused")
+	}
+	if _, err := ParseMapping("district7", []byte("transforms:\n  email: [shout]\n")); err == nil {
+		t.Errorf("Expected an unknown transform to be refused")
+	}
+}
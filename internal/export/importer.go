@@ -0,0 +1,767 @@
+package export
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/mail"
+	"sort"
+	"strings"
+
+	"educational-game-db/internal/auth"
+	"educational-game-db/internal/database"
+	"educational-game-db/internal/models"
+)
+
+// maxGrade is the highest grade an imported account may be in
+const maxGrade = 12
+
+// ErrInvalidFile is returned when an import file cannot be read at all
+var ErrInvalidFile = errors.New("invalid import file")
+
+// ErrDryRun rolls back the transaction of a dry run once it has succeeded
+var ErrDryRun = errors.New("dry run")
+
+// ImportRow is an account read from an import file
+type ImportRow struct {
+	// Line is where the row starts in the file
+	Line       int
+	Account    models.CreateAccountRequest
+	Experience int
+	IsActive   bool
+	// Filled holds the fields the file gives a value for, by their JSON name
+	Filled map[string]bool
+	// Errors are the problems that keep the row from being imported
+	Errors []models.ImportRowError
+
+	// match is the existing account the row is about, if any
+	match *models.Account
+}
+
+func (r *ImportRow) fill(field string) {
+	if r.Filled == nil {
+		r.Filled = make(map[string]bool)
+	}
+	r.Filled[field] = true
+}
+
+// failed reports whether the row has an error in field
+func (r *ImportRow) failed(field string) bool {
+	for _, rowErr := range r.Errors {
+		if rowErr.Field == field {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *ImportRow) fail(field, format string, args ...interface{}) {
+	r.Errors = append(r.Errors, models.ImportRowError{Line: r.Line, Field: field, Message: fmt.Sprintf(format, args...)})
+}
+
+// ImportCSV imports accounts from CSV, finding each field's column by its
+// header as opts.Mapping says
+func (e *ExportService) ImportCSV(r io.Reader, opts models.ImportOptions) (*models.ImportReport, error) {
+	rows, err := ParseCSV(r, opts.Mapping)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidFile, err)
+	}
+	return e.Import(rows, opts)
+}
+
+// ImportJSON imports accounts from JSON in the layout WriteJSON produces
+func (e *ExportService) ImportJSON(r io.Reader, opts models.ImportOptions) (*models.ImportReport, error) {
+	rows, err := ParseJSON(r)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidFile, err)
+	}
+	return e.Import(rows, opts)
+}
+
+// ParseCSV reads the rows of a CSV import, finding each field's column by
+// its header as mapping says. Problems with a row are recorded on it; an
+// error is only returned when the file as a whole is unusable.
+func ParseCSV(r io.Reader, mapping *models.ImportMapping) ([]ImportRow, error) {
+	rows, _, err := parseCSV(r, mapping, -1)
+	return rows, err
+}
+
+// parseCSV reads at most limit rows of a CSV import, or every row if limit
+// is negative
+func parseCSV(r io.Reader, mapping *models.ImportMapping, limit int) ([]ImportRow, *csvLayout, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+
+	header, err := reader.Read()
+	if err == io.EOF {
+		return nil, nil, fmt.Errorf("CSV file is empty")
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read CSV header: %w", err)
+	}
+	layout, err := newCSVLayout(header, mapping)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var rows []ImportRow
+	for limit < 0 || len(rows) < limit {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+
+		var parseErr *csv.ParseError
+		if errors.As(err, &parseErr) {
+			row := ImportRow{Line: parseErr.StartLine}
+			row.fail("", "invalid CSV: %v", parseErr.Err)
+			rows = append(rows, row)
+			continue
+		}
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to read CSV: %w", err)
+		}
+
+		line, _ := reader.FieldPos(0)
+		rows = append(rows, layout.row(line, record))
+	}
+
+	return rows, layout, nil
+}
+
+// ParseJSON reads the rows of a JSON import, an object with an accounts
+// array. Problems with an account are recorded on its row; an error is only
+// returned when the document as a whole is unusable.
+func ParseJSON(r io.Reader) ([]ImportRow, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read JSON: %w", err)
+	}
+
+	notAnExport := fmt.Errorf("JSON import must be an object with an accounts array")
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	if token, err := decoder.Token(); err != nil || token != json.Delim('{') {
+		return nil, notAnExport
+	}
+
+	var rows []ImportRow
+	found := false
+	for decoder.More() {
+		key, err := decoder.Token()
+		if err != nil {
+			return nil, fmt.Errorf("invalid JSON: %w", err)
+		}
+		if key != "accounts" {
+			var skip json.RawMessage
+			if err := decoder.Decode(&skip); err != nil {
+				return nil, fmt.Errorf("invalid JSON: %w", err)
+			}
+			continue
+		}
+
+		found = true
+		if token, err := decoder.Token(); err != nil || token != json.Delim('[') {
+			return nil, notAnExport
+		}
+		for decoder.More() {
+			line := lineAt(data, decoder.InputOffset())
+			var raw json.RawMessage
+			if err := decoder.Decode(&raw); err != nil {
+				return nil, fmt.Errorf("invalid JSON at line %d: %w", line, err)
+			}
+			rows = append(rows, jsonRow(line, raw))
+		}
+		if _, err := decoder.Token(); err != nil {
+			return nil, fmt.Errorf("invalid JSON: %w", err)
+		}
+	}
+	if !found {
+		return nil, notAnExport
+	}
+
+	return rows, nil
+}
+
+func jsonRow(line int, raw json.RawMessage) ImportRow {
+	var account struct {
+		Username   *string `json:"username"`
+		Email      *string `json:"email"`
+		FirstName  *string `json:"first_name"`
+		LastName   *string `json:"last_name"`
+		Grade      *int    `json:"grade"`
+		School     *string `json:"school"`
+		Experience *int    `json:"experience"`
+		IsActive   *bool   `json:"is_active"`
+		ExternalID *string `json:"external_id"`
+	}
+
+	row := ImportRow{Line: line, IsActive: true}
+	if err := json.Unmarshal(raw, &account); err != nil {
+		var typeErr *json.UnmarshalTypeError
+		if errors.As(err, &typeErr) {
+			row.fail(typeErr.Field, "must be a %s, not a JSON %s", typeErr.Type, typeErr.Value)
+		} else {
+			row.fail("", "invalid account: %v", err)
+		}
+		return row
+	}
+
+	text := func(field string, value *string) string {
+		if value == nil || strings.TrimSpace(*value) == "" {
+			return ""
+		}
+		row.fill(field)
+		return strings.TrimSpace(*value)
+	}
+	row.Account = models.CreateAccountRequest{
+		Username:   text("username", account.Username),
+		Email:      text("email", account.Email),
+		FirstName:  text("first_name", account.FirstName),
+		LastName:   text("last_name", account.LastName),
+		School:     text("school", account.School),
+		ExternalID: text("external_id", account.ExternalID),
+	}
+	if account.Grade != nil {
+		row.fill("grade")
+		row.Account.Grade = *account.Grade
+	}
+	if account.Experience != nil {
+		row.fill("experience")
+		row.Experience = *account.Experience
+	}
+	if account.IsActive != nil {
+		row.fill("is_active")
+		row.IsActive = *account.IsActive
+	}
+	return row
+}
+
+// lineAt returns the line of the first value at or after offset in data
+func lineAt(data []byte, offset int64) int {
+	pos := int(offset)
+	for pos < len(data) && strings.IndexByte(" \t\r\n,", data[pos]) >= 0 {
+		pos++
+	}
+	return bytes.Count(data[:pos], []byte("\n")) + 1
+}
+
+// Import validates every row and imports them as opts says. Rows that already
+// have errors, for instance from parsing, are never imported.
+func (e *ExportService) Import(rows []ImportRow, opts models.ImportOptions) (*models.ImportReport, error) {
+	if opts.Mode == "" {
+		opts.Mode = models.ImportAllOrNothing
+	}
+	if !models.IsValidImportMode(opts.Mode) {
+		return nil, fmt.Errorf("import mode must be %s or %s", models.ImportAllOrNothing, models.ImportBestEffort)
+	}
+	if opts.MatchKey != "" && !models.IsValidMatchKey(opts.MatchKey) {
+		return nil, fmt.Errorf("match key must be %s, %s or %s", models.MatchUsername, models.MatchEmail, models.MatchExternalID)
+	}
+	if opts.Strategy == "" {
+		opts.Strategy = models.ConflictSkip
+	}
+	if !models.IsValidConflictStrategy(opts.Strategy) {
+		return nil, fmt.Errorf("conflict strategy must be %s, %s or %s", models.ConflictSkip, models.ConflictOverwrite, models.ConflictMerge)
+	}
+	if opts.DeactivateMissing && opts.MatchKey == "" {
+		return nil, fmt.Errorf("deactivating missing accounts needs a match key")
+	}
+
+	e.validate(rows, opts)
+
+	report := &models.ImportReport{
+		Mode:    opts.Mode,
+		DryRun:  opts.DryRun,
+		Rows:    len(rows),
+		Errors:  []models.ImportRowError{},
+		Changes: []models.ImportChange{},
+	}
+	if opts.MatchKey != "" {
+		report.MatchKey = opts.MatchKey
+		report.Strategy = opts.Strategy
+	}
+	bad := 0
+	for _, row := range rows {
+		if len(row.Errors) > 0 {
+			bad++
+			report.Errors = append(report.Errors, row.Errors...)
+		}
+	}
+
+	var err error
+	if opts.Mode == models.ImportAllOrNothing {
+		err = e.importAll(rows, bad, opts, report)
+	} else {
+		err = e.importEach(rows, opts, report)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	sort.SliceStable(report.Errors, func(i, j int) bool { return report.Errors[i].Line < report.Errors[j].Line })
+	return report, nil
+}
+
+// importAll imports every row in one transaction, or none if any row is bad
+// or refused by the database
+func (e *ExportService) importAll(rows []ImportRow, bad int, opts models.ImportOptions, report *models.ImportReport) error {
+	if bad > 0 {
+		report.Skipped = len(rows)
+		return nil
+	}
+
+	applied := &models.ImportReport{}
+	refused := false
+	err := e.db.Transaction(func(tx database.Store) error {
+		for i := range rows {
+			if err := applyRow(tx, &rows[i], opts, applied); err != nil {
+				// Later rows are not tried: PostgreSQL refuses any further
+				// statement once one has failed in a transaction
+				refused = true
+				report.Errors = append(report.Errors, models.ImportRowError{Line: rows[i].Line, Message: err.Error()})
+				return err
+			}
+		}
+		if opts.DeactivateMissing {
+			if err := deactivateMissing(tx, rows, opts, applied); err != nil {
+				return err
+			}
+		}
+		if opts.DryRun {
+			return ErrDryRun
+		}
+		return nil
+	})
+
+	switch {
+	case err == nil, errors.Is(err, ErrDryRun):
+		addChanges(report, applied)
+		report.Committed = err == nil
+	case refused:
+		report.Skipped = len(rows)
+	default:
+		return err
+	}
+	return nil
+}
+
+// importEach imports every good row in a transaction of its own, so a row
+// the database refuses leaves no trace and does not stop the others
+func (e *ExportService) importEach(rows []ImportRow, opts models.ImportOptions, report *models.ImportReport) error {
+	for i := range rows {
+		row := &rows[i]
+		if len(row.Errors) > 0 {
+			report.Skipped++
+			continue
+		}
+
+		applied := &models.ImportReport{}
+		err := e.db.Transaction(func(tx database.Store) error {
+			if err := applyRow(tx, row, opts, applied); err != nil {
+				return err
+			}
+			if opts.DryRun {
+				return ErrDryRun
+			}
+			return nil
+		})
+		if err != nil && !errors.Is(err, ErrDryRun) {
+			report.Skipped++
+			report.Errors = append(report.Errors, models.ImportRowError{Line: row.Line, Message: err.Error()})
+			continue
+		}
+		addChanges(report, applied)
+	}
+
+	if opts.DeactivateMissing {
+		applied := &models.ImportReport{}
+		err := e.db.Transaction(func(tx database.Store) error {
+			if err := deactivateMissing(tx, rows, opts, applied); err != nil {
+				return err
+			}
+			if opts.DryRun {
+				return ErrDryRun
+			}
+			return nil
+		})
+		if err != nil && !errors.Is(err, ErrDryRun) {
+			report.Errors = append(report.Errors, models.ImportRowError{Message: "failed to deactivate missing accounts: " + err.Error()})
+		} else {
+			addChanges(report, applied)
+		}
+	}
+
+	report.Committed = !opts.DryRun && len(report.Changes) > 0
+	return nil
+}
+
+// validate records on each row what keeps it from being imported: missing or
+// malformed fields, clashes with an earlier row, and usernames, emails or
+// external IDs of another account than the one the row matches
+func (e *ExportService) validate(rows []ImportRow, opts models.ImportOptions) {
+	seen := map[string]map[string]int{
+		models.MatchUsername:   {},
+		models.MatchEmail:      {},
+		models.MatchExternalID: {},
+	}
+
+	for i := range rows {
+		row := &rows[i]
+		if len(row.Errors) > 0 {
+			continue
+		}
+		account := &row.Account
+
+		if account.Username == "" {
+			row.fail("username", "is required")
+		}
+		if account.Email == "" {
+			row.fail("email", "is required")
+		} else if address, err := mail.ParseAddress(account.Email); err != nil || address.Address != account.Email {
+			row.fail("email", "%q is not an email address", account.Email)
+		}
+		if opts.MatchKey == models.MatchExternalID && account.ExternalID == "" {
+			row.fail("external_id", "is required to match accounts")
+		}
+		// Identifiers are only looked up once they are known to be well formed
+		if opts.MatchKey != "" && !row.failed(opts.MatchKey) {
+			row.match = e.lookup(opts.MatchKey, requestIdentifier(opts.MatchKey, account))
+		}
+		for _, field := range []string{models.MatchUsername, models.MatchEmail, models.MatchExternalID} {
+			value := requestIdentifier(field, account)
+			if value == "" || row.failed(field) {
+				continue
+			}
+			if line, ok := seen[field][identifierKey(field, value)]; ok {
+				row.fail(field, "%q is also on line %d", value, line)
+				continue
+			}
+			seen[field][identifierKey(field, value)] = row.Line
+
+			// A skipped row changes nothing, so it cannot clash
+			if row.match != nil && opts.Strategy == models.ConflictSkip {
+				continue
+			}
+			if owner := e.lookup(field, value); owner != nil && (row.match == nil || owner.ID != row.match.ID) {
+				if field == models.MatchEmail {
+					row.fail(field, "%q is already in use", value)
+				} else {
+					row.fail(field, "%q is already taken", value)
+				}
+			}
+		}
+
+		if account.Grade < 0 || account.Grade > maxGrade {
+			row.fail("grade", "must be between 0 and %d", maxGrade)
+		}
+		if row.Experience < 0 {
+			row.fail("experience", "cannot be negative")
+		}
+
+		if opts.School != "" {
+			if account.School == "" {
+				account.School = opts.School
+			} else if !strings.EqualFold(account.School, opts.School) {
+				row.fail("school", "must be %s", opts.School)
+			}
+			if row.match != nil && !strings.EqualFold(row.match.School, opts.School) {
+				row.fail(opts.MatchKey, "matches an account of another school")
+			}
+		}
+	}
+}
+
+// lookup returns the live account with value in the identifying field, or
+// nil if there is none
+func (e *ExportService) lookup(field, value string) *models.Account {
+	var account *models.Account
+	var err error
+	switch field {
+	case models.MatchUsername:
+		account, err = e.db.GetAccountByUsername(value)
+	case models.MatchEmail:
+		account, err = e.db.GetAccountByEmail(value)
+	case models.MatchExternalID:
+		account, err = e.db.GetAccountByExternalID(value)
+	}
+	if err != nil {
+		return nil
+	}
+	return account
+}
+
+// requestIdentifier and accountIdentifier return the value of an identifying
+// field, named by its match key
+func requestIdentifier(field string, req *models.CreateAccountRequest) string {
+	switch field {
+	case models.MatchUsername:
+		return req.Username
+	case models.MatchEmail:
+		return req.Email
+	case models.MatchExternalID:
+		return req.ExternalID
+	}
+	return ""
+}
+
+func accountIdentifier(field string, account *models.Account) string {
+	switch field {
+	case models.MatchUsername:
+		return account.Username
+	case models.MatchEmail:
+		return account.Email
+	case models.MatchExternalID:
+		if account.ExternalID != nil {
+			return *account.ExternalID
+		}
+	}
+	return ""
+}
+
+// identifierKey is what identifying values are compared by: emails ignore
+// case, as the database does
+func identifierKey(field, value string) string {
+	if field == models.MatchEmail {
+		return strings.ToLower(value)
+	}
+	return value
+}
+
+// applyRow creates the account of a row, or updates the account it matches
+// as opts.Strategy says, and adds what it did to report
+func applyRow(tx database.Store, row *ImportRow, opts models.ImportOptions, report *models.ImportReport) error {
+	if row.match == nil {
+		account, err := createRow(tx, row)
+		if err != nil {
+			return err
+		}
+		addChange(report, models.ImportChange{Line: row.Line, Action: models.ImportCreated, AccountID: account.ID, Username: account.Username})
+		return nil
+	}
+
+	if opts.Strategy == models.ConflictSkip {
+		report.Unchanged++
+		return nil
+	}
+	want := updatedAccount(row, opts.Strategy)
+	if len(accountDiff(row.match, want)) == 0 {
+		report.Unchanged++
+		return nil
+	}
+
+	// The version read while validating makes a concurrent edit fail the row
+	// rather than be overwritten
+	version := row.match.Version
+	account, err := tx.UpdateAccount(row.match.ID, models.UpdateAccountRequest{
+		FirstName:  want.FirstName,
+		LastName:   want.LastName,
+		Grade:      want.Grade,
+		School:     want.School,
+		IsActive:   want.IsActive,
+		Version:    &version,
+		Username:   &want.Username,
+		Email:      &want.Email,
+		ExternalID: want.ExternalID,
+	})
+	if err != nil {
+		return err
+	}
+	if want.Role != account.Role {
+		if account, err = tx.SetAccountRole(account.ID, want.Role); err != nil {
+			return err
+		}
+	}
+
+	// The saved account is compared rather than want, since a school name
+	// may be another spelling of the account's school
+	fields := accountDiff(row.match, account)
+	if len(fields) == 0 {
+		report.Unchanged++
+		return nil
+	}
+	addChange(report, models.ImportChange{Line: row.Line, Action: models.ImportUpdated, AccountID: account.ID, Username: account.Username, Fields: fields})
+	return nil
+}
+
+// updatedAccount returns the account a row matches as the row would leave
+// it: overwrite takes every field from the row, blank ones included, and
+// merge only those the row fills in. Experience is kept, since it comes
+// from the XP ledger, and an external ID is never cleared. A row only sets
+// the role when it has one, and never demotes a superadmin.
+func updatedAccount(row *ImportRow, strategy string) *models.Account {
+	account := *row.match
+	take := func(field string) bool {
+		return strategy == models.ConflictOverwrite || row.Filled[field]
+	}
+
+	// Every valid row has a username and email
+	account.Username = row.Account.Username
+	account.Email = row.Account.Email
+	if take("first_name") {
+		account.FirstName = row.Account.FirstName
+	}
+	if take("last_name") {
+		account.LastName = row.Account.LastName
+	}
+	if take("grade") {
+		account.Grade = row.Account.Grade
+	}
+	if take("school") && !strings.EqualFold(row.Account.School, account.School) {
+		account.School = row.Account.School
+	}
+	if take("is_active") {
+		account.IsActive = row.IsActive
+	}
+	if row.Account.ExternalID != "" {
+		externalID := row.Account.ExternalID
+		account.ExternalID = &externalID
+	}
+	if row.Account.Role != "" && account.Role != models.RoleSuperadmin {
+		account.Role = row.Account.Role
+	}
+	return &account
+}
+
+// accountDiff lists the imported fields that differ between two versions of
+// an account
+func accountDiff(old, new *models.Account) []models.ImportFieldChange {
+	var fields []models.ImportFieldChange
+	add := func(field string, from, to interface{}) {
+		if from != to {
+			fields = append(fields, models.ImportFieldChange{Field: field, Old: from, New: to})
+		}
+	}
+
+	add("username", old.Username, new.Username)
+	add("email", old.Email, new.Email)
+	add("first_name", old.FirstName, new.FirstName)
+	add("last_name", old.LastName, new.LastName)
+	add("grade", old.Grade, new.Grade)
+	add("school", old.School, new.School)
+	add("is_active", old.IsActive, new.IsActive)
+	add("role", old.Role, new.Role)
+	add("external_id", accountIdentifier(models.MatchExternalID, old), accountIdentifier(models.MatchExternalID, new))
+	return fields
+}
+
+// deactivateMissing deactivates the active students of the imported schools
+// that no row matches, and adds them to report. Only students are
+// deactivated, so a roster cannot lock out the staff of its school.
+func deactivateMissing(tx database.Store, rows []ImportRow, opts models.ImportOptions, report *models.ImportReport) error {
+	// Rows with errors still count as present, so a typo in a roster does not
+	// deactivate the account it was meant to update
+	present := make(map[string]bool)
+	var schools []string
+	for _, row := range rows {
+		if value := requestIdentifier(opts.MatchKey, &row.Account); value != "" {
+			present[identifierKey(opts.MatchKey, value)] = true
+		}
+		schools = append(schools, row.Account.School)
+		if row.match != nil {
+			schools = append(schools, row.match.School)
+		}
+	}
+	if opts.School != "" {
+		schools = []string{opts.School}
+	}
+
+	active := true
+	searched := make(map[int]bool)
+	var missing []models.Account
+	for _, name := range schools {
+		school, err := tx.FindSchool(name)
+		if err != nil || searched[school.ID] {
+			continue
+		}
+		searched[school.ID] = true
+
+		listing := models.AccountListOptions{SchoolID: &school.ID, Roles: []string{models.RoleStudent}, IsActive: &active}
+		err = tx.ForEachAccount(listing, func(account *models.Account) error {
+			if !present[identifierKey(opts.MatchKey, accountIdentifier(opts.MatchKey, account))] {
+				missing = append(missing, *account)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	// Accounts are deactivated once they have all been read, since a query
+	// cannot run while another one's rows are open on PostgreSQL
+	for _, account := range missing {
+		if _, err := tx.SetAccountActive(account.ID, false); err != nil {
+			return err
+		}
+		addChange(report, models.ImportChange{
+			Action:    models.ImportDeactivated,
+			AccountID: account.ID,
+			Username:  account.Username,
+			Fields:    []models.ImportFieldChange{{Field: "is_active", Old: true, New: false}},
+		})
+	}
+	return nil
+}
+
+// addChange records a change in report and counts it
+func addChange(report *models.ImportReport, change models.ImportChange) {
+	switch change.Action {
+	case models.ImportCreated:
+		report.Created++
+	case models.ImportUpdated:
+		report.Updated++
+	case models.ImportDeactivated:
+		report.Deactivated++
+	}
+	report.Changes = append(report.Changes, change)
+}
+
+// addChanges adds what one transaction of an import did to its report
+func addChanges(report, applied *models.ImportReport) {
+	for _, change := range applied.Changes {
+		addChange(report, change)
+	}
+	report.Unchanged += applied.Unchanged
+}
+
+// createRow creates the account of a row. It is given its own random password
+// that nobody knows and flagged for a reset, so its owner has to set a
+// password through a reset link or one handed out by staff before signing in.
+func createRow(tx database.Store, row *ImportRow) (*models.Account, error) {
+	req := row.Account
+	password, err := auth.GenerateTemporaryPassword()
+	if err != nil {
+		return nil, err
+	}
+	req.Password = password
+	req.MustResetPassword = true
+
+	account, err := tx.CreateAccount(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if !row.IsActive {
+		if account, err = tx.SetAccountActive(account.ID, false); err != nil {
+			return nil, err
+		}
+	}
+
+	// Experience is carried over as a ledger entry
+	if row.Experience > 0 {
+		_, _, err := tx.RecordXPEvent(models.XPEvent{
+			AccountID: account.ID,
+			Amount:    row.Experience,
+			Source:    models.XPSourceImport,
+			Reason:    "Imported experience",
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to import experience: %w", err)
+		}
+	}
+
+	return account, nil
+}
@@ -0,0 +1,297 @@
+package export
+
+import (
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"educational-game-db/internal/models"
+
+	"gopkg.in/yaml.v3"
+)
+
+// defaultGradeAliases are grade names every CSV import understands
+var defaultGradeAliases = map[string]int{"k": 0, "kg": 0, "kindergarten": 0}
+
+// mappingName is what an import mapping may be called, so its name can go in a URL
+var mappingName = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_.-]*$`)
+
+// ParseMapping decodes and validates an import mapping called name. JSON is
+// accepted as it is a subset of YAML.
+func ParseMapping(name string, data []byte) (*models.ImportMapping, error) {
+	var m models.ImportMapping
+	if err := yaml.Unmarshal(data, &m); err != nil {
+		return nil, fmt.Errorf("failed to parse import mapping: %w", err)
+	}
+	m.Name = name
+	if err := ValidateMapping(&m); err != nil {
+		return nil, err
+	}
+	return &m, nil
+}
+
+// ValidateMapping reports whether an import mapping can be used
+func ValidateMapping(m *models.ImportMapping) error {
+	if !mappingName.MatchString(m.Name) {
+		return fmt.Errorf("mapping name %q must be letters, digits, '.', '_' and '-'", m.Name)
+	}
+	for field, header := range m.Columns {
+		if !isImportField(field) {
+			return fmt.Errorf("mapping has unknown field %q", field)
+		}
+		if headerKey(header) == "" {
+			return fmt.Errorf("mapping has no column for %s", field)
+		}
+	}
+	for field, transforms := range m.Transforms {
+		if !isImportField(field) {
+			return fmt.Errorf("mapping has unknown field %q", field)
+		}
+		for _, transform := range transforms {
+			switch transform {
+			case models.TransformTrim, models.TransformLowercase, models.TransformUppercase:
+			default:
+				return fmt.Errorf("mapping has unknown transform %q for %s", transform, field)
+			}
+		}
+	}
+	for alias, grade := range m.GradeAliases {
+		if strings.TrimSpace(alias) == "" {
+			return fmt.Errorf("mapping has an empty grade alias")
+		}
+		if grade < 0 || grade > maxGrade {
+			return fmt.Errorf("grade alias %q must be between 0 and %d", alias, maxGrade)
+		}
+	}
+	return nil
+}
+
+func isImportField(field string) bool {
+	for _, f := range models.ImportFields {
+		if f == field {
+			return true
+		}
+	}
+	return false
+}
+
+// headerKey is what column headers are matched by, so that "First Name",
+// "first_name" and "FirstName" are the same column
+func headerKey(header string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			return unicode.ToLower(r)
+		}
+		return -1
+	}, header)
+}
+
+// csvLayout is where the fields of a CSV import are and how their values
+// are read
+type csvLayout struct {
+	header     []string
+	columns    map[string]int
+	transforms map[string][]string
+	grades     map[string]int
+}
+
+// newCSVLayout finds the column of each field in a CSV header. A field the
+// mapping names a column for must have it; other fields are read from a
+// column named after them, if there is one.
+func newCSVLayout(header []string, mapping *models.ImportMapping) (*csvLayout, error) {
+	if mapping == nil {
+		mapping = &models.ImportMapping{}
+	}
+
+	byKey := make(map[string]int)
+	repeated := make(map[string]bool)
+	for i, name := range header {
+		key := headerKey(name)
+		if _, ok := byKey[key]; ok {
+			repeated[key] = true
+		}
+		byKey[key] = i
+	}
+
+	layout := &csvLayout{
+		header:     header,
+		columns:    make(map[string]int),
+		transforms: mapping.Transforms,
+		grades:     make(map[string]int),
+	}
+	for _, field := range models.ImportFields {
+		name, mapped := mapping.Columns[field]
+		if !mapped {
+			name = field
+		}
+		key := headerKey(name)
+		i, ok := byKey[key]
+		switch {
+		case !ok && mapped:
+			return nil, fmt.Errorf("CSV header has no %q column for %s", name, field)
+		case !ok:
+			continue
+		case repeated[key]:
+			return nil, fmt.Errorf("CSV header has more than one %q column", strings.TrimSpace(header[i]))
+		}
+		layout.columns[field] = i
+	}
+	for _, field := range []string{"username", "email"} {
+		if _, ok := layout.columns[field]; !ok {
+			return nil, fmt.Errorf("CSV header has no %s column", field)
+		}
+	}
+
+	for alias, grade := range defaultGradeAliases {
+		layout.grades[alias] = grade
+	}
+	for alias, grade := range mapping.GradeAliases {
+		layout.grades[strings.ToLower(strings.TrimSpace(alias))] = grade
+	}
+	return layout, nil
+}
+
+// value returns a field's value in record after the field's transforms
+func (l *csvLayout) value(record []string, field string) string {
+	i, ok := l.columns[field]
+	if !ok {
+		return ""
+	}
+
+	value := record[i]
+	transforms, ok := l.transforms[field]
+	if !ok {
+		transforms = []string{models.TransformTrim}
+	}
+	for _, transform := range transforms {
+		switch transform {
+		case models.TransformTrim:
+			value = strings.TrimSpace(value)
+		case models.TransformLowercase:
+			value = strings.ToLower(value)
+		case models.TransformUppercase:
+			value = strings.ToUpper(value)
+		}
+	}
+	return value
+}
+
+// row interprets a record. The ID, game level and timestamps of an export
+// are assigned by the database, so they are not imported.
+func (l *csvLayout) row(line int, record []string) ImportRow {
+	row := ImportRow{Line: line, IsActive: true}
+	if len(record) != len(l.header) {
+		row.fail("", "expected %d columns, got %d", len(l.header), len(record))
+		return row
+	}
+
+	text := func(field string) string {
+		value := l.value(record, field)
+		if strings.TrimSpace(value) == "" {
+			return ""
+		}
+		row.fill(field)
+		return value
+	}
+	row.Account = models.CreateAccountRequest{
+		Username:   text("username"),
+		Email:      text("email"),
+		FirstName:  text("first_name"),
+		LastName:   text("last_name"),
+		School:     text("school"),
+		ExternalID: text("external_id"),
+	}
+
+	if value := text("grade"); value != "" {
+		grade, ok := l.grade(value)
+		if !ok {
+			row.fail("grade", "%q is not a grade", value)
+		}
+		row.Account.Grade = grade
+	}
+	if value := text("experience"); value != "" {
+		experience, err := strconv.Atoi(strings.TrimSpace(value))
+		if err != nil {
+			row.fail("experience", "%q is not a whole number", value)
+		}
+		row.Experience = experience
+	}
+	if value := text("is_active"); value != "" {
+		active, err := strconv.ParseBool(strings.TrimSpace(value))
+		if err != nil {
+			row.fail("is_active", "%q is not true or false", value)
+		}
+		row.IsActive = active
+	}
+
+	return row
+}
+
+// grade reads a grade given as a number or one of its aliases
+func (l *csvLayout) grade(value string) (int, bool) {
+	value = strings.TrimSpace(value)
+	if grade, ok := l.grades[strings.ToLower(value)]; ok {
+		return grade, true
+	}
+	grade, err := strconv.Atoi(value)
+	return grade, err == nil
+}
+
+// Value returns a field of the row as it would be imported
+func (r *ImportRow) Value(field string) string {
+	switch field {
+	case "username":
+		return r.Account.Username
+	case "email":
+		return r.Account.Email
+	case "first_name":
+		return r.Account.FirstName
+	case "last_name":
+		return r.Account.LastName
+	case "grade":
+		return strconv.Itoa(r.Account.Grade)
+	case "school":
+		return r.Account.School
+	case "experience":
+		return strconv.Itoa(r.Experience)
+	case "is_active":
+		return strconv.FormatBool(r.IsActive)
+	case "external_id":
+		return r.Account.ExternalID
+	}
+	return ""
+}
+
+// CSVPreview shows how the start of a CSV file would be imported
+type CSVPreview struct {
+	// Columns gives the header of the column each field is read from
+	Columns map[string]string
+	// Ignored are the headers of the columns no field is read from
+	Ignored []string
+	Rows    []ImportRow
+}
+
+// PreviewCSV reads the header and first limit rows of a CSV file as an
+// import with mapping would, without checking them against the database
+func PreviewCSV(r io.Reader, mapping *models.ImportMapping, limit int) (*CSVPreview, error) {
+	rows, layout, err := parseCSV(r, mapping, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	preview := &CSVPreview{Columns: make(map[string]string), Rows: rows}
+	used := make(map[int]bool)
+	for field, i := range layout.columns {
+		preview.Columns[field] = layout.header[i]
+		used[i] = true
+	}
+	for i, name := range layout.header {
+		if !used[i] {
+			preview.Ignored = append(preview.Ignored, name)
+		}
+	}
+	return preview, nil
+}
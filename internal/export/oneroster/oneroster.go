@@ -0,0 +1,357 @@
+// Package oneroster reads and writes OneRoster 1.1 CSV bundles, the zip files
+// student information systems exchange rosters in, and syncs them onto
+// schools, accounts and classrooms.
+//
+// Only orgs.csv, users.csv, classes.csv and enrollments.csv are used. Courses,
+// academic sessions and the other files have nothing to map onto and are
+// ignored when read and marked absent when written.
+package oneroster
+
+import (
+	"archive/zip"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strconv"
+	"strings"
+
+	"educational-game-db/internal/database"
+	"educational-game-db/internal/models"
+)
+
+// ErrInvalidBundle is returned when a bundle cannot be read at all
+var ErrInvalidBundle = errors.New("invalid OneRoster bundle")
+
+// Version is the OneRoster version of the bundles read and written
+const Version = "1.1"
+
+// The files of a bundle that are synced
+const (
+	ManifestFile    = "manifest.csv"
+	OrgsFile        = "orgs.csv"
+	UsersFile       = "users.csv"
+	ClassesFile     = "classes.csv"
+	EnrollmentsFile = "enrollments.csv"
+)
+
+// Manifest values saying how a file is given
+const (
+	fileAbsent = "absent"
+	fileBulk   = "bulk"
+	fileDelta  = "delta"
+)
+
+// statusDeleted marks a record of a delta file as removed
+const statusDeleted = "tobedeleted"
+
+// Service syncs OneRoster bundles with the database
+type Service struct {
+	db database.Store
+}
+
+// NewService creates a new OneRoster service
+func NewService(db database.Store) *Service {
+	return &Service{db: db}
+}
+
+// Org is a row of orgs.csv
+type Org struct {
+	Line      int
+	SourcedID string
+	Status    string
+	Name      string
+	Type      string
+}
+
+// User is a row of users.csv
+type User struct {
+	Line          int
+	SourcedID     string
+	Status        string
+	EnabledUser   string
+	OrgSourcedIDs []string
+	Role          string
+	Username      string
+	GivenName     string
+	FamilyName    string
+	Email         string
+	Grades        []string
+}
+
+// Class is a row of classes.csv
+type Class struct {
+	Line            int
+	SourcedID       string
+	Status          string
+	Title           string
+	Grades          []string
+	SchoolSourcedID string
+}
+
+// Enrollment is a row of enrollments.csv
+type Enrollment struct {
+	Line           int
+	Status         string
+	ClassSourcedID string
+	UserSourcedID  string
+	Role           string
+}
+
+// Bundle is what a OneRoster bundle holds
+type Bundle struct {
+	// Manifest holds the manifest's properties; nil when there is none
+	Manifest    map[string]string
+	Orgs        []Org
+	Users       []User
+	Classes     []Class
+	Enrollments []Enrollment
+
+	// files holds the synced files the bundle has
+	files map[string]bool
+}
+
+// Has reports whether the bundle has a file, which the manifest may mark
+// absent even if the zip holds it
+func (b *Bundle) Has(file string) bool {
+	return b.files[file]
+}
+
+// fileMode returns how the manifest says a file is given, bulk when it
+// does not say
+func (b *Bundle) fileMode(file string) string {
+	if mode := b.Manifest["file."+strings.TrimSuffix(file, ".csv")]; mode != "" {
+		return strings.ToLower(mode)
+	}
+	return fileBulk
+}
+
+// syncMode returns the mode to sync the bundle in: the one asked for, else
+// delta when the manifest marks any file as delta. A full sync of delta
+// files would remove every record they leave out, so it is refused.
+func (b *Bundle) syncMode(mode string) (string, error) {
+	delta := ""
+	for _, file := range []string{OrgsFile, UsersFile, ClassesFile, EnrollmentsFile} {
+		if b.Has(file) && b.fileMode(file) == fileDelta {
+			delta = file
+			break
+		}
+	}
+
+	switch mode {
+	case "":
+		if delta != "" {
+			return models.RosterSyncDelta, nil
+		}
+		return models.RosterSyncFull, nil
+	case models.RosterSyncFull:
+		if delta != "" {
+			return "", fmt.Errorf("%w: the manifest marks %s as a delta file, which cannot be synced in full", ErrInvalidBundle, delta)
+		}
+		return mode, nil
+	case models.RosterSyncDelta:
+		return mode, nil
+	}
+	return "", fmt.Errorf("sync mode must be %s or %s", models.RosterSyncFull, models.RosterSyncDelta)
+}
+
+// ReadBundle reads a OneRoster bundle from a zip file of size bytes. Files
+// are found by name wherever they are in the zip.
+func ReadBundle(r io.ReaderAt, size int64) (*Bundle, error) {
+	archive, err := zip.NewReader(r, size)
+	if err != nil {
+		return nil, fmt.Errorf("%w: not a zip file: %v", ErrInvalidBundle, err)
+	}
+
+	entries := make(map[string]*zip.File)
+	for _, f := range archive.File {
+		entries[strings.ToLower(path.Base(f.Name))] = f
+	}
+
+	bundle := &Bundle{files: make(map[string]bool)}
+	if f, ok := entries[ManifestFile]; ok {
+		records, err := readCSV(f, "propertyName", "value")
+		if err != nil {
+			return nil, err
+		}
+		bundle.Manifest = make(map[string]string)
+		for _, record := range records {
+			bundle.Manifest[record.get("propertyName")] = record.get("value")
+		}
+		if version := bundle.Manifest["oneroster.version"]; version != "" && version != Version {
+			return nil, fmt.Errorf("%w: OneRoster %s is not supported, only %s", ErrInvalidBundle, version, Version)
+		}
+	}
+
+	for _, file := range []string{OrgsFile, UsersFile, ClassesFile, EnrollmentsFile} {
+		f, ok := entries[file]
+		if !ok || bundle.fileMode(file) == fileAbsent {
+			continue
+		}
+		bundle.files[file] = true
+
+		switch file {
+		case OrgsFile:
+			records, err := readCSV(f, "sourcedId", "name", "type")
+			if err != nil {
+				return nil, err
+			}
+			for _, record := range records {
+				bundle.Orgs = append(bundle.Orgs, Org{
+					Line:      record.line,
+					SourcedID: record.get("sourcedId"),
+					Status:    record.get("status"),
+					Name:      record.get("name"),
+					Type:      record.get("type"),
+				})
+			}
+		case UsersFile:
+			records, err := readCSV(f, "sourcedId", "orgSourcedIds", "role", "username")
+			if err != nil {
+				return nil, err
+			}
+			for _, record := range records {
+				bundle.Users = append(bundle.Users, User{
+					Line:          record.line,
+					SourcedID:     record.get("sourcedId"),
+					Status:        record.get("status"),
+					EnabledUser:   record.get("enabledUser"),
+					OrgSourcedIDs: record.list("orgSourcedIds"),
+					Role:          record.get("role"),
+					Username:      record.get("username"),
+					GivenName:     record.get("givenName"),
+					FamilyName:    record.get("familyName"),
+					Email:         record.get("email"),
+					Grades:        record.list("grades"),
+				})
+			}
+		case ClassesFile:
+			records, err := readCSV(f, "sourcedId", "title", "schoolSourcedId")
+			if err != nil {
+				return nil, err
+			}
+			for _, record := range records {
+				bundle.Classes = append(bundle.Classes, Class{
+					Line:            record.line,
+					SourcedID:       record.get("sourcedId"),
+					Status:          record.get("status"),
+					Title:           record.get("title"),
+					Grades:          record.list("grades"),
+					SchoolSourcedID: record.get("schoolSourcedId"),
+				})
+			}
+		case EnrollmentsFile:
+			records, err := readCSV(f, "classSourcedId", "userSourcedId", "role")
+			if err != nil {
+				return nil, err
+			}
+			for _, record := range records {
+				bundle.Enrollments = append(bundle.Enrollments, Enrollment{
+					Line:           record.line,
+					Status:         record.get("status"),
+					ClassSourcedID: record.get("classSourcedId"),
+					UserSourcedID:  record.get("userSourcedId"),
+					Role:           record.get("role"),
+				})
+			}
+		}
+	}
+
+	return bundle, nil
+}
+
+// record is a row of a bundle file, read by the header of its columns
+type record struct {
+	line    int
+	values  []string
+	columns map[string]int
+}
+
+func (r record) get(column string) string {
+	i, ok := r.columns[strings.ToLower(column)]
+	if !ok || i >= len(r.values) {
+		return ""
+	}
+	return strings.TrimSpace(r.values[i])
+}
+
+// list splits a column holding a comma separated list
+func (r record) list(column string) []string {
+	var items []string
+	for _, item := range strings.Split(r.get(column), ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// readCSV reads a bundle file, which must have the required columns
+func readCSV(f *zip.File, required ...string) ([]record, error) {
+	name := path.Base(f.Name)
+	rc, err := f.Open()
+	if err != nil {
+		return nil, fmt.Errorf("%w: cannot open %s: %v", ErrInvalidBundle, name, err)
+	}
+	defer rc.Close()
+
+	reader := csv.NewReader(rc)
+	reader.FieldsPerRecord = -1
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s has no header: %v", ErrInvalidBundle, name, err)
+	}
+
+	columns := make(map[string]int)
+	for i, column := range header {
+		column = strings.TrimPrefix(column, "\ufeff")
+		columns[strings.ToLower(strings.TrimSpace(column))] = i
+	}
+	for _, column := range required {
+		if _, ok := columns[strings.ToLower(column)]; !ok {
+			return nil, fmt.Errorf("%w: %s has no %s column", ErrInvalidBundle, name, column)
+		}
+	}
+
+	var records []record
+	for {
+		values, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s: %v", ErrInvalidBundle, name, err)
+		}
+		line, _ := reader.FieldPos(0)
+		records = append(records, record{line: line, values: values, columns: columns})
+	}
+	return records, nil
+}
+
+// gradeNumber reads a OneRoster grade code: KG and the earlier years are
+// grade 0, and 01 to 12 the grades of that number
+func gradeNumber(code string) (int, bool) {
+	switch strings.ToUpper(code) {
+	case "IT", "PR", "PK", "TK", "KG":
+		return 0, true
+	}
+	grade, err := strconv.Atoi(code)
+	if err != nil || grade < 1 || grade > 12 {
+		return 0, false
+	}
+	return grade, true
+}
+
+// gradeCode writes a grade as a OneRoster grade code
+func gradeCode(grade int) string {
+	if grade == 0 {
+		return "KG"
+	}
+	return fmt.Sprintf("%02d", grade)
+}
+
+// isDeleted reports whether a record is marked as removed
+func isDeleted(status string) bool {
+	return strings.EqualFold(status, statusDeleted)
+}
@@ -0,0 +1,202 @@
+package oneroster
+
+import (
+	"archive/zip"
+	"bytes"
+	"strconv"
+	"testing"
+
+	"educational-game-db/internal/database"
+	"educational-game-db/internal/models"
+)
+
+func setupTestService(t *testing.T) (*Service, *database.Database) {
+	t.Helper()
+	db, err := database.NewDatabase(":memory:")
+	if err != nil {
+		t.Fatalf("Failed to create test database: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return NewService(db), db
+}
+
+// zipBundle zips files, given by name, into a bundle
+func zipBundle(t *testing.T, files map[string]string) *Bundle {
+	t.Helper()
+	var buf bytes.Buffer
+	archive := zip.NewWriter(&buf)
+	for name, content := range files {
+		f, err := archive.Create(name)
+		if err != nil {
+			t.Fatalf("Failed to add %s: %v", name, err)
+		}
+		f.Write([]byte(content))
+	}
+	if err := archive.Close(); err != nil {
+		t.Fatalf("Failed to write zip: %v", err)
+	}
+
+	bundle, err := ReadBundle(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatalf("Failed to read bundle: %v", err)
+	}
+	return bundle
+}
+
+const (
+	testOrgs = "sourcedId,status,dateLastModified,name,type,identifier,parentSourcedId\n" +
+		"d1,,,Hill District,district,,\n" +
+		"s1,,,Hill School,school,,d1\n"
+	testUsers = "sourcedId,status,dateLastModified,enabledUser,orgSourcedIds,role,username,userIds,givenName,familyName,middleName,identifier,email,sms,phone,agentSourcedIds,grades,password\n" +
+		"u1,,,true,\"d1,s1\",student,ada,,Ada,Lovelace,,,ada@example.com,,,,05,\n" +
+		"u2,,,true,s1,student,alan,,Alan,Turing,,,alan@example.com,,,,KG,\n" +
+		"u3,,,true,s1,teacher,mr_t,,Tom,Smith,,,t@example.com,,,,,\n" +
+		"p1,,,true,s1,parent,pat,,Pat,Lovelace,,,pat@example.com,,,,,\n"
+	testClasses = "sourcedId,status,dateLastModified,title,grades,courseSourcedId,classCode,classType,location,schoolSourcedId,termSourcedIds,subjects,subjectCodes,periods\n" +
+		"c1,,,5A,05,,,homeroom,,s1,,,,\n"
+	testEnrollments = "sourcedId,status,dateLastModified,classSourcedId,schoolSourcedId,userSourcedId,role,primary,beginDate,endDate\n" +
+		"e1,,,c1,s1,u1,student,,,\n" +
+		"e2,,,c1,s1,u2,student,,,\n" +
+		"e3,,,c1,s1,u3,teacher,,,\n"
+)
+
+func TestSyncFullAndDelta(t *testing.T) {
+	service, db := setupTestService(t)
+	// grace was made by hand, so a full sync deactivates her; ada is
+	// linked by email
+	for _, username := range []string{"ada", "grace"} {
+		if _, err := db.CreateAccount(models.CreateAccountRequest{
+			Username: username, Email: username + "@example.com", Password: "password123", Grade: 5, School: "Hill School",
+		}); err != nil {
+			t.Fatalf("Failed to create account: %v", err)
+		}
+	}
+
+	bundle := zipBundle(t, map[string]string{
+		OrgsFile: testOrgs, UsersFile: testUsers, ClassesFile: testClasses, EnrollmentsFile: testEnrollments,
+	})
+	report, err := service.Sync(bundle, models.RosterSyncOptions{})
+	if err != nil {
+		t.Fatalf("Failed to sync: %v", err)
+	}
+	if !report.Committed || len(report.Errors) != 0 {
+		t.Fatalf("Expected the sync to be saved, got %+v", report)
+	}
+	if report.Mode != models.RosterSyncFull || report.Schools.Updated != 1 || report.Schools.Skipped != 1 {
+		t.Errorf("Expected a full sync linking the school and skipping the district, got %+v", report)
+	}
+	if users := report.Users; users.Created != 2 || users.Updated != 1 || users.Removed != 1 || users.Skipped != 1 {
+		t.Errorf("Expected 2 users created, ada linked, grace deactivated and the parent skipped, got %+v", users)
+	}
+	if report.Classes.Created != 1 || report.Enrollments.Created != 3 {
+		t.Errorf("Expected the class and its 3 enrollments, got %+v %+v", report.Classes, report.Enrollments)
+	}
+
+	ada, err := db.GetAccountByExternalID("u1")
+	if err != nil || ada.Username != "ada" || ada.LastName != "Lovelace" {
+		t.Fatalf("Expected ada to be linked to her sourcedId and updated, got %+v, %v", ada, err)
+	}
+	if alan, _ := db.GetAccountByUsername("alan"); alan.Grade != 0 || alan.School != "Hill School" {
+		t.Errorf("Expected alan in kindergarten at Hill School, got %+v", alan)
+	}
+	if teacher, _ := db.GetAccountByUsername("mr_t"); teacher.Role != models.RoleTeacher {
+		t.Errorf("Expected mr_t to be a teacher, got %s", teacher.Role)
+	}
+	if grace, _ := db.GetAccountByUsername("grace"); grace.IsActive {
+		t.Errorf("Expected grace, missing from the roster, to be deactivated")
+	}
+
+	report, err = service.Sync(bundle, models.RosterSyncOptions{})
+	if err != nil {
+		t.Fatalf("Failed to sync: %v", err)
+	}
+	if report.Users.Unchanged != 3 || report.Classes.Unchanged != 1 || report.Enrollments.Unchanged != 3 || len(report.Changes) != 0 {
+		t.Errorf("Expected a second sync to change nothing, got %+v", report)
+	}
+
+	// alan leaves, and the class is deleted in a dry run
+	delta := zipBundle(t, map[string]string{
+		ManifestFile: "propertyName,value\noneroster.version,1.1\nfile.users,delta\nfile.classes,delta\nfile.orgs,absent\n",
+		OrgsFile:     testOrgs,
+		UsersFile:    "sourcedId,status,orgSourcedIds,role,username\nu2,tobedeleted,s1,student,alan\n",
+		ClassesFile:  "sourcedId,status,title,schoolSourcedId\nc1,tobedeleted,5A,s1\n",
+	})
+	if _, err := service.Sync(delta, models.RosterSyncOptions{Mode: models.RosterSyncFull}); err == nil {
+		t.Errorf("Expected delta files to be refused in a full sync")
+	}
+	report, err = service.Sync(delta, models.RosterSyncOptions{DryRun: true})
+	if err != nil {
+		t.Fatalf("Failed to sync: %v", err)
+	}
+	if report.Mode != models.RosterSyncDelta || report.Committed || report.Users.Removed != 1 || report.Classes.Removed != 1 {
+		t.Errorf("Expected a delta dry run removing alan and the class, got %+v", report)
+	}
+	if alan, _ := db.GetAccountByUsername("alan"); !alan.IsActive {
+		t.Errorf("Expected a dry run to save nothing")
+	}
+	if _, err := db.GetClassroomBySourcedID("c1"); err != nil {
+		t.Errorf("Expected a dry run to keep the class: %v", err)
+	}
+}
+
+func TestSyncErrorsSaveNothing(t *testing.T) {
+	service, db := setupTestService(t)
+
+	users := testUsers + "u4,,,maybe,s1,student,grace,,,,,,grace@example.com,,,,,\n"
+	report, err := service.Sync(zipBundle(t, map[string]string{OrgsFile: testOrgs, UsersFile: users}), models.RosterSyncOptions{})
+	if err != nil {
+		t.Fatalf("Failed to sync: %v", err)
+	}
+	if report.Committed || len(report.Errors) != 1 || report.Errors[0].Line != 6 || report.Errors[0].Field != "enabledUser" {
+		t.Fatalf("Expected an enabledUser error on line 6, got %+v", report)
+	}
+	if _, err := db.FindSchool("Hill School"); err == nil {
+		t.Errorf("Expected a sync with errors to save nothing")
+	}
+}
+
+func TestWriteBundleRoundTrip(t *testing.T) {
+	service, db := setupTestService(t)
+	bundle := zipBundle(t, map[string]string{
+		OrgsFile: testOrgs, UsersFile: testUsers, ClassesFile: testClasses, EnrollmentsFile: testEnrollments,
+	})
+	if _, err := service.Sync(bundle, models.RosterSyncOptions{}); err != nil {
+		t.Fatalf("Failed to sync: %v", err)
+	}
+	school, _ := db.FindSchool("Hill School")
+	local, err := db.CreateClassroom(school.ID, models.ClassroomRequest{Name: "Chess Club", Grade: 5})
+	if err != nil {
+		t.Fatalf("Failed to create classroom: %v", err)
+	}
+
+	var buf bytes.Buffer
+	if err := service.WriteBundle(&buf, &school.ID); err != nil {
+		t.Fatalf("Failed to write bundle: %v", err)
+	}
+	written, err := ReadBundle(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatalf("Failed to read the written bundle: %v", err)
+	}
+
+	if len(written.Orgs) != 1 || written.Orgs[0].SourcedID != "s1" {
+		t.Errorf("Expected the school with its sourcedId, got %+v", written.Orgs)
+	}
+	if len(written.Users) != 3 || written.Users[0].SourcedID != "u1" || written.Users[0].Grades[0] != "05" || written.Users[2].Role != "teacher" {
+		t.Errorf("Expected the 3 synced users, got %+v", written.Users)
+	}
+	if len(written.Classes) != 2 || written.Classes[0].SourcedID != "c1" || written.Classes[1].SourcedID != "class-"+strconv.Itoa(local.ID) {
+		t.Errorf("Expected both classes, the local one with a made up sourcedId, got %+v", written.Classes)
+	}
+	if len(written.Enrollments) != 3 {
+		t.Errorf("Expected 3 enrollments, got %+v", written.Enrollments)
+	}
+
+	// The bundle syncs back without changing anything
+	report, err := service.Sync(written, models.RosterSyncOptions{})
+	if err != nil || len(report.Errors) != 0 {
+		t.Fatalf("Failed to sync the written bundle: %+v, %v", report, err)
+	}
+	if len(report.Changes) != 0 || report.Classes.Updated != 1 || report.Enrollments.Unchanged != 3 {
+		t.Errorf("Expected only the local class to be linked, got %+v", report)
+	}
+}
@@ -0,0 +1,730 @@
+package oneroster
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"educational-game-db/internal/database"
+	"educational-game-db/internal/export"
+	"educational-game-db/internal/models"
+)
+
+// errSyncFailed rolls back the transaction of a sync that found errors
+var errSyncFailed = errors.New("sync failed")
+
+// accountRoles are the OneRoster roles that have accounts, with their
+// account role. Guardians, parents and the like are skipped.
+var accountRoles = map[string]string{
+	"student":       models.RoleStudent,
+	"teacher":       models.RoleTeacher,
+	"aide":          models.RoleTeacher,
+	"administrator": models.RoleSchoolAdmin,
+}
+
+// enrollmentRoles are the OneRoster enrollment roles, with the role they
+// give in a classroom
+var enrollmentRoles = map[string]string{
+	"student":       models.EnrollmentStudent,
+	"teacher":       models.EnrollmentTeacher,
+	"aide":          models.EnrollmentTeacher,
+	"administrator": models.EnrollmentTeacher,
+}
+
+// userColumns names the users.csv column each imported account field comes
+// from, so import errors point at the column to fix
+var userColumns = map[string]string{
+	"username":    "username",
+	"email":       "email",
+	"first_name":  "givenName",
+	"last_name":   "familyName",
+	"grade":       "grades",
+	"school":      "orgSourcedIds",
+	"is_active":   "enabledUser",
+	"external_id": "sourcedId",
+}
+
+// Sync applies a bundle to the database as opts says, in one transaction:
+// if any record has an error, nothing is saved. Orgs become schools, users
+// accounts, classes classrooms and enrollments enrollments, each found by
+// its sourcedId. Records that were made before the first sync are linked by
+// name, or email for accounts, rather than made again.
+//
+// A full sync also deactivates the active students of the synced schools
+// that users.csv leaves out, deletes their classrooms from an earlier sync
+// that classes.csv leaves out, and drops the enrollments of synced classes
+// that enrollments.csv leaves out. A file missing from the bundle leaves
+// its records as they are. Schools are never deleted.
+func (s *Service) Sync(bundle *Bundle, opts models.RosterSyncOptions) (*models.RosterSyncReport, error) {
+	mode, err := bundle.syncMode(opts.Mode)
+	if err != nil {
+		return nil, err
+	}
+
+	report := newReport(mode, opts.DryRun)
+	err = s.db.Transaction(func(tx database.Store) error {
+		sync := &syncer{
+			tx:       tx,
+			bundle:   bundle,
+			mode:     mode,
+			report:   report,
+			schools:  make(map[string]*models.School),
+			classes:  make(map[string]*models.Classroom),
+			accounts: make(map[string]*models.Account),
+			synced:   make(map[int]bool),
+		}
+		for _, step := range []func() error{sync.syncOrgs, sync.syncUsers, sync.syncClasses, sync.syncEnrollments} {
+			if err := step(); err != nil {
+				return err
+			}
+			// Each file refers to the records of the ones before it, so
+			// errors in one would only be repeated by the next
+			if len(report.Errors) > 0 {
+				return errSyncFailed
+			}
+		}
+		if opts.DryRun {
+			return export.ErrDryRun
+		}
+		return nil
+	})
+
+	switch {
+	case err == nil:
+		report.Committed = true
+	case errors.Is(err, export.ErrDryRun):
+	case errors.Is(err, errSyncFailed):
+		failed := newReport(mode, opts.DryRun)
+		failed.Errors = report.Errors
+		failed.Warnings = report.Warnings
+		report = failed
+	default:
+		return nil, err
+	}
+
+	sort.SliceStable(report.Errors, func(i, j int) bool { return report.Errors[i].Line < report.Errors[j].Line })
+	return report, nil
+}
+
+func newReport(mode string, dryRun bool) *models.RosterSyncReport {
+	return &models.RosterSyncReport{
+		Mode:     mode,
+		DryRun:   dryRun,
+		Changes:  []models.ImportChange{},
+		Errors:   []models.RosterSyncProblem{},
+		Warnings: []models.RosterSyncProblem{},
+	}
+}
+
+// syncer is the state of one sync, inside its transaction
+type syncer struct {
+	tx     database.Store
+	bundle *Bundle
+	mode   string
+	report *models.RosterSyncReport
+
+	// schools, classes and accounts are found by sourcedId; nil when there
+	// is none
+	schools  map[string]*models.School
+	classes  map[string]*models.Classroom
+	accounts map[string]*models.Account
+	// synced holds the IDs of the schools the bundle lists or has classes in
+	synced map[int]bool
+}
+
+func (s *syncer) fail(file string, line int, field, format string, args ...interface{}) {
+	s.report.Errors = append(s.report.Errors, models.RosterSyncProblem{File: file, Line: line, Field: field, Message: fmt.Sprintf(format, args...)})
+}
+
+func (s *syncer) warn(file string, line int, field, format string, args ...interface{}) {
+	s.report.Warnings = append(s.report.Warnings, models.RosterSyncProblem{File: file, Line: line, Field: field, Message: fmt.Sprintf(format, args...)})
+}
+
+// school returns the school synced from an org, or nil
+func (s *syncer) school(sourcedID string) *models.School {
+	if school, ok := s.schools[sourcedID]; ok {
+		return school
+	}
+	school, _ := s.tx.GetSchoolBySourcedID(sourcedID)
+	s.schools[sourcedID] = school
+	return school
+}
+
+// class returns the classroom synced from a class, or nil
+func (s *syncer) class(sourcedID string) *models.Classroom {
+	if classroom, ok := s.classes[sourcedID]; ok {
+		return classroom
+	}
+	classroom, _ := s.tx.GetClassroomBySourcedID(sourcedID)
+	s.classes[sourcedID] = classroom
+	return classroom
+}
+
+// account returns the account synced from a user, or nil
+func (s *syncer) account(sourcedID string) *models.Account {
+	if account, ok := s.accounts[sourcedID]; ok {
+		return account
+	}
+	account, _ := s.tx.GetAccountByExternalID(sourcedID)
+	s.accounts[sourcedID] = account
+	return account
+}
+
+// syncOrgs syncs the schools of orgs.csv. Districts and other kinds of org have
+// nothing to sync to and are skipped.
+func (s *syncer) syncOrgs() error {
+	counts := &s.report.Schools
+	seen := make(map[string]int)
+	for _, org := range s.bundle.Orgs {
+		if org.SourcedID == "" {
+			s.fail(OrgsFile, org.Line, "sourcedId", "is required")
+			continue
+		}
+		if line, ok := seen[org.SourcedID]; ok {
+			s.fail(OrgsFile, org.Line, "sourcedId", "%q is also on line %d", org.SourcedID, line)
+			continue
+		}
+		seen[org.SourcedID] = org.Line
+
+		if !strings.EqualFold(org.Type, "school") {
+			counts.Skipped++
+			continue
+		}
+		if isDeleted(org.Status) {
+			s.warn(OrgsFile, org.Line, "status", "schools are not deleted by a sync; delete %s by hand", org.Name)
+			counts.Skipped++
+			continue
+		}
+		if org.Name == "" {
+			s.fail(OrgsFile, org.Line, "name", "is required")
+			continue
+		}
+
+		school, err := s.tx.GetSchoolBySourcedID(org.SourcedID)
+		if err == nil {
+			if school.Name == org.Name {
+				counts.Unchanged++
+			} else {
+				school, err = s.tx.RenameSchool(school.ID, org.Name)
+				if errors.Is(err, database.ErrSchoolExists) {
+					s.fail(OrgsFile, org.Line, "name", "%q is the name of another school", org.Name)
+					continue
+				}
+				if err != nil {
+					return err
+				}
+				counts.Updated++
+			}
+		} else if school, err = s.tx.FindSchool(org.Name); err == nil {
+			if school.SourcedID != nil {
+				s.fail(OrgsFile, org.Line, "name", "%q is the school of org %q", school.Name, *school.SourcedID)
+				continue
+			}
+			if err := s.tx.SetSchoolSourcedID(school.ID, org.SourcedID); err != nil {
+				return err
+			}
+			counts.Updated++
+		} else {
+			if school, err = s.tx.CreateSchool(org.Name); err != nil {
+				return err
+			}
+			if err := s.tx.SetSchoolSourcedID(school.ID, org.SourcedID); err != nil {
+				return err
+			}
+			counts.Created++
+		}
+
+		s.schools[org.SourcedID] = school
+		s.synced[school.ID] = true
+	}
+	return nil
+}
+
+// syncUsers syncs the accounts of users.csv through an import matching them by
+// sourcedId, which overwrites their fields and role
+func (s *syncer) syncUsers() error {
+	if !s.bundle.Has(UsersFile) {
+		return nil
+	}
+
+	counts := &s.report.Users
+	var rows []export.ImportRow
+	var removed []User
+	// linked holds the rows of accounts given a sourcedId by link, by
+	// account ID
+	linked := make(map[int]export.ImportRow)
+	seen := make(map[string]int)
+	for _, user := range s.bundle.Users {
+		if user.SourcedID == "" {
+			s.fail(UsersFile, user.Line, "sourcedId", "is required")
+			continue
+		}
+		if line, ok := seen[user.SourcedID]; ok {
+			s.fail(UsersFile, user.Line, "sourcedId", "%q is also on line %d", user.SourcedID, line)
+			continue
+		}
+		seen[user.SourcedID] = user.Line
+
+		role, ok := accountRoles[strings.ToLower(user.Role)]
+		if !ok {
+			counts.Skipped++
+			continue
+		}
+		if isDeleted(user.Status) {
+			removed = append(removed, user)
+			continue
+		}
+
+		row := export.ImportRow{
+			Line:     user.Line,
+			IsActive: true,
+			Account: models.CreateAccountRequest{
+				Username:   user.Username,
+				Email:      user.Email,
+				FirstName:  user.GivenName,
+				LastName:   user.FamilyName,
+				Role:       role,
+				ExternalID: user.SourcedID,
+			},
+		}
+		if user.EnabledUser != "" {
+			enabled, err := strconv.ParseBool(user.EnabledUser)
+			if err != nil {
+				s.fail(UsersFile, user.Line, "enabledUser", "must be true or false")
+				continue
+			}
+			row.IsActive = enabled
+		}
+		// An account belongs to one school, the first of the user's orgs
+		// that is one
+		for _, org := range user.OrgSourcedIDs {
+			if school := s.school(org); school != nil {
+				row.Account.School = school.Name
+				break
+			}
+		}
+		if row.Account.School == "" {
+			s.warn(UsersFile, user.Line, "orgSourcedIds", "none of %s is a synced school, so the account has none",
+				strings.Join(user.OrgSourcedIDs, ", "))
+		}
+		if role == models.RoleStudent && len(user.Grades) > 0 {
+			if grade, ok := gradeNumber(user.Grades[0]); ok {
+				row.Account.Grade = grade
+			} else {
+				s.warn(UsersFile, user.Line, "grades", "grade %s is not one of K to 12 and is left blank", user.Grades[0])
+			}
+		}
+
+		accountID, err := s.link(&row)
+		if err != nil {
+			return err
+		}
+		rows = append(rows, row)
+		if accountID != 0 {
+			linked[accountID] = row
+		}
+	}
+
+	if len(rows) > 0 {
+		imported, err := export.NewExportService(s.tx).Import(rows, models.ImportOptions{
+			Mode:              models.ImportAllOrNothing,
+			MatchKey:          models.MatchExternalID,
+			Strategy:          models.ConflictOverwrite,
+			DeactivateMissing: s.mode == models.RosterSyncFull,
+		})
+		if err != nil {
+			return err
+		}
+		for _, rowErr := range imported.Errors {
+			s.fail(UsersFile, rowErr.Line, userColumns[rowErr.Field], "%s", rowErr.Message)
+		}
+		if len(imported.Errors) > 0 {
+			return nil
+		}
+
+		counts.Created += imported.Created
+		counts.Updated += imported.Updated
+		counts.Unchanged += imported.Unchanged
+		counts.Removed += imported.Deactivated
+		s.report.Changes = append(s.report.Changes, imported.Changes...)
+		s.addLinks(linked)
+	}
+
+	for _, user := range removed {
+		account := s.account(user.SourcedID)
+		if account == nil || !account.IsActive || account.Role == models.RoleSuperadmin {
+			counts.Unchanged++
+			continue
+		}
+		if _, err := s.tx.SetAccountActive(account.ID, false); err != nil {
+			return err
+		}
+		counts.Removed++
+		s.report.Changes = append(s.report.Changes, models.ImportChange{
+			Line:      user.Line,
+			Action:    models.ImportDeactivated,
+			AccountID: account.ID,
+			Username:  account.Username,
+			Fields:    []models.ImportFieldChange{{Field: "is_active", Old: true, New: false}},
+		})
+	}
+	return nil
+}
+
+// link gives the sourcedId of a row to the account with the row's email when
+// that account has none, as accounts made before the first sync do, so the
+// import updates it rather than refusing the email as taken. It returns the
+// ID of the account it linked, or 0.
+func (s *syncer) link(row *export.ImportRow) (int, error) {
+	if row.Account.Email == "" {
+		return 0, nil
+	}
+	if _, err := s.tx.GetAccountByExternalID(row.Account.ExternalID); err == nil {
+		return 0, nil
+	}
+	account, err := s.tx.GetAccountByEmail(row.Account.Email)
+	if err != nil || account.ExternalID != nil {
+		return 0, nil
+	}
+
+	externalID := row.Account.ExternalID
+	version := account.Version
+	_, err = s.tx.UpdateAccount(account.ID, models.UpdateAccountRequest{
+		FirstName:  account.FirstName,
+		LastName:   account.LastName,
+		Grade:      account.Grade,
+		School:     account.School,
+		SchoolID:   account.SchoolID,
+		IsActive:   account.IsActive,
+		Version:    &version,
+		ExternalID: &externalID,
+	})
+	if err != nil {
+		return 0, err
+	}
+	return account.ID, nil
+}
+
+// addLinks adds the sourcedIds link gave to the changes of the sync, which
+// the import saw as already set
+func (s *syncer) addLinks(linked map[int]export.ImportRow) {
+	for i := range s.report.Changes {
+		change := &s.report.Changes[i]
+		if row, ok := linked[change.AccountID]; ok && change.Action == models.ImportUpdated {
+			field := models.ImportFieldChange{Field: "external_id", Old: "", New: row.Account.ExternalID}
+			change.Fields = append([]models.ImportFieldChange{field}, change.Fields...)
+			delete(linked, change.AccountID)
+		}
+	}
+
+	var ids []int
+	for id := range linked {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+	for _, id := range ids {
+		row := linked[id]
+		s.report.Users.Unchanged--
+		s.report.Users.Updated++
+		s.report.Changes = append(s.report.Changes, models.ImportChange{
+			Line:      row.Line,
+			Action:    models.ImportUpdated,
+			AccountID: id,
+			Username:  row.Account.Username,
+			Fields:    []models.ImportFieldChange{{Field: "external_id", Old: "", New: row.Account.ExternalID}},
+		})
+	}
+}
+
+// syncClasses syncs the classrooms of classes.csv
+func (s *syncer) syncClasses() error {
+	if !s.bundle.Has(ClassesFile) {
+		return nil
+	}
+
+	counts := &s.report.Classes
+	seen := make(map[string]int)
+	for _, class := range s.bundle.Classes {
+		if class.SourcedID == "" {
+			s.fail(ClassesFile, class.Line, "sourcedId", "is required")
+			continue
+		}
+		if line, ok := seen[class.SourcedID]; ok {
+			s.fail(ClassesFile, class.Line, "sourcedId", "%q is also on line %d", class.SourcedID, line)
+			continue
+		}
+		seen[class.SourcedID] = class.Line
+
+		existing := s.class(class.SourcedID)
+		if isDeleted(class.Status) {
+			if existing == nil {
+				counts.Unchanged++
+				continue
+			}
+			if err := s.tx.DeleteClassroom(existing.ID); err != nil {
+				return err
+			}
+			s.classes[class.SourcedID] = nil
+			counts.Removed++
+			continue
+		}
+
+		school := s.school(class.SchoolSourcedID)
+		if school == nil {
+			s.fail(ClassesFile, class.Line, "schoolSourcedId", "%q is not a synced school", class.SchoolSourcedID)
+			continue
+		}
+		if class.Title == "" {
+			s.fail(ClassesFile, class.Line, "title", "is required")
+			continue
+		}
+		s.synced[school.ID] = true
+
+		req := models.ClassroomRequest{Name: class.Title}
+		if len(class.Grades) > 0 {
+			if grade, ok := gradeNumber(class.Grades[0]); ok {
+				req.Grade = grade
+			} else {
+				s.warn(ClassesFile, class.Line, "grades", "grade %s is not one of K to 12 and is left blank", class.Grades[0])
+			}
+		}
+
+		classroom, err := s.syncClass(class, existing, school, req)
+		if err != nil {
+			return err
+		}
+		if classroom != nil {
+			s.classes[class.SourcedID] = classroom
+		}
+	}
+
+	if s.mode != models.RosterSyncFull {
+		return nil
+	}
+
+	var schoolIDs []int
+	for id := range s.synced {
+		schoolIDs = append(schoolIDs, id)
+	}
+	sort.Ints(schoolIDs)
+	for _, id := range schoolIDs {
+		classrooms, err := s.tx.ListClassrooms(id)
+		if err != nil {
+			return err
+		}
+		for _, classroom := range classrooms {
+			if classroom.SourcedID == nil {
+				continue
+			}
+			if _, ok := seen[*classroom.SourcedID]; ok {
+				continue
+			}
+			if err := s.tx.DeleteClassroom(classroom.ID); err != nil {
+				return err
+			}
+			s.classes[*classroom.SourcedID] = nil
+			counts.Removed++
+		}
+	}
+	return nil
+}
+
+// syncClass creates or updates the classroom of a class. A classroom the
+// class was not synced to before is linked by name. It returns nil for a
+// class with an error.
+func (s *syncer) syncClass(class Class, existing *models.Classroom, school *models.School, req models.ClassroomRequest) (*models.Classroom, error) {
+	counts := &s.report.Classes
+	taken := func(err error) bool {
+		if errors.Is(err, database.ErrClassroomExists) {
+			s.fail(ClassesFile, class.Line, "title", "%q is the name of another classroom of the school", req.Name)
+			return true
+		}
+		return false
+	}
+
+	if existing == nil {
+		classrooms, err := s.tx.ListClassrooms(school.ID)
+		if err != nil {
+			return nil, err
+		}
+		for i := range classrooms {
+			if classrooms[i].SourcedID == nil && classrooms[i].Name == req.Name {
+				existing = &classrooms[i]
+				if err := s.tx.SetClassroomSourcedID(existing.ID, class.SourcedID); err != nil {
+					return nil, err
+				}
+				if existing.Grade == req.Grade {
+					counts.Updated++
+					return existing, nil
+				}
+				break
+			}
+		}
+	}
+
+	switch {
+	case existing == nil:
+		classroom, err := s.tx.CreateClassroom(school.ID, req)
+		if taken(err) {
+			return nil, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if err := s.tx.SetClassroomSourcedID(classroom.ID, class.SourcedID); err != nil {
+			return nil, err
+		}
+		counts.Created++
+		return classroom, nil
+	case existing.SchoolID != school.ID:
+		s.fail(ClassesFile, class.Line, "schoolSourcedId", "the class belongs to another school and cannot move")
+		return nil, nil
+	case existing.Name == req.Name && existing.Grade == req.Grade:
+		counts.Unchanged++
+		return existing, nil
+	}
+
+	classroom, err := s.tx.UpdateClassroom(existing.ID, req)
+	if taken(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	counts.Updated++
+	return classroom, nil
+}
+
+// syncEnrollments syncs the enrollments of enrollments.csv. An enrollment the
+// database refuses, such as a teacher's in a school the account does not
+// belong to, is left out with a warning.
+func (s *syncer) syncEnrollments() error {
+	if !s.bundle.Has(EnrollmentsFile) {
+		return nil
+	}
+
+	counts := &s.report.Enrollments
+	type key struct{ classroomID, accountID int }
+	seen := make(map[key]int)
+	// enrolled holds the roles in each classroom read so far, by account
+	enrolled := make(map[int]map[int]string)
+	load := func(classroomID int) (map[int]string, error) {
+		if roles, ok := enrolled[classroomID]; ok {
+			return roles, nil
+		}
+		enrollments, err := s.tx.GetEnrollments(classroomID)
+		if err != nil {
+			return nil, err
+		}
+		roles := make(map[int]string)
+		for _, enrollment := range enrollments {
+			roles[enrollment.AccountID] = enrollment.Role
+		}
+		enrolled[classroomID] = roles
+		return roles, nil
+	}
+
+	for _, enrollment := range s.bundle.Enrollments {
+		role, ok := enrollmentRoles[strings.ToLower(enrollment.Role)]
+		if !ok {
+			counts.Skipped++
+			continue
+		}
+		deleted := isDeleted(enrollment.Status)
+
+		classroom := s.class(enrollment.ClassSourcedID)
+		account := s.account(enrollment.UserSourcedID)
+		switch {
+		case deleted && (classroom == nil || account == nil):
+			counts.Unchanged++
+			continue
+		case classroom == nil:
+			s.fail(EnrollmentsFile, enrollment.Line, "classSourcedId", "%q is not a synced class", enrollment.ClassSourcedID)
+			continue
+		case account == nil:
+			s.fail(EnrollmentsFile, enrollment.Line, "userSourcedId", "%q is not a synced user", enrollment.UserSourcedID)
+			continue
+		}
+
+		k := key{classroom.ID, account.ID}
+		if line, ok := seen[k]; ok {
+			s.fail(EnrollmentsFile, enrollment.Line, "userSourcedId", "%s is also enrolled in the class on line %d", enrollment.UserSourcedID, line)
+			continue
+		}
+		seen[k] = enrollment.Line
+
+		roles, err := load(classroom.ID)
+		if err != nil {
+			return err
+		}
+		old, present := roles[account.ID]
+		if deleted {
+			if !present {
+				counts.Unchanged++
+				continue
+			}
+			if err := s.tx.Unenroll(classroom.ID, account.ID); err != nil {
+				return err
+			}
+			delete(roles, account.ID)
+			counts.Removed++
+			continue
+		}
+		if present && old == role {
+			counts.Unchanged++
+			continue
+		}
+
+		if _, err := s.tx.Enroll(classroom.ID, account.ID, role); err != nil {
+			if errors.Is(err, database.ErrWrongSchool) || errors.Is(err, database.ErrInvalidEnrollment) {
+				s.warn(EnrollmentsFile, enrollment.Line, "userSourcedId", "%s: %v", account.Username, err)
+				counts.Skipped++
+				continue
+			}
+			return err
+		}
+		roles[account.ID] = role
+		if present {
+			counts.Updated++
+		} else {
+			counts.Created++
+		}
+	}
+
+	if s.mode != models.RosterSyncFull {
+		return nil
+	}
+
+	// Every synced class the bundle mentions loses the enrollments it
+	// leaves out
+	var classroomIDs []int
+	for _, classroom := range s.classes {
+		if classroom != nil {
+			classroomIDs = append(classroomIDs, classroom.ID)
+		}
+	}
+	sort.Ints(classroomIDs)
+	for _, classroomID := range classroomIDs {
+		roles, err := load(classroomID)
+		if err != nil {
+			return err
+		}
+		var missing []int
+		for accountID := range roles {
+			if _, ok := seen[key{classroomID, accountID}]; !ok {
+				missing = append(missing, accountID)
+			}
+		}
+		sort.Ints(missing)
+		for _, accountID := range missing {
+			if err := s.tx.Unenroll(classroomID, accountID); err != nil {
+				return err
+			}
+			delete(roles, accountID)
+			counts.Removed++
+		}
+	}
+	return nil
+}
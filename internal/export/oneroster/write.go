@@ -0,0 +1,220 @@
+package oneroster
+
+import (
+	"archive/zip"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strconv"
+
+	"educational-game-db/internal/models"
+)
+
+// Headers of the files a bundle is written with, in the order OneRoster 1.1
+// gives their columns
+var (
+	manifestHeader = []string{"propertyName", "value"}
+	orgsHeader     = []string{"sourcedId", "status", "dateLastModified", "name", "type", "identifier", "parentSourcedId"}
+	usersHeader    = []string{
+		"sourcedId", "status", "dateLastModified", "enabledUser", "orgSourcedIds", "role", "username",
+		"userIds", "givenName", "familyName", "middleName", "identifier", "email", "sms", "phone",
+		"agentSourcedIds", "grades", "password",
+	}
+	classesHeader = []string{
+		"sourcedId", "status", "dateLastModified", "title", "grades", "courseSourcedId", "classCode",
+		"classType", "location", "schoolSourcedId", "termSourcedIds", "subjects", "subjectCodes", "periods",
+	}
+	enrollmentsHeader = []string{
+		"sourcedId", "status", "dateLastModified", "classSourcedId", "schoolSourcedId", "userSourcedId",
+		"role", "primary", "beginDate", "endDate",
+	}
+)
+
+// exportedRoles are the account roles written to users.csv, with their
+// OneRoster role
+var exportedRoles = map[string]string{
+	models.RoleStudent:     "student",
+	models.RoleTeacher:     "teacher",
+	models.RoleSchoolAdmin: "administrator",
+}
+
+// manifest lists the files of a written bundle
+func manifest() [][]string {
+	rows := [][]string{{"manifest.version", "1.0"}, {"oneroster.version", Version}}
+	for _, file := range []string{
+		"academicSessions", "categories", "classes", "classResources", "courses", "courseResources",
+		"demographics", "enrollments", "lineItems", "orgs", "resources", "results", "users",
+	} {
+		mode := fileAbsent
+		switch file + ".csv" {
+		case OrgsFile, UsersFile, ClassesFile, EnrollmentsFile:
+			mode = fileBulk
+		}
+		rows = append(rows, []string{"file." + file, mode})
+	}
+	return append(rows, []string{"source.systemName", "educational-game-db"})
+}
+
+// WriteBundle writes the schools, accounts, classrooms and enrollments of
+// one school, or of every school when schoolID is nil, to w as a bulk
+// OneRoster bundle. Records that were not synced from a student information
+// system are given sourcedIds made from their own IDs. Accounts without a
+// school, guardians and superadmins have no place in a roster and are left
+// out.
+func (s *Service) WriteBundle(w io.Writer, schoolID *int) error {
+	var schools []models.School
+	if schoolID != nil {
+		school, err := s.db.GetSchool(*schoolID)
+		if err != nil {
+			return err
+		}
+		schools = []models.School{*school}
+	} else {
+		var err error
+		if schools, err = s.db.ListSchools(); err != nil {
+			return err
+		}
+	}
+
+	archive := zip.NewWriter(w)
+	if err := writeFile(archive, ManifestFile, manifestHeader, func(write func([]string) error) error {
+		for _, row := range manifest() {
+			if err := write(row); err != nil {
+				return err
+			}
+		}
+		return nil
+	}); err != nil {
+		return err
+	}
+
+	orgIDs := make(map[int]string)
+	if err := writeFile(archive, OrgsFile, orgsHeader, func(write func([]string) error) error {
+		for _, school := range schools {
+			orgIDs[school.ID] = sourcedID(school.SourcedID, "school", school.ID)
+			if err := write([]string{orgIDs[school.ID], "", "", school.Name, "school", "", ""}); err != nil {
+				return err
+			}
+		}
+		return nil
+	}); err != nil {
+		return err
+	}
+
+	userIDs := make(map[int]string)
+	if err := writeFile(archive, UsersFile, usersHeader, func(write func([]string) error) error {
+		roles := []string{models.RoleStudent, models.RoleTeacher, models.RoleSchoolAdmin}
+		for _, school := range schools {
+			schoolID := school.ID
+			err := s.db.ForEachAccount(models.AccountListOptions{SchoolID: &schoolID, Roles: roles}, func(account *models.Account) error {
+				userIDs[account.ID] = sourcedID(account.ExternalID, "user", account.ID)
+				grades := ""
+				if account.Role == models.RoleStudent {
+					grades = gradeCode(account.Grade)
+				}
+				return write([]string{
+					userIDs[account.ID], "", "", strconv.FormatBool(account.IsActive), orgIDs[schoolID],
+					exportedRoles[account.Role], account.Username, "", account.FirstName, account.LastName,
+					"", "", account.Email, "", "", "", grades, "",
+				})
+			})
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}); err != nil {
+		return err
+	}
+
+	var classrooms []models.Classroom
+	for _, school := range schools {
+		list, err := s.db.ListClassrooms(school.ID)
+		if err != nil {
+			return err
+		}
+		classrooms = append(classrooms, list...)
+	}
+
+	classIDs := make(map[int]string)
+	if err := writeFile(archive, ClassesFile, classesHeader, func(write func([]string) error) error {
+		for _, classroom := range classrooms {
+			classIDs[classroom.ID] = sourcedID(classroom.SourcedID, "class", classroom.ID)
+			if err := write([]string{
+				classIDs[classroom.ID], "", "", classroom.Name, gradeCode(classroom.Grade), "", "",
+				"homeroom", "", orgIDs[classroom.SchoolID], "", "", "", "",
+			}); err != nil {
+				return err
+			}
+		}
+		return nil
+	}); err != nil {
+		return err
+	}
+
+	if err := writeFile(archive, EnrollmentsFile, enrollmentsHeader, func(write func([]string) error) error {
+		for _, classroom := range classrooms {
+			enrollments, err := s.db.GetEnrollments(classroom.ID)
+			if err != nil {
+				return err
+			}
+			for _, enrollment := range enrollments {
+				user, ok := userIDs[enrollment.AccountID]
+				if !ok {
+					continue
+				}
+				if err := write([]string{
+					fmt.Sprintf("enrollment-%d-%d", classroom.ID, enrollment.AccountID), "", "",
+					classIDs[classroom.ID], orgIDs[classroom.SchoolID], user, enrollment.Role, "", "", "",
+				}); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	}); err != nil {
+		return err
+	}
+
+	if err := archive.Close(); err != nil {
+		return fmt.Errorf("failed to write OneRoster bundle: %w", err)
+	}
+	return nil
+}
+
+// writeFile adds a CSV file to a bundle, with rows written by fill
+func writeFile(archive *zip.Writer, name string, header []string, fill func(write func([]string) error) error) error {
+	f, err := archive.Create(name)
+	if err != nil {
+		return fmt.Errorf("failed to write %s: %w", name, err)
+	}
+
+	writer := csv.NewWriter(f)
+	write := func(record []string) error {
+		if err := writer.Write(record); err != nil {
+			return fmt.Errorf("failed to write %s: %w", name, err)
+		}
+		return nil
+	}
+	if err := write(header); err != nil {
+		return err
+	}
+	if err := fill(write); err != nil {
+		return err
+	}
+
+	writer.Flush()
+	if err := writer.Error(); err != nil {
+		return fmt.Errorf("failed to write %s: %w", name, err)
+	}
+	return nil
+}
+
+// sourcedID returns the sourcedId a record was synced with, or one made
+// from its own ID
+func sourcedID(synced *string, kind string, id int) string {
+	if synced != nil && *synced != "" {
+		return *synced
+	}
+	return fmt.Sprintf("%s-%d", kind, id)
+}
@@ -0,0 +1,119 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+
+	"educational-game-db/internal/achievements"
+	"educational-game-db/internal/middleware"
+	"educational-game-db/internal/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// evaluateAchievements awards the badges an account has newly earned. Badge
+// failures are logged rather than failing the request that triggered them.
+func (h *Handler) evaluateAchievements(accountID int) []achievements.Badge {
+	if h.badges == nil {
+		return []achievements.Badge{}
+	}
+
+	awarded, err := h.badges.Evaluate(accountID)
+	if err != nil {
+		log.Printf("Failed to evaluate achievements of account %d: %v", accountID, err)
+	}
+	if awarded == nil {
+		awarded = []achievements.Badge{}
+	}
+	return awarded
+}
+
+// GetBadges returns the badge catalog
+func (h *Handler) GetBadges(c *gin.Context) {
+	if h.badges == nil {
+		c.JSON(http.StatusOK, gin.H{"badges": []achievements.Badge{}})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"badges": h.badges.Catalog().Badges})
+}
+
+// GetAchievements returns the badges an account has earned
+func (h *Handler) GetAchievements(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid account ID"})
+		return
+	}
+
+	if h.badges == nil {
+		c.JSON(http.StatusOK, gin.H{"achievements": []achievements.EarnedBadge{}})
+		return
+	}
+
+	earned, err := h.badges.Earned(id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"achievements": earned})
+}
+
+// AwardAchievement lets staff award any badge by hand, including manual-only ones
+func (h *Handler) AwardAchievement(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid account ID"})
+		return
+	}
+
+	var req models.AwardAchievementRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if h.badges == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "No badges are configured"})
+		return
+	}
+	if _, ok := h.badges.Catalog().Badge(req.BadgeID); !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Unknown badge"})
+		return
+	}
+
+	var awardedBy *int
+	if actor, ok := middleware.CurrentAccount(c); ok {
+		awardedBy = &actor.ID
+	}
+
+	added, err := h.badges.Award(id, req.BadgeID, awardedBy, req.Note)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if !added {
+		c.JSON(http.StatusConflict, gin.H{"error": "Account already holds this badge"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"message": "Badge awarded"})
+}
+
+// RevokeAchievement takes a badge away from an account
+func (h *Handler) RevokeAchievement(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid account ID"})
+		return
+	}
+
+	if err := h.db.RevokeAchievement(id, c.Param("badge")); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Badge revoked"})
+}
@@ -0,0 +1,261 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"educational-game-db/internal/achievements"
+	"educational-game-db/internal/auth"
+	"educational-game-db/internal/database"
+	"educational-game-db/internal/middleware"
+	"educational-game-db/internal/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// guardianProgressEvents is how many recent experience events a guardian sees
+const guardianProgressEvents = 20
+
+func writeGuardianError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, database.ErrNotGuardian), errors.Is(err, database.ErrNotStudent):
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+	case strings.Contains(err.Error(), "not found"):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
+
+// RegisterGuardian creates a guardian account
+func (h *Handler) RegisterGuardian(c *gin.Context) {
+	var req models.GuardianSignupRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	newAccount := models.CreateAccountRequest{
+		Username:  req.Username,
+		Email:     req.Email,
+		Password:  req.Password,
+		FirstName: req.FirstName,
+		LastName:  req.LastName,
+		Role:      models.RoleGuardian,
+	}
+	if !h.checkPassword(c, req.Password, &models.Account{
+		Username:  newAccount.Username,
+		Email:     newAccount.Email,
+		FirstName: newAccount.FirstName,
+		LastName:  newAccount.LastName,
+		Role:      newAccount.Role,
+	}) {
+		return
+	}
+
+	account, err := h.db.CreateAccount(newAccount)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, account)
+}
+
+// sendConsentRequest emails the guardian a pending student named a consent
+// code
+func (h *Handler) sendConsentRequest(student *models.Account, guardianEmail string) error {
+	token, expiresAt, err := h.tokens.NewConsentToken()
+	if err != nil {
+		return err
+	}
+	if err := h.db.SetConsentToken(student.ID, auth.HashToken(token), expiresAt); err != nil {
+		return err
+	}
+	return h.notifier.SendConsentRequest(student, guardianEmail, token, expiresAt)
+}
+
+// guardianAccount returns the signed-in guardian
+func guardianAccount(c *gin.Context) (*models.Account, bool) {
+	account, ok := middleware.CurrentAccount(c)
+	if !ok || account.Role != models.RoleGuardian {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Only guardian accounts can use this endpoint"})
+		return nil, false
+	}
+	return account, true
+}
+
+func children(accounts []models.Account) []models.Child {
+	result := make([]models.Child, 0, len(accounts))
+	for i := range accounts {
+		result = append(result, models.ChildFromAccount(&accounts[i]))
+	}
+	return result
+}
+
+// GetChildren lists a guardian's children, and the students waiting for the
+// guardian's consent
+func (h *Handler) GetChildren(c *gin.Context) {
+	guardian, ok := guardianAccount(c)
+	if !ok {
+		return
+	}
+
+	linked, err := h.db.GetChildren(guardian.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	pending, err := h.db.PendingConsents(guardian.Email)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"children": children(linked), "pending": children(pending)})
+}
+
+// GiveConsent records a guardian's consent for a student who named them at
+// sign-up, with the consent code emailed to them, or renews it for one of
+// their children
+func (h *Handler) GiveConsent(c *gin.Context) {
+	guardian, ok := guardianAccount(c)
+	if !ok {
+		return
+	}
+
+	studentID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid account ID"})
+		return
+	}
+
+	var req models.ConsentRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Anyone can register a guardian account with any email address, so
+	// only the code sent to the address the student gave proves who it is
+	allowed, err := h.db.IsGuardianOf(guardian.ID, studentID)
+	if err == nil && !allowed && req.Token != "" {
+		allowed, err = h.db.ConsentRequested(studentID, guardian.Email, auth.HashToken(req.Token))
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if !allowed {
+		c.JSON(http.StatusForbidden, gin.H{"error": "This student has not asked you for consent"})
+		return
+	}
+
+	link, err := h.db.RecordConsent(models.GuardianLink{
+		GuardianID:    guardian.ID,
+		StudentID:     studentID,
+		ConsentMethod: models.ConsentMethodOnline,
+		PolicyVersion: req.PolicyVersion,
+		RecordedBy:    guardian.ID,
+	})
+	if err != nil {
+		writeGuardianError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, link)
+}
+
+// GetChildProgress gives a guardian a read-only view of a child's progress
+func (h *Handler) GetChildProgress(c *gin.Context) {
+	guardian, ok := guardianAccount(c)
+	if !ok {
+		return
+	}
+
+	studentID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid account ID"})
+		return
+	}
+
+	linked, err := h.db.IsGuardianOf(guardian.ID, studentID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if !linked {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You are not a guardian of this student"})
+		return
+	}
+
+	student, err := h.db.GetAccountByID(studentID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	events, err := h.db.GetXPEvents(studentID, guardianProgressEvents)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	earned := []achievements.EarnedBadge{}
+	if h.badges != nil {
+		if earned, err = h.badges.Earned(studentID); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"child":         models.ChildFromAccount(student),
+		"next_level_xp": h.db.LevelCurve().XPForLevel(student.GameLevel + 1),
+		"recent_xp":     events,
+		"achievements":  earned,
+	})
+}
+
+// GetGuardians lists the guardians linked to a student and their consent
+func (h *Handler) GetGuardians(c *gin.Context) {
+	id, _ := strconv.Atoi(c.Param("id"))
+
+	links, err := h.db.GetGuardianLinks(id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"guardians": links})
+}
+
+// LinkGuardian lets staff record consent a guardian gave outside the app,
+// such as a signed form
+func (h *Handler) LinkGuardian(c *gin.Context) {
+	id, _ := strconv.Atoi(c.Param("id"))
+
+	var req models.LinkGuardianRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	link := models.GuardianLink{
+		GuardianID:    req.GuardianID,
+		StudentID:     id,
+		ConsentMethod: req.ConsentMethod,
+		PolicyVersion: req.PolicyVersion,
+	}
+	if actor, ok := middleware.CurrentAccount(c); ok {
+		link.RecordedBy = actor.ID
+	}
+
+	recorded, err := h.db.RecordConsent(link)
+	if err != nil {
+		writeGuardianError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, recorded)
+}
@@ -1,26 +1,59 @@
 package handlers
 
 import (
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"log"
 	"net/http"
 	"strconv"
+	"strings"
 	"time"
 
+	"educational-game-db/internal/achievements"
+	"educational-game-db/internal/auth"
 	"educational-game-db/internal/database"
 	"educational-game-db/internal/export"
+	"educational-game-db/internal/export/oneroster"
+	"educational-game-db/internal/middleware"
 	"educational-game-db/internal/models"
+	"educational-game-db/internal/notify"
 
 	"github.com/gin-gonic/gin"
 )
 
 type Handler struct {
-	db            *database.Database
+	db            database.Store
+	tokens        *auth.TokenService
+	badges        *achievements.Engine
 	exportService *export.ExportService
+	rosterService *oneroster.Service
+	notifier      notify.Notifier
+	limits        auth.LoginLimits
+	passwords     *auth.PasswordPolicy
+	// twoFactorRoles must use two-factor authentication
+	twoFactorRoles []string
+	// sso is the single sign-on identity provider, nil when not configured
+	sso             *auth.OIDCProvider
+	ssoProvisioning models.SSOProvisioning
 }
 
-func NewHandler(db *database.Database) *Handler {
+// NewHandler creates the API handlers. A nil notifier logs password reset
+// links and consent codes instead of delivering them.
+func NewHandler(db database.Store, tokens *auth.TokenService, badges *achievements.Engine, notifier notify.Notifier) *Handler {
+	if notifier == nil {
+		notifier = notify.Log{}
+	}
 	return &Handler{
 		db:            db,
+		tokens:        tokens,
+		badges:        badges,
 		exportService: export.NewExportService(db),
+		rosterService: oneroster.NewService(db),
+		notifier:      notifier,
+		limits:        auth.DefaultLoginLimits,
+		passwords:     auth.DefaultPasswordPolicy(),
 	}
 }
 
@@ -31,23 +64,237 @@ func (h *Handler) CreateAccount(c *gin.Context) {
 		return
 	}
 
+	// Young students signing themselves up wait for a guardian to consent
+	if models.RequiresGuardianConsent(req.Grade) {
+		req.ConsentStatus = models.ConsentPending
+	}
+
+	// Signing up joins an existing school; only those who manage schools
+	// may create one, through POST /schools
+	if principal, ok := middleware.CurrentPrincipal(c); !ok || !principal.Can(auth.PermSchoolsWrite) {
+		var err error
+		if req.SchoolID != nil {
+			_, err = h.db.GetSchool(*req.SchoolID)
+		} else if models.SchoolKey(req.School) != "" {
+			_, err = h.db.FindSchool(req.School)
+		}
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown school"})
+			return
+		}
+	}
+
+	if !h.checkPassword(c, req.Password, &models.Account{
+		Username:  req.Username,
+		Email:     req.Email,
+		FirstName: req.FirstName,
+		LastName:  req.LastName,
+		Role:      req.Role,
+		Grade:     req.Grade,
+	}) {
+		return
+	}
+
 	account, err := h.db.CreateAccount(req)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
+	if account.ConsentStatus == models.ConsentPending && req.GuardianEmail != "" {
+		if err := h.sendConsentRequest(account, req.GuardianEmail); err != nil {
+			log.Printf("Failed to send consent request for account %d: %v", account.ID, err)
+		}
+	}
+	h.evaluateAchievements(account.ID)
 
 	c.JSON(http.StatusCreated, account)
 }
 
 func (h *Handler) GetAccounts(c *gin.Context) {
-	accounts, err := h.db.GetAllAccounts()
+	principal, ok := middleware.CurrentPrincipal(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
+		return
+	}
+
+	opts, err := parseAccountListOptions(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Deleted accounts are only shown to those who may restore them
+	if opts.Deleted && !principal.Can(auth.PermAccountsDelete) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Insufficient permissions"})
+		return
+	}
+
+	// Only list the accounts the caller is allowed to act on
+	if !principal.RestrictListing(&opts) {
+		c.JSON(http.StatusOK, models.AccountPage{Accounts: []models.Account{}})
+		return
+	}
+
+	page, err := h.db.ListAccounts(opts)
+	if err != nil {
+		if errors.Is(err, database.ErrInvalidCursor) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	response := gin.H{
+		"accounts": page.Accounts,
+		"total":    page.Total,
+	}
+	if page.NextCursor != "" {
+		next := *c.Request.URL
+		query := next.Query()
+		query.Set("cursor", page.NextCursor)
+		next.RawQuery = query.Encode()
+
+		response["next_cursor"] = page.NextCursor
+		response["next"] = next.RequestURI()
+		c.Header("Link", "<"+next.RequestURI()+`>; rel="next"`)
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// SearchAccounts finds accounts by the start of their usernames, emails,
+// names or school, so "jo smi" finds John Smith
+func (h *Handler) SearchAccounts(c *gin.Context) {
+	principal, ok := middleware.CurrentPrincipal(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
+		return
+	}
+
+	query := strings.TrimSpace(c.Query("q"))
+	if query == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Search query q is required"})
+		return
+	}
+
+	var opts models.AccountListOptions
+	if value := c.Query("limit"); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "limit must be a positive integer"})
+			return
+		}
+		opts.Limit = limit
+	}
+
+	if !principal.RestrictListing(&opts) {
+		c.JSON(http.StatusOK, gin.H{"accounts": []models.Account{}})
+		return
+	}
+
+	accounts, err := h.db.SearchAccounts(query, opts)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
-	c.JSON(http.StatusOK, accounts)
+	c.JSON(http.StatusOK, gin.H{"accounts": accounts})
+}
+
+// parseAccountListOptions reads the filters, sort order and page of GET /api/accounts
+func parseAccountListOptions(c *gin.Context) (models.AccountListOptions, error) {
+	opts := models.AccountListOptions{
+		School: c.Query("school"),
+		Sort:   c.DefaultQuery("sort", "created_at"),
+		Cursor: c.Query("cursor"),
+	}
+	if !models.IsValidAccountSortKey(opts.Sort) {
+		return opts, fmt.Errorf("sort must be one of %s", strings.Join(models.AccountSortKeys, ", "))
+	}
+
+	switch order := c.DefaultQuery("order", ""); order {
+	case "":
+		opts.Descending = opts.Sort == "created_at"
+	case "asc", "desc":
+		opts.Descending = order == "desc"
+	default:
+		return opts, fmt.Errorf("order must be asc or desc")
+	}
+
+	if role := c.Query("role"); role != "" {
+		if !models.IsValidRole(role) {
+			return opts, fmt.Errorf("unknown role %q", role)
+		}
+		opts.Roles = []string{role}
+	}
+
+	ints := []struct {
+		name string
+		dest **int
+	}{
+		{"school_id", &opts.SchoolID},
+		{"classroom_id", &opts.ClassroomID},
+		{"grade", &opts.Grade},
+		{"min_level", &opts.MinLevel},
+		{"max_level", &opts.MaxLevel},
+	}
+	for _, param := range ints {
+		value := c.Query(param.name)
+		if value == "" {
+			continue
+		}
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return opts, fmt.Errorf("%s must be an integer", param.name)
+		}
+		*param.dest = &n
+	}
+
+	if value := c.Query("limit"); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit <= 0 {
+			return opts, fmt.Errorf("limit must be a positive integer")
+		}
+		opts.Limit = limit
+	}
+
+	if value := c.Query("is_active"); value != "" {
+		active, err := strconv.ParseBool(value)
+		if err != nil {
+			return opts, fmt.Errorf("is_active must be true or false")
+		}
+		opts.IsActive = &active
+	}
+
+	if value := c.Query("deleted"); value != "" {
+		deleted, err := strconv.ParseBool(value)
+		if err != nil {
+			return opts, fmt.Errorf("deleted must be true or false")
+		}
+		opts.Deleted = deleted
+	}
+
+	times := []struct {
+		name string
+		dest **time.Time
+	}{
+		{"created_after", &opts.CreatedAfter},
+		{"created_before", &opts.CreatedBefore},
+	}
+	for _, param := range times {
+		value := c.Query(param.name)
+		if value == "" {
+			continue
+		}
+		t, err := models.ParseListTime(value)
+		if err != nil {
+			return opts, fmt.Errorf("%s: %w", param.name, err)
+		}
+		*param.dest = &t
+	}
+
+	return opts, nil
 }
 
 func (h *Handler) GetAccount(c *gin.Context) {
@@ -64,9 +311,13 @@ func (h *Handler) GetAccount(c *gin.Context) {
 		return
 	}
 
+	c.Header("ETag", accountETag(account))
 	c.JSON(http.StatusOK, account)
 }
 
+// UpdateAccount overwrites an account's profile. With an If-Match header, or
+// a version in the body, the update is refused with 412 if the account has
+// changed since the client read it.
 func (h *Handler) UpdateAccount(c *gin.Context) {
 	idStr := c.Param("id")
 	id, err := strconv.Atoi(idStr)
@@ -81,15 +332,76 @@ func (h *Handler) UpdateAccount(c *gin.Context) {
 		return
 	}
 
+	// Students may edit their profile but not (de)activate themselves
+	if actor, ok := middleware.CurrentAccount(c); ok && actor.Role == models.RoleStudent {
+		req.IsActive = actor.IsActive
+	}
+
+	current, err := h.db.GetAccountByID(id)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	// The school decides whose accounts staff can reach, so only those who
+	// manage schools may move an account to another one
+	if principal, ok := middleware.CurrentPrincipal(c); !ok || !principal.Can(auth.PermSchoolsWrite) {
+		req.School = current.School
+		req.SchoolID = current.SchoolID
+	}
+
+	if ifMatch := c.GetHeader("If-Match"); ifMatch != "" {
+		if !etagMatches(ifMatch, accountETag(current)) {
+			accountChanged(c, current)
+			return
+		}
+		req.Version = &current.Version
+	}
+
 	account, err := h.db.UpdateAccount(id, req)
 	if err != nil {
+		if errors.Is(err, database.ErrAccountChanged) {
+			if current, err := h.db.GetAccountByID(id); err == nil {
+				accountChanged(c, current)
+				return
+			}
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
+	h.evaluateAchievements(account.ID)
 
+	c.Header("ETag", accountETag(account))
 	c.JSON(http.StatusOK, account)
 }
 
+// accountETag is the entity tag of an account's current version
+func accountETag(account *models.Account) string {
+	return strconv.Quote(strconv.Itoa(account.Version))
+}
+
+// etagMatches reports whether an If-Match header lists etag, using the
+// strong comparison If-Match calls for
+func etagMatches(ifMatch, etag string) bool {
+	for _, tag := range strings.Split(ifMatch, ",") {
+		tag = strings.TrimSpace(tag)
+		if tag == "*" || tag == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// accountChanged refuses an update based on an outdated version, sending the
+// current account so the client can redo its changes on top of it
+func accountChanged(c *gin.Context, current *models.Account) {
+	c.Header("ETag", accountETag(current))
+	c.JSON(http.StatusPreconditionFailed, gin.H{
+		"error":   database.ErrAccountChanged.Error() + "; reload it and try again",
+		"account": current,
+	})
+}
+
 func (h *Handler) DeleteAccount(c *gin.Context) {
 	idStr := c.Param("id")
 	id, err := strconv.Atoi(idStr)
@@ -107,8 +419,54 @@ func (h *Handler) DeleteAccount(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"message": "Account deleted successfully"})
 }
 
+// RestoreAccount brings back a deleted account before it is purged
+func (h *Handler) RestoreAccount(c *gin.Context) {
+	principal, ok := middleware.CurrentPrincipal(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
+		return
+	}
+
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid account ID"})
+		return
+	}
+
+	deleted, err := h.db.GetDeletedAccount(id)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Deleted account not found"})
+		return
+	}
+	if !principal.CanAccess(deleted) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You do not have access to this account"})
+		return
+	}
+
+	account, err := h.db.RestoreAccount(id)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, account)
+}
+
+// GetStats aggregates the accounts the caller may list, narrowed by the same
+// filters as GetAccounts, e.g. school_id or classroom_id
 func (h *Handler) GetStats(c *gin.Context) {
-	stats, err := h.db.GetAccountStats()
+	opts, err := parseAccountListOptions(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if principal, ok := middleware.CurrentPrincipal(c); ok && !principal.RestrictListing(&opts) {
+		c.JSON(http.StatusOK, models.AccountStats{})
+		return
+	}
+
+	stats, err := h.db.GetAccountStats(opts)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -121,6 +479,8 @@ func (h *Handler) Login(c *gin.Context) {
 	var req struct {
 		Username string `json:"username" binding:"required"`
 		Password string `json:"password" binding:"required"`
+		// Code is a TOTP or recovery code, for accounts with two-factor authentication
+		Code string `json:"code"`
 	}
 
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -128,70 +488,367 @@ func (h *Handler) Login(c *gin.Context) {
 		return
 	}
 
-	if h.db.VerifyPassword(req.Username, req.Password) {
-		account, err := h.db.GetAccountByUsername(req.Username)
+	now := time.Now()
+	until, err := h.db.LoginLockedUntil(req.Username, c.ClientIP(), now)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if !until.IsZero() {
+		h.refuseLockedLogin(c, req.Username, until, now)
+		return
+	}
+
+	if !h.db.VerifyPassword(req.Username, req.Password) {
+		h.recordLoginFailure(c, req.Username)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid credentials"})
+		return
+	}
+
+	account, err := h.db.GetAccountByUsername(req.Username)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get account"})
+		return
+	}
+
+	if !account.IsActive {
+		h.recordAuthEvent(req.Username, &account.ID, c.ClientIP(), models.AuthOutcomeDenied)
+		c.JSON(http.StatusForbidden, gin.H{"error": "Account is inactive"})
+		return
+	}
+
+	if account.AwaitingConsent() {
+		h.recordAuthEvent(req.Username, &account.ID, c.ClientIP(), models.AuthOutcomeDenied)
+		c.JSON(http.StatusForbidden, gin.H{"error": "Account is waiting for a guardian's consent"})
+		return
+	}
+
+	if account.TwoFactorEnabled {
+		if req.Code == "" {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Two-factor code required", "two_factor_required": true})
+			return
+		}
+
+		valid, err := h.verifySecondFactor(account, req.Code)
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get account"})
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if !valid {
+			h.recordLoginFailure(c, req.Username)
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid two-factor code", "two_factor_required": true})
 			return
 		}
-		c.JSON(http.StatusOK, gin.H{"message": "Login successful", "account": account})
-	} else {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid credentials"})
 	}
+
+	h.recordLoginSuccess(c, account)
+
+	message := "Login successful"
+	if account.MustResetPassword {
+		message = "Login successful; choose a new password to continue"
+	}
+	h.issueTokens(c, account, message)
 }
 
-// ExportCSV exports accounts to CSV format
-func (h *Handler) ExportCSV(c *gin.Context) {
-	filename := "accounts_export_" + time.Now().Format("2006-01-02_15-04-05") + ".csv"
+// RefreshToken exchanges a refresh token for a new access and refresh token pair
+func (h *Handler) RefreshToken(c *gin.Context) {
+	var req struct {
+		RefreshToken string `json:"refresh_token" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
 
-	err := h.exportService.ExportToCSV(filename)
+	refreshToken, expiresAt, err := h.tokens.NewRefreshToken()
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
-	c.Header("Content-Disposition", "attachment; filename="+filename)
-	c.Header("Content-Type", "text/csv")
-	c.File(filename)
+	accountID, err := h.db.RotateRefreshToken(auth.HashToken(req.RefreshToken), auth.HashToken(refreshToken), expiresAt)
+	if err != nil {
+		if errors.Is(err, database.ErrInvalidRefreshToken) {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	account, err := h.db.GetAccountByID(accountID)
+	if err != nil || !account.IsActive || account.AwaitingConsent() {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Account is not available"})
+		return
+	}
+
+	accessToken, accessExpiresAt, err := h.tokens.IssueAccessToken(account)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, tokenResponse(accessToken, accessExpiresAt, refreshToken, account))
 }
 
-// ExportJSON exports accounts to JSON format
-func (h *Handler) ExportJSON(c *gin.Context) {
-	filename := "accounts_export_" + time.Now().Format("2006-01-02_15-04-05") + ".json"
+// Logout revokes the presented refresh token
+func (h *Handler) Logout(c *gin.Context) {
+	var req struct {
+		RefreshToken string `json:"refresh_token" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := h.db.RevokeRefreshToken(auth.HashToken(req.RefreshToken)); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Logged out successfully"})
+}
+
+// GetMe returns the authenticated account, or the API key for service callers
+func (h *Handler) GetMe(c *gin.Context) {
+	principal, ok := middleware.CurrentPrincipal(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
+		return
+	}
+
+	if principal.APIKey != nil {
+		c.JSON(http.StatusOK, gin.H{"api_key": principal.APIKey})
+		return
+	}
 
-	err := h.exportService.ExportToJSON(filename)
+	c.JSON(http.StatusOK, principal.Account)
+}
+
+// issueTokens starts a new session for the account and writes the token response
+func (h *Handler) issueTokens(c *gin.Context, account *models.Account, message string) {
+	accessToken, accessExpiresAt, err := h.tokens.IssueAccessToken(account)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
-	c.Header("Content-Disposition", "attachment; filename="+filename)
-	c.Header("Content-Type", "application/json")
-	c.File(filename)
+	refreshToken, refreshExpiresAt, err := h.tokens.NewRefreshToken()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := h.db.CreateRefreshToken(account.ID, auth.HashToken(refreshToken), refreshExpiresAt); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	response := tokenResponse(accessToken, accessExpiresAt, refreshToken, account)
+	response["message"] = message
+	c.JSON(http.StatusOK, response)
+}
+
+func tokenResponse(accessToken string, expiresAt time.Time, refreshToken string, account *models.Account) gin.H {
+	return gin.H{
+		"access_token":  accessToken,
+		"token_type":    "Bearer",
+		"expires_in":    int(time.Until(expiresAt).Seconds()),
+		"refresh_token": refreshToken,
+		"account":       account,
+	}
+}
+
+// ExportCSV streams the accounts the caller may list as CSV, narrowed by the
+// same filters as GetAccounts
+func (h *Handler) ExportCSV(c *gin.Context) {
+	h.streamExport(c, "csv", "text/csv; charset=utf-8", h.exportService.WriteCSV)
+}
+
+// ExportJSON streams the accounts the caller may list as JSON, narrowed by the
+// same filters as GetAccounts
+func (h *Handler) ExportJSON(c *gin.Context) {
+	h.streamExport(c, "json", "application/json; charset=utf-8", h.exportService.WriteJSON)
+}
+
+// streamExport writes an export straight into the response, gzipped when the
+// client accepts it. Without a Content-Length the response is sent chunked as
+// it is written, so no file is made and the accounts are never all in memory.
+func (h *Handler) streamExport(c *gin.Context, extension, contentType string,
+	write func(io.Writer, models.AccountListOptions) (int, error)) {
+	principal, ok := middleware.CurrentPrincipal(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
+		return
+	}
+
+	opts, err := parseAccountListOptions(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if opts.Deleted && !principal.Can(auth.PermAccountsDelete) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Insufficient permissions"})
+		return
+	}
+	// Only export the accounts the caller is allowed to act on
+	if !principal.RestrictListing(&opts) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "None of the requested accounts are visible to you"})
+		return
+	}
+
+	filename := "accounts_export_" + time.Now().Format("2006-01-02_15-04-05") + "." + extension
+	header := c.Writer.Header()
+	header.Set("Content-Type", contentType)
+	header.Set("Content-Disposition", `attachment; filename="`+filename+`"`)
+	header.Set("Vary", "Accept-Encoding")
+
+	var out io.Writer = c.Writer
+	var gz *gzip.Writer
+	if acceptsGzip(c.GetHeader("Accept-Encoding")) {
+		header.Set("Content-Encoding", "gzip")
+		gz = gzip.NewWriter(c.Writer)
+		out = gz
+	}
+
+	count, err := write(out, opts)
+	if err == nil && gz != nil {
+		err = gz.Close()
+	}
+	if err != nil {
+		if !c.Writer.Written() {
+			header.Del("Content-Encoding")
+			header.Del("Content-Disposition")
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		log.Printf("Export failed after %d accounts: %v", count, err)
+		abortStream(c)
+	}
+}
+
+// abortStream drops the connection of a response that failed part-way, as it
+// is too late for an error status. Ending the response normally would make a
+// truncated download look complete.
+func abortStream(c *gin.Context) {
+	c.Abort()
+	// Only HTTP/1 connections can be taken over from the server
+	if c.Request.ProtoMajor != 1 {
+		return
+	}
+	if conn, _, err := c.Writer.Hijack(); err == nil {
+		conn.Close()
+	}
 }
 
-// ImportCSV imports accounts from uploaded CSV file
+// acceptsGzip reports whether an Accept-Encoding header allows gzip
+func acceptsGzip(acceptEncoding string) bool {
+	for _, coding := range strings.Split(acceptEncoding, ",") {
+		name, params, _ := strings.Cut(strings.TrimSpace(coding), ";")
+		if strings.TrimSpace(name) != "gzip" {
+			continue
+		}
+		return strings.ReplaceAll(strings.TrimSpace(params), " ", "") != "q=0"
+	}
+	return false
+}
+
+// ImportCSV imports accounts from an uploaded CSV file
 func (h *Handler) ImportCSV(c *gin.Context) {
-	file, header, err := c.Request.FormFile("file")
+	h.runImport(c, h.exportService.ImportCSV)
+}
+
+// ImportJSON imports accounts from an uploaded JSON file
+func (h *Handler) ImportJSON(c *gin.Context) {
+	if c.Request.FormValue("mapping") != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Import mappings only apply to CSV imports"})
+		return
+	}
+	h.runImport(c, h.exportService.ImportJSON)
+}
+
+// runImport imports the uploaded file with the mode, dry_run, match_key,
+// strategy, deactivate_missing and mapping given as query or form parameters,
+// answering with the import report. The upload is
+// read as it arrives rather than saved, and accounts outside the school of a
+// school admin are refused.
+func (h *Handler) runImport(c *gin.Context, importFile func(io.Reader, models.ImportOptions) (*models.ImportReport, error)) {
+	principal, ok := middleware.CurrentPrincipal(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
+		return
+	}
+
+	file, _, err := c.Request.FormFile("file")
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "No file uploaded"})
 		return
 	}
 	defer file.Close()
 
-	// Save uploaded file temporarily
-	tempFilename := "temp_import_" + time.Now().Format("20060102_150405") + ".csv"
-	if err := c.SaveUploadedFile(header, tempFilename); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save uploaded file"})
+	opts := models.ImportOptions{
+		Mode:     c.Request.FormValue("mode"),
+		MatchKey: c.Request.FormValue("match_key"),
+		Strategy: c.Request.FormValue("strategy"),
+	}
+	if value := c.Request.FormValue("dry_run"); value != "" {
+		if opts.DryRun, err = strconv.ParseBool(value); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "dry_run must be true or false"})
+			return
+		}
+	}
+	if value := c.Request.FormValue("deactivate_missing"); value != "" {
+		if opts.DeactivateMissing, err = strconv.ParseBool(value); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "deactivate_missing must be true or false"})
+			return
+		}
+	}
+	if opts.Mode != "" && !models.IsValidImportMode(opts.Mode) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "mode must be " + models.ImportAllOrNothing + " or " + models.ImportBestEffort})
 		return
 	}
+	if opts.MatchKey != "" && !models.IsValidMatchKey(opts.MatchKey) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "match_key must be " + models.MatchUsername + ", " + models.MatchEmail + " or " + models.MatchExternalID})
+		return
+	}
+	if opts.Strategy != "" && !models.IsValidConflictStrategy(opts.Strategy) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "strategy must be " + models.ConflictSkip + ", " + models.ConflictOverwrite + " or " + models.ConflictMerge})
+		return
+	}
+	if opts.DeactivateMissing && opts.MatchKey == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "deactivate_missing needs a match_key"})
+		return
+	}
+	if name := c.Request.FormValue("mapping"); name != "" {
+		if opts.Mapping, err = h.db.GetImportMapping(name); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown import mapping: " + name})
+			return
+		}
+	}
 
-	// Import from the temporary file
-	err = h.exportService.ImportFromCSV(tempFilename)
+	if principal.Account != nil && principal.Account.Role != models.RoleSuperadmin {
+		if principal.Account.School == "" {
+			c.JSON(http.StatusForbidden, gin.H{"error": "You must belong to a school to import accounts"})
+			return
+		}
+		opts.School = principal.Account.School
+	}
+
+	report, err := importFile(file, opts)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		status := http.StatusInternalServerError
+		if errors.Is(err, export.ErrInvalidFile) {
+			status = http.StatusBadRequest
+		}
+		c.JSON(status, gin.H{"error": err.Error()})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"message": "Accounts imported successfully"})
+	status := http.StatusOK
+	if !report.DryRun && report.Mode == models.ImportAllOrNothing && len(report.Errors) > 0 {
+		status = http.StatusUnprocessableEntity
+	}
+	c.JSON(status, report)
 }
@@ -2,12 +2,25 @@ package handlers
 
 import (
 	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/csv"
 	"encoding/json"
+	"fmt"
+	"mime/multipart"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
 	"testing"
+	"time"
 
+	"educational-game-db/internal/achievements"
+	"educational-game-db/internal/auth"
+	"educational-game-db/internal/auth/oidctest"
 	"educational-game-db/internal/database"
+	"educational-game-db/internal/middleware"
 	"educational-game-db/internal/models"
 
 	"github.com/gin-gonic/gin"
@@ -18,11 +31,30 @@ func setupTestHandler() (*Handler, *database.Database) {
 	db, _ := database.NewDatabase(":memory:")
 
 	// Create handler
-	handler := NewHandler(db)
+	catalog, _ := achievements.DefaultCatalog()
+	handler := NewHandler(db, auth.NewTokenService([]byte("test-secret")), achievements.NewEngine(catalog, db), nil)
 
 	return handler, db
 }
 
+// teachClass puts teacher in charge of a new classroom of their school and
+// enrolls the given students, skipping any from other schools
+func teachClass(t *testing.T, db *database.Database, teacher *models.Account, studentIDs ...int) *models.Classroom {
+	t.Helper()
+
+	classroom, err := db.CreateClassroom(*teacher.SchoolID, models.ClassroomRequest{Name: fmt.Sprintf("Class of %s", teacher.Username)})
+	if err != nil {
+		t.Fatalf("Failed to create classroom: %v", err)
+	}
+	if _, err := db.Enroll(classroom.ID, teacher.ID, models.EnrollmentTeacher); err != nil {
+		t.Fatalf("Failed to enroll teacher: %v", err)
+	}
+	for _, id := range studentIDs {
+		_, _ = db.Enroll(classroom.ID, id, models.EnrollmentStudent)
+	}
+	return classroom
+}
+
 func TestCreateAccountHandler(t *testing.T) {
 	handler, db := setupTestHandler()
 	defer db.Close()
@@ -30,11 +62,15 @@ func TestCreateAccountHandler(t *testing.T) {
 	// Set gin to test mode
 	gin.SetMode(gin.TestMode)
 
+	if _, err := db.CreateSchool("Test School"); err != nil {
+		t.Fatalf("Failed to create school: %v", err)
+	}
+
 	// Create request payload
 	req := models.CreateAccountRequest{
 		Username:  "testuser",
 		Email:     "test@example.com",
-		Password:  "password123",
+		Password:  "purple-otter-51",
 		FirstName: "Test",
 		LastName:  "User",
 		Grade:     5,
@@ -72,6 +108,21 @@ func TestCreateAccountHandler(t *testing.T) {
 	if response.Username != req.Username {
 		t.Errorf("Expected username %s, got %s", req.Username, response.Username)
 	}
+
+	// Signing up cannot create a school
+	req.Username, req.Email, req.School = "newschool", "new@example.com", "Made Up Academy"
+	jsonData, _ = json.Marshal(req)
+	w = httptest.NewRecorder()
+	c, _ = gin.CreateTestContext(w)
+	c.Request, _ = http.NewRequest("POST", "/accounts", bytes.NewBuffer(jsonData))
+	c.Request.Header.Set("Content-Type", "application/json")
+	handler.CreateAccount(c)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected an unknown school to be rejected, got %d: %s", w.Code, w.Body.String())
+	}
+	if _, err := db.FindSchool("Made Up Academy"); err == nil {
+		t.Error("Expected no school to be created")
+	}
 }
 
 func TestCreateAccountHandlerInvalidData(t *testing.T) {
@@ -146,6 +197,256 @@ func TestGetAccountHandler(t *testing.T) {
 	}
 }
 
+func TestUpdateAccountIfMatch(t *testing.T) {
+	handler, db := setupTestHandler()
+	defer db.Close()
+
+	gin.SetMode(gin.TestMode)
+
+	account, _ := db.CreateAccount(models.CreateAccountRequest{Username: "etag", Email: "etag@example.com", Password: "password123", FirstName: "Ed"})
+	params := gin.Params{{Key: "id", Value: strconv.Itoa(account.ID)}}
+
+	perform := func(method, ifMatch, body string, fn gin.HandlerFunc) *httptest.ResponseRecorder {
+		httpReq, _ := http.NewRequest(method, "/api/accounts/"+strconv.Itoa(account.ID), strings.NewReader(body))
+		httpReq.Header.Set("Content-Type", "application/json")
+		if ifMatch != "" {
+			httpReq.Header.Set("If-Match", ifMatch)
+		}
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httpReq
+		c.Params = params
+		middleware.SetCurrentAccount(c, &models.Account{ID: 999, Role: models.RoleSuperadmin})
+		fn(c)
+		return w
+	}
+
+	etag := perform("GET", "", "", handler.GetAccount).Header().Get("ETag")
+	if etag == "" {
+		t.Fatal("Expected an ETag on the account")
+	}
+
+	// The dashboard saves first; the PWA's edit is based on what it read before
+	w := perform("PUT", etag, `{"first_name": "Edward", "is_active": true}`, handler.UpdateAccount)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+	newETag := w.Header().Get("ETag")
+	if newETag == etag {
+		t.Error("Expected the ETag to change with the update")
+	}
+
+	w = perform("PUT", etag, `{"first_name": "Eddie", "is_active": true}`, handler.UpdateAccount)
+	if w.Code != http.StatusPreconditionFailed {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusPreconditionFailed, w.Code, w.Body.String())
+	}
+	if w.Header().Get("ETag") != newETag {
+		t.Errorf("Expected the current ETag %s with the conflict, got %s", newETag, w.Header().Get("ETag"))
+	}
+
+	w = perform("PUT", "", fmt.Sprintf(`{"first_name": "Eddie", "is_active": true, "version": %d}`, account.Version), handler.UpdateAccount)
+	if w.Code != http.StatusPreconditionFailed {
+		t.Errorf("Expected a stale version in the body to be refused, got %d", w.Code)
+	}
+
+	if w := perform("PUT", `"nope", `+newETag, `{"first_name": "Eddie", "is_active": true}`, handler.UpdateAccount); w.Code != http.StatusOK {
+		t.Errorf("Expected any listed ETag to match, got %d: %s", w.Code, w.Body.String())
+	}
+	if got, _ := db.GetAccountByID(account.ID); got.FirstName != "Eddie" {
+		t.Errorf("Expected the matching update to apply, got %q", got.FirstName)
+	}
+}
+
+func TestUpdateAccountKeepsSchool(t *testing.T) {
+	handler, db := setupTestHandler()
+	defer db.Close()
+
+	gin.SetMode(gin.TestMode)
+
+	admin, _ := db.CreateAccount(models.CreateAccountRequest{Username: "alpha_admin", Email: "aa@example.com", Password: "password123", School: "Alpha"})
+	admin, _ = db.SetAccountRole(admin.ID, models.RoleSchoolAdmin)
+
+	perform := func(actor *models.Account, body string) *httptest.ResponseRecorder {
+		httpReq, _ := http.NewRequest("PUT", "/api/accounts/"+strconv.Itoa(admin.ID), strings.NewReader(body))
+		httpReq.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httpReq
+		c.Params = gin.Params{{Key: "id", Value: strconv.Itoa(admin.ID)}}
+		middleware.SetCurrentAccount(c, actor)
+		handler.UpdateAccount(c)
+		return w
+	}
+
+	// A school admin moving themselves would reach another school's accounts
+	if w := perform(admin, `{"first_name": "Ann", "school": "Beta", "is_active": true}`); w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+	got, _ := db.GetAccountByID(admin.ID)
+	if got.FirstName != "Ann" || got.School != "Alpha" || *got.SchoolID != *admin.SchoolID {
+		t.Errorf("Expected the name to change and the school to stay Alpha, got %q at %q", got.FirstName, got.School)
+	}
+	if _, err := db.FindSchool("Beta"); err == nil {
+		t.Error("Expected no school to be created")
+	}
+
+	superadmin := &models.Account{ID: 999, Role: models.RoleSuperadmin}
+	if w := perform(superadmin, `{"first_name": "Ann", "school": "Beta", "is_active": true}`); w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+	if got, _ := db.GetAccountByID(admin.ID); got.School != "Beta" {
+		t.Errorf("Expected a superadmin to move the account to Beta, got %q", got.School)
+	}
+}
+
+func TestExportCSVHandler(t *testing.T) {
+	handler, db := setupTestHandler()
+	defer db.Close()
+
+	gin.SetMode(gin.TestMode)
+
+	admin, _ := db.CreateAccount(models.CreateAccountRequest{Username: "admin", Email: "admin@example.com", Password: "password123", School: "School A"})
+	admin, _ = db.SetAccountRole(admin.ID, models.RoleSchoolAdmin)
+	db.CreateAccount(models.CreateAccountRequest{Username: "pupil", Email: "pupil@example.com", Password: "password123", School: "School A"})
+	db.CreateAccount(models.CreateAccountRequest{Username: "other", Email: "other@example.com", Password: "password123", School: "School B"})
+
+	httpReq, _ := http.NewRequest("GET", "/api/export/csv", nil)
+	httpReq.Header.Set("Accept-Encoding", "gzip, deflate")
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httpReq
+	middleware.SetCurrentAccount(c, admin)
+
+	handler.ExportCSV(c)
+
+	if w.Code != http.StatusOK || w.Header().Get("Content-Encoding") != "gzip" {
+		t.Fatalf("Expected a gzipped export, got %d %v: %s", w.Code, w.Header(), w.Body.String())
+	}
+	gz, err := gzip.NewReader(w.Body)
+	if err != nil {
+		t.Fatalf("Export is not gzipped: %v", err)
+	}
+	records, err := csv.NewReader(gz).ReadAll()
+	if err != nil {
+		t.Fatalf("Export is not valid CSV: %v", err)
+	}
+	// The header, the admin and their student, but not another school's account
+	if len(records) != 3 || records[1][1] != "admin" || records[2][1] != "pupil" {
+		t.Errorf("Expected the school's 2 accounts, got %v", records)
+	}
+}
+
+func TestImportCSVHandler(t *testing.T) {
+	handler, db := setupTestHandler()
+	defer db.Close()
+
+	gin.SetMode(gin.TestMode)
+
+	admin, _ := db.CreateAccount(models.CreateAccountRequest{Username: "admin", Email: "admin@example.com", Password: "password123", School: "School A"})
+	admin, _ = db.SetAccountRole(admin.ID, models.RoleSchoolAdmin)
+
+	upload := func(query, file string) (int, models.ImportReport) {
+		var body bytes.Buffer
+		form := multipart.NewWriter(&body)
+		part, _ := form.CreateFormFile("file", "accounts.csv")
+		part.Write([]byte(file))
+		form.Close()
+
+		httpReq, _ := http.NewRequest("POST", "/api/export/csv?"+query, &body)
+		httpReq.Header.Set("Content-Type", form.FormDataContentType())
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httpReq
+		middleware.SetCurrentAccount(c, admin)
+
+		handler.ImportCSV(c)
+
+		var report models.ImportReport
+		json.Unmarshal(w.Body.Bytes(), &report)
+		return w.Code, report
+	}
+
+	const file = "ID,Username,Email,FirstName,LastName,Grade,School,GameLevel,Experience,CreatedAt,UpdatedAt,IsActive\n" +
+		",pupil,pupil@example.com,,,3,,,,,,\n" +
+		",other,other@example.com,,,3,School B,,,,,\n"
+
+	// A school admin may only import into their own school
+	code, report := upload("", file)
+	if code != http.StatusUnprocessableEntity || report.Committed || len(report.Errors) != 1 || report.Errors[0].Line != 3 {
+		t.Fatalf("Expected 422 with an error on line 3, got %d %+v", code, report)
+	}
+
+	code, report = upload("mode=best_effort", file)
+	if code != http.StatusOK || !report.Committed || report.Created != 1 {
+		t.Fatalf("Expected the good row to be imported, got %d %+v", code, report)
+	}
+	if pupil, err := db.GetAccountByUsername("pupil"); err != nil || pupil.School != "School A" {
+		t.Errorf("Expected pupil to be put in the admin's school, got %+v, %v", pupil, err)
+	}
+
+	if code, _ := upload("mode=sometimes", file); code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for an unknown mode, got %d", code)
+	}
+}
+
+func TestOneRosterHandlers(t *testing.T) {
+	handler, db := setupTestHandler()
+	defer db.Close()
+
+	gin.SetMode(gin.TestMode)
+
+	admin, _ := db.CreateAccount(models.CreateAccountRequest{Username: "admin", Email: "admin@example.com", Password: "password123"})
+	admin, _ = db.SetAccountRole(admin.ID, models.RoleSuperadmin)
+	db.CreateAccount(models.CreateAccountRequest{Username: "pupil", Email: "pupil@example.com", Password: "password123", Grade: 3, School: "School A"})
+
+	httpReq, _ := http.NewRequest("GET", "/api/export/oneroster", nil)
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httpReq
+	middleware.SetCurrentAccount(c, admin)
+
+	handler.ExportOneRoster(c)
+
+	if w.Code != http.StatusOK || w.Header().Get("Content-Type") != "application/zip" {
+		t.Fatalf("Expected a zip, got %d %s", w.Code, w.Body.String())
+	}
+	bundle := w.Body.Bytes()
+
+	upload := func(query string, file []byte) (int, models.RosterSyncReport) {
+		var body bytes.Buffer
+		form := multipart.NewWriter(&body)
+		part, _ := form.CreateFormFile("file", "oneroster.zip")
+		part.Write(file)
+		form.Close()
+
+		httpReq, _ := http.NewRequest("POST", "/api/export/oneroster?"+query, &body)
+		httpReq.Header.Set("Content-Type", form.FormDataContentType())
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httpReq
+		middleware.SetCurrentAccount(c, admin)
+
+		handler.SyncOneRoster(c)
+
+		var report models.RosterSyncReport
+		json.Unmarshal(w.Body.Bytes(), &report)
+		return w.Code, report
+	}
+
+	// The export syncs back, linking the school and pupil it made sourcedIds for
+	code, report := upload("dry_run=true", bundle)
+	if code != http.StatusOK || len(report.Errors) != 0 || report.Committed || report.Users.Updated != 1 {
+		t.Fatalf("Expected a dry run linking pupil, got %d %+v", code, report)
+	}
+
+	if code, _ := upload("", []byte("not a zip")); code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for a file that is not a zip, got %d", code)
+	}
+	if code, _ := upload("mode=sometimes", bundle); code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for an unknown mode, got %d", code)
+	}
+}
+
 func TestGetAccountHandlerNotFound(t *testing.T) {
 	handler, db := setupTestHandler()
 	defer db.Close()
@@ -187,6 +488,7 @@ func TestGetAccountsHandler(t *testing.T) {
 	w := httptest.NewRecorder()
 	c, _ := gin.CreateTestContext(w)
 	c.Request = httpReq
+	middleware.SetCurrentAccount(c, &models.Account{ID: 999, Role: models.RoleSuperadmin})
 
 	handler.GetAccounts(c)
 
@@ -194,14 +496,17 @@ func TestGetAccountsHandler(t *testing.T) {
 		t.Errorf("Expected status %d, got %d", http.StatusOK, w.Code)
 	}
 
-	var response []models.Account
+	var response models.AccountPage
 	err := json.Unmarshal(w.Body.Bytes(), &response)
 	if err != nil {
 		t.Fatalf("Failed to parse response: %v", err)
 	}
 
-	if len(response) != len(accounts) {
-		t.Errorf("Expected %d accounts, got %d", len(accounts), len(response))
+	if len(response.Accounts) != len(accounts) {
+		t.Errorf("Expected %d accounts, got %d", len(accounts), len(response.Accounts))
+	}
+	if response.Total != len(accounts) {
+		t.Errorf("Expected total %d, got %d", len(accounts), response.Total)
 	}
 }
 
@@ -244,3 +549,1073 @@ func TestGetStatsHandler(t *testing.T) {
 		t.Error("Expected total_accounts in response")
 	}
 }
+
+func performLogin(t *testing.T, handler *Handler, username, password string) (*httptest.ResponseRecorder, map[string]interface{}) {
+	t.Helper()
+
+	jsonData, _ := json.Marshal(map[string]string{"username": username, "password": password})
+	httpReq, _ := http.NewRequest("POST", "/login", bytes.NewBuffer(jsonData))
+	httpReq.Header.Set("Content-Type", "application/json")
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httpReq
+
+	handler.Login(c)
+
+	var response map[string]interface{}
+	_ = json.Unmarshal(w.Body.Bytes(), &response)
+	return w, response
+}
+
+func TestLoginIssuesTokens(t *testing.T) {
+	handler, db := setupTestHandler()
+	defer db.Close()
+
+	gin.SetMode(gin.TestMode)
+
+	_, _ = db.CreateAccount(models.CreateAccountRequest{
+		Username: "loginuser", Email: "login@example.com", Password: "password123",
+	})
+
+	w, response := performLogin(t, handler, "loginuser", "password123")
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d", http.StatusOK, w.Code)
+	}
+
+	accessToken, _ := response["access_token"].(string)
+	if accessToken == "" {
+		t.Fatal("Expected access_token in response")
+	}
+	if response["refresh_token"] == nil {
+		t.Fatal("Expected refresh_token in response")
+	}
+
+	claims, err := handler.tokens.ParseAccessToken(accessToken)
+	if err != nil {
+		t.Fatalf("Failed to parse issued access token: %v", err)
+	}
+	if claims.Username != "loginuser" {
+		t.Errorf("Expected username claim loginuser, got %s", claims.Username)
+	}
+}
+
+func TestLoginInvalidCredentials(t *testing.T) {
+	handler, db := setupTestHandler()
+	defer db.Close()
+
+	gin.SetMode(gin.TestMode)
+
+	_, _ = db.CreateAccount(models.CreateAccountRequest{
+		Username: "loginuser", Email: "login@example.com", Password: "password123",
+	})
+
+	w, _ := performLogin(t, handler, "loginuser", "wrongpassword")
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected status %d, got %d", http.StatusUnauthorized, w.Code)
+	}
+}
+
+func TestRefreshTokenRotation(t *testing.T) {
+	handler, db := setupTestHandler()
+	defer db.Close()
+
+	gin.SetMode(gin.TestMode)
+
+	_, _ = db.CreateAccount(models.CreateAccountRequest{
+		Username: "refreshuser", Email: "refresh@example.com", Password: "password123",
+	})
+
+	_, login := performLogin(t, handler, "refreshuser", "password123")
+	original, _ := login["refresh_token"].(string)
+
+	refresh := func(token string) *httptest.ResponseRecorder {
+		jsonData, _ := json.Marshal(map[string]string{"refresh_token": token})
+		httpReq, _ := http.NewRequest("POST", "/token/refresh", bytes.NewBuffer(jsonData))
+		httpReq.Header.Set("Content-Type", "application/json")
+
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httpReq
+		handler.RefreshToken(c)
+		return w
+	}
+
+	w := refresh(original)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d", http.StatusOK, w.Code)
+	}
+
+	var rotated map[string]interface{}
+	_ = json.Unmarshal(w.Body.Bytes(), &rotated)
+	replacement, _ := rotated["refresh_token"].(string)
+	if replacement == "" || replacement == original {
+		t.Fatal("Expected a new refresh token after rotation")
+	}
+
+	// Reusing the rotated token must fail and revoke the replacement too
+	if w := refresh(original); w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected status %d when reusing a refresh token, got %d", http.StatusUnauthorized, w.Code)
+	}
+	if w := refresh(replacement); w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected status %d after token reuse was detected, got %d", http.StatusUnauthorized, w.Code)
+	}
+}
+
+func TestGetAccountsHandlerScopedToSchool(t *testing.T) {
+	handler, db := setupTestHandler()
+	defer db.Close()
+
+	gin.SetMode(gin.TestMode)
+
+	accounts := []models.CreateAccountRequest{
+		{Username: "teacher", Email: "teacher@example.com", Password: "password123", School: "School A"},
+		{Username: "studenta", Email: "studenta@example.com", Password: "password123", School: "School A"},
+		{Username: "studentb", Email: "studentb@example.com", Password: "password123", School: "School B"},
+	}
+
+	for _, req := range accounts {
+		_, _ = db.CreateAccount(req)
+	}
+
+	teacher, err := db.SetAccountRole(1, models.RoleTeacher)
+	if err != nil {
+		t.Fatalf("Failed to set role: %v", err)
+	}
+	teachClass(t, db, teacher, 2, 3)
+
+	httpReq, _ := http.NewRequest("GET", "/accounts", nil)
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httpReq
+	middleware.SetCurrentAccount(c, teacher)
+
+	handler.GetAccounts(c)
+
+	var response models.AccountPage
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatalf("Failed to parse response: %v", err)
+	}
+
+	if len(response.Accounts) != 2 {
+		t.Fatalf("Expected 2 accounts (self and own student), got %d", len(response.Accounts))
+	}
+	for _, account := range response.Accounts {
+		if account.School != "School A" {
+			t.Errorf("Teacher should not see account %s from %s", account.Username, account.School)
+		}
+	}
+}
+
+func TestGetAccountsHandlerPagination(t *testing.T) {
+	handler, db := setupTestHandler()
+	defer db.Close()
+
+	gin.SetMode(gin.TestMode)
+
+	for i := 1; i <= 5; i++ {
+		_, _ = db.CreateAccount(models.CreateAccountRequest{
+			Username: fmt.Sprintf("page%d", i),
+			Email:    fmt.Sprintf("page%d@example.com", i),
+			Password: "password123",
+			Grade:    i % 2,
+			School:   "Test School",
+		})
+	}
+
+	list := func(target string) (*httptest.ResponseRecorder, map[string]interface{}) {
+		httpReq, _ := http.NewRequest("GET", target, nil)
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httpReq
+		middleware.SetCurrentAccount(c, &models.Account{ID: 999, Role: models.RoleSuperadmin})
+
+		handler.GetAccounts(c)
+
+		var response map[string]interface{}
+		_ = json.Unmarshal(w.Body.Bytes(), &response)
+		return w, response
+	}
+
+	w, response := list("/api/accounts?sort=username&order=asc&limit=2")
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d", http.StatusOK, w.Code)
+	}
+	if response["total"] != float64(5) {
+		t.Errorf("Expected total 5, got %v", response["total"])
+	}
+	next, ok := response["next"].(string)
+	if !ok || !strings.Contains(next, "cursor=") || !strings.Contains(next, "limit=2") {
+		t.Fatalf("Expected a next link keeping the query, got %v", response["next"])
+	}
+	if link := w.Header().Get("Link"); !strings.Contains(link, `rel="next"`) {
+		t.Errorf("Expected a Link header, got %q", link)
+	}
+
+	_, response = list(next)
+	page := response["accounts"].([]interface{})
+	if first := page[0].(map[string]interface{})["username"]; first != "page3" {
+		t.Errorf("Expected second page to start at page3, got %v", first)
+	}
+
+	_, response = list("/api/accounts?grade=1")
+	if response["total"] != float64(3) {
+		t.Errorf("Expected 3 accounts in grade 1, got %v", response["total"])
+	}
+
+	for _, target := range []string{"/api/accounts?sort=password_hash", "/api/accounts?grade=first", "/api/accounts?cursor=bogus"} {
+		if w, _ := list(target); w.Code != http.StatusBadRequest {
+			t.Errorf("Expected status %d for %s, got %d", http.StatusBadRequest, target, w.Code)
+		}
+	}
+}
+
+func TestSearchAccountsHandler(t *testing.T) {
+	handler, db := setupTestHandler()
+	defer db.Close()
+
+	gin.SetMode(gin.TestMode)
+
+	accounts := []models.CreateAccountRequest{
+		{Username: "teacher", Email: "teacher@example.com", Password: "password123", School: "School A"},
+		{Username: "jsmith", Email: "jsmith@example.com", Password: "password123", FirstName: "John", LastName: "Smith", School: "School A"},
+		{Username: "jsmithb", Email: "jsmithb@example.com", Password: "password123", FirstName: "John", LastName: "Smith", School: "School B"},
+	}
+	for _, req := range accounts {
+		_, _ = db.CreateAccount(req)
+	}
+
+	teacher, err := db.SetAccountRole(1, models.RoleTeacher)
+	if err != nil {
+		t.Fatalf("Failed to set role: %v", err)
+	}
+	teachClass(t, db, teacher, 2)
+
+	httpReq, _ := http.NewRequest("GET", "/api/accounts/search?q=jo+smi", nil)
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httpReq
+	middleware.SetCurrentAccount(c, teacher)
+
+	handler.SearchAccounts(c)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d", http.StatusOK, w.Code)
+	}
+
+	var response struct {
+		Accounts []models.Account `json:"accounts"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatalf("Failed to parse response: %v", err)
+	}
+	if len(response.Accounts) != 1 || response.Accounts[0].School != "School A" {
+		t.Errorf("Expected only the School A match, got %+v", response.Accounts)
+	}
+}
+
+func TestRecordXPHandler(t *testing.T) {
+	handler, db := setupTestHandler()
+	defer db.Close()
+
+	gin.SetMode(gin.TestMode)
+
+	student, err := db.CreateAccount(models.CreateAccountRequest{
+		Username: "player", Email: "player@example.com", Password: "password123",
+	})
+	if err != nil {
+		t.Fatalf("Failed to create account: %v", err)
+	}
+	teacher := &models.Account{ID: 999, Role: models.RoleTeacher}
+
+	record := func(actor *models.Account, body string) (*httptest.ResponseRecorder, map[string]interface{}) {
+		httpReq, _ := http.NewRequest("POST", fmt.Sprintf("/api/accounts/%d/xp", student.ID), strings.NewReader(body))
+		httpReq.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httpReq
+		c.Params = gin.Params{{Key: "id", Value: strconv.Itoa(student.ID)}}
+		middleware.SetCurrentAccount(c, actor)
+
+		if middleware.RequirePermission(auth.PermXPWrite)(c); !c.IsAborted() {
+			handler.RecordXP(c)
+		}
+
+		var response map[string]interface{}
+		_ = json.Unmarshal(w.Body.Bytes(), &response)
+		return w, response
+	}
+
+	w, response := record(teacher, `{"amount": 150, "source": "game", "game_ref": "spelling-bee"}`)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusCreated, w.Code, w.Body.String())
+	}
+	if response["level_up"] != true {
+		t.Errorf("Expected 150 XP to level up, got %v", response["level_up"])
+	}
+	if badges, _ := response["achievements"].([]interface{}); len(badges) != 1 {
+		t.Errorf("Expected the first-steps badge to be awarded, got %v", response["achievements"])
+	}
+
+	if w, _ := record(student, `{"amount": 2000000000, "source": "game"}`); w.Code != http.StatusForbidden {
+		t.Errorf("Expected a student to be refused awarding themselves XP, got %d", w.Code)
+	}
+	if got, _ := db.GetAccountByID(student.ID); got.Experience != 150 {
+		t.Errorf("Expected the experience to stay at 150, got %d", got.Experience)
+	}
+	if w, _ := record(teacher, `{"amount": 10}`); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected a missing source to be rejected, got %d", w.Code)
+	}
+}
+
+func TestGetLeaderboardHandler(t *testing.T) {
+	handler, db := setupTestHandler()
+	defer db.Close()
+
+	gin.SetMode(gin.TestMode)
+
+	var players []*models.Account
+	for i, school := range []string{"School A", "School A", "School B"} {
+		account, err := db.CreateAccount(models.CreateAccountRequest{
+			Username: fmt.Sprintf("player%d", i), Email: fmt.Sprintf("player%d@example.com", i),
+			Password: "password123", FirstName: "Player", LastName: "One", School: school, Grade: 4,
+		})
+		if err != nil {
+			t.Fatalf("Failed to create account: %v", err)
+		}
+		if _, _, err := db.RecordXPEvent(models.XPEvent{AccountID: account.ID, Amount: 100 * (i + 1), Source: "game"}); err != nil {
+			t.Fatalf("Failed to record XP: %v", err)
+		}
+		players = append(players, account)
+	}
+
+	leaderboard := func(query string) (*httptest.ResponseRecorder, models.Leaderboard) {
+		httpReq, _ := http.NewRequest("GET", "/api/leaderboards?"+query, nil)
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httpReq
+		middleware.SetCurrentAccount(c, players[0])
+
+		handler.GetLeaderboard(c)
+
+		var board models.Leaderboard
+		_ = json.Unmarshal(w.Body.Bytes(), &board)
+		return w, board
+	}
+
+	w, board := leaderboard("scope=school&window=weekly")
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+	if len(board.Entries) != 2 || board.Entries[0].AccountID != players[1].ID {
+		t.Errorf("Expected the two School A players, got %+v", board.Entries)
+	}
+	if board.Me == nil || board.Me.Rank != 2 {
+		t.Errorf("Expected the caller to rank 2nd, got %+v", board.Me)
+	}
+
+	if w, _ := leaderboard("scope=school&school=School+B"); w.Code != http.StatusForbidden {
+		t.Errorf("Expected another school's board to be refused, got %d", w.Code)
+	}
+	if w, _ := leaderboard("metric=level&window=daily"); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected a daily level board to be rejected, got %d", w.Code)
+	}
+	if w, _ := leaderboard("metric=streak"); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected an unknown metric to be rejected, got %d", w.Code)
+	}
+
+	w, board = leaderboard("scope=grade")
+	if w.Code != http.StatusOK || len(board.Entries) != 3 {
+		t.Errorf("Expected all grade 4 players, got %d: %+v", w.Code, board.Entries)
+	}
+
+	// Students of other schools are ranked but not named
+	for _, query := range []string{"scope=global", "scope=grade"} {
+		w, board = leaderboard(query)
+		if w.Code != http.StatusOK || len(board.Entries) != 3 || strings.Contains(w.Body.String(), players[2].Username) {
+			t.Fatalf("Expected %s to rank all players without naming School B's, got %d: %s", query, w.Code, w.Body.String())
+		}
+		top := board.Entries[0]
+		if top.School != "School B" || top.AccountID != 0 || top.DisplayName != "Anonymous" {
+			t.Errorf("Expected School B's player to be anonymous on %s, got %+v", query, top)
+		}
+		if board.Entries[1].Username != players[1].Username {
+			t.Errorf("Expected School A's players to be named on %s, got %+v", query, board.Entries[1])
+		}
+	}
+
+	// A storage failure is the server's fault and does not leak the query
+	db.Close()
+	if w, _ := leaderboard("scope=global"); w.Code != http.StatusInternalServerError || strings.Contains(w.Body.String(), "SELECT") {
+		t.Errorf("Expected a storage failure to answer 500 without details, got %d: %s", w.Code, w.Body.String())
+	}
+}
+
+func TestClassroomHandlers(t *testing.T) {
+	handler, db := setupTestHandler()
+	defer db.Close()
+
+	gin.SetMode(gin.TestMode)
+
+	admin, _ := db.CreateAccount(models.CreateAccountRequest{Username: "admin", Email: "admin@example.com", Password: "password123", School: "School A"})
+	admin, _ = db.SetAccountRole(admin.ID, models.RoleSchoolAdmin)
+	student, _ := db.CreateAccount(models.CreateAccountRequest{Username: "pupil", Email: "pupil@example.com", Password: "password123", School: "School A"})
+	other, _ := db.CreateAccount(models.CreateAccountRequest{Username: "other", Email: "other@example.com", Password: "password123", School: "School B"})
+
+	perform := func(method, path string, params gin.Params, body string, fn gin.HandlerFunc) *httptest.ResponseRecorder {
+		httpReq, _ := http.NewRequest(method, path, strings.NewReader(body))
+		httpReq.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httpReq
+		c.Params = params
+		middleware.SetCurrentAccount(c, admin)
+		fn(c)
+		return w
+	}
+
+	schoolID := strconv.Itoa(*admin.SchoolID)
+	w := perform("POST", "/api/schools/"+schoolID+"/classrooms", gin.Params{{Key: "id", Value: schoolID}},
+		`{"name": "Room 1", "grade": 3}`, handler.CreateClassroom)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusCreated, w.Code, w.Body.String())
+	}
+	var classroom models.Classroom
+	_ = json.Unmarshal(w.Body.Bytes(), &classroom)
+	classroomID := strconv.Itoa(classroom.ID)
+
+	enroll := func(accountID int) *httptest.ResponseRecorder {
+		return perform("POST", "/api/classrooms/"+classroomID+"/enrollments", gin.Params{{Key: "id", Value: classroomID}},
+			fmt.Sprintf(`{"account_id": %d}`, accountID), handler.Enroll)
+	}
+	if w := enroll(student.ID); w.Code != http.StatusCreated {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusCreated, w.Code, w.Body.String())
+	}
+	if w := enroll(other.ID); w.Code != http.StatusUnprocessableEntity {
+		t.Errorf("Expected another school's account to be refused, got %d", w.Code)
+	}
+
+	w = perform("GET", "/api/stats?classroom_id="+classroomID, nil, "", handler.GetStats)
+	var stats models.AccountStats
+	_ = json.Unmarshal(w.Body.Bytes(), &stats)
+	if w.Code != http.StatusOK || stats.TotalAccounts != 1 {
+		t.Errorf("Expected stats for the one enrolled student, got %d: %s", w.Code, w.Body.String())
+	}
+}
+
+func TestRestoreAccountHandler(t *testing.T) {
+	handler, db := setupTestHandler()
+	defer db.Close()
+
+	gin.SetMode(gin.TestMode)
+
+	admin, _ := db.CreateAccount(models.CreateAccountRequest{Username: "admin", Email: "admin@example.com", Password: "password123", School: "School A"})
+	admin, _ = db.SetAccountRole(admin.ID, models.RoleSchoolAdmin)
+	teacher, _ := db.CreateAccount(models.CreateAccountRequest{Username: "teach", Email: "teach@example.com", Password: "password123", School: "School A"})
+	teacher, _ = db.SetAccountRole(teacher.ID, models.RoleTeacher)
+	student, _ := db.CreateAccount(models.CreateAccountRequest{Username: "pupil", Email: "pupil@example.com", Password: "password123", School: "School A"})
+	other, _ := db.CreateAccount(models.CreateAccountRequest{Username: "other", Email: "other@example.com", Password: "password123", School: "School B"})
+
+	perform := func(actor *models.Account, method, path string, params gin.Params, fn gin.HandlerFunc) *httptest.ResponseRecorder {
+		httpReq, _ := http.NewRequest(method, path, nil)
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httpReq
+		c.Params = params
+		middleware.SetCurrentAccount(c, actor)
+		fn(c)
+		return w
+	}
+	restore := func(actor *models.Account, id int) *httptest.ResponseRecorder {
+		path := fmt.Sprintf("/api/accounts/%d/restore", id)
+		return perform(actor, "POST", path, gin.Params{{Key: "id", Value: strconv.Itoa(id)}}, handler.RestoreAccount)
+	}
+
+	for _, account := range []*models.Account{student, other} {
+		if err := db.DeleteAccount(account.ID); err != nil {
+			t.Fatalf("Failed to delete account: %v", err)
+		}
+	}
+
+	if w := perform(teacher, "GET", "/api/accounts?deleted=true", nil, handler.GetAccounts); w.Code != http.StatusForbidden {
+		t.Errorf("Expected teachers not to list deleted accounts, got %d", w.Code)
+	}
+	w := perform(admin, "GET", "/api/accounts?deleted=true", nil, handler.GetAccounts)
+	var page models.AccountPage
+	_ = json.Unmarshal(w.Body.Bytes(), &page)
+	if w.Code != http.StatusOK || len(page.Accounts) != 1 || page.Accounts[0].ID != student.ID {
+		t.Errorf("Expected the school's deleted student to be listed, got %d: %s", w.Code, w.Body.String())
+	}
+
+	if w := restore(admin, other.ID); w.Code != http.StatusForbidden {
+		t.Errorf("Expected another school's account not to be restored, got %d", w.Code)
+	}
+	if w := restore(admin, student.ID); w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+	if _, err := db.GetAccountByID(student.ID); err != nil {
+		t.Errorf("Expected the restored account to be back: %v", err)
+	}
+	if w := restore(admin, student.ID); w.Code != http.StatusNotFound {
+		t.Errorf("Expected restoring a live account to be not found, got %d", w.Code)
+	}
+}
+
+func TestTeacherRosterHandlers(t *testing.T) {
+	handler, db := setupTestHandler()
+	defer db.Close()
+
+	gin.SetMode(gin.TestMode)
+
+	teacher, _ := db.CreateAccount(models.CreateAccountRequest{Username: "teacher", Email: "teacher@example.com", Password: "password123", School: "School A"})
+	teacher, _ = db.SetAccountRole(teacher.ID, models.RoleTeacher)
+	colleague, _ := db.CreateAccount(models.CreateAccountRequest{Username: "colleague", Email: "colleague@example.com", Password: "password123", School: "School A"})
+	colleague, _ = db.SetAccountRole(colleague.ID, models.RoleTeacher)
+	student, _ := db.CreateAccount(models.CreateAccountRequest{Username: "pupil", Email: "pupil@example.com", Password: "password123", School: "School A"})
+
+	perform := func(actor *models.Account, method, path string, params gin.Params, body string, fn gin.HandlerFunc) *httptest.ResponseRecorder {
+		httpReq, _ := http.NewRequest(method, path, strings.NewReader(body))
+		httpReq.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httpReq
+		c.Params = params
+		middleware.SetCurrentAccount(c, actor)
+		fn(c)
+		return w
+	}
+
+	w := perform(teacher, "POST", "/api/teacher/classrooms", nil, `{"name": "Room 7", "grade": 4}`, handler.CreateTeacherClassroom)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusCreated, w.Code, w.Body.String())
+	}
+	var classroom models.Classroom
+	_ = json.Unmarshal(w.Body.Bytes(), &classroom)
+	params := gin.Params{{Key: "id", Value: strconv.Itoa(classroom.ID)}}
+	path := "/api/teacher/classrooms/" + strconv.Itoa(classroom.ID) + "/roster"
+
+	w = perform(teacher, "POST", path, params, `{"usernames": ["pupil", "colleague", "ghost"]}`, handler.AddToRoster)
+	var result models.RosterResult
+	_ = json.Unmarshal(w.Body.Bytes(), &result)
+	if w.Code != http.StatusOK || len(result.Added) != 1 || len(result.NotEligible) != 1 || len(result.NotFound) != 1 {
+		t.Fatalf("Unexpected roster result %d: %s", w.Code, w.Body.String())
+	}
+
+	if w := perform(colleague, "GET", path, params, "", handler.GetRoster); w.Code != http.StatusForbidden {
+		t.Errorf("Expected a colleague to be refused another teacher's roster, got %d", w.Code)
+	}
+	w = perform(teacher, "GET", path, params, "", handler.GetRoster)
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"username":"pupil"`) {
+		t.Errorf("Expected the roster to list pupil, got %d: %s", w.Code, w.Body.String())
+	}
+
+	studentParams := gin.Params{{Key: "id", Value: strconv.Itoa(student.ID)}}
+	w = perform(teacher, "POST", "/api/teacher/students/"+strconv.Itoa(student.ID)+"/reset-password", studentParams, "", handler.ResetStudentPassword)
+	var reset struct {
+		Password string `json:"password"`
+	}
+	_ = json.Unmarshal(w.Body.Bytes(), &reset)
+	if w.Code != http.StatusOK || len(reset.Password) != auth.TemporaryPasswordLength {
+		t.Fatalf("Expected a temporary password, got %d: %s", w.Code, w.Body.String())
+	}
+	if !db.VerifyPassword("pupil", reset.Password) {
+		t.Error("Expected the temporary password to work")
+	}
+
+	w = perform(teacher, "POST", "/api/teacher/students/"+strconv.Itoa(student.ID)+"/deactivate", studentParams, "", handler.DeactivateStudent)
+	if account, _ := db.GetAccountByID(student.ID); w.Code != http.StatusOK || account.IsActive {
+		t.Errorf("Expected pupil to be deactivated, got %d: %s", w.Code, w.Body.String())
+	}
+}
+
+func TestGuardianConsentFlow(t *testing.T) {
+	db, _ := database.NewDatabase(":memory:")
+	defer db.Close()
+	notifier := &recordingNotifier{}
+	handler := NewHandler(db, auth.NewTokenService([]byte("test-secret")), nil, notifier)
+
+	gin.SetMode(gin.TestMode)
+
+	perform := func(actor *models.Account, method, path string, params gin.Params, body string, fn gin.HandlerFunc) *httptest.ResponseRecorder {
+		httpReq, _ := http.NewRequest(method, path, strings.NewReader(body))
+		httpReq.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httpReq
+		c.Params = params
+		if actor != nil {
+			middleware.SetCurrentAccount(c, actor)
+		}
+		fn(c)
+		return w
+	}
+
+	w := perform(nil, "POST", "/api/accounts", nil, `{"username": "kid", "email": "kid@example.com", "password": "purple-otter-51",
+		"grade": 3, "guardian_email": "Parent@Example.com"}`, handler.CreateAccount)
+	var student models.Account
+	_ = json.Unmarshal(w.Body.Bytes(), &student)
+	if w.Code != http.StatusCreated || student.ConsentStatus != models.ConsentPending {
+		t.Fatalf("Expected a pending account, got %d: %s", w.Code, w.Body.String())
+	}
+	if w, _ := performLogin(t, handler, "kid", "purple-otter-51"); w.Code != http.StatusForbidden {
+		t.Errorf("Expected a pending student to be refused login, got %d", w.Code)
+	}
+	if notifier.token == "" || notifier.to != "Parent@Example.com" {
+		t.Fatalf("Expected a consent code to be sent to the guardian, got %+v", notifier)
+	}
+
+	w = perform(nil, "POST", "/api/guardians", nil, `{"username": "parent", "email": "parent@example.com", "password": "purple-otter-51"}`, handler.RegisterGuardian)
+	var guardian models.Account
+	_ = json.Unmarshal(w.Body.Bytes(), &guardian)
+	if w.Code != http.StatusCreated || guardian.Role != models.RoleGuardian {
+		t.Fatalf("Expected a guardian account, got %d: %s", w.Code, w.Body.String())
+	}
+	stranger, _ := db.CreateAccount(models.CreateAccountRequest{Username: "stranger", Email: "stranger@example.com", Password: "password123", Role: models.RoleGuardian})
+
+	w = perform(&guardian, "GET", "/api/guardian/children", nil, "", handler.GetChildren)
+	if !strings.Contains(w.Body.String(), `"pending":[{"id":1,"username":"kid"`) {
+		t.Errorf("Expected kid to be waiting for consent, got %s", w.Body.String())
+	}
+
+	params := gin.Params{{Key: "id", Value: strconv.Itoa(student.ID)}}
+	consent := `{"policy_version": "2025-01", "token": "` + notifier.token + `"}`
+	if w := perform(stranger, "POST", "/api/guardian/children/1/consent", params, consent, handler.GiveConsent); w.Code != http.StatusForbidden {
+		t.Errorf("Expected another guardian to be refused, got %d", w.Code)
+	}
+	// Anyone can register with the address the student gave; without the
+	// code sent there, that proves nothing
+	for _, body := range []string{`{"policy_version": "2025-01"}`, `{"policy_version": "2025-01", "token": "guess"}`} {
+		if w := perform(&guardian, "POST", "/api/guardian/children/1/consent", params, body, handler.GiveConsent); w.Code != http.StatusForbidden {
+			t.Errorf("Expected consent without the emailed code to be refused, got %d", w.Code)
+		}
+	}
+	w = perform(&guardian, "POST", "/api/guardian/children/1/consent", params, consent, handler.GiveConsent)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Expected consent to be recorded, got %d: %s", w.Code, w.Body.String())
+	}
+	if w, _ := performLogin(t, handler, "kid", "purple-otter-51"); w.Code != http.StatusOK {
+		t.Errorf("Expected the student to log in after consent, got %d", w.Code)
+	}
+
+	w = perform(&guardian, "GET", "/api/guardian/children/1/progress", params, "", handler.GetChildProgress)
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"consent_status":"granted"`) {
+		t.Errorf("Expected the child's progress, got %d: %s", w.Code, w.Body.String())
+	}
+	if w := perform(stranger, "GET", "/api/guardian/children/1/progress", params, "", handler.GetChildProgress); w.Code != http.StatusForbidden {
+		t.Errorf("Expected an unlinked guardian to be refused progress, got %d", w.Code)
+	}
+}
+
+// recordingNotifier keeps the last token it was given instead of sending it
+type recordingNotifier struct {
+	token string
+	to    string
+}
+
+func (n *recordingNotifier) SendPasswordReset(account *models.Account, token string, expiresAt time.Time) error {
+	n.token, n.to = token, account.Email
+	return nil
+}
+
+func (n *recordingNotifier) SendConsentRequest(student *models.Account, guardianEmail, token string, expiresAt time.Time) error {
+	n.token, n.to = token, guardianEmail
+	return nil
+}
+
+func TestPasswordResetFlow(t *testing.T) {
+	db, _ := database.NewDatabase(":memory:")
+	defer db.Close()
+	notifier := &recordingNotifier{}
+	handler := NewHandler(db, auth.NewTokenService([]byte("test-secret")), nil, notifier)
+
+	gin.SetMode(gin.TestMode)
+
+	_, _ = db.CreateAccount(models.CreateAccountRequest{Username: "forgetful", Email: "forgetful@example.com", Password: "password123"})
+
+	perform := func(path, body string, fn gin.HandlerFunc) *httptest.ResponseRecorder {
+		httpReq, _ := http.NewRequest("POST", path, strings.NewReader(body))
+		httpReq.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httpReq
+		fn(c)
+		return w
+	}
+
+	if w := perform("/api/password/forgot", `{"login": "nobody@example.com"}`, handler.ForgotPassword); w.Code != http.StatusAccepted || notifier.token != "" {
+		t.Errorf("Expected an unknown login to be accepted without sending anything, got %d", w.Code)
+	}
+	if w := perform("/api/password/forgot", `{"login": "Forgetful@example.com"}`, handler.ForgotPassword); w.Code != http.StatusAccepted || notifier.token == "" {
+		t.Fatalf("Expected a reset token to be sent, got %d: %s", w.Code, w.Body.String())
+	}
+
+	body := fmt.Sprintf(`{"token": %q, "new_password": "brandnew1"}`, notifier.token)
+	if w := perform("/api/password/reset", body, handler.ResetPassword); w.Code != http.StatusOK {
+		t.Fatalf("Expected the password to be reset, got %d: %s", w.Code, w.Body.String())
+	}
+	if w := perform("/api/password/reset", body, handler.ResetPassword); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected the token to be single-use, got %d", w.Code)
+	}
+	if w, _ := performLogin(t, handler, "forgetful", "brandnew1"); w.Code != http.StatusOK {
+		t.Errorf("Expected login with the new password, got %d", w.Code)
+	}
+}
+
+func TestChangePasswordHandler(t *testing.T) {
+	handler, db := setupTestHandler()
+	defer db.Close()
+
+	gin.SetMode(gin.TestMode)
+
+	account, _ := db.CreateAccount(models.CreateAccountRequest{Username: "changer", Email: "changer@example.com", Password: "password123"})
+	if err := db.SetPassword(account.ID, "temporary1", true); err != nil {
+		t.Fatalf("Failed to set password: %v", err)
+	}
+	account, _ = db.GetAccountByID(account.ID)
+
+	router := gin.New()
+	router.Use(func(c *gin.Context) { middleware.SetCurrentAccount(c, account) })
+	router.Use(middleware.RequireCurrentPassword("/api/password/change"))
+	router.POST("/api/password/change", handler.ChangePassword)
+	router.GET("/api/accounts", handler.GetAccounts)
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/api/accounts", nil))
+	if w.Code != http.StatusForbidden || !strings.Contains(w.Body.String(), "must_reset_password") {
+		t.Errorf("Expected other routes to be blocked until the password is changed, got %d", w.Code)
+	}
+
+	change := func(body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", "/api/password/change", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+	if w := change(`{"old_password": "wrong", "new_password": "chosen123"}`); w.Code != http.StatusForbidden {
+		t.Errorf("Expected a wrong current password to be refused, got %d", w.Code)
+	}
+	for _, weak := range []string{"short1", "password1", "changer-2026"} {
+		w := change(`{"old_password": "temporary1", "new_password": "` + weak + `"}`)
+		if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), "problems") {
+			t.Errorf("Expected %q to be refused by the password policy, got %d: %s", weak, w.Code, w.Body.String())
+		}
+	}
+	w = change(`{"old_password": "temporary1", "new_password": "chosen123"}`)
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "access_token") {
+		t.Fatalf("Expected the password to change with fresh tokens, got %d: %s", w.Code, w.Body.String())
+	}
+	if account, _ := db.GetAccountByID(account.ID); account.MustResetPassword || !db.VerifyPassword("changer", "chosen123") {
+		t.Error("Expected the new password to work and the reset flag to be cleared")
+	}
+}
+
+func TestCurrentPasswordLockout(t *testing.T) {
+	handler, db := setupTestHandler()
+	defer db.Close()
+
+	gin.SetMode(gin.TestMode)
+
+	handler.SetLoginLimits(auth.LoginLimits{
+		Username: auth.LockoutPolicy{FreeAttempts: 1, Threshold: 2, Lockout: time.Hour, Window: time.Hour},
+		IP:       auth.LockoutPolicy{FreeAttempts: 100, Window: time.Hour},
+	})
+	account, _ := db.CreateAccount(models.CreateAccountRequest{Username: "stolen", Email: "stolen@example.com", Password: "password123"})
+
+	change := func(old string) *httptest.ResponseRecorder {
+		body := `{"old_password": "` + old + `", "new_password": "chosen123"}`
+		httpReq, _ := http.NewRequest("POST", "/api/password/change", strings.NewReader(body))
+		httpReq.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httpReq
+		middleware.SetCurrentAccount(c, account)
+		handler.ChangePassword(c)
+		return w
+	}
+
+	// Guessing with a stolen access token counts like guessing at login
+	for i := 0; i < 2; i++ {
+		if w := change("guess"); w.Code != http.StatusForbidden {
+			t.Fatalf("Expected a wrong current password to be refused, got %d", w.Code)
+		}
+	}
+	if w := change("password123"); w.Code != http.StatusTooManyRequests {
+		t.Errorf("Expected the account to be locked out, got %d: %s", w.Code, w.Body.String())
+	}
+	if w, _ := performLogin(t, handler, "stolen", "password123"); w.Code != http.StatusTooManyRequests {
+		t.Errorf("Expected logins to be locked out as well, got %d", w.Code)
+	}
+	if !db.VerifyPassword("stolen", "password123") {
+		t.Error("Expected the password to be unchanged")
+	}
+}
+
+func TestLoginLockout(t *testing.T) {
+	handler, db := setupTestHandler()
+	defer db.Close()
+
+	gin.SetMode(gin.TestMode)
+
+	handler.SetLoginLimits(auth.LoginLimits{
+		Username: auth.LockoutPolicy{FreeAttempts: 1, Threshold: 2, Lockout: time.Hour, Window: time.Hour},
+		IP:       auth.LockoutPolicy{FreeAttempts: 100, Window: time.Hour},
+	})
+
+	_, _ = db.CreateAccount(models.CreateAccountRequest{
+		Username: "loginuser", Email: "login@example.com", Password: "password123",
+	})
+
+	// A real username and an unknown one are locked out alike
+	for _, username := range []string{"loginuser", "nosuchuser"} {
+		for i := 0; i < 2; i++ {
+			if w, _ := performLogin(t, handler, username, "wrongpassword"); w.Code != http.StatusUnauthorized {
+				t.Fatalf("Expected status %d, got %d", http.StatusUnauthorized, w.Code)
+			}
+		}
+		w, response := performLogin(t, handler, username, "password123")
+		if w.Code != http.StatusTooManyRequests || w.Header().Get("Retry-After") == "" {
+			t.Fatalf("Expected %s to be locked out, got %d: %s", username, w.Code, w.Body.String())
+		}
+		if response["error"] != "Too many failed login attempts; try again later" {
+			t.Errorf("Expected the generic lockout message, got %v", response["error"])
+		}
+	}
+
+	perform := func(method string, params gin.Params, fn gin.HandlerFunc) *httptest.ResponseRecorder {
+		httpReq, _ := http.NewRequest(method, "/api/admin", nil)
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httpReq
+		c.Params = params
+		middleware.SetCurrentAccount(c, &models.Account{ID: 999, Role: models.RoleSuperadmin})
+		fn(c)
+		return w
+	}
+
+	w := perform("GET", nil, handler.GetLoginLocks)
+	var locks struct {
+		Lockouts []models.LoginLock `json:"lockouts"`
+	}
+	_ = json.Unmarshal(w.Body.Bytes(), &locks)
+	if len(locks.Lockouts) != 2 {
+		t.Fatalf("Expected 2 lockouts, got %s", w.Body.String())
+	}
+
+	w = perform("DELETE", gin.Params{{Key: "kind", Value: "username"}, {Key: "key", Value: "loginuser"}}, handler.ClearLoginLock)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+	if w, _ := performLogin(t, handler, "loginuser", "password123"); w.Code != http.StatusOK {
+		t.Errorf("Expected login after the lockout was cleared, got %d", w.Code)
+	}
+
+	events, _ := db.GetAuthEvents(models.AuthLogQuery{Username: "loginuser"})
+	outcomes := make([]string, len(events))
+	for i, event := range events {
+		outcomes[i] = event.Outcome
+	}
+	if strings.Join(outcomes, ",") != "success,locked,failure,failure" {
+		t.Errorf("Unexpected auth log: %v", outcomes)
+	}
+}
+
+func TestTwoFactorLogin(t *testing.T) {
+	handler, db := setupTestHandler()
+	defer db.Close()
+
+	gin.SetMode(gin.TestMode)
+
+	admin, _ := db.CreateAccount(models.CreateAccountRequest{
+		Username: "admin", Email: "admin@example.com", Password: "password123",
+	})
+
+	perform := func(body string, fn gin.HandlerFunc) *httptest.ResponseRecorder {
+		httpReq, _ := http.NewRequest("POST", "/api/2fa", strings.NewReader(body))
+		httpReq.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httpReq
+		account, _ := db.GetAccountByID(admin.ID)
+		middleware.SetCurrentAccount(c, account)
+		fn(c)
+		return w
+	}
+
+	w := perform("", handler.SetupTwoFactor)
+	var setup models.TwoFactorSetup
+	_ = json.Unmarshal(w.Body.Bytes(), &setup)
+	if w.Code != http.StatusOK || setup.Secret == "" || !strings.HasPrefix(setup.OTPAuthURI, "otpauth://totp/") {
+		t.Fatalf("Expected a secret and otpauth URI, got %d: %s", w.Code, w.Body.String())
+	}
+
+	// Confirm with the previous period's code, leaving the current one for login
+	step := auth.TOTPStep(time.Now())
+	previous, _ := auth.TOTPCode(setup.Secret, step-1)
+	current, _ := auth.TOTPCode(setup.Secret, step)
+	stale, _ := auth.TOTPCode(setup.Secret, step-5)
+
+	if w := perform(`{"code": "`+stale+`"}`, handler.ConfirmTwoFactor); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected a stale code to be refused, got %d", w.Code)
+	}
+	w = perform(`{"code": "`+previous+`"}`, handler.ConfirmTwoFactor)
+	var confirmed struct {
+		RecoveryCodes []string `json:"recovery_codes"`
+	}
+	_ = json.Unmarshal(w.Body.Bytes(), &confirmed)
+	if w.Code != http.StatusOK || len(confirmed.RecoveryCodes) != auth.RecoveryCodeCount {
+		t.Fatalf("Expected two-factor authentication to be enabled, got %d: %s", w.Code, w.Body.String())
+	}
+
+	w, response := performLogin(t, handler, "admin", "password123")
+	if w.Code != http.StatusUnauthorized || response["two_factor_required"] != true {
+		t.Fatalf("Expected a password alone to be refused, got %d: %s", w.Code, w.Body.String())
+	}
+
+	login := func(code string) *httptest.ResponseRecorder {
+		jsonData, _ := json.Marshal(map[string]string{"username": "admin", "password": "password123", "code": code})
+		httpReq, _ := http.NewRequest("POST", "/login", bytes.NewBuffer(jsonData))
+		httpReq.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httpReq
+		handler.Login(c)
+		return w
+	}
+
+	if w := login(current); w.Code != http.StatusOK {
+		t.Fatalf("Expected login with a TOTP code, got %d: %s", w.Code, w.Body.String())
+	}
+	if w := login(current); w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected a used TOTP code to be refused, got %d", w.Code)
+	}
+	if w := login(confirmed.RecoveryCodes[0]); w.Code != http.StatusOK {
+		t.Errorf("Expected login with a recovery code, got %d: %s", w.Code, w.Body.String())
+	}
+	if w := login(confirmed.RecoveryCodes[0]); w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected a used recovery code to be refused, got %d", w.Code)
+	}
+
+	// Roles that require a second factor cannot turn it off
+	handler.SetTwoFactorRoles([]string{models.RoleStudent})
+	if w := perform(`{"password": "password123"}`, handler.DisableTwoFactor); w.Code != http.StatusForbidden {
+		t.Errorf("Expected a required second factor to stay on, got %d", w.Code)
+	}
+}
+
+func TestSingleSignOn(t *testing.T) {
+	handler, db := setupTestHandler()
+	defer db.Close()
+
+	gin.SetMode(gin.TestMode)
+
+	idp, server, err := oidctest.NewServer("game", "shh")
+	if err != nil {
+		t.Fatalf("Failed to start mock provider: %v", err)
+	}
+	defer server.Close()
+
+	provider, err := auth.NewOIDCProvider(context.Background(), auth.OIDCConfig{
+		Issuer: server.URL, ClientID: "game", ClientSecret: "shh", RedirectURL: "http://game.example/api/sso/callback",
+	})
+	if err != nil {
+		t.Fatalf("Failed to discover provider: %v", err)
+	}
+	handler.SetSSO(provider, models.SSOProvisioning{Grade: 4, School: "District School"})
+
+	router := gin.New()
+	router.GET("/api/sso/login", handler.StartSSO)
+	router.GET("/api/sso/callback", handler.SSOCallback)
+	router.POST("/api/token/refresh", handler.RefreshToken)
+
+	noRedirects := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}}
+	// callback returns the fragment the portal is sent back with
+	callback := func(query string, cookies ...*http.Cookie) url.Values {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", "/api/sso/callback?"+query, nil)
+		for _, cookie := range cookies {
+			req.AddCookie(cookie)
+		}
+		router.ServeHTTP(w, req)
+		portal, _ := url.Parse(w.Header().Get("Location"))
+		fragment, _ := url.ParseQuery(portal.EscapedFragment())
+		return fragment
+	}
+	// signIn goes through the provider and returns the callback query and
+	// the state cookie the browser was given
+	signIn := func(user map[string]interface{}) (string, *http.Cookie) {
+		idp.SetUser(user)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("GET", "/api/sso/login", nil))
+		cookies := w.Result().Cookies()
+		if len(cookies) != 1 || !cookies[0].HttpOnly || cookies[0].SameSite != http.SameSiteLaxMode {
+			t.Fatalf("Expected an HttpOnly, SameSite=Lax state cookie, got %+v", cookies)
+		}
+		resp, err := noRedirects.Get(w.Header().Get("Location"))
+		if err != nil {
+			t.Fatalf("Failed to reach provider: %v", err)
+		}
+		resp.Body.Close()
+		back, _ := url.Parse(resp.Header.Get("Location"))
+		return back.RawQuery, cookies[0]
+	}
+
+	query, cookie := signIn(map[string]interface{}{"sub": "sub-1", "email": "Ada@District.example", "email_verified": true, "given_name": "Ada"})
+	// A callback from another browser, such as a victim sent the link by
+	// whoever started the sign-in, is refused
+	if fragment := callback(query); fragment.Get("sso_error") == "" {
+		t.Fatalf("Expected a callback without the state cookie to be refused, got %v", fragment)
+	}
+	_, other := signIn(map[string]interface{}{"sub": "sub-9"})
+	if fragment := callback(query, other); fragment.Get("sso_error") == "" {
+		t.Fatalf("Expected a callback with another sign-in's cookie to be refused, got %v", fragment)
+	}
+	fragment := callback(query, cookie)
+	if fragment.Get("sso") == "" {
+		t.Fatalf("Expected a new student to be signed in, got %v", fragment)
+	}
+	if again := callback(query, cookie); again.Get("sso_error") == "" {
+		t.Error("Expected a sign-in to be accepted only once")
+	}
+
+	account, err := db.GetAccountByOIDCSubject("sub-1")
+	if err != nil {
+		t.Fatalf("Expected the new account to be linked: %v", err)
+	}
+	if account.Username != "ada" || account.Grade != 4 || account.School != "District School" || account.FirstName != "Ada" {
+		t.Errorf("Expected the account to be provisioned with the defaults, got %+v", account)
+	}
+
+	body := `{"refresh_token": "` + fragment.Get("sso") + `"}`
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest("POST", "/api/token/refresh", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "access_token") {
+		t.Errorf("Expected the portal to exchange the refresh token, got %d: %s", w.Code, w.Body.String())
+	}
+
+	if fragment := callback(signIn(map[string]interface{}{"sub": "sub-1"})); fragment.Get("sso") == "" {
+		t.Errorf("Expected a linked account to sign in by subject alone, got %v", fragment)
+	}
+
+	teacher, _ := db.CreateAccount(models.CreateAccountRequest{Username: "mrsmith", Email: "smith@district.example", Password: "unknown123"})
+	unverified := map[string]interface{}{"sub": "sub-2", "email": "smith@district.example", "email_verified": false}
+	if fragment := callback(signIn(unverified)); fragment.Get("sso_error") == "" {
+		t.Error("Expected an unverified email not to take over an account")
+	}
+	unverified["email_verified"] = true
+	if fragment := callback(signIn(unverified)); fragment.Get("sso") == "" {
+		t.Errorf("Expected a verified email to link the existing account, got %v", fragment)
+	}
+	if linked, err := db.GetAccountByOIDCSubject("sub-2"); err != nil || linked.ID != teacher.ID {
+		t.Errorf("Expected the existing account to be linked, got %v", err)
+	}
+
+	if fragment := callback("error=access_denied"); fragment.Get("sso_error") == "" {
+		t.Error("Expected a provider error to be passed to the portal")
+	}
+}
@@ -0,0 +1,64 @@
+package handlers
+
+import (
+	"net/http"
+
+	"educational-game-db/internal/export"
+	"educational-game-db/internal/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ListImportMappings lists the saved mappings of CSV import columns to fields
+func (h *Handler) ListImportMappings(c *gin.Context) {
+	mappings, err := h.db.ListImportMappings()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, mappings)
+}
+
+// GetImportMapping returns a saved import mapping by name
+func (h *Handler) GetImportMapping(c *gin.Context) {
+	mapping, err := h.db.GetImportMapping(c.Param("name"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, mapping)
+}
+
+// SaveImportMapping creates or replaces the import mapping named in the route
+func (h *Handler) SaveImportMapping(c *gin.Context) {
+	var mapping models.ImportMapping
+	if err := c.ShouldBindJSON(&mapping); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	mapping.Name = c.Param("name")
+	if err := export.ValidateMapping(&mapping); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	saved, err := h.db.SaveImportMapping(mapping)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, saved)
+}
+
+// DeleteImportMapping removes a saved import mapping
+func (h *Handler) DeleteImportMapping(c *gin.Context) {
+	if err := h.db.DeleteImportMapping(c.Param("name")); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Import mapping deleted successfully"})
+}
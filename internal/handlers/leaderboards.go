@@ -0,0 +1,119 @@
+package handlers
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+
+	"educational-game-db/internal/middleware"
+	"educational-game-db/internal/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// anonymousName stands in for students of other schools on global and grade
+// boards
+const anonymousName = "Anonymous"
+
+// GetLeaderboard ranks students by experience or level. School and grade
+// boards default to the caller's own school and grade. Accounts other than
+// superadmins may only ask for their own school's board, and see global and
+// grade boards with the students of other schools anonymised.
+func (h *Handler) GetLeaderboard(c *gin.Context) {
+	q := models.LeaderboardQuery{
+		Metric: c.DefaultQuery("metric", models.LeaderboardMetricExperience),
+		Scope:  c.DefaultQuery("scope", models.LeaderboardScopeGlobal),
+		Window: c.DefaultQuery("window", models.LeaderboardWindowAllTime),
+		School: c.Query("school"),
+	}
+
+	if value := c.Query("limit"); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit <= 0 || limit > 100 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "limit must be between 1 and 100"})
+			return
+		}
+		q.Limit = limit
+	}
+
+	actor, isAccount := middleware.CurrentAccount(c)
+	if isAccount {
+		q.AccountID = actor.ID
+	}
+
+	switch q.Scope {
+	case models.LeaderboardScopeSchool:
+		if isAccount && actor.Role != models.RoleSuperadmin {
+			if q.School != "" && q.School != actor.School {
+				c.JSON(http.StatusForbidden, gin.H{"error": "Insufficient permissions"})
+				return
+			}
+			q.School = actor.School
+		}
+		if q.School == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "school is required for the school scope"})
+			return
+		}
+	case models.LeaderboardScopeGrade:
+		value := c.Query("grade")
+		switch {
+		case value != "":
+			grade, err := strconv.Atoi(value)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("invalid grade: %s", value)})
+				return
+			}
+			q.Grade = grade
+		case isAccount && actor.Grade != 0:
+			q.Grade = actor.Grade
+		default:
+			c.JSON(http.StatusBadRequest, gin.H{"error": "grade is required for the grade scope"})
+			return
+		}
+	}
+
+	if err := q.Validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	board, err := h.db.GetLeaderboard(q)
+	if err != nil {
+		log.Printf("Failed to get leaderboard: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get leaderboard"})
+		return
+	}
+	if isAccount && actor.Role != models.RoleSuperadmin {
+		for i := range board.Entries {
+			if entry := &board.Entries[i]; entry.School != actor.School || actor.School == "" {
+				entry.AccountID, entry.Username, entry.DisplayName = 0, "", anonymousName
+			}
+		}
+	}
+
+	c.JSON(http.StatusOK, board)
+}
+
+// SetLeaderboardOptOut hides an account from, or shows it on, leaderboards
+func (h *Handler) SetLeaderboardOptOut(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid account ID"})
+		return
+	}
+
+	var req models.SetLeaderboardOptOutRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	account, err := h.db.SetLeaderboardOptOut(id, *req.OptOut)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, account)
+}
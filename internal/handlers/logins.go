@@ -0,0 +1,150 @@
+package handlers
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"educational-game-db/internal/auth"
+	"educational-game-db/internal/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// SetLoginLimits replaces the lockout policies applied to failed logins
+func (h *Handler) SetLoginLimits(limits auth.LoginLimits) {
+	h.limits = limits
+}
+
+// refuseLockedLogin answers a login attempt made while its username or IP is
+// locked out. The answer does not depend on whether the username exists.
+func (h *Handler) refuseLockedLogin(c *gin.Context, username string, until, now time.Time) {
+	h.recordAuthEvent(username, nil, c.ClientIP(), models.AuthOutcomeLocked)
+
+	retryAfter := int(math.Ceil(until.Sub(now).Seconds()))
+	c.Header("Retry-After", strconv.Itoa(retryAfter))
+	c.JSON(http.StatusTooManyRequests, gin.H{
+		"error":       "Too many failed login attempts; try again later",
+		"retry_after": retryAfter,
+	})
+}
+
+// recordLoginFailure counts a wrong password against both the username and
+// the client IP
+func (h *Handler) recordLoginFailure(c *gin.Context, username string) {
+	ip := c.ClientIP()
+	if _, err := h.db.RecordLoginFailure(models.LoginKeyUsername, username, h.limits.Username.Window, h.limits.Username.Delay); err != nil {
+		log.Printf("Failed to record login failure: %v", err)
+	}
+	if _, err := h.db.RecordLoginFailure(models.LoginKeyIP, ip, h.limits.IP.Window, h.limits.IP.Delay); err != nil {
+		log.Printf("Failed to record login failure: %v", err)
+	}
+	h.recordAuthEvent(username, nil, ip, models.AuthOutcomeFailure)
+}
+
+// checkCurrentPassword verifies a signed-in account's password before a
+// sensitive change. Failures count towards the same lockouts as logins, so a
+// stolen access token cannot be used to guess the password. It answers the
+// request itself when the password is refused.
+func (h *Handler) checkCurrentPassword(c *gin.Context, account *models.Account, password string) bool {
+	now := time.Now()
+	until, err := h.db.LoginLockedUntil(account.Username, c.ClientIP(), now)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return false
+	}
+	if !until.IsZero() {
+		h.refuseLockedLogin(c, account.Username, until, now)
+		return false
+	}
+
+	if !h.db.VerifyPassword(account.Username, password) {
+		h.recordLoginFailure(c, account.Username)
+		c.JSON(http.StatusForbidden, gin.H{"error": "Current password is incorrect"})
+		return false
+	}
+	return true
+}
+
+// recordLoginSuccess forgets the failed logins of the account's username.
+// Failures from the client IP are kept, so that logging into one account does
+// not hide guessing at others.
+func (h *Handler) recordLoginSuccess(c *gin.Context, account *models.Account) {
+	if _, err := h.db.ClearLoginFailures(models.LoginKeyUsername, account.Username); err != nil {
+		log.Printf("Failed to clear login failures: %v", err)
+	}
+	h.recordAuthEvent(account.Username, &account.ID, c.ClientIP(), models.AuthOutcomeSuccess)
+}
+
+// recordAuthEvent appends to the auth log; failing to do so does not fail the login
+func (h *Handler) recordAuthEvent(username string, accountID *int, ip, outcome string) {
+	event := models.AuthEvent{Username: username, AccountID: accountID, IP: ip, Outcome: outcome}
+	if err := h.db.RecordAuthEvent(event); err != nil {
+		log.Printf("Failed to record auth event: %v", err)
+	}
+}
+
+// GetLoginLocks lists the usernames and IPs currently locked out, or every
+// one with recent failures when all=true
+func (h *Handler) GetLoginLocks(c *gin.Context) {
+	all := c.Query("all") == "true"
+
+	locks, err := h.db.ListLoginLocks(!all, time.Now())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"lockouts": locks})
+}
+
+// ClearLoginLock lifts the lockout of a username or IP and forgets its failures
+func (h *Handler) ClearLoginLock(c *gin.Context) {
+	kind := c.Param("kind")
+	if !models.IsValidLoginKeyKind(kind) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "kind must be username or ip"})
+		return
+	}
+
+	cleared, err := h.db.ClearLoginFailures(kind, c.Param("key"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if !cleared {
+		c.JSON(http.StatusNotFound, gin.H{"error": "No failed logins recorded"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Lockout cleared"})
+}
+
+// GetAuthLog returns the most recent login attempts, filtered by the username,
+// ip and outcome query parameters
+func (h *Handler) GetAuthLog(c *gin.Context) {
+	q := models.AuthLogQuery{
+		Username: c.Query("username"),
+		IP:       c.Query("ip"),
+		Outcome:  c.Query("outcome"),
+	}
+
+	if value := c.Query("limit"); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit <= 0 || limit > models.MaxAuthLogLimit {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("limit must be between 1 and %d", models.MaxAuthLogLimit)})
+			return
+		}
+		q.Limit = limit
+	}
+
+	events, err := h.db.GetAuthEvents(q)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"events": events})
+}
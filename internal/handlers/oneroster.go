@@ -0,0 +1,102 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"educational-game-db/internal/export/oneroster"
+	"educational-game-db/internal/middleware"
+	"educational-game-db/internal/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ExportOneRoster streams the schools, accounts, classrooms and enrollments
+// the caller may export as a OneRoster bundle: every school's for a
+// superadmin, and a school admin's own school's
+func (h *Handler) ExportOneRoster(c *gin.Context) {
+	principal, ok := middleware.CurrentPrincipal(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
+		return
+	}
+
+	var schoolID *int
+	if principal.Account != nil && principal.Account.Role != models.RoleSuperadmin {
+		if principal.Account.SchoolID == nil {
+			c.JSON(http.StatusForbidden, gin.H{"error": "You must belong to a school to export rosters"})
+			return
+		}
+		schoolID = principal.Account.SchoolID
+	}
+
+	filename := "oneroster_" + time.Now().Format("2006-01-02_15-04-05") + ".zip"
+	header := c.Writer.Header()
+	header.Set("Content-Type", "application/zip")
+	header.Set("Content-Disposition", `attachment; filename="`+filename+`"`)
+
+	if err := h.rosterService.WriteBundle(c.Writer, schoolID); err != nil {
+		if !c.Writer.Written() {
+			header.Del("Content-Disposition")
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		log.Printf("OneRoster export failed: %v", err)
+		abortStream(c)
+	}
+}
+
+// SyncOneRoster syncs an uploaded OneRoster bundle with the mode and dry_run
+// given as query or form parameters, answering with the sync report
+func (h *Handler) SyncOneRoster(c *gin.Context) {
+	file, fileHeader, err := c.Request.FormFile("file")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "No file uploaded"})
+		return
+	}
+	defer file.Close()
+
+	opts := models.RosterSyncOptions{Mode: c.Request.FormValue("mode")}
+	if value := c.Request.FormValue("dry_run"); value != "" {
+		if opts.DryRun, err = strconv.ParseBool(value); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "dry_run must be true or false"})
+			return
+		}
+	}
+	if opts.Mode != "" && !models.IsValidRosterSyncMode(opts.Mode) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "mode must be " + models.RosterSyncFull + " or " + models.RosterSyncDelta})
+		return
+	}
+
+	// A zip is read from its end, so the upload is read from where the form
+	// parser stored it rather than as it arrives
+	bundle, err := oneroster.ReadBundle(file, fileHeader.Size)
+	if err != nil {
+		rosterSyncFailed(c, err)
+		return
+	}
+	report, err := h.rosterService.Sync(bundle, opts)
+	if err != nil {
+		rosterSyncFailed(c, err)
+		return
+	}
+
+	status := http.StatusOK
+	if !report.DryRun && len(report.Errors) > 0 {
+		status = http.StatusUnprocessableEntity
+	}
+	c.JSON(status, report)
+}
+
+// rosterSyncFailed answers a sync that could not run: a bundle that cannot
+// be read is the client's fault, anything else the server's
+func rosterSyncFailed(c *gin.Context, err error) {
+	status := http.StatusInternalServerError
+	if errors.Is(err, oneroster.ErrInvalidBundle) {
+		status = http.StatusBadRequest
+	}
+	c.JSON(status, gin.H{"error": err.Error()})
+}
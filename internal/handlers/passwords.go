@@ -0,0 +1,172 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+
+	"educational-game-db/internal/auth"
+	"educational-game-db/internal/database"
+	"educational-game-db/internal/middleware"
+	"educational-game-db/internal/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ChangePassword replaces the caller's password after checking the current
+// one. Every other session is signed out and the caller gets fresh tokens.
+func (h *Handler) ChangePassword(c *gin.Context) {
+	account, ok := middleware.CurrentAccount(c)
+	if !ok {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Only accounts have a password to change"})
+		return
+	}
+
+	var req models.ChangePasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if !h.checkCurrentPassword(c, account, req.OldPassword) {
+		return
+	}
+	if req.NewPassword == req.OldPassword {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "New password must differ from the current one"})
+		return
+	}
+	if !h.checkPassword(c, req.NewPassword, account) {
+		return
+	}
+
+	if err := h.db.SetPassword(account.ID, req.NewPassword, false); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if err := h.db.RevokeAccountRefreshTokens(account.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	account, err := h.db.GetAccountByID(account.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	h.issueTokens(c, account, "Password changed")
+}
+
+// ForgotPassword sends a password reset link to the owner of an account. The
+// response is the same whether or not the account exists, so it cannot be
+// used to find out which usernames or emails are registered.
+func (h *Handler) ForgotPassword(c *gin.Context) {
+	var req models.ForgotPasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	login := strings.TrimSpace(req.Login)
+	account, err := h.db.GetAccountByUsername(login)
+	if err != nil && strings.Contains(login, "@") {
+		account, err = h.db.GetAccountByEmail(login)
+	}
+
+	if err == nil && account.IsActive {
+		if err := h.sendPasswordReset(account); err != nil {
+			log.Printf("Failed to send password reset to account %d: %v", account.ID, err)
+		}
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{"message": "If an account matches, a password reset link has been sent"})
+}
+
+func (h *Handler) sendPasswordReset(account *models.Account) error {
+	token, expiresAt, err := h.tokens.NewResetToken()
+	if err != nil {
+		return err
+	}
+	if err := h.db.CreatePasswordResetToken(account.ID, auth.HashToken(token), expiresAt); err != nil {
+		return err
+	}
+	return h.notifier.SendPasswordReset(account, token, expiresAt)
+}
+
+// ResetPassword sets a new password with a token from ForgotPassword
+func (h *Handler) ResetPassword(c *gin.Context) {
+	var req models.PasswordResetRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	tokenHash := auth.HashToken(req.Token)
+	account, err := h.db.PasswordResetAccount(tokenHash)
+	if err != nil {
+		if errors.Is(err, database.ErrInvalidResetToken) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if !h.checkPassword(c, req.NewPassword, account) {
+		return
+	}
+
+	if _, err := h.db.ResetPassword(tokenHash, req.NewPassword); err != nil {
+		if errors.Is(err, database.ErrInvalidResetToken) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Password reset; please log in"})
+}
+
+// SetPasswordPolicy sets the rules new passwords must follow
+func (h *Handler) SetPasswordPolicy(policy *auth.PasswordPolicy) {
+	h.passwords = policy
+}
+
+// checkPassword refuses a password the policy does not allow for account,
+// listing what is wrong with it
+func (h *Handler) checkPassword(c *gin.Context, password string, account *models.Account) bool {
+	err := h.passwords.Check(password, account)
+	if err == nil {
+		return true
+	}
+
+	var policyErr *auth.PasswordError
+	if errors.As(err, &policyErr) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "problems": policyErr.Problems})
+		return false
+	}
+	c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	return false
+}
+
+// temporaryPassword returns a password for staff to hand out; young students
+// get a passphrase they can read and type
+func (h *Handler) temporaryPassword(account *models.Account) (string, error) {
+	if account.Role == models.RoleStudent && h.passwords.IsYoung(account.Grade) {
+		return auth.GeneratePassphrase()
+	}
+	return auth.GenerateTemporaryPassword()
+}
+
+// SuggestPassphrase returns a random passphrase that the policy allows, for
+// sign-up forms to offer
+func (h *Handler) SuggestPassphrase(c *gin.Context) {
+	passphrase, err := auth.GeneratePassphrase()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"passphrase": passphrase})
+}
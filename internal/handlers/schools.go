@@ -0,0 +1,251 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"educational-game-db/internal/database"
+	"educational-game-db/internal/middleware"
+	"educational-game-db/internal/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// writeSchoolError answers a failed school, classroom or enrollment change
+func writeSchoolError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, database.ErrSchoolExists), errors.Is(err, database.ErrClassroomExists):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case errors.Is(err, database.ErrNameRequired):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, database.ErrWrongSchool), errors.Is(err, database.ErrInvalidEnrollment):
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
+
+// ListSchools returns every school to superadmins and API keys, and the
+// caller's own school to everyone else
+func (h *Handler) ListSchools(c *gin.Context) {
+	principal, ok := middleware.CurrentPrincipal(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
+		return
+	}
+
+	schools, err := h.db.ListSchools()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	visible := []models.School{}
+	for _, school := range schools {
+		if principal.CanAccessSchool(school.ID) {
+			visible = append(visible, school)
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"schools": visible})
+}
+
+func (h *Handler) CreateSchool(c *gin.Context) {
+	var req models.SchoolRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	school, err := h.db.CreateSchool(req.Name)
+	if err != nil {
+		writeSchoolError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, school)
+}
+
+func (h *Handler) GetSchool(c *gin.Context) {
+	id, _ := strconv.Atoi(c.Param("id"))
+	school, err := h.db.GetSchool(id)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, school)
+}
+
+// RenameSchool renames a school and the school name shown on its accounts
+func (h *Handler) RenameSchool(c *gin.Context) {
+	id, _ := strconv.Atoi(c.Param("id"))
+
+	var req models.SchoolRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	school, err := h.db.RenameSchool(id, req.Name)
+	if err != nil {
+		writeSchoolError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, school)
+}
+
+func (h *Handler) DeleteSchool(c *gin.Context) {
+	id, _ := strconv.Atoi(c.Param("id"))
+	if err := h.db.DeleteSchool(id); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "School deleted successfully"})
+}
+
+// MergeSchools folds the school in the route into the school named by into_id
+func (h *Handler) MergeSchools(c *gin.Context) {
+	id, _ := strconv.Atoi(c.Param("id"))
+
+	var req models.MergeSchoolsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if _, err := h.db.GetSchool(req.IntoID); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	school, err := h.db.MergeSchools(id, req.IntoID)
+	if err != nil {
+		writeSchoolError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, school)
+}
+
+func (h *Handler) ListClassrooms(c *gin.Context) {
+	id, _ := strconv.Atoi(c.Param("id"))
+	classrooms, err := h.db.ListClassrooms(id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"classrooms": classrooms})
+}
+
+func (h *Handler) CreateClassroom(c *gin.Context) {
+	id, _ := strconv.Atoi(c.Param("id"))
+
+	var req models.ClassroomRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	classroom, err := h.db.CreateClassroom(id, req)
+	if err != nil {
+		writeSchoolError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, classroom)
+}
+
+func (h *Handler) GetClassroom(c *gin.Context) {
+	id, _ := strconv.Atoi(c.Param("id"))
+	classroom, err := h.db.GetClassroom(id)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, classroom)
+}
+
+func (h *Handler) UpdateClassroom(c *gin.Context) {
+	id, _ := strconv.Atoi(c.Param("id"))
+
+	var req models.ClassroomRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	classroom, err := h.db.UpdateClassroom(id, req)
+	if err != nil {
+		writeSchoolError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, classroom)
+}
+
+func (h *Handler) DeleteClassroom(c *gin.Context) {
+	id, _ := strconv.Atoi(c.Param("id"))
+	if err := h.db.DeleteClassroom(id); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Classroom deleted successfully"})
+}
+
+// GetEnrollments lists who is enrolled in a classroom. Their accounts are
+// listed by GET /api/accounts?classroom_id=.
+func (h *Handler) GetEnrollments(c *gin.Context) {
+	id, _ := strconv.Atoi(c.Param("id"))
+	enrollments, err := h.db.GetEnrollments(id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"enrollments": enrollments})
+}
+
+// Enroll places an account of the classroom's school in the classroom
+func (h *Handler) Enroll(c *gin.Context) {
+	id, _ := strconv.Atoi(c.Param("id"))
+
+	var req models.EnrollRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if _, err := h.db.GetAccountByID(req.AccountID); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	enrollment, err := h.db.Enroll(id, req.AccountID, req.Role)
+	if err != nil {
+		writeSchoolError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, enrollment)
+}
+
+func (h *Handler) Unenroll(c *gin.Context) {
+	id, _ := strconv.Atoi(c.Param("id"))
+	accountID, err := strconv.Atoi(c.Param("account_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid account ID"})
+		return
+	}
+
+	if err := h.db.Unenroll(id, accountID); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Account unenrolled successfully"})
+}
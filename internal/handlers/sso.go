@@ -0,0 +1,259 @@
+package handlers
+
+import (
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+
+	"educational-game-db/internal/auth"
+	"educational-game-db/internal/database"
+	"educational-game-db/internal/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// ssoStateTTL is how long a sign-in may spend at the identity provider
+	ssoStateTTL = 10 * time.Minute
+	// ssoPortalURL is where the browser is sent back to after a sign-in
+	ssoPortalURL = "/"
+	// maxUsernameSuffix bounds the search for a free username when provisioning
+	maxUsernameSuffix = 1000
+	// ssoStateCookie holds the hash of the state of the sign-in the browser
+	// started, so a callback can only finish a sign-in begun by that browser
+	ssoStateCookie = "sso_state"
+)
+
+// SetSSO enables single sign-on through an OpenID Connect identity provider.
+// Accounts created on first sign-in are given the grade and school in provisioning.
+func (h *Handler) SetSSO(provider *auth.OIDCProvider, provisioning models.SSOProvisioning) {
+	h.sso = provider
+	h.ssoProvisioning = provisioning
+}
+
+// GetSSO tells the portal whether to offer single sign-on
+func (h *Handler) GetSSO(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"enabled": h.sso != nil})
+}
+
+// StartSSO sends the browser to the identity provider to sign in
+func (h *Handler) StartSSO(c *gin.Context) {
+	if h.sso == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Single sign-on is not configured"})
+		return
+	}
+
+	state, err := auth.RandomToken(32)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	nonce, err := auth.RandomToken(32)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	verifier, err := auth.NewPKCEVerifier()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	stateHash := auth.HashToken(state)
+	if err := h.db.CreateSSOState(stateHash, nonce, verifier, time.Now().Add(ssoStateTTL)); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	setSSOStateCookie(c, stateHash, int(ssoStateTTL/time.Second))
+	c.Redirect(http.StatusFound, h.sso.AuthCodeURL(state, nonce, verifier))
+}
+
+// SSOCallback finishes a sign-in when the identity provider sends the browser
+// back. The portal is handed a refresh token in the URL fragment, which never
+// reaches a server, and exchanges it for an access token.
+func (h *Handler) SSOCallback(c *gin.Context) {
+	if h.sso == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Single sign-on is not configured"})
+		return
+	}
+
+	if reason := c.Query("error"); reason != "" {
+		if description := c.Query("error_description"); description != "" {
+			reason = description
+		}
+		ssoFailed(c, "The identity provider did not sign you in: "+reason)
+		return
+	}
+
+	// Without this, anyone could send a victim the callback of a sign-in
+	// they started themselves and have the victim signed in as them
+	stateHash := auth.HashToken(c.Query("state"))
+	cookie, err := c.Cookie(ssoStateCookie)
+	setSSOStateCookie(c, "", -1)
+	if err != nil || subtle.ConstantTimeCompare([]byte(cookie), []byte(stateHash)) != 1 {
+		ssoFailed(c, database.ErrInvalidSSOState.Error())
+		return
+	}
+
+	state, err := h.db.ConsumeSSOState(stateHash)
+	if err != nil {
+		if !errors.Is(err, database.ErrInvalidSSOState) {
+			log.Printf("Failed to get single sign-on state: %v", err)
+		}
+		ssoFailed(c, database.ErrInvalidSSOState.Error())
+		return
+	}
+
+	identity, err := h.sso.Exchange(c.Request.Context(), c.Query("code"), state.CodeVerifier, state.Nonce)
+	if err != nil {
+		log.Printf("Single sign-on failed: %v", err)
+		ssoFailed(c, "Could not verify your sign-in with the identity provider")
+		return
+	}
+
+	account, err := h.ssoAccount(identity)
+	if err != nil {
+		ssoFailed(c, err.Error())
+		return
+	}
+
+	var refusal string
+	switch {
+	case !account.IsActive:
+		refusal = "Account is inactive"
+	case account.AwaitingConsent():
+		refusal = "Account is waiting for a guardian's consent"
+	case account.TwoFactorEnabled:
+		// Single sign-on would otherwise skip the account's second factor
+		refusal = "Your account uses two-factor authentication; log in with your password and code"
+	}
+	if refusal != "" {
+		h.recordAuthEvent(account.Username, &account.ID, c.ClientIP(), models.AuthOutcomeDenied)
+		ssoFailed(c, refusal)
+		return
+	}
+
+	refreshToken, expiresAt, err := h.tokens.NewRefreshToken()
+	if err == nil {
+		err = h.db.CreateRefreshToken(account.ID, auth.HashToken(refreshToken), expiresAt)
+	}
+	if err != nil {
+		log.Printf("Failed to start session for account %d: %v", account.ID, err)
+		ssoFailed(c, "Could not start your session; please try again")
+		return
+	}
+
+	h.recordLoginSuccess(c, account)
+	c.Redirect(http.StatusFound, ssoPortalURL+"#sso="+url.QueryEscape(refreshToken))
+}
+
+// setSSOStateCookie sets the state cookie for the SSO routes, which share the
+// path of the request, for maxAge seconds or, when it is negative, clears it
+func setSSOStateCookie(c *gin.Context, value string, maxAge int) {
+	http.SetCookie(c.Writer, &http.Cookie{
+		Name:     ssoStateCookie,
+		Value:    value,
+		Path:     path.Dir(c.Request.URL.Path),
+		MaxAge:   maxAge,
+		Secure:   c.Request.TLS != nil,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+// ssoFailed sends the browser back to the portal with a message to show
+func ssoFailed(c *gin.Context, message string) {
+	c.Redirect(http.StatusFound, ssoPortalURL+"#sso_error="+url.QueryEscape(message))
+}
+
+// ssoAccount finds the account an identity provider account signs in to:
+// the one linked to it, else the one with its verified email, which is then
+// linked. Failing both, a new student account is provisioned.
+func (h *Handler) ssoAccount(identity *auth.OIDCIdentity) (*models.Account, error) {
+	if account, err := h.db.GetAccountByOIDCSubject(identity.Subject); err == nil {
+		return account, nil
+	}
+
+	if identity.Email == "" {
+		return nil, fmt.Errorf("the identity provider did not share your email address")
+	}
+
+	if account, err := h.db.GetAccountByEmail(identity.Email); err == nil {
+		// An unverified email could be anyone's, so it must not take over an account
+		if !identity.EmailVerified {
+			return nil, fmt.Errorf("your email address is not verified by the identity provider")
+		}
+		if err := h.db.LinkOIDCSubject(account.ID, identity.Subject); err != nil {
+			if errors.Is(err, database.ErrOIDCSubjectTaken) {
+				return nil, fmt.Errorf("the account with your email address is linked to another identity")
+			}
+			return nil, err
+		}
+		return h.db.GetAccountByID(account.ID)
+	}
+
+	return h.provisionSSOAccount(identity)
+}
+
+// provisionSSOAccount creates a student account for someone signing in for
+// the first time. Its password is random and unknown; the owner signs in
+// through the identity provider, or sets a password with a reset link.
+func (h *Handler) provisionSSOAccount(identity *auth.OIDCIdentity) (*models.Account, error) {
+	password, err := auth.GenerateTemporaryPassword()
+	if err != nil {
+		return nil, err
+	}
+
+	username, err := h.freeUsername(identity)
+	if err != nil {
+		return nil, err
+	}
+
+	account, err := h.db.CreateAccount(models.CreateAccountRequest{
+		Username:    username,
+		Email:       identity.Email,
+		Password:    password,
+		FirstName:   identity.GivenName,
+		LastName:    identity.FamilyName,
+		Grade:       h.ssoProvisioning.Grade,
+		School:      h.ssoProvisioning.School,
+		OIDCSubject: identity.Subject,
+	})
+	if err != nil {
+		return nil, err
+	}
+	h.evaluateAchievements(account.ID)
+
+	return account, nil
+}
+
+// freeUsername picks an unused username from the identity's preferred
+// username or email, adding a number if it is taken
+func (h *Handler) freeUsername(identity *auth.OIDCIdentity) (string, error) {
+	base := identity.PreferredUsername
+	if base == "" {
+		base = identity.Email
+	}
+	base, _, _ = strings.Cut(strings.ToLower(base), "@")
+	if base == "" {
+		base = "student"
+	}
+
+	for i := 1; i <= maxUsernameSuffix; i++ {
+		username := base
+		if i > 1 {
+			username = fmt.Sprintf("%s%d", base, i)
+		}
+		if _, err := h.db.GetAccountByUsername(username); err != nil {
+			return username, nil
+		}
+	}
+	return "", fmt.Errorf("no free username for %s", base)
+}
@@ -0,0 +1,259 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+
+	"educational-game-db/internal/middleware"
+	"educational-game-db/internal/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// teacherClassroom loads the classroom named by the :id route parameter when
+// the caller teaches it. School admins, superadmins and API keys may also
+// manage the rosters of classrooms in schools they can access.
+func (h *Handler) teacherClassroom(c *gin.Context) (*models.Classroom, bool) {
+	principal, ok := middleware.CurrentPrincipal(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
+		return nil, false
+	}
+
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid classroom ID"})
+		return nil, false
+	}
+
+	classroom, err := h.db.GetClassroom(id)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return nil, false
+	}
+
+	allowed := principal.CanAccessSchool(classroom.SchoolID)
+	if principal.Account != nil && principal.Account.Role == models.RoleTeacher {
+		allowed, err = h.db.IsClassroomTeacher(classroom.ID, principal.Account.ID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return nil, false
+		}
+	}
+	if !allowed {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You do not teach this classroom"})
+		return nil, false
+	}
+
+	return classroom, true
+}
+
+// GetTeacherClassrooms lists the classrooms the caller teaches
+func (h *Handler) GetTeacherClassrooms(c *gin.Context) {
+	account, ok := middleware.CurrentAccount(c)
+	if !ok {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Teacher endpoints require a staff account"})
+		return
+	}
+
+	classrooms, err := h.db.TeacherClassrooms(account.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"classrooms": classrooms})
+}
+
+// CreateTeacherClassroom adds a classroom to the caller's school with the
+// caller as its teacher
+func (h *Handler) CreateTeacherClassroom(c *gin.Context) {
+	account, ok := middleware.CurrentAccount(c)
+	if !ok {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Teacher endpoints require a staff account"})
+		return
+	}
+	if account.SchoolID == nil {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "Your account does not belong to a school"})
+		return
+	}
+
+	var req models.ClassroomRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	classroom, err := h.db.CreateClassroom(*account.SchoolID, req)
+	if err != nil {
+		writeSchoolError(c, err)
+		return
+	}
+	if _, err := h.db.Enroll(classroom.ID, account.ID, models.EnrollmentTeacher); err != nil {
+		writeSchoolError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, classroom)
+}
+
+// GetRoster returns a classroom and the students enrolled in it
+func (h *Handler) GetRoster(c *gin.Context) {
+	classroom, ok := h.teacherClassroom(c)
+	if !ok {
+		return
+	}
+
+	page, err := h.db.ListAccounts(models.AccountListOptions{
+		ClassroomID: &classroom.ID,
+		Roles:       []string{models.RoleStudent},
+		Sort:        "last_name",
+		Limit:       models.MaxPageSize,
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"classroom": classroom, "students": page.Accounts, "total": page.Total})
+}
+
+// AddToRoster enrolls students of the classroom's school by username
+func (h *Handler) AddToRoster(c *gin.Context) {
+	classroom, ok := h.teacherClassroom(c)
+	if !ok {
+		return
+	}
+
+	var req models.AddStudentsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	result, err := h.db.AddToRoster(classroom.ID, req.Usernames)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, result)
+}
+
+// RemoveFromRoster takes a student out of a classroom
+func (h *Handler) RemoveFromRoster(c *gin.Context) {
+	classroom, ok := h.teacherClassroom(c)
+	if !ok {
+		return
+	}
+
+	accountID, err := strconv.Atoi(c.Param("account_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid account ID"})
+		return
+	}
+	student, err := h.db.GetAccountByID(accountID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	if student.Role != models.RoleStudent {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Only students can be removed from a roster"})
+		return
+	}
+
+	if err := h.db.Unenroll(classroom.ID, accountID); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Student removed from roster"})
+}
+
+// rosterStudent loads the student named by the :id route parameter, whose
+// access RequireAccountAccess has already checked
+func (h *Handler) rosterStudent(c *gin.Context) (*models.Account, bool) {
+	id, _ := strconv.Atoi(c.Param("id"))
+	student, err := h.db.GetAccountByID(id)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return nil, false
+	}
+	if student.Role != models.RoleStudent {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Only student accounts can be managed here"})
+		return nil, false
+	}
+	return student, true
+}
+
+// ResetStudentPassword sets a temporary password for a student, generating
+// one when none is given, and signs the student out everywhere. The student
+// must choose their own password when they next log in. The temporary
+// password is only ever shown in this response.
+func (h *Handler) ResetStudentPassword(c *gin.Context) {
+	student, ok := h.rosterStudent(c)
+	if !ok {
+		return
+	}
+
+	var req models.ResetPasswordRequest
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	password := req.Password
+	if password == "" {
+		var err error
+		if password, err = h.temporaryPassword(student); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+	} else if !h.checkPassword(c, password, student) {
+		return
+	}
+
+	if err := h.db.SetPassword(student.ID, password, true); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if err := h.db.RevokeAccountRefreshTokens(student.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"account_id": student.ID, "username": student.Username, "password": password})
+}
+
+// DeactivateStudent stops a student from logging in and ends their sessions
+func (h *Handler) DeactivateStudent(c *gin.Context) {
+	h.setStudentActive(c, false)
+}
+
+// ActivateStudent lets a deactivated student log in again
+func (h *Handler) ActivateStudent(c *gin.Context) {
+	h.setStudentActive(c, true)
+}
+
+func (h *Handler) setStudentActive(c *gin.Context, active bool) {
+	student, ok := h.rosterStudent(c)
+	if !ok {
+		return
+	}
+
+	account, err := h.db.SetAccountActive(student.ID, active)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if !active {
+		if err := h.db.RevokeAccountRefreshTokens(student.ID); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	c.JSON(http.StatusOK, account)
+}
@@ -0,0 +1,282 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"educational-game-db/internal/auth"
+	"educational-game-db/internal/database"
+	"educational-game-db/internal/middleware"
+	"educational-game-db/internal/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// SetTwoFactorRoles sets the roles that must use two-factor authentication
+func (h *Handler) SetTwoFactorRoles(roles []string) {
+	h.twoFactorRoles = roles
+}
+
+// requiresTwoFactor reports whether accounts with a role must use a second factor
+func (h *Handler) requiresTwoFactor(role string) bool {
+	for _, r := range h.twoFactorRoles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
+// verifySecondFactor checks a TOTP code, or failing that a recovery code,
+// for an account with two-factor authentication enabled. Each code works once.
+func (h *Handler) verifySecondFactor(account *models.Account, code string) (bool, error) {
+	secret, err := h.db.GetTOTPSecret(account.ID)
+	if err != nil {
+		return false, err
+	}
+
+	if step, ok := auth.VerifyTOTP(secret.Secret, code, time.Now()); ok {
+		return h.db.UseTOTPStep(account.ID, step)
+	}
+
+	return h.db.UseRecoveryCode(account.ID, auth.HashRecoveryCode(code))
+}
+
+// twoFactorAccount returns the calling account, refusing API keys
+func twoFactorAccount(c *gin.Context) (*models.Account, bool) {
+	account, ok := middleware.CurrentAccount(c)
+	if !ok {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Only accounts can use two-factor authentication"})
+	}
+	return account, ok
+}
+
+// GetTwoFactor reports whether the caller has a second factor, and whether
+// their role requires one
+func (h *Handler) GetTwoFactor(c *gin.Context) {
+	account, ok := twoFactorAccount(c)
+	if !ok {
+		return
+	}
+
+	remaining, err := h.db.CountRecoveryCodes(account.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.TwoFactorStatus{
+		Enabled:                account.TwoFactorEnabled,
+		Required:               h.requiresTwoFactor(account.Role),
+		RecoveryCodesRemaining: remaining,
+	})
+}
+
+// SetupTwoFactor starts enrolling an authenticator app. The secret is shown
+// once more as a QR code, and takes effect when a code from it is confirmed.
+func (h *Handler) SetupTwoFactor(c *gin.Context) {
+	account, ok := twoFactorAccount(c)
+	if !ok {
+		return
+	}
+
+	secret, err := auth.GenerateTOTPSecret()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := h.db.SetTOTPSecret(account.ID, secret); err != nil {
+		if errors.Is(err, database.ErrTwoFactorEnabled) {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.TwoFactorSetup{
+		Secret:     secret,
+		OTPAuthURI: auth.TOTPURI(account.Username, secret),
+		QRCodeURL:  "/api/2fa/qr.png",
+	})
+}
+
+// pendingTOTPSecret returns the caller's secret while it is still being enrolled
+func (h *Handler) pendingTOTPSecret(c *gin.Context, account *models.Account) (*models.TOTPSecret, bool) {
+	secret, err := h.db.GetTOTPSecret(account.ID)
+	if err != nil {
+		if errors.Is(err, database.ErrNoTOTPSecret) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Start two-factor setup first"})
+			return nil, false
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return nil, false
+	}
+
+	if secret.ConfirmedAt != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": database.ErrTwoFactorEnabled.Error()})
+		return nil, false
+	}
+
+	return secret, true
+}
+
+// GetTwoFactorQRCode renders the secret being enrolled as a PNG QR code
+func (h *Handler) GetTwoFactorQRCode(c *gin.Context) {
+	account, ok := twoFactorAccount(c)
+	if !ok {
+		return
+	}
+
+	secret, ok := h.pendingTOTPSecret(c, account)
+	if !ok {
+		return
+	}
+
+	png, err := auth.TOTPQRCode(auth.TOTPURI(account.Username, secret.Secret))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.Header("Cache-Control", "no-store")
+	c.Data(http.StatusOK, "image/png", png)
+}
+
+// ConfirmTwoFactor enables two-factor authentication once the caller proves
+// their authenticator works, and returns their recovery codes. The codes are
+// not stored in the clear and cannot be shown again.
+func (h *Handler) ConfirmTwoFactor(c *gin.Context) {
+	account, ok := twoFactorAccount(c)
+	if !ok {
+		return
+	}
+
+	var req models.TwoFactorCodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	secret, ok := h.pendingTOTPSecret(c, account)
+	if !ok {
+		return
+	}
+
+	step, valid := auth.VerifyTOTP(secret.Secret, req.Code, time.Now())
+	if !valid {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid two-factor code"})
+		return
+	}
+
+	codes, hashes, err := newRecoveryCodes()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := h.db.EnableTwoFactor(account.ID, step, hashes); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":        "Two-factor authentication enabled",
+		"recovery_codes": codes,
+	})
+}
+
+// RegenerateRecoveryCodes replaces the caller's recovery codes, given a
+// current code from their authenticator
+func (h *Handler) RegenerateRecoveryCodes(c *gin.Context) {
+	account, ok := twoFactorAccount(c)
+	if !ok {
+		return
+	}
+
+	var req models.TwoFactorCodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if !account.TwoFactorEnabled {
+		c.JSON(http.StatusNotFound, gin.H{"error": database.ErrNoTOTPSecret.Error()})
+		return
+	}
+
+	secret, err := h.db.GetTOTPSecret(account.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	step, valid := auth.VerifyTOTP(secret.Secret, req.Code, time.Now())
+	if valid {
+		if valid, err = h.db.UseTOTPStep(account.ID, step); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+	}
+	if !valid {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Invalid two-factor code"})
+		return
+	}
+
+	codes, hashes, err := newRecoveryCodes()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if err := h.db.ReplaceRecoveryCodes(account.ID, hashes); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"recovery_codes": codes})
+}
+
+// DisableTwoFactor turns off the caller's second factor after checking their
+// password. Accounts whose role requires a second factor cannot turn it off.
+func (h *Handler) DisableTwoFactor(c *gin.Context) {
+	account, ok := twoFactorAccount(c)
+	if !ok {
+		return
+	}
+
+	var req models.DisableTwoFactorRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if h.requiresTwoFactor(account.Role) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Two-factor authentication is required for your role"})
+		return
+	}
+	if !h.checkCurrentPassword(c, account, req.Password) {
+		return
+	}
+
+	if err := h.db.DisableTwoFactor(account.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Two-factor authentication disabled"})
+}
+
+// newRecoveryCodes generates recovery codes and the hashes stored for them
+func newRecoveryCodes() ([]string, []string, error) {
+	codes, err := auth.GenerateRecoveryCodes()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	hashes := make([]string, len(codes))
+	for i, code := range codes {
+		hashes[i] = auth.HashRecoveryCode(code)
+	}
+	return codes, hashes, nil
+}
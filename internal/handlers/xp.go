@@ -0,0 +1,85 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"educational-game-db/internal/database"
+	"educational-game-db/internal/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RecordXP appends an experience event to an account's ledger. It is open to
+// staff and to game servers' API keys, never to students themselves.
+func (h *Handler) RecordXP(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid account ID"})
+		return
+	}
+
+	var req models.RecordXPRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	before, err := h.db.GetAccountByID(id)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	event, account, err := h.db.RecordXPEvent(models.XPEvent{
+		AccountID: id,
+		Amount:    req.Amount,
+		Source:    req.Source,
+		Reason:    req.Reason,
+		GameRef:   req.GameRef,
+	})
+	if err != nil {
+		if errors.Is(err, database.ErrNegativeExperience) {
+			c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"event":         event,
+		"account":       account,
+		"level_up":      account.GameLevel > before.GameLevel,
+		"next_level_xp": h.db.LevelCurve().XPForLevel(account.GameLevel + 1),
+		"achievements":  h.evaluateAchievements(account.ID),
+	})
+}
+
+// GetXPEvents returns the most recent entries of an account's experience ledger
+func (h *Handler) GetXPEvents(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid account ID"})
+		return
+	}
+
+	limit := models.DefaultPageSize
+	if value := c.Query("limit"); value != "" {
+		limit, err = strconv.Atoi(value)
+		if err != nil || limit <= 0 || limit > models.MaxPageSize {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("limit must be between 1 and %d", models.MaxPageSize)})
+			return
+		}
+	}
+
+	events, err := h.db.GetXPEvents(id, limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"events": events})
+}
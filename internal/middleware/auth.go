@@ -0,0 +1,314 @@
+package middleware
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"educational-game-db/internal/auth"
+	"educational-game-db/internal/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// principalContextKey is the gin context key holding the authenticated principal
+	principalContextKey = "principal"
+	// accountContextKey is the gin context key holding the authenticated account
+	accountContextKey = "account"
+)
+
+// AccountLookup loads accounts referenced by verified tokens, and the
+// rosters of teachers
+type AccountLookup interface {
+	GetAccountByID(id int) (*models.Account, error)
+	TeacherRoster(teacherID int) ([]int, error)
+}
+
+// SchoolLookup loads the schools and classrooms referenced by routes
+type SchoolLookup interface {
+	GetSchool(id int) (*models.School, error)
+	GetClassroom(id int) (*models.Classroom, error)
+}
+
+// APIKeyLookup resolves API keys presented in the X-API-Key header
+type APIKeyLookup interface {
+	GetAPIKeyByHash(keyHash string) (*models.APIKey, error)
+	TouchAPIKey(id int) error
+}
+
+// RequireAuth rejects requests that carry neither a valid X-API-Key header
+// nor a valid bearer access token, and stores the resulting principal on the
+// gin context
+func RequireAuth(tokens *auth.TokenService, accounts AccountLookup, keys APIKeyLookup) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if apiKey := c.GetHeader("X-API-Key"); apiKey != "" {
+			key, err := keys.GetAPIKeyByHash(auth.HashToken(apiKey))
+			if err != nil || !key.IsUsable(time.Now()) {
+				abortUnauthorized(c, "Invalid API key")
+				return
+			}
+
+			if err := keys.TouchAPIKey(key.ID); err != nil {
+				log.Printf("Failed to record API key usage: %v", err)
+			}
+
+			c.Set(principalContextKey, &auth.Principal{APIKey: key})
+			c.Next()
+			return
+		}
+
+		header := c.GetHeader("Authorization")
+		tokenString, ok := strings.CutPrefix(header, "Bearer ")
+		if !ok || tokenString == "" {
+			abortUnauthorized(c, "Authentication required")
+			return
+		}
+
+		claims, err := tokens.ParseAccessToken(tokenString)
+		if err != nil {
+			abortUnauthorized(c, err.Error())
+			return
+		}
+
+		accountID, err := claims.AccountID()
+		if err != nil {
+			abortUnauthorized(c, auth.ErrInvalidToken.Error())
+			return
+		}
+
+		account, err := accounts.GetAccountByID(accountID)
+		if err != nil || !account.IsActive || account.AwaitingConsent() {
+			abortUnauthorized(c, "Account is not available")
+			return
+		}
+
+		principal := &auth.Principal{Account: account}
+		if account.Role == models.RoleTeacher {
+			if principal.Roster, err = accounts.TeacherRoster(account.ID); err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+				c.Abort()
+				return
+			}
+		}
+
+		SetCurrentPrincipal(c, principal)
+		c.Next()
+	}
+}
+
+// RequireCurrentPassword stops accounts that must reset their password from
+// using any route but the allowed ones, such as the password change endpoint
+func RequireCurrentPassword(allowed ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		account, ok := CurrentAccount(c)
+		if !ok || !account.MustResetPassword {
+			c.Next()
+			return
+		}
+
+		for _, path := range allowed {
+			if c.FullPath() == path {
+				c.Next()
+				return
+			}
+		}
+
+		c.JSON(http.StatusForbidden, gin.H{"error": "Password change required", "must_reset_password": true})
+		c.Abort()
+	}
+}
+
+// RequireTwoFactor stops accounts whose role must use two-factor
+// authentication, but has not set it up, from using any route but the allowed
+// ones, such as the two-factor setup endpoints
+func RequireTwoFactor(roles []string, allowed ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		account, ok := CurrentAccount(c)
+		if !ok || account.TwoFactorEnabled || !containsString(roles, account.Role) {
+			c.Next()
+			return
+		}
+
+		if containsString(allowed, c.FullPath()) {
+			c.Next()
+			return
+		}
+
+		c.JSON(http.StatusForbidden, gin.H{"error": "Two-factor authentication required", "two_factor_setup_required": true})
+		c.Abort()
+	}
+}
+
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+// RequirePermission rejects requests whose principal lacks perm
+func RequirePermission(perm auth.Permission) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		principal, ok := CurrentPrincipal(c)
+		if !ok {
+			abortUnauthorized(c, "Authentication required")
+			return
+		}
+
+		if !principal.Can(perm) {
+			abortForbidden(c)
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// RequireAccountAccess rejects requests for the account named by the :id
+// route parameter unless the principal may act on it
+func RequireAccountAccess(accounts AccountLookup) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		principal, ok := CurrentPrincipal(c)
+		if !ok {
+			abortUnauthorized(c, "Authentication required")
+			return
+		}
+
+		id, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid account ID"})
+			c.Abort()
+			return
+		}
+
+		target, err := accounts.GetAccountByID(id)
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			c.Abort()
+			return
+		}
+
+		if !principal.CanAccess(target) {
+			abortForbidden(c)
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// RequireSchoolAccess rejects requests for the school named by the :id route
+// parameter unless the principal belongs to it
+func RequireSchoolAccess(schools SchoolLookup) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		principal, ok := CurrentPrincipal(c)
+		if !ok {
+			abortUnauthorized(c, "Authentication required")
+			return
+		}
+
+		id, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid school ID"})
+			c.Abort()
+			return
+		}
+
+		if _, err := schools.GetSchool(id); err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			c.Abort()
+			return
+		}
+
+		if !principal.CanAccessSchool(id) {
+			abortForbidden(c)
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// RequireClassroomAccess rejects requests for the classroom named by the :id
+// route parameter unless the principal belongs to its school
+func RequireClassroomAccess(schools SchoolLookup) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		principal, ok := CurrentPrincipal(c)
+		if !ok {
+			abortUnauthorized(c, "Authentication required")
+			return
+		}
+
+		id, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid classroom ID"})
+			c.Abort()
+			return
+		}
+
+		classroom, err := schools.GetClassroom(id)
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			c.Abort()
+			return
+		}
+
+		if !principal.CanAccessSchool(classroom.SchoolID) {
+			abortForbidden(c)
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// SetCurrentAccount stores an authenticated account and its principal on the gin context
+func SetCurrentAccount(c *gin.Context, account *models.Account) {
+	SetCurrentPrincipal(c, &auth.Principal{Account: account})
+}
+
+// SetCurrentPrincipal stores an authenticated principal, and its account if
+// it has one, on the gin context
+func SetCurrentPrincipal(c *gin.Context, principal *auth.Principal) {
+	if principal.Account != nil {
+		c.Set(accountContextKey, principal.Account)
+	}
+	c.Set(principalContextKey, principal)
+}
+
+// CurrentAccount returns the authenticated account stored by RequireAuth.
+// It reports false for requests authenticated with an API key.
+func CurrentAccount(c *gin.Context) (*models.Account, bool) {
+	value, exists := c.Get(accountContextKey)
+	if !exists {
+		return nil, false
+	}
+	account, ok := value.(*models.Account)
+	return account, ok
+}
+
+// CurrentPrincipal returns the authenticated principal stored by RequireAuth
+func CurrentPrincipal(c *gin.Context) (*auth.Principal, bool) {
+	value, exists := c.Get(principalContextKey)
+	if !exists {
+		return nil, false
+	}
+	principal, ok := value.(*auth.Principal)
+	return principal, ok
+}
+
+func abortUnauthorized(c *gin.Context, message string) {
+	c.Header("WWW-Authenticate", `Bearer realm="educational-game-db"`)
+	c.JSON(http.StatusUnauthorized, gin.H{"error": message})
+	c.Abort()
+}
+
+func abortForbidden(c *gin.Context) {
+	c.JSON(http.StatusForbidden, gin.H{"error": "Insufficient permissions"})
+	c.Abort()
+}
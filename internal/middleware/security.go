@@ -68,38 +68,6 @@ func (rl *RateLimiter) Cleanup() {
 	rl.limiter = make(map[string]*rate.Limiter)
 }
 
-// AuthMiddleware provides basic authentication validation
-func AuthMiddleware() gin.HandlerFunc {
-	return func(c *gin.Context) {
-		// For now, this is a placeholder for authentication
-		// In a real application, you would validate JWT tokens or API keys here
-
-		// Check for API key in header
-		apiKey := c.GetHeader("X-API-Key")
-		if apiKey == "" {
-			// Allow requests without API key for public endpoints
-			c.Next()
-			return
-		}
-
-		// Basic API key validation (in production, use proper validation)
-		validAPIKeys := map[string]bool{
-			"dev-key-123":   true,
-			"admin-key-456": true,
-		}
-
-		if !validAPIKeys[apiKey] {
-			c.JSON(http.StatusUnauthorized, gin.H{
-				"error": "Invalid API key",
-			})
-			c.Abort()
-			return
-		}
-
-		c.Next()
-	}
-}
-
 // SecurityHeaders adds common security headers
 func SecurityHeaders() gin.HandlerFunc {
 	return func(c *gin.Context) {
@@ -4,43 +4,108 @@ import (
 	"time"
 )
 
+// Account roles, from least to most privileged
+const (
+	RoleStudent     = "student"
+	RoleGuardian    = "guardian"
+	RoleTeacher     = "teacher"
+	RoleSchoolAdmin = "school_admin"
+	RoleSuperadmin  = "superadmin"
+)
+
+// Roles lists every valid account role
+var Roles = []string{RoleStudent, RoleGuardian, RoleTeacher, RoleSchoolAdmin, RoleSuperadmin}
+
+// IsValidRole reports whether role is a known account role
+func IsValidRole(role string) bool {
+	for _, r := range Roles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
 // Account represents a student account in the educational game
 type Account struct {
-	ID           int       `json:"id" db:"id"`
-	Username     string    `json:"username" db:"username" binding:"required"`
-	Email        string    `json:"email" db:"email" binding:"required,email"`
-	PasswordHash string    `json:"-" db:"password_hash"`
-	FirstName    string    `json:"first_name" db:"first_name"`
-	LastName     string    `json:"last_name" db:"last_name"`
-	Grade        int       `json:"grade" db:"grade"`
-	School       string    `json:"school" db:"school"`
-	GameLevel    int       `json:"game_level" db:"game_level"`
-	Experience   int       `json:"experience" db:"experience"`
-	CreatedAt    time.Time `json:"created_at" db:"created_at"`
-	UpdatedAt    time.Time `json:"updated_at" db:"updated_at"`
-	IsActive     bool      `json:"is_active" db:"is_active"`
+	ID                int       `json:"id" db:"id"`
+	Username          string    `json:"username" db:"username" binding:"required"`
+	Email             string    `json:"email" db:"email" binding:"required,email"`
+	PasswordHash      string    `json:"-" db:"password_hash"`
+	FirstName         string    `json:"first_name" db:"first_name"`
+	LastName          string    `json:"last_name" db:"last_name"`
+	Grade             int       `json:"grade" db:"grade"`
+	School            string    `json:"school" db:"school"`
+	SchoolID          *int      `json:"school_id" db:"school_id"`
+	Role              string    `json:"role" db:"role"`
+	GameLevel         int       `json:"game_level" db:"game_level"`
+	Experience        int       `json:"experience" db:"experience"`
+	CreatedAt         time.Time `json:"created_at" db:"created_at"`
+	UpdatedAt         time.Time `json:"updated_at" db:"updated_at"`
+	IsActive          bool      `json:"is_active" db:"is_active"`
+	LeaderboardOptOut bool      `json:"leaderboard_opt_out" db:"leaderboard_opt_out"`
+	ConsentStatus     string    `json:"consent_status" db:"consent_status"`
+	MustResetPassword bool      `json:"must_reset_password" db:"must_reset_password"`
+	TwoFactorEnabled  bool      `json:"two_factor_enabled" db:"two_factor_enabled"`
+	// OIDCSubject links the account to its identity provider account
+	OIDCSubject *string `json:"oidc_subject,omitempty" db:"oidc_subject"`
+	// DeletedAt is set while a deleted account waits to be purged
+	DeletedAt *time.Time `json:"deleted_at,omitempty" db:"deleted_at"`
+	// Version goes up with every account update that changes one of the
+	// fields it writes; an update that changes nothing keeps it
+	Version int `json:"version" db:"version"`
+	// ExternalID is the account's ID in the student information system it
+	// is imported from
+	ExternalID *string `json:"external_id,omitempty" db:"external_id"`
+}
+
+// AwaitingConsent reports whether the account cannot sign in until a guardian consents
+func (a *Account) AwaitingConsent() bool {
+	return a.ConsentStatus == ConsentPending
 }
 
-// CreateAccountRequest represents the request payload for creating an account
+// CreateAccountRequest represents the request payload for creating an account.
+// The school is given either by ID or by name. Sign-up refuses an unknown name;
+// callers allowed to manage schools create the school with it instead.
 type CreateAccountRequest struct {
 	Username  string `json:"username" binding:"required"`
 	Email     string `json:"email" binding:"required,email"`
-	Password  string `json:"password" binding:"required,min=6"`
+	Password  string `json:"password" binding:"required"`
 	FirstName string `json:"first_name"`
 	LastName  string `json:"last_name"`
 	Grade     int    `json:"grade"`
 	School    string `json:"school"`
+	SchoolID  *int   `json:"school_id"`
+	// GuardianEmail is who to ask for consent when the account needs it
+	GuardianEmail string `json:"guardian_email" binding:"omitempty,email"`
+
+	// Role, ConsentStatus, MustResetPassword, OIDCSubject and ExternalID are
+	// set by the server, never from the request body; zero values create an
+	// active student
+	Role              string `json:"-"`
+	ConsentStatus     string `json:"-"`
+	MustResetPassword bool   `json:"-"`
+	OIDCSubject       string `json:"-"`
+	ExternalID        string `json:"-"`
 }
 
-// UpdateAccountRequest represents the request payload for updating an account
+// UpdateAccountRequest represents the request payload for updating an account.
+// Game level and experience come from the XP ledger and cannot be set here.
 type UpdateAccountRequest struct {
-	FirstName  string `json:"first_name"`
-	LastName   string `json:"last_name"`
-	Grade      int    `json:"grade"`
-	School     string `json:"school"`
-	GameLevel  int    `json:"game_level"`
-	Experience int    `json:"experience"`
-	IsActive   bool   `json:"is_active"`
+	FirstName string `json:"first_name"`
+	LastName  string `json:"last_name"`
+	Grade     int    `json:"grade"`
+	School    string `json:"school"`
+	SchoolID  *int   `json:"school_id"`
+	IsActive  bool   `json:"is_active"`
+	// Version, when set, makes the update fail if the account has changed since
+	Version *int `json:"version,omitempty"`
+
+	// Username, Email and ExternalID are only changed by imports, never from
+	// the request body; nil leaves them as they are
+	Username   *string `json:"-"`
+	Email      *string `json:"-"`
+	ExternalID *string `json:"-"`
 }
 
 // AccountStats represents aggregated statistics about accounts
@@ -0,0 +1,21 @@
+package models
+
+import (
+	"time"
+)
+
+// Achievement records a badge awarded to an account. AwardedBy is the staff
+// account that awarded it by hand, or nil when the badge engine did.
+type Achievement struct {
+	AccountID int       `json:"account_id" db:"account_id"`
+	BadgeID   string    `json:"badge_id" db:"badge_id"`
+	AwardedAt time.Time `json:"awarded_at" db:"awarded_at"`
+	AwardedBy *int      `json:"awarded_by,omitempty" db:"awarded_by"`
+	Note      string    `json:"note,omitempty" db:"note"`
+}
+
+// AwardAchievementRequest represents a manual badge award by staff
+type AwardAchievementRequest struct {
+	BadgeID string `json:"badge_id" binding:"required"`
+	Note    string `json:"note" binding:"max=255"`
+}
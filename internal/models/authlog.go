@@ -0,0 +1,64 @@
+package models
+
+import (
+	"time"
+)
+
+// Kinds of key failed logins are counted against
+const (
+	LoginKeyUsername = "username"
+	LoginKeyIP       = "ip"
+)
+
+// IsValidLoginKeyKind reports whether kind names a login key kind
+func IsValidLoginKeyKind(kind string) bool {
+	return kind == LoginKeyUsername || kind == LoginKeyIP
+}
+
+// Outcomes recorded in the auth log
+const (
+	AuthOutcomeSuccess = "success"
+	AuthOutcomeFailure = "failure"
+	AuthOutcomeLocked  = "locked"
+	// AuthOutcomeDenied is a correct password for an account that may not sign in
+	AuthOutcomeDenied = "denied"
+)
+
+const (
+	// DefaultAuthLogLimit is the number of auth log entries returned when no limit is given
+	DefaultAuthLogLimit = 100
+	// MaxAuthLogLimit caps the number of auth log entries returned at once
+	MaxAuthLogLimit = 1000
+)
+
+// LoginLock counts the recent failed logins for a username or client IP
+type LoginLock struct {
+	Kind          string     `json:"kind" db:"kind"`
+	Key           string     `json:"key" db:"login_key"`
+	Failures      int        `json:"failures" db:"failures"`
+	LastFailureAt time.Time  `json:"last_failure_at" db:"last_failure_at"`
+	LockedUntil   *time.Time `json:"locked_until,omitempty" db:"locked_until"`
+}
+
+// IsLocked reports whether logins are refused at now
+func (l *LoginLock) IsLocked(now time.Time) bool {
+	return l.LockedUntil != nil && now.Before(*l.LockedUntil)
+}
+
+// AuthEvent is one login attempt recorded in the auth log
+type AuthEvent struct {
+	ID        int       `json:"id" db:"id"`
+	Username  string    `json:"username" db:"username"`
+	AccountID *int      `json:"account_id,omitempty" db:"account_id"`
+	IP        string    `json:"ip" db:"ip"`
+	Outcome   string    `json:"outcome" db:"outcome"`
+	CreatedAt time.Time `json:"created_at" db:"created_at"`
+}
+
+// AuthLogQuery filters the auth log; empty fields match everything
+type AuthLogQuery struct {
+	Username string
+	IP       string
+	Outcome  string
+	Limit    int
+}
@@ -0,0 +1,93 @@
+package models
+
+import "time"
+
+// Guardian consent states of an account
+const (
+	ConsentNotRequired = "not_required"
+	ConsentPending     = "pending"
+	ConsentGranted     = "granted"
+)
+
+// ConsentMaxGrade is the highest grade whose students are presumed to be
+// under 13 and need a guardian's consent before they can sign in
+const ConsentMaxGrade = 7
+
+// RequiresGuardianConsent reports whether a self-registered student of the
+// given grade must wait for a guardian. Grade 0 means the grade is unknown.
+func RequiresGuardianConsent(grade int) bool {
+	return grade > 0 && grade <= ConsentMaxGrade
+}
+
+// Ways a guardian's consent can be collected
+const (
+	ConsentMethodOnline     = "online"
+	ConsentMethodSignedForm = "signed_form"
+	ConsentMethodEmail      = "email"
+	ConsentMethodPhone      = "phone"
+)
+
+// GuardianLink ties a guardian account to a student and records the consent
+// the guardian gave
+type GuardianLink struct {
+	GuardianID    int       `json:"guardian_id" db:"guardian_id"`
+	StudentID     int       `json:"student_id" db:"student_id"`
+	ConsentedAt   time.Time `json:"consented_at" db:"consented_at"`
+	ConsentMethod string    `json:"consent_method" db:"consent_method"`
+	PolicyVersion string    `json:"policy_version" db:"policy_version"`
+	// RecordedBy is the account that recorded the consent: the guardian for
+	// online consent, otherwise a staff member, or 0 for an API key
+	RecordedBy int `json:"recorded_by" db:"recorded_by"`
+}
+
+// GuardianSignupRequest represents the request payload for registering a guardian
+type GuardianSignupRequest struct {
+	Username  string `json:"username" binding:"required"`
+	Email     string `json:"email" binding:"required,email"`
+	Password  string `json:"password" binding:"required"`
+	FirstName string `json:"first_name"`
+	LastName  string `json:"last_name"`
+}
+
+// ConsentRequest represents a guardian approving a child's account
+type ConsentRequest struct {
+	PolicyVersion string `json:"policy_version" binding:"required,max=50"`
+	// Token is the consent code emailed to the guardian; renewing consent
+	// for a child already linked does not need one
+	Token string `json:"token"`
+}
+
+// LinkGuardianRequest represents staff recording consent collected outside the app
+type LinkGuardianRequest struct {
+	GuardianID    int    `json:"guardian_id" binding:"required"`
+	ConsentMethod string `json:"consent_method" binding:"required,oneof=online signed_form email phone"`
+	PolicyVersion string `json:"policy_version" binding:"required,max=50"`
+}
+
+// Child is a guardian's view of one of their students
+type Child struct {
+	ID            int    `json:"id"`
+	Username      string `json:"username"`
+	FirstName     string `json:"first_name"`
+	LastName      string `json:"last_name"`
+	Grade         int    `json:"grade"`
+	School        string `json:"school"`
+	GameLevel     int    `json:"game_level"`
+	Experience    int    `json:"experience"`
+	ConsentStatus string `json:"consent_status"`
+}
+
+// ChildFromAccount copies the fields a guardian may see
+func ChildFromAccount(account *Account) Child {
+	return Child{
+		ID:            account.ID,
+		Username:      account.Username,
+		FirstName:     account.FirstName,
+		LastName:      account.LastName,
+		Grade:         account.Grade,
+		School:        account.School,
+		GameLevel:     account.GameLevel,
+		Experience:    account.Experience,
+		ConsentStatus: account.ConsentStatus,
+	}
+}
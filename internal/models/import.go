@@ -0,0 +1,151 @@
+package models
+
+import "time"
+
+// Import modes, deciding what happens to the good rows when some are bad
+const (
+	// ImportAllOrNothing imports every row or, if any row is bad, none
+	ImportAllOrNothing = "all_or_nothing"
+	// ImportBestEffort imports the good rows and reports the bad ones
+	ImportBestEffort = "best_effort"
+)
+
+// IsValidImportMode reports whether mode names an import mode
+func IsValidImportMode(mode string) bool {
+	return mode == ImportAllOrNothing || mode == ImportBestEffort
+}
+
+// Match keys, the field that finds the existing account a row is about
+const (
+	MatchUsername   = "username"
+	MatchEmail      = "email"
+	MatchExternalID = "external_id"
+)
+
+// IsValidMatchKey reports whether key names a match key
+func IsValidMatchKey(key string) bool {
+	return key == MatchUsername || key == MatchEmail || key == MatchExternalID
+}
+
+// Conflict strategies, deciding what a row does to the account it matches
+const (
+	// ConflictSkip leaves the account as it is
+	ConflictSkip = "skip"
+	// ConflictOverwrite replaces every field of the account with the row's,
+	// blank ones included
+	ConflictOverwrite = "overwrite"
+	// ConflictMerge copies only the fields the row fills in
+	ConflictMerge = "merge"
+)
+
+// IsValidConflictStrategy reports whether strategy names a conflict strategy
+func IsValidConflictStrategy(strategy string) bool {
+	return strategy == ConflictSkip || strategy == ConflictOverwrite || strategy == ConflictMerge
+}
+
+// Actions of the changes in an import report
+const (
+	ImportCreated     = "created"
+	ImportUpdated     = "updated"
+	ImportDeactivated = "deactivated"
+)
+
+// ImportOptions controls how an import is run
+type ImportOptions struct {
+	// Mode is ImportAllOrNothing (the default when empty) or ImportBestEffort
+	Mode string
+	// DryRun validates and runs the import, then rolls it back
+	DryRun bool
+	// School, when set, is the only school rows may belong to; rows without
+	// one are put in it
+	School string
+
+	// MatchKey, when set, makes a row whose key matches an existing account
+	// update it as Strategy says instead of failing as taken
+	MatchKey string
+	// Strategy is ConflictSkip (the default when empty), ConflictOverwrite
+	// or ConflictMerge
+	Strategy string
+	// DeactivateMissing deactivates the active students of the imported
+	// schools that no row matches. It needs a MatchKey.
+	DeactivateMissing bool
+	// Mapping says where a CSV import's fields are; nil finds each field by
+	// its own name
+	Mapping *ImportMapping
+}
+
+// ImportFields are the account fields an import reads, by their JSON name
+var ImportFields = []string{
+	"username", "email", "first_name", "last_name", "grade",
+	"school", "experience", "is_active", "external_id",
+}
+
+// Value transforms of an import mapping
+const (
+	TransformTrim      = "trim"
+	TransformLowercase = "lowercase"
+	TransformUppercase = "uppercase"
+)
+
+// ImportMapping is a named profile saying how the columns of a school's CSV
+// files map to account fields
+type ImportMapping struct {
+	Name string `json:"name" yaml:"name"`
+	// Columns gives the header of the column each field is read from;
+	// fields it leaves out are read from a column named after them
+	Columns map[string]string `json:"columns" yaml:"columns"`
+	// Transforms lists what is done to each field's values, in order;
+	// values of fields it leaves out are trimmed
+	Transforms map[string][]string `json:"transforms,omitempty" yaml:"transforms,omitempty"`
+	// GradeAliases names grades, on top of K, KG and Kindergarten for 0
+	GradeAliases map[string]int `json:"grade_aliases,omitempty" yaml:"grade_aliases,omitempty"`
+	CreatedAt    time.Time      `json:"created_at" yaml:"-"`
+	UpdatedAt    time.Time      `json:"updated_at" yaml:"-"`
+}
+
+// ImportRowError is a problem with one row of an import
+type ImportRowError struct {
+	// Line is where the row starts in the file; 0 for the file as a whole
+	Line    int    `json:"line"`
+	Field   string `json:"field,omitempty"`
+	Message string `json:"message"`
+}
+
+// ImportFieldChange is a field an import changed, with its old and new value
+type ImportFieldChange struct {
+	Field string      `json:"field"`
+	Old   interface{} `json:"old"`
+	New   interface{} `json:"new"`
+}
+
+// ImportChange is an account an import created, updated or deactivated
+type ImportChange struct {
+	// Line is the row the change comes from; 0 for a deactivated account
+	// that no row mentions
+	Line      int                 `json:"line"`
+	Action    string              `json:"action"`
+	AccountID int                 `json:"account_id,omitempty"`
+	Username  string              `json:"username"`
+	Fields    []ImportFieldChange `json:"fields,omitempty"`
+}
+
+// ImportReport says what an import did, or in a dry run would have done
+type ImportReport struct {
+	Mode   string `json:"mode"`
+	DryRun bool   `json:"dry_run"`
+	// MatchKey and Strategy are only set for imports that match accounts
+	MatchKey string `json:"match_key,omitempty"`
+	Strategy string `json:"strategy,omitempty"`
+	// Committed is false when nothing was written: a dry run, or an
+	// all-or-nothing import with errors
+	Committed bool `json:"committed"`
+	Rows      int  `json:"rows"`
+	Created   int  `json:"created"`
+	Updated   int  `json:"updated"`
+	// Unchanged counts rows that matched an account and left it as it was
+	Unchanged   int              `json:"unchanged"`
+	Deactivated int              `json:"deactivated"`
+	Skipped     int              `json:"skipped"`
+	Errors      []ImportRowError `json:"errors"`
+	Changes     []ImportChange   `json:"changes"`
+}
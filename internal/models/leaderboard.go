@@ -0,0 +1,90 @@
+package models
+
+import "fmt"
+
+// Leaderboard metrics
+const (
+	LeaderboardMetricExperience = "experience"
+	LeaderboardMetricLevel      = "level"
+)
+
+// Leaderboard scopes
+const (
+	LeaderboardScopeGlobal = "global"
+	LeaderboardScopeSchool = "school"
+	LeaderboardScopeGrade  = "grade"
+)
+
+// Leaderboard windows. Daily and weekly boards rank the experience earned in
+// the current UTC day or ISO week.
+const (
+	LeaderboardWindowAllTime = "all_time"
+	LeaderboardWindowWeekly  = "weekly"
+	LeaderboardWindowDaily   = "daily"
+)
+
+// LeaderboardQuery selects a leaderboard. AccountID, when set, asks for that
+// account's own rank as well.
+type LeaderboardQuery struct {
+	Metric    string
+	Scope     string
+	Window    string
+	School    string
+	Grade     int
+	Limit     int
+	AccountID int
+}
+
+// Validate reports whether the query asks for a leaderboard that exists
+func (q LeaderboardQuery) Validate() error {
+	switch q.Metric {
+	case LeaderboardMetricExperience, LeaderboardMetricLevel:
+	default:
+		return fmt.Errorf("metric must be %s or %s", LeaderboardMetricExperience, LeaderboardMetricLevel)
+	}
+	switch q.Scope {
+	case LeaderboardScopeGlobal, LeaderboardScopeGrade:
+	case LeaderboardScopeSchool:
+		if q.School == "" {
+			return fmt.Errorf("school is required for the school scope")
+		}
+	default:
+		return fmt.Errorf("scope must be %s, %s or %s", LeaderboardScopeGlobal, LeaderboardScopeSchool, LeaderboardScopeGrade)
+	}
+	switch q.Window {
+	case LeaderboardWindowAllTime, LeaderboardWindowWeekly, LeaderboardWindowDaily:
+	default:
+		return fmt.Errorf("window must be %s, %s or %s", LeaderboardWindowAllTime, LeaderboardWindowWeekly, LeaderboardWindowDaily)
+	}
+	if q.Metric == LeaderboardMetricLevel && q.Window != LeaderboardWindowAllTime {
+		return fmt.Errorf("level leaderboards are only available %s", LeaderboardWindowAllTime)
+	}
+	return nil
+}
+
+// LeaderboardEntry is one ranked account. Ties share a rank. Students of
+// other schools than the caller's have no account ID or username.
+type LeaderboardEntry struct {
+	Rank        int    `json:"rank"`
+	AccountID   int    `json:"account_id,omitempty"`
+	Username    string `json:"username,omitempty"`
+	DisplayName string `json:"display_name"`
+	School      string `json:"school"`
+	Grade       int    `json:"grade"`
+	Value       int    `json:"value"`
+}
+
+// Leaderboard is the top of a ranking, plus the caller's own position
+type Leaderboard struct {
+	Metric      string             `json:"metric"`
+	Scope       string             `json:"scope"`
+	Window      string             `json:"window"`
+	PeriodStart string             `json:"period_start,omitempty"`
+	Entries     []LeaderboardEntry `json:"entries"`
+	Me          *LeaderboardEntry  `json:"me,omitempty"`
+}
+
+// SetLeaderboardOptOutRequest represents the request to hide or show an account on leaderboards
+type SetLeaderboardOptOutRequest struct {
+	OptOut *bool `json:"leaderboard_opt_out" binding:"required"`
+}
@@ -0,0 +1,71 @@
+package models
+
+import (
+	"fmt"
+	"time"
+)
+
+const (
+	// DefaultPageSize is used when a listing does not ask for a page size
+	DefaultPageSize = 50
+	// MaxPageSize caps how many accounts a single page may return
+	MaxPageSize = 200
+)
+
+// AccountSortKeys lists the fields accounts can be sorted by
+var AccountSortKeys = []string{"created_at", "username", "last_name", "grade", "game_level", "experience"}
+
+// AccountListOptions filters, sorts and paginates an account listing.
+// Nil pointer fields are not filtered on.
+type AccountListOptions struct {
+	School      string
+	SchoolID    *int
+	ClassroomID *int
+	Roles       []string
+	// RosterOf, when set, limits the Roles matches to students taught by this account
+	RosterOf int
+	// SelfID, when set, also matches the caller's own account whatever its role
+	SelfID int
+
+	Grade         *int
+	IsActive      *bool
+	MinLevel      *int
+	MaxLevel      *int
+	CreatedAfter  *time.Time
+	CreatedBefore *time.Time
+	// Deleted lists deleted accounts waiting to be purged instead of live ones
+	Deleted bool
+
+	Sort       string
+	Descending bool
+	Limit      int
+	Cursor     string
+}
+
+// AccountPage is one page of an account listing
+type AccountPage struct {
+	Accounts   []Account `json:"accounts"`
+	Total      int       `json:"total"`
+	NextCursor string    `json:"next_cursor,omitempty"`
+}
+
+// IsValidAccountSortKey reports whether accounts can be sorted by key
+func IsValidAccountSortKey(key string) bool {
+	for _, k := range AccountSortKeys {
+		if k == key {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseListTime parses a listing time bound given as RFC 3339 or YYYY-MM-DD
+func ParseListTime(value string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	if t, err := time.ParseInLocation("2006-01-02", value, time.Local); err == nil {
+		return t, nil
+	}
+	return time.Time{}, fmt.Errorf("invalid time %q, use YYYY-MM-DD or RFC 3339", value)
+}
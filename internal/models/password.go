@@ -0,0 +1,19 @@
+package models
+
+// ChangePasswordRequest represents an account changing its own password
+type ChangePasswordRequest struct {
+	OldPassword string `json:"old_password" binding:"required"`
+	NewPassword string `json:"new_password" binding:"required"`
+}
+
+// ForgotPasswordRequest asks for a password reset link. Login is a username
+// or an email address.
+type ForgotPasswordRequest struct {
+	Login string `json:"login" binding:"required"`
+}
+
+// PasswordResetRequest sets a new password with a reset token
+type PasswordResetRequest struct {
+	Token       string `json:"token" binding:"required"`
+	NewPassword string `json:"new_password" binding:"required"`
+}
@@ -0,0 +1,21 @@
+package models
+
+// AddStudentsRequest represents a bulk add of students to a classroom roster
+type AddStudentsRequest struct {
+	Usernames []string `json:"usernames" binding:"required,min=1,max=500"`
+}
+
+// RosterResult reports what happened to each username of a bulk add
+type RosterResult struct {
+	Added           []string `json:"added"`
+	AlreadyEnrolled []string `json:"already_enrolled"`
+	NotFound        []string `json:"not_found"`
+	// NotEligible lists accounts that are not students of the classroom's school
+	NotEligible []string `json:"not_eligible"`
+}
+
+// ResetPasswordRequest represents a staff password reset. An empty password
+// asks for a generated one.
+type ResetPasswordRequest struct {
+	Password string `json:"password"`
+}
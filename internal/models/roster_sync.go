@@ -0,0 +1,67 @@
+package models
+
+// Roster sync modes, deciding what a OneRoster bundle says about the records
+// it leaves out
+const (
+	// RosterSyncFull treats the bundle as the whole roster: synced records it
+	// leaves out are removed
+	RosterSyncFull = "full"
+	// RosterSyncDelta treats the bundle as changes: records it leaves out are
+	// kept, and those marked tobedeleted are removed
+	RosterSyncDelta = "delta"
+)
+
+// IsValidRosterSyncMode reports whether mode names a roster sync mode
+func IsValidRosterSyncMode(mode string) bool {
+	return mode == RosterSyncFull || mode == RosterSyncDelta
+}
+
+// RosterSyncOptions controls how a OneRoster bundle is synced
+type RosterSyncOptions struct {
+	// Mode is RosterSyncFull or RosterSyncDelta; when empty it is taken from
+	// the bundle's manifest, and is full without one
+	Mode string
+	// DryRun runs the sync, then rolls it back
+	DryRun bool
+}
+
+// RosterSyncCounts counts what a sync did to one kind of record
+type RosterSyncCounts struct {
+	Created   int `json:"created"`
+	Updated   int `json:"updated"`
+	Unchanged int `json:"unchanged"`
+	// Removed counts deactivated accounts, deleted classrooms and dropped
+	// enrollments
+	Removed int `json:"removed"`
+	// Skipped counts records with nothing to sync to, such as districts or
+	// parents
+	Skipped int `json:"skipped"`
+}
+
+// RosterSyncProblem is an error or warning about one record of a bundle
+type RosterSyncProblem struct {
+	File string `json:"file"`
+	// Line is where the record is in the file; 0 for the file as a whole
+	Line    int    `json:"line"`
+	Field   string `json:"field,omitempty"`
+	Message string `json:"message"`
+}
+
+// RosterSyncReport says what a sync did, or in a dry run would have done
+type RosterSyncReport struct {
+	Mode   string `json:"mode"`
+	DryRun bool   `json:"dry_run"`
+	// Committed is false when nothing was written: a dry run, or a sync
+	// with errors
+	Committed   bool             `json:"committed"`
+	Schools     RosterSyncCounts `json:"schools"`
+	Users       RosterSyncCounts `json:"users"`
+	Classes     RosterSyncCounts `json:"classes"`
+	Enrollments RosterSyncCounts `json:"enrollments"`
+	// Changes are the accounts the sync created, updated or deactivated
+	Changes []ImportChange `json:"changes"`
+	// Errors keep the whole sync from being saved; warnings are about
+	// records left out of it
+	Errors   []RosterSyncProblem `json:"errors"`
+	Warnings []RosterSyncProblem `json:"warnings"`
+}
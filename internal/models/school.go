@@ -0,0 +1,102 @@
+package models
+
+import (
+	"strings"
+	"time"
+	"unicode"
+)
+
+// Roles an account can hold within a classroom
+const (
+	EnrollmentStudent = "student"
+	EnrollmentTeacher = "teacher"
+)
+
+// School is a school accounts and classrooms belong to
+type School struct {
+	ID   int    `json:"id" db:"id"`
+	Name string `json:"name" db:"name"`
+	// SourcedID is the school's ID in the student information system it is
+	// synced from
+	SourcedID *string   `json:"sourced_id,omitempty" db:"sourced_id"`
+	CreatedAt time.Time `json:"created_at" db:"created_at"`
+	UpdatedAt time.Time `json:"updated_at" db:"updated_at"`
+}
+
+// Classroom is a class within a school
+type Classroom struct {
+	ID       int    `json:"id" db:"id"`
+	SchoolID int    `json:"school_id" db:"school_id"`
+	Name     string `json:"name" db:"name"`
+	Grade    int    `json:"grade" db:"grade"`
+	// SourcedID is the class's ID in the student information system it is
+	// synced from
+	SourcedID *string   `json:"sourced_id,omitempty" db:"sourced_id"`
+	CreatedAt time.Time `json:"created_at" db:"created_at"`
+	UpdatedAt time.Time `json:"updated_at" db:"updated_at"`
+}
+
+// Enrollment places an account in a classroom as a student or teacher
+type Enrollment struct {
+	ClassroomID int       `json:"classroom_id" db:"classroom_id"`
+	AccountID   int       `json:"account_id" db:"account_id"`
+	Role        string    `json:"role" db:"role"`
+	EnrolledAt  time.Time `json:"enrolled_at" db:"enrolled_at"`
+}
+
+// SchoolRequest represents the request payload for creating or renaming a school
+type SchoolRequest struct {
+	Name string `json:"name" binding:"required,max=255"`
+}
+
+// MergeSchoolsRequest represents the request to fold a school into another
+type MergeSchoolsRequest struct {
+	IntoID int `json:"into_id" binding:"required"`
+}
+
+// ClassroomRequest represents the request payload for creating or updating a classroom
+type ClassroomRequest struct {
+	Name  string `json:"name" binding:"required,max=255"`
+	Grade int    `json:"grade"`
+}
+
+// EnrollRequest represents the request payload for enrolling an account in a classroom
+type EnrollRequest struct {
+	AccountID int    `json:"account_id" binding:"required"`
+	Role      string `json:"role"`
+}
+
+// schoolAbbreviations expands the short forms schools are commonly entered with
+var schoolAbbreviations = map[string]string{
+	"elem":  "elementary",
+	"el":    "elementary",
+	"es":    "elementary",
+	"ms":    "middle",
+	"hs":    "high",
+	"jr":    "junior",
+	"sr":    "senior",
+	"acad":  "academy",
+	"intl":  "international",
+	"sch":   "school",
+	"schl":  "school",
+	"prep":  "preparatory",
+	"cntrl": "central",
+	"ctr":   "center",
+}
+
+// SchoolKey reduces a school name to the form used to tell schools apart, so
+// that "Lincoln Elem." and "lincoln elementary school" are the same school
+func SchoolKey(name string) string {
+	words := strings.FieldsFunc(strings.ToLower(name), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	for i, word := range words {
+		if full, ok := schoolAbbreviations[word]; ok {
+			words[i] = full
+		}
+	}
+	if n := len(words); n > 1 && words[n-1] == "school" {
+		words = words[:n-1]
+	}
+	return strings.Join(words, " ")
+}
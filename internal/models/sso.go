@@ -0,0 +1,21 @@
+package models
+
+import (
+	"time"
+)
+
+// SSOState is a single sign-on that was sent to the identity provider and
+// has not come back yet
+type SSOState struct {
+	Nonce        string    `json:"-" db:"nonce"`
+	CodeVerifier string    `json:"-" db:"code_verifier"`
+	CreatedAt    time.Time `json:"created_at" db:"created_at"`
+	ExpiresAt    time.Time `json:"expires_at" db:"expires_at"`
+}
+
+// SSOProvisioning holds what accounts created on their first single sign-on
+// are given, since identity providers rarely know a student's grade or school
+type SSOProvisioning struct {
+	Grade  int
+	School string
+}
@@ -0,0 +1,39 @@
+package models
+
+import (
+	"time"
+)
+
+// TOTPSecret is the authenticator secret shared with an account
+type TOTPSecret struct {
+	AccountID    int        `json:"account_id" db:"account_id"`
+	Secret       string     `json:"-" db:"secret"`
+	LastUsedStep int64      `json:"-" db:"last_used_step"`
+	CreatedAt    time.Time  `json:"created_at" db:"created_at"`
+	ConfirmedAt  *time.Time `json:"confirmed_at,omitempty" db:"confirmed_at"`
+}
+
+// TwoFactorStatus describes an account's second factor
+type TwoFactorStatus struct {
+	Enabled                bool `json:"enabled"`
+	Required               bool `json:"required"`
+	RecoveryCodesRemaining int  `json:"recovery_codes_remaining"`
+}
+
+// TwoFactorSetup is returned when an account starts enrolling an authenticator
+type TwoFactorSetup struct {
+	Secret     string `json:"secret"`
+	OTPAuthURI string `json:"otpauth_uri"`
+	QRCodeURL  string `json:"qr_code_url"`
+}
+
+// TwoFactorCodeRequest carries a TOTP code from the account's authenticator
+type TwoFactorCodeRequest struct {
+	Code string `json:"code" binding:"required"`
+}
+
+// DisableTwoFactorRequest turns off the caller's second factor; the password
+// is asked again so that a stolen session cannot do it
+type DisableTwoFactorRequest struct {
+	Password string `json:"password" binding:"required"`
+}
@@ -0,0 +1,32 @@
+package models
+
+import (
+	"time"
+)
+
+const (
+	// XPSourceImport marks experience carried over by an account import
+	XPSourceImport = "import"
+	// XPSourceAdjustment marks manual corrections made by staff
+	XPSourceAdjustment = "adjustment"
+)
+
+// XPEvent is one entry of the append-only experience ledger
+type XPEvent struct {
+	ID        int       `json:"id" db:"id"`
+	AccountID int       `json:"account_id" db:"account_id"`
+	Amount    int       `json:"amount" db:"amount"`
+	Source    string    `json:"source" db:"source"`
+	Reason    string    `json:"reason" db:"reason"`
+	GameRef   string    `json:"game_ref,omitempty" db:"game_ref"`
+	CreatedAt time.Time `json:"created_at" db:"created_at"`
+}
+
+// RecordXPRequest represents the request to add experience to an account.
+// GameRef identifies the game or play session that earned it.
+type RecordXPRequest struct {
+	Amount  int    `json:"amount" binding:"required"`
+	Source  string `json:"source" binding:"required,max=64"`
+	Reason  string `json:"reason" binding:"max=255"`
+	GameRef string `json:"game_ref" binding:"max=128"`
+}
@@ -0,0 +1,133 @@
+// Package notify delivers messages to account holders and their guardians,
+// such as password reset links and consent codes. Deployments choose how by
+// configuring a Notifier.
+package notify
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"net/smtp"
+	"net/url"
+	"strings"
+	"time"
+
+	"educational-game-db/internal/models"
+)
+
+// DefaultResetURL is the page reset links point to when none is configured
+const DefaultResetURL = "http://localhost:8080/"
+
+// Notifier delivers messages to the owner of an account
+type Notifier interface {
+	// SendPasswordReset delivers a single-use password reset token
+	SendPasswordReset(account *models.Account, token string, expiresAt time.Time) error
+	// SendConsentRequest delivers a single-use consent token to the guardian
+	// a student named at sign-up
+	SendConsentRequest(student *models.Account, guardianEmail, token string, expiresAt time.Time) error
+}
+
+// ResetLink returns the page at base with the reset token in its query string
+func ResetLink(base, token string) string {
+	if base == "" {
+		base = DefaultResetURL
+	}
+	u, err := url.Parse(base)
+	if err != nil {
+		return base
+	}
+	query := u.Query()
+	query.Set("reset_token", token)
+	u.RawQuery = query.Encode()
+	return u.String()
+}
+
+func resetMessage(account *models.Account, link string, expiresAt time.Time) string {
+	name := account.FirstName
+	if name == "" {
+		name = account.Username
+	}
+	return fmt.Sprintf("Hi %s,\r\n\r\n"+
+		"Someone asked to reset the password of the account %s. To choose a new\r\n"+
+		"password, open this link before %s:\r\n\r\n%s\r\n\r\n"+
+		"If you did not ask for this, you can ignore this message.\r\n",
+		name, account.Username, expiresAt.UTC().Format("2006-01-02 15:04 MST"), link)
+}
+
+func consentMessage(student *models.Account, token string, expiresAt time.Time) string {
+	name := strings.TrimSpace(student.FirstName + " " + student.LastName)
+	if name == "" {
+		name = student.Username
+	}
+	return fmt.Sprintf("Hello,\r\n\r\n"+
+		"%s signed up for the account %s and named you as their parent or\r\n"+
+		"guardian. They cannot sign in until you approve it. To do so, sign in\r\n"+
+		"with a guardian account registered with this email address and give\r\n"+
+		"this consent code for account %d before %s:\r\n\r\n%s\r\n\r\n"+
+		"If you do not know this child, you can ignore this message.\r\n",
+		name, student.Username, student.ID, expiresAt.UTC().Format("2006-01-02 15:04 MST"), token)
+}
+
+// Log writes notifications to the server log instead of delivering them. It
+// is meant for development and is the default.
+type Log struct {
+	ResetURL string
+}
+
+func (n Log) SendPasswordReset(account *models.Account, token string, expiresAt time.Time) error {
+	log.Printf("Password reset for %s <%s>: %s (expires %s)", account.Username, account.Email,
+		ResetLink(n.ResetURL, token), expiresAt.Format(time.RFC3339))
+	return nil
+}
+
+func (n Log) SendConsentRequest(student *models.Account, guardianEmail, token string, expiresAt time.Time) error {
+	log.Printf("Consent request for %s (account %d) to <%s>: %s (expires %s)", student.Username, student.ID,
+		guardianEmail, token, expiresAt.Format(time.RFC3339))
+	return nil
+}
+
+// SMTP emails notifications through a mail server
+type SMTP struct {
+	// Addr is the host:port of the mail server
+	Addr string
+	From string
+	// Username and Password authenticate with PLAIN auth when set
+	Username string
+	Password string
+	ResetURL string
+}
+
+func (n SMTP) SendPasswordReset(account *models.Account, token string, expiresAt time.Time) error {
+	if err := n.send(account.Email, "Reset your password", resetMessage(account, ResetLink(n.ResetURL, token), expiresAt)); err != nil {
+		return fmt.Errorf("failed to send password reset email: %w", err)
+	}
+	return nil
+}
+
+func (n SMTP) SendConsentRequest(student *models.Account, guardianEmail, token string, expiresAt time.Time) error {
+	if err := n.send(guardianEmail, "Approve your child's account", consentMessage(student, token, expiresAt)); err != nil {
+		return fmt.Errorf("failed to send consent request email: %w", err)
+	}
+	return nil
+}
+
+func (n SMTP) send(to, subject, body string) error {
+	var auth smtp.Auth
+	if n.Username != "" {
+		host, _, err := net.SplitHostPort(n.Addr)
+		if err != nil {
+			return fmt.Errorf("invalid SMTP address: %w", err)
+		}
+		auth = smtp.PlainAuth("", n.Username, n.Password, host)
+	}
+
+	headers := []string{
+		"From: " + n.From,
+		"To: " + to,
+		"Subject: " + subject,
+		"MIME-Version: 1.0",
+		"Content-Type: text/plain; charset=utf-8",
+	}
+	msg := strings.Join(headers, "\r\n") + "\r\n\r\n" + body
+	return smtp.SendMail(n.Addr, auth, n.From, []string{to}, []byte(msg))
+}
@@ -0,0 +1,38 @@
+package notify
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"educational-game-db/internal/models"
+)
+
+func TestResetLink(t *testing.T) {
+	if got := ResetLink("", "abc"); got != "http://localhost:8080/?reset_token=abc" {
+		t.Errorf("Unexpected default link %s", got)
+	}
+	if got := ResetLink("https://game.example.com/portal?lang=en", "a+b"); got != "https://game.example.com/portal?lang=en&reset_token=a%2Bb" {
+		t.Errorf("Unexpected link %s", got)
+	}
+}
+
+func TestResetMessage(t *testing.T) {
+	account := &models.Account{Username: "jsmith", FirstName: "John"}
+	msg := resetMessage(account, "https://example.com/?reset_token=abc", time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC))
+	for _, want := range []string{"Hi John", "jsmith", "https://example.com/?reset_token=abc", "2025-03-01 12:00 UTC"} {
+		if !strings.Contains(msg, want) {
+			t.Errorf("Expected message to contain %q:\n%s", want, msg)
+		}
+	}
+}
+
+func TestConsentMessage(t *testing.T) {
+	student := &models.Account{ID: 7, Username: "kid", FirstName: "Kim"}
+	msg := consentMessage(student, "abc", time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC))
+	for _, want := range []string{"Kim signed up", "kid", "account 7", "abc", "2025-03-01 12:00 UTC"} {
+		if !strings.Contains(msg, want) {
+			t.Errorf("Expected message to contain %q:\n%s", want, msg)
+		}
+	}
+}
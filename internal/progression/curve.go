@@ -0,0 +1,86 @@
+// Package progression turns experience totals into game levels
+package progression
+
+import (
+	"fmt"
+	"math"
+)
+
+// Curve maps total experience to a game level. Every account starts at
+// level 1, and going from level n to n+1 costs BaseXP * Growth^(n-1)
+// experience, so a Growth of 1 gives a linear curve.
+type Curve struct {
+	BaseXP   int
+	Growth   float64
+	MaxLevel int // 0 means levels are unbounded
+}
+
+// DefaultCurve asks 100 XP for level 2 and 50% more for each level after
+var DefaultCurve = Curve{BaseXP: 100, Growth: 1.5, MaxLevel: 100}
+
+// Validate reports whether the curve can be used
+func (c Curve) Validate() error {
+	if c.BaseXP <= 0 {
+		return fmt.Errorf("base XP must be positive, got %d", c.BaseXP)
+	}
+	if c.Growth < 1 {
+		return fmt.Errorf("level growth must be at least 1, got %g", c.Growth)
+	}
+	if c.MaxLevel < 0 {
+		return fmt.Errorf("max level must not be negative, got %d", c.MaxLevel)
+	}
+	return nil
+}
+
+// Level returns the level reached with xp total experience
+func (c Curve) Level(xp int) int {
+	if c.Growth == 1 {
+		// Every level costs the same, so the level is counted rather than
+		// walked one at a time
+		level := 1
+		if xp > 0 {
+			level += xp / c.BaseXP
+		}
+		if c.MaxLevel > 0 && level > c.MaxLevel {
+			level = c.MaxLevel
+		}
+		return level
+	}
+
+	level := 1
+	cost := float64(c.BaseXP)
+	remaining := float64(xp)
+	for remaining >= math.Floor(cost) && (c.MaxLevel == 0 || level < c.MaxLevel) {
+		remaining -= math.Floor(cost)
+		cost *= c.Growth
+		level++
+	}
+	return level
+}
+
+// XPForLevel returns the total experience needed to reach level
+func (c Curve) XPForLevel(level int) int {
+	if c.MaxLevel > 0 && level > c.MaxLevel {
+		level = c.MaxLevel
+	}
+	if c.Growth == 1 {
+		total := int64(level-1) * int64(c.BaseXP)
+		if total < 0 {
+			return 0
+		}
+		if total > math.MaxInt32 {
+			return math.MaxInt32
+		}
+		return int(total)
+	}
+	total := 0.0
+	cost := float64(c.BaseXP)
+	for n := 1; n < level; n++ {
+		total += math.Floor(cost)
+		cost *= c.Growth
+	}
+	if total > math.MaxInt32 {
+		return math.MaxInt32
+	}
+	return int(total)
+}
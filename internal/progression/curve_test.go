@@ -0,0 +1,78 @@
+package progression
+
+import (
+	"math"
+	"testing"
+)
+
+func TestCurveLevel(t *testing.T) {
+	curve := Curve{BaseXP: 100, Growth: 1.5, MaxLevel: 5}
+
+	tests := []struct {
+		xp    int
+		level int
+	}{
+		{0, 1},
+		{99, 1},
+		{100, 2},
+		{249, 2},
+		{250, 3},
+		{475, 4},
+		{812, 5},
+		{1000000, 5},
+	}
+
+	for _, tt := range tests {
+		if got := curve.Level(tt.xp); got != tt.level {
+			t.Errorf("Level(%d) = %d, expected %d", tt.xp, got, tt.level)
+		}
+	}
+}
+
+func TestCurveLinear(t *testing.T) {
+	curve := Curve{BaseXP: 10, Growth: 1}
+	if got := curve.Level(math.MaxInt32); got != 1+math.MaxInt32/10 {
+		t.Errorf("Level(MaxInt32) = %d, expected %d", got, 1+math.MaxInt32/10)
+	}
+	if got := curve.Level(-5); got != 1 {
+		t.Errorf("Level(-5) = %d, expected 1", got)
+	}
+	for level := 1; level <= 20; level++ {
+		xp := curve.XPForLevel(level)
+		if got := curve.Level(xp); got != level || (level > 1 && curve.Level(xp-1) != level-1) {
+			t.Errorf("Level %d should be reached at exactly %d XP", level, xp)
+		}
+	}
+
+	curve.MaxLevel = 5
+	if got := curve.Level(1000); got != 5 {
+		t.Errorf("Level(1000) = %d, expected the max level 5", got)
+	}
+	if got := curve.XPForLevel(10); got != 40 {
+		t.Errorf("XPForLevel(10) = %d, expected the max level's 40", got)
+	}
+}
+
+func TestCurveXPForLevelMatchesLevel(t *testing.T) {
+	curve := DefaultCurve
+	for level := 1; level <= 20; level++ {
+		xp := curve.XPForLevel(level)
+		if got := curve.Level(xp); got != level {
+			t.Errorf("Level(XPForLevel(%d)) = %d", level, got)
+		}
+		if level > 1 && curve.Level(xp-1) != level-1 {
+			t.Errorf("Level %d reached before %d XP", level, xp)
+		}
+	}
+}
+
+func TestCurveValidate(t *testing.T) {
+	if err := DefaultCurve.Validate(); err != nil {
+		t.Errorf("Default curve should be valid: %v", err)
+	}
+	for _, curve := range []Curve{{BaseXP: 0, Growth: 1}, {BaseXP: 100, Growth: 0.5}, {BaseXP: 100, Growth: 1, MaxLevel: -1}} {
+		if err := curve.Validate(); err == nil {
+			t.Errorf("Expected %+v to be invalid", curve)
+		}
+	}
+}
@@ -1,40 +1,151 @@
 package server
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"net/http"
 	"time"
 
+	"educational-game-db/internal/achievements"
+	"educational-game-db/internal/auth"
 	"educational-game-db/internal/database"
 	"educational-game-db/internal/handlers"
 	"educational-game-db/internal/middleware"
+	"educational-game-db/internal/models"
+	"educational-game-db/internal/notify"
 
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
 )
 
+// Config holds the settings used to build a Server
+type Config struct {
+	Port            string
+	JWTSecret       []byte
+	AccessTokenTTL  time.Duration
+	RefreshTokenTTL time.Duration
+	// ResetTokenTTL is how long password reset links stay valid
+	ResetTokenTTL time.Duration
+	// Badges is the achievement catalog; nil uses the built-in badges
+	Badges *achievements.Catalog
+	// Notifier delivers password reset links; nil logs them instead
+	Notifier notify.Notifier
+	// LoginLimits locks out usernames and IPs that keep failing to log in;
+	// nil uses auth.DefaultLoginLimits
+	LoginLimits *auth.LoginLimits
+	// TwoFactorRoles must set up two-factor authentication before using the API
+	TwoFactorRoles []string
+	// PasswordPolicy decides which passwords accounts may choose; nil uses
+	// auth.DefaultPasswordPolicy
+	PasswordPolicy *auth.PasswordPolicy
+	// SSO enables single sign-on through an OpenID Connect identity provider
+	SSO *auth.OIDCConfig
+	// SSOProvisioning is given to accounts created on their first single sign-on
+	SSOProvisioning models.SSOProvisioning
+	// DeletedRetention is how long deleted accounts can be restored before they
+	// are purged; 0 keeps them until purged by hand
+	DeletedRetention time.Duration
+}
+
+const (
+	// DefaultDeletedRetention is how long deleted accounts are kept by default
+	DefaultDeletedRetention = 30 * 24 * time.Hour
+	// purgeInterval is how often deleted accounts past their retention are purged
+	purgeInterval = time.Hour
+)
+
 type Server struct {
-	db          *database.Database
+	db          database.Store
 	router      *gin.Engine
 	port        string
 	rateLimiter *middleware.RateLimiter
+	tokens      *auth.TokenService
+	badges      *achievements.Engine
+	notifier    notify.Notifier
+	limits      auth.LoginLimits
+	twoFactor   []string
+	passwords   *auth.PasswordPolicy
+	sso         *auth.OIDCProvider
+	provision   models.SSOProvisioning
+	retention   time.Duration
+	stopPurge   chan struct{}
 }
 
-func NewServer(db *database.Database, port string) *Server {
+func NewServer(db database.Store, cfg Config) (*Server, error) {
 	gin.SetMode(gin.ReleaseMode)
 	router := gin.Default()
 
+	secret := cfg.JWTSecret
+	if len(secret) == 0 {
+		var err error
+		secret, err = auth.GenerateSecret()
+		if err != nil {
+			return nil, err
+		}
+		log.Printf("No JWT secret configured; using a random one, sessions will not survive a restart")
+	}
+
+	tokens := auth.NewTokenService(secret)
+	if cfg.AccessTokenTTL > 0 {
+		tokens.AccessTTL = cfg.AccessTokenTTL
+	}
+	if cfg.RefreshTokenTTL > 0 {
+		tokens.RefreshTTL = cfg.RefreshTokenTTL
+	}
+	if cfg.ResetTokenTTL > 0 {
+		tokens.ResetTTL = cfg.ResetTokenTTL
+	}
+
+	catalog := cfg.Badges
+	if catalog == nil {
+		var err error
+		catalog, err = achievements.DefaultCatalog()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	limits := auth.DefaultLoginLimits
+	if cfg.LoginLimits != nil {
+		limits = *cfg.LoginLimits
+	}
+
+	passwords := cfg.PasswordPolicy
+	if passwords == nil {
+		passwords = auth.DefaultPasswordPolicy()
+	}
+
+	var sso *auth.OIDCProvider
+	if cfg.SSO != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+
+		var err error
+		if sso, err = auth.NewOIDCProvider(ctx, *cfg.SSO); err != nil {
+			return nil, err
+		}
+	}
+
 	server := &Server{
 		db:          db,
 		router:      router,
-		port:        port,
+		port:        cfg.Port,
 		rateLimiter: middleware.NewRateLimiter(),
+		tokens:      tokens,
+		badges:      achievements.NewEngine(catalog, db),
+		notifier:    cfg.Notifier,
+		limits:      limits,
+		twoFactor:   cfg.TwoFactorRoles,
+		passwords:   passwords,
+		sso:         sso,
+		provision:   cfg.SSOProvisioning,
+		retention:   cfg.DeletedRetention,
 	}
 
 	server.setupMiddleware()
 	server.setupRoutes()
-	return server
+	return server, nil
 }
 
 func (s *Server) setupMiddleware() {
@@ -60,7 +171,13 @@ func (s *Server) setupMiddleware() {
 }
 
 func (s *Server) setupRoutes() {
-	handler := handlers.NewHandler(s.db)
+	handler := handlers.NewHandler(s.db, s.tokens, s.badges, s.notifier)
+	handler.SetLoginLimits(s.limits)
+	handler.SetTwoFactorRoles(s.twoFactor)
+	handler.SetPasswordPolicy(s.passwords)
+	if s.sso != nil {
+		handler.SetSSO(s.sso, s.provision)
+	}
 
 	// Serve static files
 	s.router.Static("/static", "./web/static")
@@ -81,21 +198,145 @@ func (s *Server) setupRoutes() {
 	// API routes
 	api := s.router.Group("/api")
 	{
-		api.GET("/accounts", handler.GetAccounts)
+		// Public routes
 		api.POST("/accounts", handler.CreateAccount)
-		api.GET("/accounts/:id", handler.GetAccount)
-		api.PUT("/accounts/:id", handler.UpdateAccount)
-		api.DELETE("/accounts/:id", handler.DeleteAccount)
-		api.GET("/stats", handler.GetStats)
+		api.POST("/guardians", handler.RegisterGuardian)
 		api.POST("/login", handler.Login)
+		api.POST("/logout", handler.Logout)
+		api.POST("/token/refresh", handler.RefreshToken)
+		api.POST("/password/forgot", handler.ForgotPassword)
+		api.POST("/password/reset", handler.ResetPassword)
+		api.GET("/password/passphrase", handler.SuggestPassphrase)
+		api.GET("/sso", handler.GetSSO)
+		api.GET("/sso/login", handler.StartSSO)
+		api.GET("/sso/callback", handler.SSOCallback)
+	}
+
+	// Authenticated API routes
+	authed := api.Group("")
+	authed.Use(middleware.RequireAuth(s.tokens, s.db, s.db))
+	// Accounts with a temporary password may only look themselves up and change it
+	authed.Use(middleware.RequireCurrentPassword("/api/me", "/api/password/change"))
+	// Roles that must use a second factor can only set one up until they have
+	authed.Use(middleware.RequireTwoFactor(s.twoFactor, "/api/me", "/api/password/change",
+		"/api/2fa", "/api/2fa/setup", "/api/2fa/qr.png", "/api/2fa/confirm"))
+	{
+		authed.GET("/me", handler.GetMe)
+		authed.POST("/password/change", handler.ChangePassword)
+
+		twoFactor := authed.Group("/2fa")
+		{
+			twoFactor.GET("", handler.GetTwoFactor)
+			twoFactor.POST("/setup", handler.SetupTwoFactor)
+			twoFactor.GET("/qr.png", handler.GetTwoFactorQRCode)
+			twoFactor.POST("/confirm", handler.ConfirmTwoFactor)
+			twoFactor.POST("/recovery-codes", handler.RegenerateRecoveryCodes)
+			twoFactor.POST("/disable", handler.DisableTwoFactor)
+		}
+		authed.GET("/accounts", middleware.RequirePermission(auth.PermAccountsList), handler.GetAccounts)
+		authed.GET("/accounts/search", middleware.RequirePermission(auth.PermAccountsList), handler.SearchAccounts)
+
+		// Deleted accounts are hidden from RequireAccountAccess, so restoring checks access itself
+		authed.POST("/accounts/:id/restore", middleware.RequirePermission(auth.PermAccountsDelete), handler.RestoreAccount)
+
+		account := authed.Group("/accounts/:id")
+		account.Use(middleware.RequireAccountAccess(s.db))
+		{
+			account.GET("", middleware.RequirePermission(auth.PermAccountsRead), handler.GetAccount)
+			account.PUT("", middleware.RequirePermission(auth.PermAccountsWrite), handler.UpdateAccount)
+			account.DELETE("", middleware.RequirePermission(auth.PermAccountsDelete), handler.DeleteAccount)
+			account.GET("/xp", middleware.RequirePermission(auth.PermAccountsRead), handler.GetXPEvents)
+			account.POST("/xp", middleware.RequirePermission(auth.PermXPWrite), handler.RecordXP)
+			account.GET("/achievements", middleware.RequirePermission(auth.PermAccountsRead), handler.GetAchievements)
+			account.POST("/achievements", middleware.RequirePermission(auth.PermAwardBadges), handler.AwardAchievement)
+			account.DELETE("/achievements/:badge", middleware.RequirePermission(auth.PermAwardBadges), handler.RevokeAchievement)
+			account.PUT("/leaderboard-opt-out", middleware.RequirePermission(auth.PermAccountsWrite), handler.SetLeaderboardOptOut)
+			account.GET("/guardians", middleware.RequirePermission(auth.PermAccountsRead), handler.GetGuardians)
+			account.POST("/guardians", middleware.RequirePermission(auth.PermConsentWrite), handler.LinkGuardian)
+		}
+
+		authed.GET("/schools", middleware.RequirePermission(auth.PermSchoolsRead), handler.ListSchools)
+		authed.POST("/schools", middleware.RequirePermission(auth.PermSchoolsWrite), handler.CreateSchool)
+
+		school := authed.Group("/schools/:id")
+		school.Use(middleware.RequireSchoolAccess(s.db))
+		{
+			school.GET("", middleware.RequirePermission(auth.PermSchoolsRead), handler.GetSchool)
+			school.PUT("", middleware.RequirePermission(auth.PermSchoolsWrite), handler.RenameSchool)
+			school.DELETE("", middleware.RequirePermission(auth.PermSchoolsWrite), handler.DeleteSchool)
+			school.POST("/merge", middleware.RequirePermission(auth.PermSchoolsWrite), handler.MergeSchools)
+			school.GET("/classrooms", middleware.RequirePermission(auth.PermSchoolsRead), handler.ListClassrooms)
+			school.POST("/classrooms", middleware.RequirePermission(auth.PermClassroomsWrite), handler.CreateClassroom)
+		}
+
+		classroom := authed.Group("/classrooms/:id")
+		classroom.Use(middleware.RequireClassroomAccess(s.db))
+		{
+			classroom.GET("", middleware.RequirePermission(auth.PermSchoolsRead), handler.GetClassroom)
+			classroom.PUT("", middleware.RequirePermission(auth.PermClassroomsWrite), handler.UpdateClassroom)
+			classroom.DELETE("", middleware.RequirePermission(auth.PermClassroomsWrite), handler.DeleteClassroom)
+			classroom.GET("/enrollments", middleware.RequirePermission(auth.PermSchoolsRead), handler.GetEnrollments)
+			classroom.POST("/enrollments", middleware.RequirePermission(auth.PermClassroomsWrite), handler.Enroll)
+			classroom.DELETE("/enrollments/:account_id", middleware.RequirePermission(auth.PermClassroomsWrite), handler.Unenroll)
+		}
+
+		// Teachers manage the classrooms they teach and the students on their rosters
+		teacher := authed.Group("/teacher")
+		teacher.Use(middleware.RequirePermission(auth.PermRosters))
+		{
+			teacher.GET("/classrooms", handler.GetTeacherClassrooms)
+			teacher.POST("/classrooms", handler.CreateTeacherClassroom)
+			teacher.GET("/classrooms/:id/roster", handler.GetRoster)
+			teacher.POST("/classrooms/:id/roster", handler.AddToRoster)
+			teacher.DELETE("/classrooms/:id/roster/:account_id", handler.RemoveFromRoster)
+
+			student := teacher.Group("/students/:id")
+			student.Use(middleware.RequireAccountAccess(s.db))
+			{
+				student.POST("/reset-password", handler.ResetStudentPassword)
+				student.POST("/deactivate", handler.DeactivateStudent)
+				student.POST("/activate", handler.ActivateStudent)
+			}
+		}
+
+		// Guardians approve their children's accounts and follow their progress
+		guardian := authed.Group("/guardian")
+		guardian.Use(middleware.RequirePermission(auth.PermChildrenRead))
+		{
+			guardian.GET("/children", handler.GetChildren)
+			guardian.POST("/children/:id/consent", handler.GiveConsent)
+			guardian.GET("/children/:id/progress", handler.GetChildProgress)
+		}
+
+		// Superadmins review login attempts and lift lockouts
+		security := authed.Group("/admin")
+		security.Use(middleware.RequirePermission(auth.PermSecurity))
+		{
+			security.GET("/lockouts", handler.GetLoginLocks)
+			security.DELETE("/lockouts/:kind/:key", handler.ClearLoginLock)
+			security.GET("/auth-log", handler.GetAuthLog)
+		}
+
+		authed.GET("/achievements", handler.GetBadges)
+		authed.GET("/leaderboards", middleware.RequirePermission(auth.PermLeaderboards), handler.GetLeaderboard)
+		authed.GET("/stats", middleware.RequirePermission(auth.PermStatsRead), handler.GetStats)
 
 		// Export/Import routes (with stricter rate limiting)
-		exportGroup := api.Group("/export")
+		exportGroup := authed.Group("/export")
 		exportGroup.Use(s.rateLimiter.RateLimit(10, 2)) // More restrictive for export/import
 		{
-			exportGroup.GET("/csv", handler.ExportCSV)
-			exportGroup.GET("/json", handler.ExportJSON)
-			exportGroup.POST("/csv", handler.ImportCSV)
+			exportGroup.GET("/csv", middleware.RequirePermission(auth.PermExport), handler.ExportCSV)
+			exportGroup.GET("/json", middleware.RequirePermission(auth.PermExport), handler.ExportJSON)
+			exportGroup.POST("/csv", middleware.RequirePermission(auth.PermImport), handler.ImportCSV)
+			exportGroup.POST("/json", middleware.RequirePermission(auth.PermImport), handler.ImportJSON)
+			exportGroup.GET("/mappings", middleware.RequirePermission(auth.PermImport), handler.ListImportMappings)
+			exportGroup.GET("/mappings/:name", middleware.RequirePermission(auth.PermImport), handler.GetImportMapping)
+			exportGroup.PUT("/mappings/:name", middleware.RequirePermission(auth.PermImport), handler.SaveImportMapping)
+			exportGroup.DELETE("/mappings/:name", middleware.RequirePermission(auth.PermImport), handler.DeleteImportMapping)
+			exportGroup.GET("/oneroster", middleware.RequirePermission(auth.PermExport), handler.ExportOneRoster)
+			// A sync can create and rename schools, so it also needs their permission
+			exportGroup.POST("/oneroster", middleware.RequirePermission(auth.PermImport),
+				middleware.RequirePermission(auth.PermSchoolsWrite), handler.SyncOneRoster)
 		}
 	}
 
@@ -121,9 +362,38 @@ func (s *Server) Start() error {
 	log.Printf("Starting server on port %s", s.port)
 	log.Printf("Access the web interface at: http://localhost:%s", s.port)
 	log.Printf("Admin dashboard at: http://localhost:%s/admin", s.port)
+	if s.retention > 0 {
+		s.stopPurge = make(chan struct{})
+		go s.purgeDeletedAccounts(s.stopPurge)
+	}
 	return s.router.Run(fmt.Sprintf(":%s", s.port))
 }
 
 func (s *Server) Stop() error {
+	if s.stopPurge != nil {
+		close(s.stopPurge)
+	}
 	return s.db.Close()
 }
+
+// purgeDeletedAccounts permanently removes accounts deleted longer ago than
+// the retention period, at startup and then every purgeInterval
+func (s *Server) purgeDeletedAccounts(stop <-chan struct{}) {
+	ticker := time.NewTicker(purgeInterval)
+	defer ticker.Stop()
+
+	for {
+		n, err := s.db.PurgeDeletedAccounts(time.Now().Add(-s.retention))
+		if err != nil {
+			log.Printf("Failed to purge deleted accounts: %v", err)
+		} else if n > 0 {
+			log.Printf("Purged %d deleted accounts", n)
+		}
+
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
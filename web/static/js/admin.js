@@ -4,13 +4,98 @@ class AdminPanel {
     this.apiBase = '/api';
     this.accounts = [];
     this.stats = null;
+    this.classrooms = [];
+    this.roster = [];
     this.init();
   }
 
   async init() {
+    if (!(await this.checkAccess())) {
+      return;
+    }
     this.setupEventListeners();
+    if (await this.checkTwoFactor()) {
+      return;
+    }
     await this.loadData();
     this.renderAll();
+    if (this.currentUser.role === 'teacher') {
+      await this.loadTeacherView();
+    }
+  }
+
+  // Only staff roles may use the dashboard; everyone else goes back to the portal
+  async checkAccess() {
+    try {
+      this.currentUser = await this.apiCall('/me');
+    } catch (error) {
+      return false;
+    }
+
+    // Temporary passwords are changed in the portal first
+    if (!['teacher', 'school_admin', 'superadmin'].includes(this.currentUser.role) || this.currentUser.must_reset_password) {
+      window.location.href = '/';
+      return false;
+    }
+    return true;
+  }
+
+  // Shows the two-factor card to accounts without a second factor. Returns
+  // true, hiding the rest of the dashboard, when their role requires one.
+  async checkTwoFactor() {
+    const status = await this.apiCall('/2fa');
+    if (status.enabled) {
+      return false;
+    }
+
+    document.getElementById('twoFactorView').style.display = 'block';
+    if (!status.required) {
+      return false;
+    }
+
+    document.getElementById('twoFactorIntro').textContent =
+      'Your role requires two-factor authentication. Set it up to use the dashboard.';
+    document.querySelectorAll('.main .container > .card, .stats-grid').forEach(element => {
+      if (element.id !== 'twoFactorView') {
+        element.style.display = 'none';
+      }
+    });
+    return true;
+  }
+
+  async startTwoFactorSetup() {
+    try {
+      const setup = await this.apiCall('/2fa/setup', 'POST');
+      document.getElementById('twoFactorSecret').textContent = setup.secret;
+
+      // The QR code needs the bearer token, so it cannot be a plain image URL
+      const tokens = JSON.parse(localStorage.getItem('eduGameDB_tokens') || 'null');
+      const response = await fetch(setup.qr_code_url, {
+        headers: { 'Authorization': `Bearer ${tokens.access_token}` }
+      });
+      if (response.ok) {
+        document.getElementById('twoFactorQRCode').src = URL.createObjectURL(await response.blob());
+      }
+
+      document.getElementById('twoFactorSetup').style.display = 'block';
+      document.getElementById('twoFactorStartBtn').style.display = 'none';
+    } catch (error) {
+      this.showMessage('Failed to start two-factor setup: ' + error.message, 'error');
+    }
+  }
+
+  async handleTwoFactorConfirm(e) {
+    e.preventDefault();
+    const code = document.getElementById('twoFactorCode').value.trim();
+
+    try {
+      const result = await this.apiCall('/2fa/confirm', 'POST', { code });
+      document.getElementById('twoFactorSetup').style.display = 'none';
+      document.getElementById('twoFactorRecoveryCodes').textContent = result.recovery_codes.join('\n');
+      document.getElementById('twoFactorRecovery').style.display = 'block';
+    } catch (error) {
+      this.showMessage(error.message, 'error');
+    }
   }
 
   setupEventListeners() {
@@ -50,6 +135,38 @@ class AdminPanel {
     if (exportBtn) {
       exportBtn.addEventListener('click', () => this.exportData());
     }
+
+    // Two-factor setup
+    const twoFactorStartBtn = document.getElementById('twoFactorStartBtn');
+    if (twoFactorStartBtn) {
+      twoFactorStartBtn.addEventListener('click', () => this.startTwoFactorSetup());
+    }
+
+    const twoFactorConfirmForm = document.getElementById('twoFactorConfirmForm');
+    if (twoFactorConfirmForm) {
+      twoFactorConfirmForm.addEventListener('submit', (e) => this.handleTwoFactorConfirm(e));
+    }
+
+    const twoFactorDoneBtn = document.getElementById('twoFactorDoneBtn');
+    if (twoFactorDoneBtn) {
+      twoFactorDoneBtn.addEventListener('click', () => window.location.reload());
+    }
+
+    // Teacher view
+    const classroomSelect = document.getElementById('teacherClassroomSelect');
+    if (classroomSelect) {
+      classroomSelect.addEventListener('change', () => this.loadRoster());
+    }
+
+    const newClassroomBtn = document.getElementById('newClassroomBtn');
+    if (newClassroomBtn) {
+      newClassroomBtn.addEventListener('click', () => this.createTeacherClassroom());
+    }
+
+    const addStudentsForm = document.getElementById('addStudentsForm');
+    if (addStudentsForm) {
+      addStudentsForm.addEventListener('submit', (e) => this.handleAddStudents(e));
+    }
   }
 
   // API Methods
@@ -61,12 +178,22 @@ class AdminPanel {
       },
     };
 
+    // The admin dashboard reuses the session stored by the student portal login
+    const tokens = JSON.parse(localStorage.getItem('eduGameDB_tokens') || 'null');
+    if (tokens && tokens.access_token) {
+      config.headers['Authorization'] = `Bearer ${tokens.access_token}`;
+    }
+
     if (data) {
       config.body = JSON.stringify(data);
     }
 
     try {
       const response = await fetch(`${this.apiBase}${endpoint}`, config);
+      if (response.status === 401) {
+        window.location.href = '/';
+        throw new Error('Please log in first');
+      }
       const result = await response.json();
 
       if (!response.ok) {
@@ -84,11 +211,11 @@ class AdminPanel {
     try {
       this.showLoading(true);
       const [accounts, stats] = await Promise.all([
-        this.apiCall('/accounts'),
+        this.loadAllAccounts(),
         this.apiCall('/stats')
       ]);
       
-      this.accounts = accounts || [];
+      this.accounts = accounts;
       this.stats = stats;
     } catch (error) {
       this.showMessage('Failed to load data: ' + error.message, 'error');
@@ -97,6 +224,20 @@ class AdminPanel {
     }
   }
 
+  // The accounts listing is paginated; follow next_cursor until every page is loaded
+  async loadAllAccounts(deleted = false) {
+    const accounts = [];
+    let cursor = '';
+    do {
+      const query = '/accounts?limit=200' + (deleted ? '&deleted=true' : '') +
+        (cursor ? '&cursor=' + encodeURIComponent(cursor) : '');
+      const page = await this.apiCall(query);
+      accounts.push(...(page.accounts || []));
+      cursor = page.next_cursor || '';
+    } while (cursor);
+    return accounts;
+  }
+
   async refreshData() {
     await this.loadData();
     this.renderAll();
@@ -141,9 +282,17 @@ class AdminPanel {
   createAccountRow(account) {
     const row = document.createElement('tr');
     
-    const statusBadge = account.is_active 
+    let statusBadge = account.is_active 
       ? '<span class="badge badge-success">Active</span>'
       : '<span class="badge badge-danger">Inactive</span>';
+    let actions = `
+        <button class="btn btn-sm btn-primary" onclick="adminPanel.editAccount(${account.id})">Edit</button>
+        <button class="btn btn-sm btn-danger" onclick="adminPanel.deleteAccount(${account.id})">Delete</button>`;
+    if (account.deleted_at) {
+      statusBadge = '<span class="badge badge-danger">Deleted</span>';
+      actions = `
+        <button class="btn btn-sm btn-primary" onclick="adminPanel.restoreAccount(${account.id})">Restore</button>`;
+    }
 
     const createdDate = new Date(account.created_at).toLocaleDateString();
     
@@ -158,9 +307,7 @@ class AdminPanel {
       <td>${account.experience}</td>
       <td>${statusBadge}</td>
       <td>${createdDate}</td>
-      <td>
-        <button class="btn btn-sm btn-primary" onclick="adminPanel.editAccount(${account.id})">Edit</button>
-        <button class="btn btn-sm btn-danger" onclick="adminPanel.deleteAccount(${account.id})">Delete</button>
+      <td>${actions}
       </td>
     `;
     
@@ -210,12 +357,14 @@ class AdminPanel {
     if (!form) return;
 
     form.querySelector('[name="accountId"]').value = account.id;
+    form.querySelector('[name="version"]').value = account.version;
     form.querySelector('[name="firstName"]').value = account.first_name;
     form.querySelector('[name="lastName"]').value = account.last_name;
     form.querySelector('[name="grade"]').value = account.grade;
     form.querySelector('[name="school"]').value = account.school;
-    form.querySelector('[name="gameLevel"]').value = account.game_level;
-    form.querySelector('[name="experience"]').value = account.experience;
+    form.querySelector('[name="progress"]').value = `Level ${account.game_level} / ${account.experience} XP`;
+    form.querySelector('[name="xpAdjustment"]').value = 0;
+    form.querySelector('[name="xpReason"]').value = '';
     form.querySelector('[name="isActive"]').checked = account.is_active;
   }
 
@@ -228,14 +377,23 @@ class AdminPanel {
       last_name: formData.get('lastName'),
       grade: parseInt(formData.get('grade')) || 0,
       school: formData.get('school'),
-      game_level: parseInt(formData.get('gameLevel')) || 1,
-      experience: parseInt(formData.get('experience')) || 0,
-      is_active: formData.get('isActive') === 'on'
+      is_active: formData.get('isActive') === 'on',
+      version: parseInt(formData.get('version')) || undefined
     };
+    const xpAdjustment = parseInt(formData.get('xpAdjustment')) || 0;
 
     try {
       this.showLoading(true);
       await this.apiCall(`/accounts/${accountId}`, 'PUT', updateData);
+
+      // Experience is only changed through the ledger
+      if (xpAdjustment !== 0) {
+        await this.apiCall(`/accounts/${accountId}/xp`, 'POST', {
+          amount: xpAdjustment,
+          source: 'adjustment',
+          reason: formData.get('xpReason') || 'Adjusted by staff'
+        });
+      }
       
       this.showMessage('Account updated successfully!', 'success');
       this.closeModal();
@@ -252,7 +410,7 @@ class AdminPanel {
     const account = this.accounts.find(acc => acc.id === id);
     if (!account) return;
 
-    const confirmed = confirm(`Are you sure you want to delete account for ${account.username}?`);
+    const confirmed = confirm(`Are you sure you want to delete account for ${account.username}? It can be restored until it is purged.`);
     if (!confirmed) return;
 
     try {
@@ -269,6 +427,22 @@ class AdminPanel {
     }
   }
 
+  async restoreAccount(id) {
+    try {
+      this.showLoading(true);
+      const account = await this.apiCall(`/accounts/${id}/restore`, 'POST');
+
+      this.showMessage(`Account for ${account.username} restored successfully!`, 'success');
+      await this.refreshData();
+      this.handleFilter('deleted');
+
+    } catch (error) {
+      this.showMessage('Failed to restore account: ' + error.message, 'error');
+    } finally {
+      this.showLoading(false);
+    }
+  }
+
   handleSearch(query) {
     const filteredAccounts = this.accounts.filter(account => {
       const searchableText = [
@@ -285,10 +459,19 @@ class AdminPanel {
     this.renderFilteredAccounts(filteredAccounts);
   }
 
-  handleFilter(filter) {
+  async handleFilter(filter) {
     let filteredAccounts = [...this.accounts];
 
     switch (filter) {
+      case 'deleted':
+        // Deleted accounts are not part of the regular listing
+        try {
+          filteredAccounts = await this.loadAllAccounts(true);
+        } catch (error) {
+          this.showMessage('Failed to load deleted accounts: ' + error.message, 'error');
+          return;
+        }
+        break;
       case 'active':
         filteredAccounts = this.accounts.filter(acc => acc.is_active);
         break;
@@ -367,6 +550,170 @@ class AdminPanel {
   }
 
   // Modal Management
+  // Teacher view: the classrooms the signed-in teacher runs and their rosters
+  async loadTeacherView() {
+    const view = document.getElementById('teacherView');
+    if (!view) return;
+    view.style.display = 'block';
+
+    try {
+      const result = await this.apiCall('/teacher/classrooms');
+      this.classrooms = result.classrooms || [];
+    } catch (error) {
+      this.showMessage('Failed to load classes: ' + error.message, 'error');
+      return;
+    }
+
+    const select = document.getElementById('teacherClassroomSelect');
+    select.innerHTML = '';
+    this.classrooms.forEach(classroom => {
+      const option = document.createElement('option');
+      option.value = classroom.id;
+      option.textContent = classroom.grade ? `${classroom.name} (grade ${classroom.grade})` : classroom.name;
+      select.appendChild(option);
+    });
+
+    await this.loadRoster();
+  }
+
+  selectedClassroomId() {
+    const select = document.getElementById('teacherClassroomSelect');
+    return select && select.value ? parseInt(select.value) : null;
+  }
+
+  async loadRoster() {
+    const classroomId = this.selectedClassroomId();
+    if (!classroomId) {
+      this.roster = [];
+      this.renderRoster();
+      return;
+    }
+
+    try {
+      const result = await this.apiCall(`/teacher/classrooms/${classroomId}/roster`);
+      this.roster = result.students || [];
+    } catch (error) {
+      this.showMessage('Failed to load roster: ' + error.message, 'error');
+      this.roster = [];
+    }
+    this.renderRoster();
+  }
+
+  renderRoster() {
+    const tbody = document.getElementById('rosterTableBody');
+    if (!tbody) return;
+
+    tbody.innerHTML = '';
+
+    if (this.roster.length === 0) {
+      const message = this.classrooms.length === 0 ? 'You do not have any classes yet' : 'No students in this class';
+      tbody.innerHTML = `<tr><td colspan="6" class="text-center">${message}</td></tr>`;
+      return;
+    }
+
+    this.roster.forEach(student => {
+      const row = document.createElement('tr');
+      const statusBadge = student.is_active
+        ? '<span class="badge badge-success">Active</span>'
+        : '<span class="badge badge-danger">Inactive</span>';
+      const toggle = student.is_active
+        ? `<button class="btn btn-sm btn-secondary" onclick="adminPanel.setStudentActive(${student.id}, false)">Deactivate</button>`
+        : `<button class="btn btn-sm btn-secondary" onclick="adminPanel.setStudentActive(${student.id}, true)">Activate</button>`;
+
+      row.innerHTML = `
+        <td>${student.username}</td>
+        <td>${student.first_name} ${student.last_name}</td>
+        <td>${student.grade || 'N/A'}</td>
+        <td>${student.game_level}</td>
+        <td>${statusBadge}</td>
+        <td>
+          <button class="btn btn-sm btn-primary" onclick="adminPanel.resetStudentPassword(${student.id})">Reset Password</button>
+          ${toggle}
+          <button class="btn btn-sm btn-danger" onclick="adminPanel.removeFromRoster(${student.id})">Remove</button>
+        </td>
+      `;
+      tbody.appendChild(row);
+    });
+  }
+
+  async createTeacherClassroom() {
+    const name = prompt('Name of the new class:');
+    if (!name) return;
+
+    try {
+      const classroom = await this.apiCall('/teacher/classrooms', 'POST', { name, grade: this.currentUser.grade || 0 });
+      this.showMessage(`Class ${classroom.name} created`, 'success');
+      await this.loadTeacherView();
+      document.getElementById('teacherClassroomSelect').value = classroom.id;
+      await this.loadRoster();
+    } catch (error) {
+      this.showMessage('Failed to create class: ' + error.message, 'error');
+    }
+  }
+
+  async handleAddStudents(e) {
+    e.preventDefault();
+
+    const classroomId = this.selectedClassroomId();
+    if (!classroomId) {
+      this.showMessage('Create a class first', 'error');
+      return;
+    }
+
+    const input = document.getElementById('addStudentsInput');
+    const usernames = input.value.split(/[\s,]+/).filter(name => name);
+    if (usernames.length === 0) return;
+
+    try {
+      const result = await this.apiCall(`/teacher/classrooms/${classroomId}/roster`, 'POST', { usernames });
+      const notes = [`Added ${result.added.length} student(s)`];
+      if (result.already_enrolled.length) notes.push(`already enrolled: ${result.already_enrolled.join(', ')}`);
+      if (result.not_found.length) notes.push(`not found: ${result.not_found.join(', ')}`);
+      if (result.not_eligible.length) notes.push(`not students of your school: ${result.not_eligible.join(', ')}`);
+      this.showMessage(notes.join('; '), result.not_found.length || result.not_eligible.length ? 'info' : 'success');
+      input.value = '';
+      await this.loadRoster();
+    } catch (error) {
+      this.showMessage('Failed to add students: ' + error.message, 'error');
+    }
+  }
+
+  async resetStudentPassword(id) {
+    const student = this.roster.find(s => s.id === id);
+    if (!student || !confirm(`Reset the password for ${student.username}?`)) return;
+
+    try {
+      const result = await this.apiCall(`/teacher/students/${id}/reset-password`, 'POST');
+      alert(`New password for ${result.username}: ${result.password}\n\nIt will not be shown again.`);
+    } catch (error) {
+      this.showMessage('Failed to reset password: ' + error.message, 'error');
+    }
+  }
+
+  async setStudentActive(id, active) {
+    try {
+      await this.apiCall(`/teacher/students/${id}/${active ? 'activate' : 'deactivate'}`, 'POST');
+      this.showMessage(active ? 'Student activated' : 'Student deactivated', 'success');
+      await this.loadRoster();
+    } catch (error) {
+      this.showMessage('Failed to update student: ' + error.message, 'error');
+    }
+  }
+
+  async removeFromRoster(id) {
+    const classroomId = this.selectedClassroomId();
+    const student = this.roster.find(s => s.id === id);
+    if (!classroomId || !student || !confirm(`Remove ${student.username} from this class?`)) return;
+
+    try {
+      await this.apiCall(`/teacher/classrooms/${classroomId}/roster/${id}`, 'DELETE');
+      this.showMessage('Student removed from class', 'success');
+      await this.loadRoster();
+    } catch (error) {
+      this.showMessage('Failed to remove student: ' + error.message, 'error');
+    }
+  }
+
   showModal(modalId) {
     const modal = document.getElementById(modalId);
     if (modal) {
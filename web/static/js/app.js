@@ -3,12 +3,14 @@ class EduGameDB {
   constructor() {
     this.apiBase = '/api';
     this.currentUser = null;
+    this.tokens = null;
     this.init();
   }
 
   async init() {
     this.registerServiceWorker();
     this.setupEventListeners();
+    this.setupSingleSignOn();
     this.loadUserSession();
   }
 
@@ -32,6 +34,12 @@ class EduGameDB {
       loginForm.addEventListener('submit', (e) => this.handleLogin(e));
     }
 
+    // Password change and reset form
+    const passwordForm = document.getElementById('passwordForm');
+    if (passwordForm) {
+      passwordForm.addEventListener('submit', (e) => this.handlePasswordForm(e));
+    }
+
     // Register form
     const registerForm = document.getElementById('registerForm');
     if (registerForm) {
@@ -86,7 +94,7 @@ class EduGameDB {
   }
 
   // API Methods
-  async apiCall(endpoint, method = 'GET', data = null) {
+  async apiCall(endpoint, method = 'GET', data = null, retry = true) {
     const config = {
       method,
       headers: {
@@ -94,16 +102,31 @@ class EduGameDB {
       },
     };
 
+    if (this.tokens && this.tokens.access_token) {
+      config.headers['Authorization'] = `Bearer ${this.tokens.access_token}`;
+    }
+
     if (data) {
       config.body = JSON.stringify(data);
     }
 
     try {
       const response = await fetch(`${this.apiBase}${endpoint}`, config);
+
+      // Access tokens are short-lived; try one silent refresh before giving up
+      if (response.status === 401 && retry && this.tokens && this.tokens.refresh_token) {
+        if (await this.refreshTokens()) {
+          return this.apiCall(endpoint, method, data, false);
+        }
+        this.expireSession();
+      }
+
       const result = await response.json();
 
       if (!response.ok) {
-        throw new Error(result.error || 'An error occurred');
+        const error = new Error(result.error || 'An error occurred');
+        error.data = result;
+        throw error;
       }
 
       return result;
@@ -113,6 +136,42 @@ class EduGameDB {
     }
   }
 
+  async refreshTokens() {
+    try {
+      const response = await fetch(`${this.apiBase}/token/refresh`, {
+        method: 'POST',
+        headers: { 'Content-Type': 'application/json' },
+        body: JSON.stringify({ refresh_token: this.tokens.refresh_token })
+      });
+      if (!response.ok) {
+        return false;
+      }
+
+      const result = await response.json();
+      this.setTokens(result);
+      this.currentUser = result.account;
+      this.saveUserSession();
+      return true;
+    } catch (error) {
+      console.error('Token refresh failed:', error);
+      return false;
+    }
+  }
+
+  setTokens(result) {
+    this.tokens = {
+      access_token: result.access_token,
+      refresh_token: result.refresh_token
+    };
+  }
+
+  expireSession() {
+    this.currentUser = null;
+    this.tokens = null;
+    this.clearUserSession();
+    this.showLogin();
+  }
+
   // Authentication
   async handleLogin(e) {
     e.preventDefault();
@@ -121,13 +180,24 @@ class EduGameDB {
       username: formData.get('username'),
       password: formData.get('password')
     };
+    if (formData.get('code')) {
+      credentials.code = formData.get('code').trim();
+    }
 
     try {
       this.showLoading(true);
       const result = await this.apiCall('/login', 'POST', credentials);
       
       this.currentUser = result.account;
+      this.setTokens(result);
       this.saveUserSession();
+
+      if (this.currentUser.must_reset_password) {
+        this.showMessage('Please choose a new password to continue.', 'info');
+        this.showPasswordForm(false);
+        return;
+      }
+
       this.showMessage('Login successful!', 'success');
       
       // Redirect to dashboard
@@ -136,6 +206,11 @@ class EduGameDB {
       }, 1000);
 
     } catch (error) {
+      // Accounts with two-factor authentication log in again with a code
+      if (error.data && error.data.two_factor_required) {
+        document.getElementById('loginCodeGroup').style.display = 'block';
+        document.getElementById('loginCode').focus();
+      }
       this.showMessage(error.message, 'error');
     } finally {
       this.showLoading(false);
@@ -152,7 +227,8 @@ class EduGameDB {
       first_name: formData.get('firstName'),
       last_name: formData.get('lastName'),
       grade: parseInt(formData.get('grade')) || 0,
-      school: formData.get('school')
+      school: formData.get('school'),
+      guardian_email: formData.get('guardianEmail') || ''
     };
 
     // Validate password confirmation
@@ -165,7 +241,12 @@ class EduGameDB {
     try {
       this.showLoading(true);
       const result = await this.apiCall('/accounts', 'POST', accountData);
-      
+
+      if (result.consent_status === 'pending') {
+        this.showMessage('Account created! A parent or guardian needs to approve it before you can log in.', 'success');
+        return;
+      }
+
       this.showMessage('Account created successfully! Please log in.', 'success');
       
       // Switch to login form
@@ -180,8 +261,17 @@ class EduGameDB {
     }
   }
 
-  handleLogout() {
+  async handleLogout() {
+    if (this.tokens && this.tokens.refresh_token) {
+      try {
+        await this.apiCall('/logout', 'POST', { refresh_token: this.tokens.refresh_token }, false);
+      } catch (error) {
+        console.error('Failed to revoke session:', error);
+      }
+    }
+
     this.currentUser = null;
+    this.tokens = null;
     this.clearUserSession();
     this.showLogin();
     this.showMessage('Logged out successfully', 'success');
@@ -195,9 +285,9 @@ class EduGameDB {
       last_name: formData.get('lastName'),
       grade: parseInt(formData.get('grade')) || 0,
       school: formData.get('school'),
-      game_level: this.currentUser.game_level,
-      experience: this.currentUser.experience,
-      is_active: this.currentUser.is_active
+      is_active: this.currentUser.is_active,
+      // Refused if the profile was changed elsewhere, e.g. by a teacher
+      version: this.currentUser.version
     };
 
     try {
@@ -210,6 +300,12 @@ class EduGameDB {
       this.updateProfileDisplay();
 
     } catch (error) {
+      if (error.data && error.data.account) {
+        // Show the profile as it is now so the changes can be made again
+        this.currentUser = error.data.account;
+        this.saveUserSession();
+        this.updateProfileDisplay();
+      }
       this.showMessage(error.message, 'error');
     } finally {
       this.showLoading(false);
@@ -221,20 +317,48 @@ class EduGameDB {
     if (this.currentUser) {
       localStorage.setItem('eduGameDB_user', JSON.stringify(this.currentUser));
     }
+    if (this.tokens) {
+      localStorage.setItem('eduGameDB_tokens', JSON.stringify(this.tokens));
+    }
   }
 
+  // A password reset link opens the portal with ?reset_token=...
   loadUserSession() {
+    const params = new URLSearchParams(window.location.search);
+    this.resetToken = params.get('reset_token');
+    if (this.resetToken) {
+      window.history.replaceState({}, '', window.location.pathname);
+      this.showPasswordForm(true);
+      return;
+    }
+
+    // Single sign-on comes back with a refresh token or an error in the fragment
+    const fragment = new URLSearchParams(window.location.hash.slice(1));
+    if (fragment.has('sso') || fragment.has('sso_error')) {
+      window.history.replaceState({}, '', window.location.pathname);
+      this.finishSingleSignOn(fragment.get('sso'), fragment.get('sso_error'));
+      return;
+    }
+
     const saved = localStorage.getItem('eduGameDB_user');
-    if (saved) {
+    const tokens = localStorage.getItem('eduGameDB_tokens');
+    if (saved && tokens) {
       this.currentUser = JSON.parse(saved);
+      this.tokens = JSON.parse(tokens);
+      if (this.currentUser.must_reset_password) {
+        this.showPasswordForm(false);
+        return;
+      }
       this.showDashboard();
     } else {
+      this.clearUserSession();
       this.showLogin();
     }
   }
 
   clearUserSession() {
     localStorage.removeItem('eduGameDB_user');
+    localStorage.removeItem('eduGameDB_tokens');
   }
 
   // UI Management
@@ -246,6 +370,45 @@ class EduGameDB {
     }
   }
 
+  async finishSingleSignOn(refreshToken, error) {
+    if (error) {
+      this.showLogin();
+      this.showMessage(error.charAt(0).toUpperCase() + error.slice(1), 'error');
+      return;
+    }
+
+    this.tokens = { refresh_token: refreshToken };
+    if (!(await this.refreshTokens())) {
+      this.expireSession();
+      this.showMessage('Single sign-on failed; please try again.', 'error');
+      return;
+    }
+    this.showDashboard();
+  }
+
+  async setupSingleSignOn() {
+    try {
+      const result = await this.apiCall('/sso');
+      document.getElementById('ssoLogin').style.display = result.enabled ? 'block' : 'none';
+    } catch (error) {
+      console.error('Failed to check single sign-on:', error);
+    }
+  }
+
+  async suggestPassphrase() {
+    try {
+      const result = await this.apiCall('/password/passphrase');
+      ['regPassword', 'regPasswordConfirm'].forEach((id) => {
+        const input = document.getElementById(id);
+        input.type = 'text';
+        input.value = result.passphrase;
+      });
+      this.showMessage('Write your passphrase down somewhere safe.', 'info');
+    } catch (error) {
+      this.showMessage(error.message, 'error');
+    }
+  }
+
   showRegister() {
     this.hideAllSections();
     const registerSection = document.getElementById('registerSection');
@@ -254,6 +417,67 @@ class EduGameDB {
     }
   }
 
+  // With a reset token the current password is not needed
+  showPasswordForm(reset) {
+    this.hideAllSections();
+    const oldPasswordGroup = document.getElementById('oldPasswordGroup');
+    if (oldPasswordGroup) {
+      oldPasswordGroup.style.display = reset ? 'none' : 'block';
+    }
+    const passwordSection = document.getElementById('passwordSection');
+    if (passwordSection) {
+      passwordSection.style.display = 'block';
+    }
+  }
+
+  async handlePasswordForm(e) {
+    e.preventDefault();
+    const formData = new FormData(e.target);
+    const newPassword = formData.get('newPassword');
+
+    if (newPassword !== formData.get('newPasswordConfirm')) {
+      this.showMessage('Passwords do not match', 'error');
+      return;
+    }
+
+    try {
+      this.showLoading(true);
+      if (this.resetToken) {
+        await this.apiCall('/password/reset', 'POST', { token: this.resetToken, new_password: newPassword });
+        this.resetToken = null;
+        this.showMessage('Password reset! Please log in.', 'success');
+        this.showLogin();
+      } else {
+        const result = await this.apiCall('/password/change', 'POST', {
+          old_password: formData.get('oldPassword'),
+          new_password: newPassword
+        });
+        this.currentUser = result.account;
+        this.setTokens(result);
+        this.saveUserSession();
+        this.showMessage('Password changed!', 'success');
+        this.showDashboard();
+      }
+      e.target.reset();
+    } catch (error) {
+      this.showMessage(error.message, 'error');
+    } finally {
+      this.showLoading(false);
+    }
+  }
+
+  async forgotPassword() {
+    const login = prompt('Enter your username or email address:');
+    if (!login) return;
+
+    try {
+      const result = await this.apiCall('/password/forgot', 'POST', { login });
+      this.showMessage(result.message, 'info');
+    } catch (error) {
+      this.showMessage(error.message, 'error');
+    }
+  }
+
   showDashboard() {
     this.hideAllSections();
     const dashboardSection = document.getElementById('dashboardSection');
@@ -264,7 +488,7 @@ class EduGameDB {
   }
 
   hideAllSections() {
-    const sections = ['loginSection', 'registerSection', 'dashboardSection'];
+    const sections = ['loginSection', 'registerSection', 'passwordSection', 'dashboardSection'];
     sections.forEach(id => {
       const section = document.getElementById(id);
       if (section) {
@@ -346,32 +570,6 @@ class EduGameDB {
     }
   }
 
-  // Game Progress Methods
-  async updateGameProgress(level, experience) {
-    if (!this.currentUser) return;
-
-    const updateData = {
-      first_name: this.currentUser.first_name,
-      last_name: this.currentUser.last_name,
-      grade: this.currentUser.grade,
-      school: this.currentUser.school,
-      game_level: level,
-      experience: experience,
-      is_active: this.currentUser.is_active
-    };
-
-    try {
-      const result = await this.apiCall(`/accounts/${this.currentUser.id}`, 'PUT', updateData);
-      this.currentUser = result;
-      this.saveUserSession();
-      this.updateDashboard();
-      return true;
-    } catch (error) {
-      console.error('Failed to update game progress:', error);
-      return false;
-    }
-  }
-
   // Offline Support
   handleOffline() {
     this.showMessage('You are currently offline. Some features may be limited.', 'warning');
@@ -395,6 +593,14 @@ function showDashboard() {
   window.eduGameDB.showDashboard();
 }
 
+function suggestPassphrase() {
+  window.eduGameDB.suggestPassphrase();
+}
+
+function forgotPassword() {
+  window.eduGameDB.forgotPassword();
+}
+
 // Network status monitoring
 window.addEventListener('online', () => {
   if (window.eduGameDB) {